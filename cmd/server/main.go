@@ -1,11 +1,13 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
@@ -19,8 +21,12 @@ import (
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/lib/tokens"
 	"github.com/ICan-TC/users/cmd"
+	"github.com/ICan-TC/users/internal/checkout"
 	"github.com/ICan-TC/users/internal/config"
+	"github.com/ICan-TC/users/internal/document"
 	"github.com/ICan-TC/users/internal/handlers"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/notify"
 	"github.com/ICan-TC/users/internal/service"
 )
 
@@ -40,6 +46,7 @@ func main() {
 
 	flag.Int("port", 8888, "Port to listen on")
 	flag.String("config", "", "Path to config file")
+	flag.String("store", "postgres", "Where records are kept, postgres or memory")
 	flag.Parse()
 
 	logging.InitLogger("text")
@@ -79,23 +86,13 @@ func main() {
 	}
 
 	cfg := config.Get()
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s",
-		cfg.DB.Username,
-		cfg.DB.Password,
-		cfg.DB.Host,
-		cfg.DB.Port,
-		cfg.DB.Name,
-	)
-	if cfg.DB.SSL {
-		dsn += "?sslmode=require"
-	} else {
-		dsn += "?sslmode=disable"
-	}
-
-	dbconn, err := db.New(dsn)
+	store, err := newStore(cfg)
 	if err != nil {
 		panic(err)
 	}
+	if err := money.SetCenterCurrency(money.Currency{Code: cfg.Billing.Currency, Decimals: cfg.Billing.Decimals}); err != nil {
+		panic(err)
+	}
 
 	l.Info().Msg("Starting API server")
 	zerolog.Ctx(context.Background()).Info().Msg("Test log from zerolog.Ctx(context.Background())")
@@ -107,9 +104,9 @@ func main() {
 			// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 			AllowedOrigins: []string{"https://*", "http://*"},
 			// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-			ExposedHeaders:   []string{"Link"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", "Idempotency-Key"},
+			ExposedHeaders:   []string{"Link", "ETag", "Idempotent-Replayed", "Content-Disposition"},
 			AllowCredentials: false,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		})
@@ -117,63 +114,6 @@ func main() {
 
 		api := humachi.New(router, huma.DefaultConfig("API Server", "1.0.0"))
 
-		// Wire up the handlers
-		usersSvc, err := service.NewUsersService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Users Service")
-		} else {
-			handlers.RegisterUsersRoutes(api, usersSvc)
-		}
-
-		studentsSvc, err := service.NewStudentsService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Students Service")
-		} else {
-			handlers.RegisterStudentsRoutes(api, studentsSvc)
-		}
-
-		teachersSvc, err := service.NewTeachersService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Teachers Service")
-		} else {
-			handlers.RegisterTeachersRoutes(api, teachersSvc)
-		}
-
-		employeesSvc, err := service.NewEmployeesService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Employees Service")
-		} else {
-			handlers.RegisterEmployeesRoutes(api, employeesSvc)
-		}
-
-		parentsSvc, err := service.NewParentsService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Parents Service")
-		} else {
-			handlers.RegisterParentsRoutes(api, parentsSvc)
-		}
-
-		studentParentsSvc, err := service.NewStudentParentsService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping StudentParents Service")
-		} else {
-			handlers.RegisterStudentParentsRoutes(api, studentParentsSvc)
-		}
-
-		groupsSvc, err := service.NewGroupsService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Groups Service")
-		} else {
-			handlers.RegisterGroupsRoutes(api, groupsSvc)
-		}
-
-		enrollmentsSvc, err := service.NewEnrollmentsService(dbconn)
-		if err != nil {
-			l.Err(err).Msg("Skipping Enrollments Service")
-		} else {
-			handlers.RegisterEnrollmentsRoutes(api, enrollmentsSvc)
-		}
-
 		tokenProvider, err := tokens.NewTokenProvider(tokens.TokenProviderArgs{
 			Secret:          cfg.Auth.Secret,
 			AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
@@ -184,14 +124,66 @@ func main() {
 			os.Exit(1)
 		}
 
-		tokensSvc := service.NewTokensService(tokenProvider, dbconn)
-		authSvc, err := service.NewAuthService(usersSvc, tokensSvc)
+		var provider checkout.Provider
+		if cfg.Billing.Provider != "none" {
+			// webhooks are signed with a key of their own, leaking it mustn't
+			// let anyone sign tokens or the other way around
+			switch cfg.Billing.ProviderSecret {
+			case "":
+				l.Error().Msg("No billing provider secret to verify webhooks with, exiting")
+				os.Exit(1)
+			case cfg.Auth.Secret:
+				l.Error().Msg("The billing provider secret is the auth secret, exiting")
+				os.Exit(1)
+			}
+		}
+		if cfg.Billing.Provider == "fake" {
+			provider = checkout.NewFake(cfg.Billing.ProviderSecret, cfg.Billing.PublicURL)
+		}
+
+		reminderDays, err := service.ParseReminderDays(cfg.Billing.ReminderDays)
 		if err != nil {
-			l.Err(err).Msg("Skipping Auth Service")
-		} else {
-			handlers.RegisterAuthRoutes(api, authSvc)
+			l.Err(err).Msg("Invalid billing reminder days, exiting")
+			os.Exit(1)
+		}
+		lateFeeAmount, err := money.Parse(cmp.Or(cfg.Billing.LateFeeAmount, "0"))
+		if err != nil {
+			l.Err(err).Msg("Invalid billing late fee amount, exiting")
+			os.Exit(1)
 		}
 
+		// Wire up the handlers
+		jobs := handlers.RegisterRoutes(api, store, handlers.RouteOptions{
+			Tokens:            tokenProvider,
+			BootstrapHRUserID: cfg.Auth.BootstrapHRUserID,
+			IdempotencyTTL:    time.Duration(cfg.Server.IdempotencyKeyTTL) * time.Second,
+			Center:            cfg.Billing.Center,
+			Proration:         cfg.Billing.Proration,
+			Branding: document.Branding{
+				Name:     cmp.Or(cfg.Billing.Name, cfg.Billing.Center),
+				Address:  cfg.Billing.Address,
+				Phone:    cfg.Billing.Phone,
+				Email:    cfg.Billing.Email,
+				LogoPath: cfg.Billing.Logo,
+				FontPath: cfg.Billing.Font,
+			},
+			PublicURL: cfg.Billing.PublicURL,
+			Secret:    cfg.Auth.Secret,
+			Provider:  provider,
+			DueDays:   cfg.Billing.DueDays,
+			// deployments have no notification channel yet, reminders are
+			// logged for operators to forward
+			Notifier:     notify.NewLog(logging.L().With().Str("channel", "notify").Logger()),
+			ReminderDays: reminderDays,
+			LateFee: service.LateFeePolicy{
+				Kind:    cfg.Billing.LateFee,
+				Amount:  lateFeeAmount,
+				Percent: cfg.Billing.LateFeePercent,
+				After:   cfg.Billing.LateFeeAfter,
+			},
+		})
+		jobs.Run(context.Background())
+
 		huma.Get(api, "/greeting/{name}", func(ctx context.Context, input *struct {
 			Name string `path:"name" maxLength:"30" example:"world" doc:"Name to greet"`
 		},
@@ -214,3 +206,28 @@ func main() {
 	})
 	cli.Run()
 }
+
+// newStore opens the store picked by the config
+func newStore(cfg config.Config) (service.Store, error) {
+	if cfg.Server.Store == "memory" {
+		return service.NewMemoryStore(), nil
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s",
+		cfg.DB.Username,
+		cfg.DB.Password,
+		cfg.DB.Host,
+		cfg.DB.Port,
+		cfg.DB.Name,
+	)
+	if cfg.DB.SSL {
+		dsn += "?sslmode=require"
+	} else {
+		dsn += "?sslmode=disable"
+	}
+
+	dbconn, err := db.New(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewPostgresStore(dbconn), nil
+}
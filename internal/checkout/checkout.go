@@ -0,0 +1,128 @@
+// Package checkout talks to online payment providers: it opens the hosted
+// checkout pages families pay on and reads the webhooks providers send once
+// they did.
+package checkout
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+)
+
+// Types of the events providers send
+const (
+	// EventCompleted is sent once the money was taken
+	EventCompleted = "checkout.completed"
+	// EventFailed is sent when the payment was refused
+	EventFailed = "checkout.failed"
+	// EventExpired is sent when the page expired unpaid
+	EventExpired = "checkout.expired"
+)
+
+// ErrInvalidSignature is returned for webhooks not signed by the provider
+var ErrInvalidSignature = errors.New("webhook signature is invalid")
+
+// SessionRequest is what a checkout page asks to pay
+type SessionRequest struct {
+	// Reference is our ID of the session, sent back in its events
+	Reference   string
+	Amount      money.Amount
+	Currency    string
+	Description string
+	Email       string
+	// SuccessURL and CancelURL are where the family is sent back to
+	SuccessURL string
+	CancelURL  string
+}
+
+// Session is a checkout page opened at a provider
+type Session struct {
+	ID        string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// Event is a webhook sent by a provider about a session
+type Event struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	SessionID string       `json:"session_id"`
+	Reference string       `json:"reference"`
+	Amount    money.Amount `json:"amount"`
+	Currency  string       `json:"currency"`
+	// Transaction is the provider's reference of the money taken
+	Transaction string `json:"transaction,omitempty"`
+}
+
+// Provider is an online payment provider
+type Provider interface {
+	// Name is how the provider is known in webhook URLs and stored sessions
+	Name() string
+	// CreateSession opens a checkout page paying req
+	CreateSession(ctx context.Context, req SessionRequest) (*Session, error)
+	// ParseEvent checks a webhook delivery was signed by the provider and
+	// decodes it, failing with ErrInvalidSignature when it wasn't
+	ParseEvent(header http.Header, body []byte) (*Event, error)
+}
+
+// SignatureHeader carries the signature of the webhooks of providers using
+// Sign, as t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">
+const SignatureHeader = "Checkout-Signature"
+
+// Tolerance is how old a signed webhook can be, older deliveries are
+// rejected as replays
+const Tolerance = 5 * time.Minute
+
+// Sign returns the SignatureHeader value of body sent at t
+func Sign(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify checks signature is the SignatureHeader of body, signed with secret
+// less than Tolerance before now
+func Verify(secret []byte, signature string, body []byte, now time.Time) error {
+	var ts string
+	var sums [][]byte
+	for part := range strings.SplitSeq(signature, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if sum, err := hex.DecodeString(v); err == nil {
+				sums = append(sums, sum)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: no timestamp", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > Tolerance || age < -Tolerance {
+		return fmt.Errorf("%w: sent %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+	want := mac(secret, ts, body)
+	for _, sum := range sums {
+		if hmac.Equal(sum, want) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret []byte, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts + "."))
+	h.Write(body)
+	return h.Sum(nil)
+}
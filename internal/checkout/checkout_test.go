@@ -0,0 +1,95 @@
+package checkout
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	body := []byte(`{"id":"fev_1","type":"checkout.completed"}`)
+	now := time.Unix(1760000000, 0)
+	signed := Sign(secret, now, body)
+	v1 := signed[len("t=1760000000,"):]
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		signature string
+		body      []byte
+		now       time.Time
+		ok        bool
+	}{
+		{name: "valid", secret: secret, signature: signed, body: body, now: now, ok: true},
+		{name: "within tolerance", secret: secret, signature: signed, body: body, now: now.Add(Tolerance), ok: true},
+		{name: "clock behind", secret: secret, signature: signed, body: body, now: now.Add(-Tolerance), ok: true},
+		{name: "stale", secret: secret, signature: signed, body: body, now: now.Add(Tolerance + time.Second)},
+		{name: "from the future", secret: secret, signature: signed, body: body, now: now.Add(-Tolerance - time.Second)},
+		{name: "tampered body", secret: secret, signature: signed, body: []byte(`{"id":"fev_1","type":"checkout.completed" }`), now: now},
+		{name: "wrong secret", secret: []byte("whsec_other"), signature: signed, body: body, now: now},
+		{name: "timestamp changed", secret: secret, signature: "t=1760000001," + v1, body: body, now: now},
+		{name: "no timestamp", secret: secret, signature: v1, body: body, now: now},
+		{name: "no signature", secret: secret, signature: "t=1760000000", body: body, now: now},
+		{name: "empty", secret: secret, signature: "", body: body, now: now},
+		{name: "garbage", secret: secret, signature: "t=abc,v1=zz", body: body, now: now},
+		// providers send the signatures of every secret while rotating them
+		{name: "one of several", secret: secret, signature: "t=1760000000,v1=00ff," + v1, body: body, now: now, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.signature, tt.body, tt.now)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Verify(%q) = %v, want nil", tt.signature, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Verify(%q) = %v, want ErrInvalidSignature", tt.signature, err)
+			}
+		})
+	}
+}
+
+func TestFakeDeliver(t *testing.T) {
+	f := NewFake("whsec_test", "http://localhost:8888/")
+	s, err := f.CreateSession(t.Context(), SessionRequest{Reference: "ref", Amount: 45000, Currency: "TND"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://localhost:8888/checkout/fake/" + s.ID; s.URL != want {
+		t.Fatalf("URL %q, want %q", s.URL, want)
+	}
+
+	for _, eventType := range []string{EventCompleted, EventFailed, EventExpired} {
+		t.Run(eventType, func(t *testing.T) {
+			header, body, err := f.Deliver(s.ID, eventType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := f.ParseEvent(header, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Type != eventType || e.SessionID != s.ID || e.Reference != "ref" || e.Amount != 45000 || e.Currency != "TND" {
+				t.Fatalf("parsed %+v", e)
+			}
+			if (e.Transaction != "") != (eventType == EventCompleted) {
+				t.Fatalf("transaction %q on a %s event", e.Transaction, eventType)
+			}
+		})
+	}
+
+	header, body, _ := f.Deliver(s.ID, EventCompleted)
+	if _, err := NewFake("whsec_other", "").ParseEvent(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseEvent with another secret = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := f.ParseEvent(http.Header{}, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseEvent without a signature = %v, want ErrInvalidSignature", err)
+	}
+	if _, _, err := f.Deliver("fcs_unknown", EventCompleted); err == nil {
+		t.Fatal("Deliver of an unknown session succeeded")
+	}
+}
@@ -0,0 +1,91 @@
+package checkout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Fake is a provider running in the server, so the whole flow of online
+// payments can be tried and tested without any network. Its checkout pages
+// are paid through Deliver.
+type Fake struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]SessionRequest
+}
+
+// NewFake returns a fake provider signing its webhooks with secret, its pages
+// living under baseURL
+func NewFake(secret string, baseURL string) *Fake {
+	return &Fake{
+		secret:   []byte(secret),
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		ttl:      time.Hour,
+		sessions: map[string]SessionRequest{},
+	}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateSession(ctx context.Context, req SessionRequest) (*Session, error) {
+	id := "fcs_" + ulid.Make().String()
+	f.mu.Lock()
+	f.sessions[id] = req
+	f.mu.Unlock()
+	return &Session{
+		ID:        id,
+		URL:       f.baseURL + "/checkout/fake/" + id,
+		ExpiresAt: time.Now().Add(f.ttl),
+	}, nil
+}
+
+// Deliver plays the family finishing the checkout page with the event type
+// and returns the webhook the provider sends about it, signed now
+func (f *Fake) Deliver(sessionID string, eventType string) (http.Header, []byte, error) {
+	f.mu.Lock()
+	req, ok := f.sessions[sessionID]
+	f.mu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("no fake checkout session %q", sessionID)
+	}
+	e := Event{
+		ID:        "fev_" + ulid.Make().String(),
+		Type:      eventType,
+		SessionID: sessionID,
+		Reference: req.Reference,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+	}
+	if eventType == EventCompleted {
+		e.Transaction = "ftx_" + ulid.Make().String()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(SignatureHeader, Sign(f.secret, time.Now(), body))
+	return header, body, nil
+}
+
+func (f *Fake) ParseEvent(header http.Header, body []byte) (*Event, error) {
+	if err := Verify(f.secret, header.Get(SignatureHeader), body, time.Now()); err != nil {
+		return nil, err
+	}
+	e := &Event{}
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, fmt.Errorf("decoding webhook: %w", err)
+	}
+	return e, nil
+}
@@ -15,6 +15,11 @@ type ServerConfig struct {
 	Port      int    `flag:"port" env:"SERVICE_PORT" yaml:"port" default:"8888" validate:"min=1,max=65535"`
 	LogLevel  string `flag:"log_level" env:"LOG_LEVEL" yaml:"log_level" default:"info" validate:"oneof=debug info warn error"`
 	LogFormat string `flag:"log_format" env:"LOG_FORMAT" yaml:"log_format" default:"text" validate:"oneof=text json"`
+	// IdempotencyKeyTTL is how long, in seconds, a stored Idempotency-Key response is replayed
+	IdempotencyKeyTTL int `flag:"idempotency_key_ttl" env:"IDEMPOTENCY_KEY_TTL" yaml:"idempotency_key_ttl" default:"86400" validate:"min=60,max=604800"`
+	// Store is where records are kept, memory keeps them in process for
+	// demos and needs no database, see docs/stores.md
+	Store string `flag:"store" env:"STORE" yaml:"store" default:"postgres" validate:"oneof=postgres memory"`
 }
 
 type DBConfig struct {
@@ -31,13 +36,65 @@ type AuthConfig struct {
 	AccessTokenTTL  int    `flag:"auth_access_token_ttl" env:"AUTH_ACCESS_TOKEN_TTL" yaml:"auth_access_token_ttl" validate:"min=1,max=86400"`
 	RefreshTokenTTL int    `flag:"auth_refresh_token_ttl" env:"AUTH_REFRESH_TOKEN_TTL" yaml:"auth_refresh_token_ttl" validate:"min=1,max=86400"`
 	RateLimit       int    `flag:"auth_rate_limit" env:"AUTH_RATE_LIMIT" yaml:"auth_rate_limit" validate:"min=1,max=1000"`
+	// BootstrapHRUserID is the user who counts as HR while no employee holds
+	// the hr permission, so that a new deployment can grant it, see
+	// docs/employees.md
+	BootstrapHRUserID string `flag:"auth_bootstrap_hr_user_id" env:"AUTH_BOOTSTRAP_HR_USER_ID" yaml:"auth_bootstrap_hr_user_id"`
+}
+
+type BillingConfig struct {
+	// Center is the center served by this deployment, invoices are numbered
+	// per center
+	Center string `flag:"billing_center" env:"BILLING_CENTER" yaml:"center" default:"main" validate:"required"`
+	// Currency is the ISO 4217 code of the currency of the center
+	Currency string `flag:"billing_currency" env:"BILLING_CURRENCY" yaml:"currency" default:"TND" validate:"required"`
+	// Decimals is how many decimals amounts of the currency have
+	Decimals int `flag:"billing_decimals" env:"BILLING_DECIMALS" yaml:"decimals" default:"3" validate:"min=0,max=3"`
+	// Proration is how enrollments covering part of a billed period are
+	// charged, by the days or the sessions covered or in full
+	Proration string `flag:"billing_proration" env:"BILLING_PRORATION" yaml:"proration" default:"days" validate:"oneof=none days sessions"`
+	// Name, Address, Phone and Email are printed on invoices and receipts,
+	// see docs/documents.md
+	Name    string `flag:"billing_name" env:"BILLING_NAME" yaml:"name"`
+	Address string `flag:"billing_address" env:"BILLING_ADDRESS" yaml:"address"`
+	Phone   string `flag:"billing_phone" env:"BILLING_PHONE" yaml:"phone"`
+	Email   string `flag:"billing_email" env:"BILLING_EMAIL" yaml:"email"`
+	// Logo is a PNG or JPEG file printed on invoices and receipts
+	Logo string `flag:"billing_logo" env:"BILLING_LOGO" yaml:"logo"`
+	// Font is a TrueType file writing every name on invoices and receipts,
+	// the built-in font only writes Latin-1
+	Font string `flag:"billing_font" env:"BILLING_FONT" yaml:"font"`
+	// PublicURL is where the API is reached, the QR codes of invoices and
+	// receipts link to its verification endpoint, they have none when empty
+	PublicURL string `flag:"billing_public_url" env:"BILLING_PUBLIC_URL" yaml:"public_url" default:"http://localhost:8888"`
+	// Provider is the payment provider families pay online through, none
+	// disables online payments and fake runs one inside the server, see
+	// docs/checkout.md
+	Provider string `flag:"billing_provider" env:"BILLING_PROVIDER" yaml:"provider" default:"none" validate:"oneof=none fake"`
+	// ProviderSecret signs the webhooks of the provider, required with one
+	// and never the same as Auth.Secret
+	ProviderSecret string `flag:"billing_provider_secret" env:"BILLING_PROVIDER_SECRET" yaml:"provider_secret"`
+	// DueDays is how many days after being issued an invoice is due
+	DueDays int `flag:"billing_due_days" env:"BILLING_DUE_DAYS" yaml:"due_days" default:"15" validate:"min=0,max=365"`
+	// ReminderDays are the days past due at which parents are reminded of an
+	// unpaid invoice, each one more pressing, comma separated, see
+	// docs/receivables.md
+	ReminderDays string `flag:"billing_reminder_days" env:"BILLING_REMINDER_DAYS" yaml:"reminder_days" default:"7,21,45"`
+	// LateFee is what invoices left unpaid LateFeeAfter days past due are
+	// charged once: nothing, LateFeeAmount or LateFeePercent of what is left
+	// to pay
+	LateFee        string `flag:"billing_late_fee" env:"BILLING_LATE_FEE" yaml:"late_fee" default:"none" validate:"oneof=none fixed percent"`
+	LateFeeAmount  string `flag:"billing_late_fee_amount" env:"BILLING_LATE_FEE_AMOUNT" yaml:"late_fee_amount" default:"0"`
+	LateFeePercent int    `flag:"billing_late_fee_percent" env:"BILLING_LATE_FEE_PERCENT" yaml:"late_fee_percent" default:"0" validate:"min=0,max=100"`
+	LateFeeAfter   int    `flag:"billing_late_fee_after" env:"BILLING_LATE_FEE_AFTER" yaml:"late_fee_after" default:"30" validate:"min=0,max=365"`
 }
 
 // --- Main Config Struct ---
 type Config struct {
-	Server ServerConfig
-	DB     DBConfig
-	Auth   AuthConfig
+	Server  ServerConfig
+	DB      DBConfig
+	Auth    AuthConfig
+	Billing BillingConfig
 }
 
 var (
@@ -60,6 +117,7 @@ func Load() {
 	cfg.BindConfigStruct(v, &config.Server, "server")
 	cfg.BindConfigStruct(v, &config.DB, "db")
 	cfg.BindConfigStruct(v, &config.Auth, "auth")
+	cfg.BindConfigStruct(v, &config.Billing, "billing")
 
 	// Bind CLI flags
 	pflag.String("config", "", "Path to config file or directory")
@@ -103,12 +161,17 @@ func Load() {
 	if err := cfg.ValidateConfigStruct(&config.Server); err != nil {
 		panic(fmt.Sprintf("Config for server validation error: %v", err))
 	}
-	if err := cfg.ValidateConfigStruct(&config.DB); err != nil {
+	if config.Server.Store == "memory" {
+		l.Warn().Msg("memory store, records are lost on exit")
+	} else if err := cfg.ValidateConfigStruct(&config.DB); err != nil {
 		panic(fmt.Sprintf("Config for DB validation error: %v", err))
 	}
 	if err := cfg.ValidateConfigStruct(&config.Auth); err != nil {
 		panic(fmt.Sprintf("config AuthConfig validation error: %v", err))
 	}
+	if err := cfg.ValidateConfigStruct(&config.Billing); err != nil {
+		panic(fmt.Sprintf("config BillingConfig validation error: %v", err))
+	}
 }
 
 // Get returns the global config
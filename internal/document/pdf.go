@@ -0,0 +1,307 @@
+// Package document renders the invoices and receipts handed to families as
+// PDF files, locally and without any rendering service.
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+// ContentTypePDF is the content type of the files rendered
+const ContentTypePDF = "application/pdf"
+
+// Branding is what documents show of the center
+type Branding struct {
+	Name    string
+	Address string
+	Phone   string
+	Email   string
+	// LogoPath is a PNG or JPEG file printed in the header, none when empty
+	LogoPath string
+	// FontPath is a TrueType file able to write every name, such as names
+	// in Arabic. The built-in Helvetica only writes Latin-1.
+	FontPath string
+}
+
+// Field is a labelled value
+type Field struct {
+	Label string
+	Value string
+}
+
+// Column is a column of a Table. Width is its share of the page width.
+type Column struct {
+	Title string
+	Width float64
+	Right bool
+}
+
+// Table is a table of text cells, one per column in each row
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+	// Footer is a last row in bold, such as a total
+	Footer []string
+}
+
+// Document is an invoice or a receipt
+type Document struct {
+	// Title is the kind of document, such as Invoice
+	Title  string
+	Number string
+	Date   string
+	// Stamp is written across the header when set, such as DRAFT or VOID
+	Stamp   string
+	To      []string
+	Details []Field
+	Items   Table
+	Totals  []Field
+	// Balance is shown under BalanceTitle when it has rows
+	BalanceTitle string
+	Balance      Table
+	Notes        []string
+	// VerifyURL is encoded in the QR code printed at the bottom, none when
+	// empty
+	VerifyURL string
+}
+
+const (
+	margin     = 15.0
+	lineHeight = 5.5
+	qrSize     = 30.0
+)
+
+// renderer writes one document, text going through tr so the built-in font
+// gets the code page it writes
+type renderer struct {
+	pdf   *fpdf.Fpdf
+	font  string
+	tr    func(string) string
+	width float64
+}
+
+// Render writes d as a PDF file to w, under the branding b
+func Render(w io.Writer, b Branding, d *Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+qrSize)
+	pdf.SetTitle(strings.TrimSpace(d.Title+" "+d.Number), true)
+	pdf.SetCreator(b.Name, true)
+	r := &renderer{pdf: pdf, font: "Helvetica", tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	if b.FontPath != "" {
+		pdf.AddUTF8Font("brand", "", b.FontPath)
+		pdf.AddUTF8Font("brand", "B", b.FontPath)
+		r.font, r.tr = "brand", func(s string) string { return s }
+	}
+	pageWidth, _ := pdf.GetPageSize()
+	r.width = pageWidth - 2*margin
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() { r.footer(d) })
+	pdf.AddPage()
+
+	r.header(b, d)
+	r.parties(d)
+	r.table(d.Items)
+	r.fields(d.Totals)
+	if len(d.Balance.Rows) > 0 {
+		pdf.Ln(lineHeight)
+		r.heading(d.BalanceTitle)
+		r.table(d.Balance)
+	}
+	if len(d.Notes) > 0 {
+		pdf.Ln(lineHeight)
+		r.setFont("", 9)
+		for _, n := range d.Notes {
+			pdf.MultiCell(r.width, lineHeight-1, r.tr(n), "", "L", false)
+		}
+	}
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	return pdf.Output(w)
+}
+
+func (r *renderer) setFont(style string, size float64) {
+	r.pdf.SetFont(r.font, style, size)
+}
+
+// header writes the center on the left and the title and number on the right
+func (r *renderer) header(b Branding, d *Document) {
+	pdf := r.pdf
+	top := pdf.GetY()
+	left := margin
+	if b.LogoPath != "" {
+		pdf.ImageOptions(b.LogoPath, margin, top, 0, 20, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+		if info := pdf.GetImageInfo(b.LogoPath); info != nil && info.Height() > 0 {
+			left += 20*info.Width()/info.Height() + 4
+		}
+	}
+	half := r.width / 2
+	pdf.SetXY(left, top)
+	r.setFont("B", 14)
+	pdf.CellFormat(half, 7, r.tr(b.Name), "", 2, "L", false, 0, "")
+	r.setFont("", 9)
+	for _, line := range []string{b.Address, b.Phone, b.Email} {
+		if line != "" {
+			pdf.CellFormat(half, lineHeight-1, r.tr(line), "", 2, "L", false, 0, "")
+		}
+	}
+	bottom := pdf.GetY()
+
+	pdf.SetXY(margin+half, top)
+	r.setFont("B", 18)
+	pdf.CellFormat(half, 9, r.tr(strings.ToUpper(d.Title)), "", 2, "R", false, 0, "")
+	r.setFont("", 10)
+	for _, line := range []string{d.Number, d.Date} {
+		if line != "" {
+			pdf.CellFormat(half, lineHeight, r.tr(line), "", 2, "R", false, 0, "")
+		}
+	}
+	if d.Stamp != "" {
+		r.setFont("B", 12)
+		pdf.SetTextColor(200, 30, 30)
+		pdf.CellFormat(half, 7, r.tr(d.Stamp), "", 2, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.SetXY(margin, max(bottom, pdf.GetY(), top+20)+4)
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Line(margin, pdf.GetY(), margin+r.width, pdf.GetY())
+	pdf.Ln(4)
+}
+
+// parties writes who the document is for next to its details
+func (r *renderer) parties(d *Document) {
+	pdf := r.pdf
+	top := pdf.GetY()
+	half := r.width / 2
+	r.setFont("", 10)
+	for i, line := range d.To {
+		if i == 0 {
+			r.setFont("B", 10)
+		} else {
+			r.setFont("", 10)
+		}
+		pdf.CellFormat(half, lineHeight, r.tr(line), "", 2, "L", false, 0, "")
+	}
+	bottom := pdf.GetY()
+	pdf.SetXY(margin+half, top)
+	for _, f := range d.Details {
+		pdf.SetX(margin + half)
+		r.setFont("", 10)
+		pdf.CellFormat(half/2, lineHeight, r.tr(f.Label), "", 0, "L", false, 0, "")
+		r.setFont("B", 10)
+		pdf.CellFormat(half/2, lineHeight, r.tr(f.Value), "", 1, "R", false, 0, "")
+	}
+	pdf.SetXY(margin, max(bottom, pdf.GetY())+6)
+}
+
+func (r *renderer) heading(title string) {
+	r.setFont("B", 11)
+	r.pdf.CellFormat(r.width, lineHeight+1, r.tr(title), "", 1, "L", false, 0, "")
+}
+
+// table writes t, its header repeated on every page it spans
+func (r *renderer) table(t Table) {
+	pdf := r.pdf
+	widths := make([]float64, len(t.Columns))
+	total := 0.0
+	for _, c := range t.Columns {
+		total += c.Width
+	}
+	for i, c := range t.Columns {
+		widths[i] = r.width * c.Width / total
+	}
+	align := func(i int) string {
+		if t.Columns[i].Right {
+			return "R"
+		}
+		return "L"
+	}
+	head := func() {
+		r.setFont("B", 9)
+		pdf.SetFillColor(235, 235, 235)
+		for i, c := range t.Columns {
+			pdf.CellFormat(widths[i], lineHeight+1, r.tr(c.Title), "B", 0, align(i), true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	row := func(cells []string, style string, border string) {
+		r.setFont(style, 9)
+		lines := 1
+		split := make([][]string, len(cells))
+		for i, cell := range cells {
+			split[i] = pdf.SplitText(r.tr(cell), widths[i]-2)
+			lines = max(lines, len(split[i]))
+		}
+		height := float64(lines) * (lineHeight - 1)
+		_, pageHeight := pdf.GetPageSize()
+		if pdf.GetY()+height > pageHeight-margin-qrSize {
+			pdf.AddPage()
+			head()
+			r.setFont(style, 9)
+		}
+		x, y := pdf.GetXY()
+		for i := range cells {
+			pdf.SetXY(x, y)
+			pdf.MultiCell(widths[i], lineHeight-1, strings.Join(split[i], "\n"), "", align(i), false)
+			x += widths[i]
+		}
+		pdf.SetXY(margin, y+height)
+		if border != "" {
+			pdf.Line(margin, pdf.GetY(), margin+r.width, pdf.GetY())
+		}
+		pdf.Ln(1)
+	}
+	head()
+	pdf.SetDrawColor(220, 220, 220)
+	for _, cells := range t.Rows {
+		row(cells, "", "B")
+	}
+	if t.Footer != nil {
+		row(t.Footer, "B", "")
+	}
+	pdf.Ln(2)
+}
+
+// fields writes fs right aligned, as totals are
+func (r *renderer) fields(fs []Field) {
+	pdf := r.pdf
+	for _, f := range fs {
+		pdf.SetX(margin + r.width/2)
+		r.setFont("", 10)
+		pdf.CellFormat(r.width/4, lineHeight+0.5, r.tr(f.Label), "", 0, "L", false, 0, "")
+		r.setFont("B", 10)
+		pdf.CellFormat(r.width/4, lineHeight+0.5, r.tr(f.Value), "", 1, "R", false, 0, "")
+	}
+}
+
+// footer writes the QR code and the page number at the bottom of each page
+func (r *renderer) footer(d *Document) {
+	pdf := r.pdf
+	_, pageHeight := pdf.GetPageSize()
+	top := pageHeight - margin - qrSize + 4
+	if d.VerifyURL != "" {
+		png, err := qrcode.Encode(d.VerifyURL, qrcode.Medium, 256)
+		if err != nil {
+			pdf.SetError(fmt.Errorf("encoding the verification QR code: %w", err))
+			return
+		}
+		name := "verify-qr"
+		if pdf.GetImageInfo(name) == nil {
+			pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+		}
+		size := qrSize - 6
+		pdf.ImageOptions(name, margin+r.width-size, top, size, size, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+		r.setFont("", 8)
+		pdf.SetXY(margin, top+size-8)
+		pdf.CellFormat(r.width-size-2, 4, r.tr("Scan the code to check this document is genuine."), "", 2, "R", false, 0, "")
+	}
+	r.setFont("", 8)
+	pdf.SetXY(margin, pageHeight-margin)
+	pdf.CellFormat(r.width, 4, fmt.Sprintf("%s %s - %d/{nb}", r.tr(d.Title), r.tr(d.Number), pdf.PageNo()), "", 0, "L", false, 0, "")
+}
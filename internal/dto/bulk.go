@@ -0,0 +1,110 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+// Modes of a bulk request
+const (
+	BulkAllOrNothing = "all_or_nothing"
+	BulkBestEffort   = "best_effort"
+)
+
+// Outcomes of a single bulk item
+const (
+	BulkCreated  = "created"
+	BulkUpdated  = "updated"
+	BulkConflict = "conflict"
+	BulkInvalid  = "invalid"
+	BulkNotFound = "not_found"
+	BulkSkipped  = "skipped"
+)
+
+type BulkParams struct {
+	Mode string `query:"mode" doc:"'all_or_nothing' saves every item or none, 'best_effort' saves the valid items and reports the others" enum:"all_or_nothing,best_effort" default:"all_or_nothing"`
+}
+
+// BulkItemResult is the outcome of the item at Index in the request
+type BulkItemResult[T any] struct {
+	Index  int    `json:"index" doc:"Position of the item in the request"`
+	Status string `json:"status" doc:"Outcome of the item, 'skipped' items were valid but not saved because others failed in all_or_nothing mode" enum:"created,updated,conflict,invalid,not_found,skipped"`
+	Reason string `json:"reason,omitempty" doc:"Why the item was not saved"`
+	Item   *T     `json:"item,omitempty" doc:"The saved record"`
+}
+
+type BulkResBody[T any] struct {
+	Mode      string              `json:"mode"`
+	Committed bool                `json:"committed" doc:"Whether anything was saved"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Results   []BulkItemResult[T] `json:"results"`
+}
+
+// BulkRes is sent with 200, or 422 when an all_or_nothing batch was
+// rolled back
+type BulkRes[T any] struct {
+	Status int
+	Body   BulkResBody[T]
+}
+
+type BulkCreateStudentsReq struct {
+	AuthHeader
+	BulkParams
+	Body struct {
+		Items []BulkCreateStudentItem `json:"items" minItems:"1" maxItems:"1000" required:"true"`
+	}
+}
+type BulkCreateStudentItem struct {
+	Level  string `json:"level" doc:"Level of the student" required:"true"`
+	UserID string `json:"user_id" doc:"User ID to link the student to, also the ID of the student" required:"true"`
+}
+
+type BulkUpdateStudentsReq struct {
+	AuthHeader
+	BulkParams
+	Body struct {
+		Items []BulkUpdateStudentItem `json:"items" minItems:"1" maxItems:"1000" required:"true"`
+	}
+}
+type BulkUpdateStudentItem struct {
+	ID     string           `json:"id" doc:"ID of the student" required:"true"`
+	Level  Optional[string] `json:"level" doc:"Level of the student" required:"false"`
+	UserID Optional[string] `json:"user_id" doc:"User ID to link the student to" required:"false"`
+}
+
+type BulkCreateEnrollmentsReq struct {
+	AuthHeader
+	BulkParams
+	Body struct {
+		Items []BulkCreateEnrollmentItem `json:"items" minItems:"1" maxItems:"1000" required:"true"`
+	}
+}
+type BulkCreateEnrollmentItem struct {
+	StudentID string        `json:"student_id" doc:"Student ID to enroll" required:"true"`
+	GroupID   string        `json:"group_id" doc:"Group ID to enroll in" required:"true"`
+	Fee       *money.Amount `json:"fee" doc:"Fee for the enrollment, defaults to group's default fee if not specified" required:"false"`
+	StartDate *string       `json:"start_date" format:"date" doc:"First day the enrollment is billed, defaults to today" required:"false"`
+}
+
+type BulkUpdateEnrollmentsReq struct {
+	AuthHeader
+	BulkParams
+	Body struct {
+		Items []BulkUpdateEnrollmentItem `json:"items" minItems:"1" maxItems:"1000" required:"true"`
+	}
+}
+type BulkUpdateEnrollmentItem struct {
+	StudentID string                 `json:"student_id" doc:"Student ID" required:"true"`
+	GroupID   string                 `json:"group_id" doc:"Group ID" required:"true"`
+	Fee       Optional[money.Amount] `json:"fee" doc:"Fee for the enrollment" required:"false"`
+}
+
+type BulkCreateStudentParentsReq struct {
+	AuthHeader
+	BulkParams
+	Body struct {
+		Items []BulkCreateStudentParentItem `json:"items" minItems:"1" maxItems:"1000" required:"true"`
+	}
+}
+type BulkCreateStudentParentItem struct {
+	StudentID string `json:"student_id" doc:"ID of the student" required:"true"`
+	ParentID  string `json:"parent_id" doc:"ID of the parent" required:"true"`
+}
@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"net/http"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type CreateCheckoutSessionReq struct {
+	AuthHeader
+	IdempotencyHeader
+	ID   string `path:"id" doc:"ID of the issued invoice to pay" required:"true"`
+	Body struct {
+		SuccessURL string `json:"success_url" doc:"Where the family is sent back to once they paid" format:"uri" maxLength:"2000" required:"true"`
+		CancelURL  string `json:"cancel_url" doc:"Where the family is sent back to when they give up" format:"uri" maxLength:"2000" required:"true"`
+	}
+}
+
+type CreateCheckoutSessionRes struct{ Body CheckoutSessionRes }
+
+type GetCheckoutSessionReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the checkout session" required:"true"`
+}
+
+type GetCheckoutSessionRes struct{ Body CheckoutSessionRes }
+
+type GetCheckoutSessionsByInvoiceIDReq struct {
+	AuthHeader
+	InvoiceID string `path:"id" doc:"ID of the invoice" required:"true"`
+}
+
+type GetCheckoutSessionsByInvoiceIDRes struct {
+	Body struct {
+		Sessions []CheckoutSessionRes `json:"sessions"`
+	}
+}
+
+type CheckoutSessionRes struct {
+	ID          string       `json:"id"`
+	Provider    string       `json:"provider"`
+	InvoiceID   string       `json:"invoice_id"`
+	StudentID   string       `json:"student_id"`
+	Currency    string       `json:"currency" doc:"ISO 4217 code of the amount"`
+	Amount      money.Amount `json:"amount" doc:"Left to pay on the invoice when the session was opened"`
+	Status      string       `json:"status" enum:"open,completed,failed,expired"`
+	URL         string       `json:"url" doc:"Checkout page of the provider the family pays on"`
+	ExpiresAt   int          `json:"expires_at"`
+	PaymentID   *string      `json:"payment_id,omitempty" doc:"Payment recorded once the session completed"`
+	CompletedAt *int         `json:"completed_at,omitempty"`
+	CreatedBy   *string      `json:"created_by,omitempty" doc:"User who opened the session"`
+	CreatedAt   int          `json:"created_at"`
+	UpdatedAt   int          `json:"updated_at"`
+}
+
+// CheckoutWebhookReq is a webhook delivery as sent by a provider, whose
+// signature is checked over the exact bytes of the body
+type CheckoutWebhookReq struct {
+	Provider string `path:"provider" doc:"Name of the provider sending the webhook" required:"true"`
+	RawBody  []byte
+	// Header holds every header of the delivery, as providers sign with
+	// headers of their own
+	Header http.Header
+}
+
+func (r *CheckoutWebhookReq) Resolve(ctx huma.Context) []error {
+	r.Header = http.Header{}
+	ctx.EachHeader(func(name, value string) {
+		r.Header.Add(name, value)
+	})
+	return nil
+}
+
+type CheckoutWebhookRes struct {
+	Body struct {
+		Received bool `json:"received"`
+	}
+}
+
+type PayFakeCheckoutReq struct {
+	SessionID string `path:"session_id" doc:"ID of the session at the fake provider" required:"true"`
+	Body      struct {
+		Outcome string `json:"outcome" doc:"How the checkout ends" enum:"paid,failed,expired" required:"true"`
+	}
+}
+
+type PayFakeCheckoutRes struct{ Body CheckoutSessionRes }
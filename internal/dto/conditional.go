@@ -0,0 +1,21 @@
+package dto
+
+import "fmt"
+
+// ETag formats a row version as a strong entity tag for the ETag header. The
+// conditional request headers are compared against the unquoted value.
+func ETag(versions ...int64) string {
+	tag := ""
+	for i, v := range versions {
+		if i > 0 {
+			tag += "."
+		}
+		tag += fmt.Sprintf("%d", v)
+	}
+	return tag
+}
+
+// QuoteETag quotes an entity tag for the ETag response header.
+func QuoteETag(tag string) string {
+	return `"` + tag + `"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+// DeletionPreviewReq asks what deleting a record would do, without deleting it
+type DeletionPreviewReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the record to delete" required:"true"`
+}
+type DeletionPreviewRes struct{ Body DeletionPlanRes }
+
+type DeletionPlanRes struct {
+	Entity   string              `json:"entity" doc:"Entity that would be deleted"`
+	ID       string              `json:"id" doc:"ID of the record that would be deleted"`
+	Allowed  bool                `json:"allowed" doc:"False when a restrict policy blocks the deletion"`
+	Affected []DeletionImpactRes `json:"affected" doc:"Linked records and the policy applied to them"`
+}
+
+type DeletionImpactRes struct {
+	Entity string   `json:"entity" doc:"Entity of the linked records"`
+	Via    string   `json:"via" doc:"Column referencing the deleted record"`
+	Policy string   `json:"policy" doc:"Policy applied to the linked records" enum:"restrict,cascade_soft_delete,detach"`
+	Count  int      `json:"count" doc:"Number of linked records"`
+	IDs    []string `json:"ids,omitempty" doc:"IDs of the linked records, omitted for link tables"`
+}
@@ -0,0 +1,38 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type GetInvoicePDFReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the invoice" required:"true"`
+}
+
+type GetPaymentReceiptReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the payment" required:"true"`
+}
+
+// DocumentPDFRes is a rendered PDF file, sent inline so browsers show it
+type DocumentPDFRes struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}
+
+type VerifyDocumentReq struct {
+	Kind string `path:"kind" doc:"Kind of document" enum:"invoice,receipt" required:"true"`
+	ID   string `path:"id" doc:"ID of the invoice or payment" required:"true"`
+	Code string `query:"code" doc:"Verification code printed in the QR code of the document" required:"true"`
+}
+
+type VerifyDocumentResBody struct {
+	Kind     string       `json:"kind" enum:"invoice,receipt"`
+	ID       string       `json:"id"`
+	Number   *string      `json:"number,omitempty" doc:"Legal number of an invoice"`
+	Status   *string      `json:"status,omitempty" doc:"Status of an invoice now, which may have changed since it was printed"`
+	Date     string       `json:"date" format:"date" doc:"Day an invoice was issued or a payment received"`
+	Amount   money.Amount `json:"amount" doc:"Total of an invoice or amount of a payment"`
+	Currency string       `json:"currency" doc:"ISO 4217 code of the amount"`
+}
+
+type VerifyDocumentRes struct{ Body VerifyDocumentResBody }
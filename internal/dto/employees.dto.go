@@ -1,26 +1,22 @@
 package dto
 
+import "github.com/ICan-TC/users/internal/money"
+
 // CreateEmployeeReq defines the request for creating an employee
 // Follows the pattern of CreateStudentReq
 // UserID, Role, and Salary are required
 type CreateEmployeeReq struct {
 	AuthHeader
 	Body struct {
-		UserID string  `json:"user_id" doc:"User ID to link the employee to" required:"true"`
-		Role   string  `json:"role" doc:"Role of the employee" required:"true"`
-		Salary float64 `json:"salary" doc:"Salary of the employee" required:"true"`
+		UserID        string       `json:"user_id" doc:"User ID to link the employee to" required:"true"`
+		Role          string       `json:"role" doc:"Role of the employee" required:"true"`
+		Salary        money.Amount `json:"salary" doc:"Salary of the employee" required:"true"`
+		ContractStart *string      `json:"contract_start,omitempty" doc:"First day of the contract, the first record takes effect on it, today by default" format:"date" required:"false"`
+		ContractEnd   *string      `json:"contract_end,omitempty" doc:"Last day of the contract, open-ended by default" format:"date" required:"false"`
 	}
 }
 
-type CreateEmployeeRes struct{ Body CreateEmployeeResBody }
-type CreateEmployeeResBody struct {
-	ID        string  `json:"id"`
-	UserID    string  `json:"user_id"`
-	Role      string  `json:"role"`
-	Salary    float64 `json:"salary"`
-	CreatedAt int     `json:"created_at"`
-	UpdatedAt int     `json:"updated_at"`
-}
+type CreateEmployeeRes struct{ Body GetEmployeeResBody }
 
 // UpdateEmployeeReq for updating an employee
 // All fields except ID are optional
@@ -28,20 +24,15 @@ type CreateEmployeeResBody struct {
 type UpdateEmployeeReq struct {
 	AuthHeader
 	Body struct {
-		ID     string   `json:"id" doc:"ID of the employee" required:"true"`
-		Role   *string  `json:"role" doc:"Role of the employee" required:"false"`
-		Salary *float64 `json:"salary" doc:"Salary of the employee" required:"false"`
+		ID            string                 `json:"id" doc:"ID of the employee" required:"true"`
+		Role          Optional[string]       `json:"role" doc:"Role of the employee from today, see the records" required:"false"`
+		Salary        Optional[money.Amount] `json:"salary" doc:"Salary of the employee from today, see the records" required:"false"`
+		Status        Optional[string]       `json:"status" doc:"Status of the employee from today, see the records" enum:"active,on_leave,left" required:"false"`
+		ContractStart Nullable[string]       `json:"contract_start" doc:"First day of the contract, null when unknown" format:"date" required:"false"`
+		ContractEnd   Nullable[string]       `json:"contract_end" doc:"Last day of the contract, null for open-ended" format:"date" required:"false"`
 	}
 }
-type UpdateEmployeeRes struct{ Body UpdateEmployeeResBody }
-type UpdateEmployeeResBody struct {
-	ID        string  `json:"id"`
-	UserID    string  `json:"user_id"`
-	Role      string  `json:"role"`
-	Salary    float64 `json:"salary"`
-	CreatedAt int     `json:"created_at"`
-	UpdatedAt int     `json:"updated_at"`
-}
+type UpdateEmployeeRes struct{ Body GetEmployeeResBody }
 
 type GetEmployeeByIDReq struct {
 	AuthHeader
@@ -50,12 +41,17 @@ type GetEmployeeByIDReq struct {
 type GetEmployeeByIDRes struct{ Body GetEmployeeResBody }
 
 type GetEmployeeResBody struct {
-	ID        string  `json:"id"`
-	UserID    string  `json:"user_id"`
-	Role      string  `json:"role"`
-	Salary    float64 `json:"salary"`
-	CreatedAt int     `json:"created_at"`
-	UpdatedAt int     `json:"updated_at"`
+	ID            string        `json:"id"`
+	UserID        string        `json:"user_id"`
+	Role          string        `json:"role"`
+	Salary        *money.Amount `json:"salary,omitempty" doc:"Salary in effect, only shown to HR"`
+	Status        string        `json:"status" doc:"active, on_leave, or left once the contract ended"`
+	ContractStart *string       `json:"contract_start"`
+	ContractEnd   *string       `json:"contract_end"`
+	Permissions   []string      `json:"permissions"`
+	Relevance     *float64      `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt     int           `json:"created_at"`
+	UpdatedAt     int           `json:"updated_at"`
 }
 
 type DeleteEmployeeReq struct {
@@ -72,12 +68,75 @@ type DeleteEmployeeRes struct {
 type ListEmployeesReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListEmployeesResBody struct {
 	Employees []GetEmployeeResBody `json:"employees"`
-	Total     int                  `json:"total"`
-	ListQuery ListQuery            `json:"query"`
+	Total     int                  `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes         `json:"query"`
+	PageCursors
 }
 type ListEmployeesRes struct {
 	Body ListEmployeesResBody
 }
+
+type SetEmployeePermissionsReq struct {
+	AuthHeader
+	ID   string `path:"id" doc:"ID of the employee" required:"true"`
+	Body struct {
+		Permissions []string `json:"permissions" doc:"Every permission the employee holds, replacing the ones held" enum:"hr" uniqueItems:"true" required:"true"`
+	}
+}
+type SetEmployeePermissionsRes struct{ Body GetEmployeeResBody }
+
+type ListEmployeeRecordsReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the employee" required:"true"`
+}
+type ListEmployeeRecordsResBody struct {
+	Records []EmployeeRecordRes `json:"records" doc:"Records of the employee, the latest first"`
+}
+type ListEmployeeRecordsRes struct {
+	Body ListEmployeeRecordsResBody
+}
+
+type CreateEmployeeRecordReq struct {
+	AuthHeader
+	ID   string `path:"id" doc:"ID of the employee" required:"true"`
+	Body struct {
+		EffectiveFrom string        `json:"effective_from" doc:"Day the record takes effect" format:"date" required:"true"`
+		Role          *string       `json:"role,omitempty" doc:"Role from effective_from, the one in effect that day by default" required:"false"`
+		Salary        *money.Amount `json:"salary,omitempty" doc:"Salary from effective_from, the one in effect that day by default" required:"false"`
+		Status        *string       `json:"status,omitempty" doc:"Status from effective_from, the one in effect that day by default" enum:"active,on_leave,left" required:"false"`
+		Note          *string       `json:"note,omitempty" doc:"Why it changed, such as a yearly raise" maxLength:"500" required:"false"`
+	}
+}
+type CreateEmployeeRecordRes struct{ Body EmployeeRecordRes }
+
+type DeleteEmployeeRecordReq struct {
+	AuthHeader
+	ID       string `path:"id" doc:"ID of the employee" required:"true"`
+	RecordID string `path:"record_id" doc:"ID of the record" required:"true"`
+}
+type DeleteEmployeeRecordResBody struct {
+	ID string `json:"id"`
+}
+type DeleteEmployeeRecordRes struct {
+	Body DeleteEmployeeRecordResBody
+}
+
+// EmployeeRecordRes is the role, salary and status of an employee from a day
+// until the next record
+type EmployeeRecordRes struct {
+	ID            string       `json:"id"`
+	EmployeeID    string       `json:"employee_id"`
+	EffectiveFrom string       `json:"effective_from"`
+	Role          string       `json:"role"`
+	Salary        money.Amount `json:"salary"`
+	Status        string       `json:"status"`
+	Note          *string      `json:"note"`
+	InEffect      bool         `json:"in_effect" doc:"Whether this is the record in effect today"`
+	CreatedBy     *string      `json:"created_by" doc:"User who recorded it"`
+	CreatedAt     int          `json:"created_at"`
+	UpdatedAt     int          `json:"updated_at"`
+}
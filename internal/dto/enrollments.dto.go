@@ -1,13 +1,17 @@
 package dto
 
+import "github.com/ICan-TC/users/internal/money"
+
 // CreateEnrollmentReq defines the request for creating an enrollment
 // StudentID and GroupID are required, Fee is optional (defaults to group's default fee)
 type CreateEnrollmentReq struct {
 	AuthHeader
+	IdempotencyHeader
 	Body struct {
-		StudentID string   `json:"student_id" doc:"Student ID to enroll" required:"true"`
-		GroupID   string   `json:"group_id" doc:"Group ID to enroll in" required:"true"`
-		Fee       *float64 `json:"fee" doc:"Fee for the enrollment, defaults to group's default fee if not specified" required:"false"`
+		StudentID string        `json:"student_id" doc:"Student ID to enroll" required:"true"`
+		GroupID   string        `json:"group_id" doc:"Group ID to enroll in" required:"true"`
+		Fee       *money.Amount `json:"fee" doc:"Fee for the enrollment, defaults to group's default fee if not specified" required:"false"`
+		StartDate *string       `json:"start_date" format:"date" doc:"First day the enrollment is billed, defaults to today" required:"false"`
 	}
 }
 
@@ -18,9 +22,9 @@ type CreateEnrollmentRes struct{ Body EnrollmentModelRes }
 type UpdateEnrollmentReq struct {
 	AuthHeader
 	Body struct {
-		StudentID string   `json:"student_id" doc:"Student ID" required:"true"`
-		GroupID   string   `json:"group_id" doc:"Group ID" required:"true"`
-		Fee       *float64 `json:"fee" doc:"Fee for the enrollment" required:"false"`
+		StudentID string                 `json:"student_id" doc:"Student ID" required:"true"`
+		GroupID   string                 `json:"group_id" doc:"Group ID" required:"true"`
+		Fee       Optional[money.Amount] `json:"fee" doc:"Fee for the enrollment" required:"false"`
 	}
 }
 
@@ -34,6 +38,34 @@ type GetEnrollmentByIDReq struct {
 
 type GetEnrollmentByIDRes struct{ Body EnrollmentModelRes }
 
+// WithdrawEnrollmentReq ends an enrollment. Invoices already billing it
+// after end_date are credited the difference.
+type WithdrawEnrollmentReq struct {
+	AuthHeader
+	IdempotencyHeader
+	StudentID string `path:"student_id" doc:"Student ID" required:"true"`
+	GroupID   string `path:"group_id" doc:"Group ID" required:"true"`
+	Body      struct {
+		EndDate      *string `json:"end_date" format:"date" doc:"Last day the enrollment is billed, defaults to today" required:"false"`
+		RefundMethod *string `json:"refund_method" enum:"cash,card,transfer,cheque" doc:"Pay back with this method what the withdrawal frees of what was paid, instead of keeping it as credit of the student" required:"false"`
+	}
+}
+
+type WithdrawEnrollmentResBody struct {
+	Enrollment EnrollmentModelRes     `json:"enrollment"`
+	Invoices   []WithdrawalInvoiceRes `json:"invoices" doc:"Invoices that billed the enrollment after end_date and what was taken off them"`
+	Credited   money.Amount           `json:"credited" doc:"Part of what was paid on those invoices kept as credit of the student"`
+	Refunded   money.Amount           `json:"refunded" doc:"Part of what was paid on those invoices paid back"`
+}
+
+type WithdrawalInvoiceRes struct {
+	InvoiceID string       `json:"invoice_id"`
+	Status    string       `json:"status" enum:"draft,issued,paid" doc:"Status of the invoice after the withdrawal"`
+	Amount    money.Amount `json:"amount" doc:"Taken off the invoice, from its total for drafts and as amount_credited otherwise"`
+}
+
+type WithdrawEnrollmentRes struct{ Body WithdrawEnrollmentResBody }
+
 type DeleteEnrollmentReq struct {
 	AuthHeader
 	StudentID string `path:"student_id" doc:"Student ID" required:"true"`
@@ -52,12 +84,14 @@ type DeleteEnrollmentRes struct {
 type ListEnrollmentsReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 
 type ListEnrollmentsResBody struct {
 	Enrollments []EnrollmentModelRes `json:"enrollments"`
-	Total       int                  `json:"total"`
-	ListQuery   ListQuery            `json:"query"`
+	Total       int                  `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery   ListQueryRes         `json:"query"`
+	PageCursors
 }
 
 type ListEnrollmentsRes struct {
@@ -85,9 +119,14 @@ type GetEnrollmentsByStudentIDRes struct {
 }
 
 type EnrollmentModelRes struct {
-	StudentID string  `json:"student_id"`
-	GroupID   string  `json:"group_id"`
-	Fee       float64 `json:"fee"`
-	CreatedAt int     `json:"created_at"`
-	UpdatedAt int     `json:"updated_at"`
+	StudentID    string               `json:"student_id"`
+	GroupID      string               `json:"group_id"`
+	Fee          money.Amount         `json:"fee" doc:"Monthly fee before the pricing rules"`
+	EffectiveFee money.Amount         `json:"effective_fee" doc:"Monthly fee the pricing rules valid when the enrollment was made or its fee changed leave, invoices price it again"`
+	Adjustments  []PriceAdjustmentRes `json:"adjustments" doc:"What each pricing rule took off the fee, in the order they applied"`
+	StartDate    string               `json:"start_date" format:"date" doc:"First day the enrollment is billed"`
+	EndDate      *string              `json:"end_date" format:"date" doc:"Last day the enrollment is billed, set when the student withdrew"`
+	Relevance    *float64             `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt    int                  `json:"created_at"`
+	UpdatedAt    int                  `json:"updated_at"`
 }
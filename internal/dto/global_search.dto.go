@@ -0,0 +1,31 @@
+package dto
+
+// GlobalSearchReq searches people and groups at once
+type GlobalSearchReq struct {
+	AuthHeader
+	Q     string `query:"q" doc:"Name, username, email or group to look for" minLength:"1" maxLength:"100" required:"true"`
+	Types string `query:"types" doc:"Comma separated hit types to include, either 'user', 'group' or both" default:"user,group"`
+	Limit int    `query:"limit" doc:"Maximum number of hits" default:"20" minimum:"1" maximum:"100"`
+}
+
+type GlobalSearchResBody struct {
+	Query string         `json:"query"`
+	Hits  []SearchHitRes `json:"hits"`
+}
+type GlobalSearchRes struct{ Body GlobalSearchResBody }
+
+// SearchHitRes is a single ranked hit. User hits list every role the person
+// holds so the caller can jump to the student, parent, teacher or employee.
+type SearchHitRes struct {
+	Type      string          `json:"type" doc:"Kind of hit" enum:"user,group"`
+	ID        string          `json:"id" doc:"User ID or group ID"`
+	Label     string          `json:"label" doc:"Full name, username or group name"`
+	Detail    string          `json:"detail" doc:"Email of a user, subject and level of a group"`
+	Relevance float64         `json:"relevance" doc:"Similarity to the query between 0 and 1"`
+	Roles     []SearchRoleRes `json:"roles,omitempty" doc:"Roles held by a user"`
+}
+
+type SearchRoleRes struct {
+	Role string `json:"role" enum:"student,parent,teacher,employee"`
+	ID   string `json:"id" doc:"ID of the student, parent, teacher or employee record"`
+}
@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"github.com/danielgtaylor/huma/v2/conditional"
+
+	"github.com/ICan-TC/users/internal/money"
+)
+
 // CreateGroupReq defines the request for creating a group
 // All core fields are required except description and metadata
 type CreateGroupReq struct {
@@ -8,7 +14,7 @@ type CreateGroupReq struct {
 		Name        string                 `json:"name" doc:"Name of the group" required:"true"`
 		Description string                 `json:"description" doc:"Description of the group" required:"false"`
 		TeacherID   string                 `json:"teacher_id" doc:"Teacher ID for the group" required:"true"`
-		DefaultFee  float64                `json:"default_fee" doc:"Default fee for the group" required:"true"`
+		DefaultFee  money.Amount           `json:"default_fee" doc:"Default fee for the group" required:"true"`
 		Subject     string                 `json:"subject" doc:"Subject of the group" required:"true"`
 		Level       string                 `json:"level" doc:"Level of the group" required:"true"`
 		Metadata    map[string]interface{} `json:"metadata" doc:"Additional metadata" required:"false"`
@@ -21,27 +27,36 @@ type CreateGroupRes struct{ Body GroupModelRes }
 // All fields except ID are optional
 type UpdateGroupReq struct {
 	AuthHeader
+	conditional.Params
 	Body struct {
-		ID          string                 `json:"id" doc:"ID of the group" required:"true"`
-		Name        *string                `json:"name" doc:"Name of the group" required:"false"`
-		Description *string                `json:"description" doc:"Description of the group" required:"false"`
-		TeacherID   *string                `json:"teacher_id" doc:"Teacher ID for the group" required:"false"`
-		DefaultFee  *float64               `json:"default_fee" doc:"Default fee for the group" required:"false"`
-		Subject     *string                `json:"subject" doc:"Subject of the group" required:"false"`
-		Level       *string                `json:"level" doc:"Level of the group" required:"false"`
-		Metadata    map[string]interface{} `json:"metadata" doc:"Additional metadata" required:"false"`
+		ID          string                           `json:"id" doc:"ID of the group" required:"true"`
+		Name        Optional[string]                 `json:"name" doc:"Name of the group" required:"false"`
+		Description Nullable[string]                 `json:"description" doc:"Description of the group, null clears it" required:"false"`
+		TeacherID   Optional[string]                 `json:"teacher_id" doc:"Teacher ID for the group" required:"false"`
+		DefaultFee  Optional[money.Amount]           `json:"default_fee" doc:"Default fee for the group" required:"false"`
+		Subject     Optional[string]                 `json:"subject" doc:"Subject of the group" required:"false"`
+		Level       Optional[string]                 `json:"level" doc:"Level of the group" required:"false"`
+		Metadata    Nullable[map[string]interface{}] `json:"metadata" doc:"Merge patch of the metadata: keys are merged recursively, null removes a key, null as a whole clears it" required:"false"`
 	}
 }
-type UpdateGroupRes struct{ Body GroupModelRes }
+type UpdateGroupRes struct {
+	ETag string `header:"ETag"`
+	Body GroupModelRes
+}
 
 type GetGroupByIDReq struct {
 	AuthHeader
+	conditional.Params
 	ID string `path:"id" doc:"ID of the group" required:"true"`
 }
-type GetGroupByIDRes struct{ Body GroupModelRes }
+type GetGroupByIDRes struct {
+	ETag string `header:"ETag"`
+	Body GroupModelRes
+}
 
 type DeleteGroupReq struct {
 	AuthHeader
+	conditional.Params
 	ID string `path:"id" doc:"ID of the group" required:"true"`
 }
 type DeleteGroupResBody struct {
@@ -54,11 +69,13 @@ type DeleteGroupRes struct {
 type ListGroupsReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListGroupsResBody struct {
 	Groups    []GroupModelRes `json:"groups"`
-	Total     int             `json:"total"`
-	ListQuery ListQuery       `json:"query"`
+	Total     int             `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes    `json:"query"`
+	PageCursors
 }
 type ListGroupsRes struct {
 	Body ListGroupsResBody
@@ -69,10 +86,13 @@ type GroupModelRes struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	TeacherID   string                 `json:"teacher_id"`
-	DefaultFee  float64                `json:"default_fee"`
+	DefaultFee  money.Amount           `json:"default_fee"`
 	Subject     string                 `json:"subject"`
 	Level       string                 `json:"level"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Relevance   *float64               `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
 	CreatedAt   int                    `json:"created_at"`
 	UpdatedAt   int                    `json:"updated_at"`
+	// ETag is sent as a header
+	ETag string `json:"-"`
 }
@@ -0,0 +1,82 @@
+package dto
+
+import "github.com/danielgtaylor/huma/v2"
+
+// CreateImportReq uploads a file of students and parents for a dry run
+type CreateImportReq struct {
+	AuthHeader
+	RawBody huma.MultipartFormFiles[CreateImportForm]
+}
+type CreateImportForm struct {
+	File    huma.FormFile `form:"file" contentType:"text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/vnd.ms-excel,application/octet-stream,text/plain" required:"true" doc:"CSV or XLSX file with the headers on its first row"`
+	Mapping string        `form:"mapping" doc:"JSON object from import field, e.g. student.email, to the header of the column holding it. Columns named after a field need no mapping"`
+}
+
+type GetImportReq struct {
+	AuthHeader
+	ID   string `path:"id" doc:"ID of the import"`
+	Rows string `query:"rows" doc:"Rows to include, 'issues' only lists rows with errors or warnings" enum:"issues,all,none" default:"issues"`
+}
+
+type CommitImportReq struct {
+	AuthHeader
+	ID          string `path:"id" doc:"ID of the import"`
+	SkipInvalid bool   `query:"skip_invalid" doc:"Import the valid rows even though some rows have errors" default:"false"`
+}
+
+type ListImportsReq struct {
+	AuthHeader
+	ListQuery
+}
+
+type ImportRes struct {
+	Status int
+	Body   ImportJobRes
+}
+
+type ListImportsResBody struct {
+	Imports   []ImportJobRes `json:"imports"`
+	Total     int            `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQuery      `json:"query"`
+	PageCursors
+}
+type ListImportsRes struct {
+	Body ListImportsResBody
+}
+
+type ImportJobRes struct {
+	ID              string            `json:"id"`
+	Status          string            `json:"status" enum:"validating,validated,committing,committed,failed"`
+	Filename        string            `json:"filename"`
+	Format          string            `json:"format" enum:"csv,xlsx"`
+	Mapping         map[string]string `json:"mapping" doc:"Column header of every import field found"`
+	TotalRows       int               `json:"total_rows"`
+	ValidRows       int               `json:"valid_rows"`
+	InvalidRows     int               `json:"invalid_rows"`
+	CreatedStudents int               `json:"created_students"`
+	CreatedParents  int               `json:"created_parents"`
+	CreatedLinks    int               `json:"created_links"`
+	Error           *string           `json:"error,omitempty" doc:"Why the import failed"`
+	Rows            []ImportRowRes    `json:"rows,omitempty"`
+	CreatedAt       int               `json:"created_at"`
+	UpdatedAt       int               `json:"updated_at"`
+	CommittedAt     *int              `json:"committed_at,omitempty"`
+}
+
+type ImportRowRes struct {
+	Line     int              `json:"line" doc:"Line of the row in the file, the headers being line 1"`
+	Student  ImportPersonRes  `json:"student"`
+	Parent   *ImportPersonRes `json:"parent,omitempty"`
+	Errors   []string         `json:"errors,omitempty" doc:"Problems keeping the row from being imported"`
+	Warnings []string         `json:"warnings,omitempty" doc:"Things worth checking that don't keep the row out"`
+}
+
+type ImportPersonRes struct {
+	Username    string `json:"username,omitempty"`
+	Email       string `json:"email,omitempty"`
+	FirstName   string `json:"first_name,omitempty"`
+	FamilyName  string `json:"family_name,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+	Level       string `json:"level,omitempty"`
+}
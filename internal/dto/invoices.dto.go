@@ -0,0 +1,128 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type GenerateInvoicesReq struct {
+	AuthHeader
+	IdempotencyHeader
+	Body struct {
+		Period      string   `json:"period" doc:"Billing period, monthly or term" enum:"monthly,term" required:"true"`
+		PeriodStart string   `json:"period_start" doc:"First day of the term, or any day of the month to bill" format:"date" required:"true"`
+		PeriodEnd   *string  `json:"period_end,omitempty" doc:"Last day of the term, required for terms and ignored for months" format:"date" required:"false"`
+		StudentIDs  []string `json:"student_ids,omitempty" doc:"Only bill these students, every student with an active enrollment by default" maxItems:"1000" required:"false"`
+	}
+}
+
+type GenerateInvoicesResBody struct {
+	InvoiceIDs []string `json:"invoice_ids" doc:"Draft invoices created, one per student billed"`
+	Created    int      `json:"created"`
+	Skipped    int      `json:"skipped" doc:"Students already invoiced for the period"`
+}
+
+type GenerateInvoicesRes struct{ Body GenerateInvoicesResBody }
+
+type GetInvoiceByIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the invoice" required:"true"`
+}
+
+type GetInvoiceByIDRes struct{ Body InvoiceModelRes }
+
+type IssueInvoiceReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the invoice" required:"true"`
+}
+
+type IssueInvoiceRes struct{ Body InvoiceModelRes }
+
+type VoidInvoiceReq struct {
+	AuthHeader
+	ID   string `path:"id" doc:"ID of the invoice" required:"true"`
+	Body struct {
+		Reason string `json:"reason" doc:"Why the invoice is voided, kept with it" minLength:"1" maxLength:"500" required:"true"`
+	}
+}
+
+type VoidInvoiceRes struct{ Body InvoiceModelRes }
+
+type ListInvoicesReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListInvoicesResBody struct {
+	Invoices  []InvoiceModelRes `json:"invoices"`
+	Total     int               `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes      `json:"query"`
+	PageCursors
+}
+
+type ListInvoicesRes struct {
+	Body ListInvoicesResBody
+}
+
+type GetInvoicesByStudentIDReq struct {
+	AuthHeader
+	StudentID string `path:"student_id" doc:"Student ID" required:"true"`
+	ListQuery
+}
+
+type GetInvoicesByStudentIDRes struct {
+	Body ListInvoicesResBody
+}
+
+type GetInvoicesByParentIDReq struct {
+	AuthHeader
+	ParentID string `path:"parent_id" doc:"Parent ID" required:"true"`
+	ListQuery
+}
+
+type GetInvoicesByParentIDRes struct {
+	Body ListInvoicesResBody
+}
+
+type InvoiceModelRes struct {
+	ID               string           `json:"id"`
+	Center           string           `json:"center"`
+	Number           *string          `json:"number" doc:"Legal number, set when the invoice is issued"`
+	StudentID        string           `json:"student_id"`
+	Period           string           `json:"period" enum:"monthly,term,late_fee" doc:"Billing period, late_fee for the invoices billing late fees"`
+	PeriodStart      string           `json:"period_start" format:"date"`
+	PeriodEnd        string           `json:"period_end" format:"date"`
+	Status           string           `json:"status" enum:"draft,issued,paid,void"`
+	Currency         string           `json:"currency" doc:"ISO 4217 code of the amounts"`
+	Total            money.Amount     `json:"total"`
+	AmountPaid       money.Amount     `json:"amount_paid" doc:"Paid so far, the invoice is paid once it reaches the total less amount_credited"`
+	AmountCredited   money.Amount     `json:"amount_credited" doc:"Taken off the total by withdrawals after the invoice was issued"`
+	Lines            []InvoiceLineRes `json:"lines,omitempty" doc:"Line items, only sent for a single invoice"`
+	IssuedAt         *int             `json:"issued_at,omitempty"`
+	DueDate          *string          `json:"due_date,omitempty" format:"date" doc:"Day the invoice is due, set when it is issued"`
+	PaidAt           *int             `json:"paid_at,omitempty"`
+	VoidedAt         *int             `json:"voided_at,omitempty"`
+	VoidReason       *string          `json:"void_reason,omitempty"`
+	LateFeeInvoiceID *string          `json:"late_fee_invoice_id,omitempty" doc:"Invoice billing the late fee charged on this one"`
+	Relevance        *float64         `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt        int              `json:"created_at"`
+	UpdatedAt        int              `json:"updated_at"`
+}
+
+type InvoiceLineRes struct {
+	ID          string               `json:"id"`
+	GroupID     *string              `json:"group_id"`
+	Description string               `json:"description"`
+	Quantity    int                  `json:"quantity"`
+	ListPrice   money.Amount         `json:"list_price" doc:"Fee of the enrollment before the pricing rules"`
+	UnitPrice   money.Amount         `json:"unit_price" doc:"Fee billed per month, what the pricing rules left of list_price"`
+	Adjustments []PriceAdjustmentRes `json:"adjustments" doc:"What each pricing rule took off list_price, in the order they applied"`
+	Amount      money.Amount         `json:"amount" doc:"unit_price times quantity, prorated when the enrollment covers part of the period"`
+	CoveredFrom string               `json:"covered_from" format:"date" doc:"First day of the period the enrollment covers"`
+	CoveredTo   string               `json:"covered_to" format:"date" doc:"Last day of the period the enrollment covers"`
+	Proration   *ProrationRes        `json:"proration" doc:"How amount was prorated, null when the line bills the whole period"`
+}
+
+type ProrationRes struct {
+	Policy string `json:"policy" enum:"days,sessions" doc:"What was counted"`
+	Units  int    `json:"units" doc:"Days or sessions of the period the enrollment covers"`
+	Total  int    `json:"total" doc:"Days or sessions of the period"`
+}
@@ -0,0 +1,319 @@
+package dto
+
+import (
+	"cmp"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// PageCursors are returned by every list endpoint. Passing one of them as
+// `cursor` fetches the adjacent page using keyset pagination.
+type PageCursors struct {
+	NextCursor *string `json:"next_cursor" doc:"Cursor of the next page, null on the last page"`
+	PrevCursor *string `json:"prev_cursor" doc:"Cursor of the previous page, null on the first page"`
+}
+
+// cursor is the decoded form of the opaque cursor string. Values holds the
+// sort field followed by the primary key of the row the page starts after.
+type cursor struct {
+	SortBy   string   `json:"s"`
+	SortDir  string   `json:"d"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) *string {
+	b, _ := json.Marshal(c)
+	s := base64.RawURLEncoding.EncodeToString(b)
+	return &s
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Page orders and limits a list query of T, by offset when no cursor is given
+// and by keyset on (sort_by, primary key) otherwise.
+type Page[T any] struct {
+	params ListQuery
+	cursor *cursor
+	table  *schema.Table
+	cols   []*schema.Field
+}
+
+// NewPage validates the paging parameters against the model T of db.
+func NewPage[T any](db *bun.DB, params ListQuery) (*Page[T], error) {
+	// relevance is only selected while searching
+	if params.SortBy == "relevance" && strings.TrimSpace(params.Search) == "" {
+		return nil, huma.Error400BadRequest("sort_by=relevance needs a search term")
+	}
+	table := db.Table(reflect.TypeFor[T]())
+	p := &Page[T]{params: params, table: table}
+	// Keyset comparisons skip NULLs, so nullable and computed columns only page by offset
+	if f, ok := table.FieldMap[params.SortBy]; ok && !f.IsPtr && !f.Tag.HasOption("scanonly") {
+		p.cols = append(p.cols, f)
+		for _, pk := range table.PKs {
+			if pk != f {
+				p.cols = append(p.cols, pk)
+			}
+		}
+	}
+	if params.Cursor == "" {
+		return p, nil
+	}
+	if len(p.cols) == 0 {
+		return nil, huma.Error400BadRequest(fmt.Sprintf("cursor pagination is not supported when sorting by %s", params.SortBy))
+	}
+	c, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return nil, huma.Error400BadRequest("cursor is invalid", err)
+	}
+	if c.SortBy != params.SortBy || c.SortDir != params.SortDir || len(c.Values) != len(p.cols) {
+		return nil, huma.Error400BadRequest("cursor does not match sort_by and sort_dir")
+	}
+	p.cursor = c
+	return p, nil
+}
+
+// Apply adds ordering and limits to q. One extra row is fetched to tell
+// whether another page follows.
+func (p *Page[T]) Apply(q *bun.SelectQuery) *bun.SelectQuery {
+	if len(p.cols) == 0 {
+		q = q.Order(p.params.SortBy + " " + p.params.SortDir)
+		q = q.Limit(p.params.PerPage + 1)
+		return q.Offset(p.params.PerPage * (p.params.Page - 1))
+	}
+
+	desc := strings.EqualFold(p.params.SortDir, "desc")
+	if p.cursor != nil && p.cursor.Backward {
+		desc = !desc
+	}
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if p.cursor != nil {
+		idents := make([]string, len(p.cols))
+		args := make([]any, 0, len(p.cols)*2)
+		for i, f := range p.cols {
+			idents[i] = "?TableAlias.?"
+			args = append(args, bun.Ident(f.Name))
+		}
+		for _, v := range p.cursor.Values {
+			args = append(args, v)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(p.cols)), ", ")
+		q = q.Where(fmt.Sprintf("(%s) %s (%s)", strings.Join(idents, ", "), cmp, placeholders), args...)
+	}
+	for _, f := range p.cols {
+		q = q.OrderExpr("?TableAlias.? "+dir, bun.Ident(f.Name))
+	}
+	q = q.Limit(p.params.PerPage + 1)
+	if p.cursor == nil {
+		q = q.Offset(p.params.PerPage * (p.params.Page - 1))
+	}
+	return q
+}
+
+// Slice orders and limits rows held in memory the way Apply does a query,
+// the extra row included.
+func (p *Page[T]) Slice(rows []T) []T {
+	cols := p.cols
+	if f, ok := p.table.FieldMap[p.params.SortBy]; ok && len(cols) == 0 {
+		cols = []*schema.Field{f}
+	}
+	desc := strings.EqualFold(p.params.SortDir, "desc")
+	if p.cursor != nil && p.cursor.Backward {
+		desc = !desc
+	}
+	key := func(row *T) []reflect.Value {
+		v := reflect.ValueOf(row).Elem()
+		k := make([]reflect.Value, len(cols))
+		for i, f := range cols {
+			k[i] = f.Value(v)
+		}
+		return k
+	}
+	compare := func(a, b []reflect.Value) int {
+		for i := range a {
+			if c := CompareValues(a[i], b[i]); c != 0 {
+				if desc {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	}
+	slices.SortStableFunc(rows, func(a, b T) int { return compare(key(&a), key(&b)) })
+
+	start := 0
+	if p.cursor != nil {
+		after := make([]reflect.Value, len(cols))
+		for i, f := range cols {
+			v, err := ParseValue(f.IndirectType, p.cursor.Values[i])
+			if err != nil {
+				return nil
+			}
+			after[i] = v
+		}
+		for start < len(rows) && compare(key(&rows[start]), after) <= 0 {
+			start++
+		}
+	} else {
+		start = min(p.params.PerPage*(p.params.Page-1), len(rows))
+	}
+	rows = rows[start:]
+	return rows[:min(len(rows), p.params.PerPage+1)]
+}
+
+// Trim drops the look-ahead row, restores the requested order and returns
+// the cursors of the neighbouring pages.
+func (p *Page[T]) Trim(rows []T) ([]T, PageCursors) {
+	cursors := PageCursors{}
+	more := len(rows) > p.params.PerPage
+	if more {
+		rows = rows[:p.params.PerPage]
+	}
+	backward := p.cursor != nil && p.cursor.Backward
+	if backward {
+		slices.Reverse(rows)
+	}
+	if len(p.cols) == 0 || len(rows) == 0 {
+		return rows, cursors
+	}
+
+	if more || backward {
+		cursors.NextCursor = p.encode(rows[len(rows)-1], false)
+	}
+	if (backward && more) || (!backward && (p.cursor != nil || p.params.Page > 1)) {
+		cursors.PrevCursor = p.encode(rows[0], true)
+	}
+	return rows, cursors
+}
+
+func (p *Page[T]) encode(row T, backward bool) *string {
+	v := reflect.ValueOf(&row).Elem()
+	c := cursor{SortBy: p.params.SortBy, SortDir: p.params.SortDir, Backward: backward}
+	for _, f := range p.cols {
+		fv := reflect.Indirect(f.Value(v))
+		switch val := fv.Interface().(type) {
+		case time.Time:
+			c.Values = append(c.Values, val.UTC().Format(time.RFC3339Nano))
+		default:
+			c.Values = append(c.Values, fmt.Sprint(val))
+		}
+	}
+	return encodeCursor(c)
+}
+
+// CompareValues orders two values of a column the way Postgres does, NULLs
+// after everything else.
+func CompareValues(a, b reflect.Value) int {
+	an, bn := isNull(a), isNull(b)
+	switch {
+	case an && bn:
+		return 0
+	case an:
+		return 1
+	case bn:
+		return -1
+	}
+	a, b = reflect.Indirect(a), reflect.Indirect(b)
+	if t, ok := a.Interface().(time.Time); ok {
+		if u, ok := b.Interface().(time.Time); ok {
+			return t.Compare(u)
+		}
+	}
+	switch {
+	case a.CanInt() && b.CanInt():
+		return cmp.Compare(a.Int(), b.Int())
+	case a.CanUint() && b.CanUint():
+		return cmp.Compare(a.Uint(), b.Uint())
+	case a.CanFloat() && b.CanFloat():
+		return cmp.Compare(a.Float(), b.Float())
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return cmp.Compare(fmt.Sprint(a.Bool()), fmt.Sprint(b.Bool()))
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func isNull(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// ParseValue parses s, as sent in a cursor or a filter, into a value of typ.
+func ParseValue(typ reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(typ).Elem()
+	if typ == reflect.TypeFor[time.Time]() {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", time.DateOnly} {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return v, nil
+			}
+		}
+		return v, fmt.Errorf("%q is not a time", s)
+	}
+	// types reading themselves from text, such as money.Amount
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return v, u.UnmarshalText([]byte(s))
+	}
+	switch {
+	case typ.Kind() == reflect.String:
+		v.SetString(s)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(n)
+	case typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	default:
+		return v, fmt.Errorf("can't compare %s values", typ)
+	}
+	return v, nil
+}
@@ -22,8 +22,8 @@ type CreateParentResBody struct {
 type UpdateParentReq struct {
 	AuthHeader
 	Body struct {
-		ID     string  `json:"id" doc:"ID of the parent" required:"true"`
-		UserID *string `json:"user_id" doc:"User ID to link the parent to" required:"false"`
+		ID     string           `json:"id" doc:"ID of the parent" required:"true"`
+		UserID Optional[string] `json:"user_id" doc:"User ID to link the parent to" required:"false"`
 	}
 }
 type UpdateParentRes struct{ Body UpdateParentResBody }
@@ -59,11 +59,13 @@ type DeleteParentRes struct {
 type ListParentsReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListParentsResBody struct {
 	Parents   []ParentModelRes `json:"parents"`
-	Total     int              `json:"total"`
-	ListQuery ListQuery        `json:"query"`
+	Total     int              `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes     `json:"query"`
+	PageCursors
 }
 type ListParentsRes struct {
 	Body ListParentsResBody
@@ -75,5 +77,6 @@ type ParentModelRes struct {
 	Students  []GetStudentResBody `json:"students,omitempty"`
 	CreatedAt int                 `json:"created_at"`
 	UpdatedAt int                 `json:"updated_at"`
+	Relevance *float64            `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
 	UserModelRes
 }
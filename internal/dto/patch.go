@@ -0,0 +1,143 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Optional is a merge patch field (RFC 7396) that can be left out but never
+// cleared, for NOT NULL columns. An explicit null is rejected with a 422.
+type Optional[T any] struct {
+	Sent  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		return errors.New("field can't be null, leave it out to keep its value")
+	}
+	o.Sent = true
+	return json.Unmarshal(b, &o.Value)
+}
+
+func (o Optional[T]) Schema(r huma.Registry) *huma.Schema {
+	return huma.SchemaFromType(r, reflect.TypeOf(o.Value))
+}
+
+// Nullable is a merge patch field (RFC 7396) that tells a left out field from
+// an explicit null, which clears the column.
+type Nullable[T any] struct {
+	Sent  bool
+	Null  bool
+	Value T
+}
+
+func (o *Nullable[T]) UnmarshalJSON(b []byte) error {
+	o.Sent = true
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &o.Value)
+}
+
+func (o Nullable[T]) Schema(r huma.Registry) *huma.Schema {
+	s := *huma.SchemaFromType(r, reflect.TypeOf(o.Value))
+	s.Nullable = true
+	return &s
+}
+
+// Patch collects the columns a merge patch changes, so the update writes
+// exactly those, cleared ones included.
+type Patch struct {
+	Columns []string
+}
+
+// Empty reports whether the patch changes nothing.
+func (p *Patch) Empty() bool {
+	return len(p.Columns) == 0
+}
+
+// Has reports whether the patch changes column.
+func (p *Patch) Has(column string) bool {
+	for _, c := range p.Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchValue copies a sent field into dst.
+func PatchValue[T any](p *Patch, column string, f Optional[T], dst *T) {
+	if !f.Sent {
+		return
+	}
+	*dst = f.Value
+	p.Columns = append(p.Columns, column)
+}
+
+// PatchValuePtr copies a sent field into the pointer column dst.
+func PatchValuePtr[T any](p *Patch, column string, f Optional[T], dst **T) {
+	if !f.Sent {
+		return
+	}
+	v := f.Value
+	*dst = &v
+	p.Columns = append(p.Columns, column)
+}
+
+// PatchPtr copies a sent field into dst, nil when cleared.
+func PatchPtr[T any](p *Patch, column string, f Nullable[T], dst **T) {
+	if !f.Sent {
+		return
+	}
+	*dst = nil
+	if !f.Null {
+		v := f.Value
+		*dst = &v
+	}
+	p.Columns = append(p.Columns, column)
+}
+
+// PatchZero copies a sent field into dst, the zero value when cleared. The
+// model field must be nullzero for the column to become NULL.
+func PatchZero[T any](p *Patch, column string, f Nullable[T], dst *T) {
+	if !f.Sent {
+		return
+	}
+	var zero T
+	*dst = zero
+	if !f.Null {
+		*dst = f.Value
+	}
+	p.Columns = append(p.Columns, column)
+}
+
+// MergePatch applies an RFC 7396 merge patch to a decoded JSON document:
+// objects are merged recursively, null members are removed and anything else
+// replaces the target.
+func MergePatch(target any, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	merged := map[string]any{}
+	if t, ok := target.(map[string]any); ok {
+		for k, v := range t {
+			merged[k] = v
+		}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = MergePatch(merged[k], v)
+	}
+	return merged
+}
@@ -0,0 +1,80 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type CreatePayRateReq struct {
+	AuthHeader
+	Body struct {
+		TeacherID  *string      `json:"teacher_id,omitempty" doc:"Teacher paid the rate, every teacher of group_id by default. Set this, group_id or both" required:"false"`
+		GroupID    *string      `json:"group_id,omitempty" doc:"Group the rate is paid for, every group of teacher_id by default" required:"false"`
+		Basis      string       `json:"basis" doc:"session pays the rate per session taught, hour per hour taught" enum:"session,hour" required:"true"`
+		Rate       money.Amount `json:"rate" doc:"Amount paid per session or per hour" required:"true"`
+		ValidFrom  *string      `json:"valid_from,omitempty" doc:"First day the rate applies, always by default" format:"date" required:"false"`
+		ValidUntil *string      `json:"valid_until,omitempty" doc:"Last day the rate applies, forever by default" format:"date" required:"false"`
+	}
+}
+
+type CreatePayRateRes struct{ Body PayRateModelRes }
+
+type UpdatePayRateReq struct {
+	AuthHeader
+	Body struct {
+		ID         string                 `json:"id" doc:"ID of the rate" required:"true"`
+		Basis      Optional[string]       `json:"basis" doc:"session or hour" enum:"session,hour" required:"false"`
+		Rate       Optional[money.Amount] `json:"rate" doc:"Amount paid per session or per hour" required:"false"`
+		ValidFrom  Nullable[string]       `json:"valid_from" doc:"First day the rate applies, null for always" format:"date" required:"false"`
+		ValidUntil Nullable[string]       `json:"valid_until" doc:"Last day the rate applies, null for forever" format:"date" required:"false"`
+	}
+}
+
+type UpdatePayRateRes struct{ Body PayRateModelRes }
+
+type GetPayRateByIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the rate" required:"true"`
+}
+
+type GetPayRateByIDRes struct{ Body PayRateModelRes }
+
+type DeletePayRateReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the rate" required:"true"`
+}
+
+type DeletePayRateResBody struct {
+	ID string `json:"id"`
+}
+
+type DeletePayRateRes struct {
+	Body DeletePayRateResBody
+}
+
+type ListPayRatesReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListPayRatesResBody struct {
+	Rates     []PayRateModelRes `json:"rates"`
+	Total     int               `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes      `json:"query"`
+	PageCursors
+}
+
+type ListPayRatesRes struct {
+	Body ListPayRatesResBody
+}
+
+type PayRateModelRes struct {
+	ID         string       `json:"id"`
+	TeacherID  *string      `json:"teacher_id"`
+	GroupID    *string      `json:"group_id"`
+	Basis      string       `json:"basis" enum:"session,hour"`
+	Rate       money.Amount `json:"rate"`
+	ValidFrom  *string      `json:"valid_from"`
+	ValidUntil *string      `json:"valid_until"`
+	Relevance  *float64     `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt  int          `json:"created_at"`
+	UpdatedAt  int          `json:"updated_at"`
+}
@@ -0,0 +1,139 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+)
+
+type CreatePaymentReq struct {
+	AuthHeader
+	IdempotencyHeader
+	Body struct {
+		StudentID  string       `json:"student_id" doc:"Student the payment is for" required:"true"`
+		InvoiceID  *string      `json:"invoice_id,omitempty" doc:"Issued invoice of the student the payment is for, the oldest open invoices of the student by default" required:"false"`
+		Method     string       `json:"method" doc:"How the payment was made" enum:"cash,card,transfer,cheque" required:"true"`
+		Amount     money.Amount `json:"amount" doc:"Amount received, what the invoices don't need becomes credit of the student" required:"true"`
+		Reference  *string      `json:"reference,omitempty" doc:"Cheque number, transfer or card transaction reference" maxLength:"100" required:"false"`
+		ReceivedAt *time.Time   `json:"received_at,omitempty" doc:"When the money was received, now by default" required:"false"`
+	}
+}
+
+type CreatePaymentRes struct{ Body PaymentModelRes }
+
+type GetPaymentByIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the payment" required:"true"`
+}
+
+type GetPaymentByIDRes struct{ Body PaymentModelRes }
+
+type ListPaymentsReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListPaymentsResBody struct {
+	Payments  []PaymentModelRes `json:"payments"`
+	Total     int               `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes      `json:"query"`
+	PageCursors
+}
+
+type ListPaymentsRes struct {
+	Body ListPaymentsResBody
+}
+
+type GetPaymentsByStudentIDReq struct {
+	AuthHeader
+	StudentID string `path:"student_id" doc:"Student ID" required:"true"`
+	ListQuery
+}
+
+type GetPaymentsByStudentIDRes struct {
+	Body ListPaymentsResBody
+}
+
+type PaymentModelRes struct {
+	ID          string                 `json:"id"`
+	StudentID   string                 `json:"student_id"`
+	InvoiceID   *string                `json:"invoice_id" doc:"Invoice the payment was made for, null when it paid the oldest open invoices"`
+	Method      string                 `json:"method" enum:"cash,card,transfer,cheque,online" doc:"How the payment was made, online payments are recorded by checkout sessions"`
+	Currency    string                 `json:"currency" doc:"ISO 4217 code of the amount"`
+	Amount      money.Amount           `json:"amount"`
+	Reference   *string                `json:"reference,omitempty"`
+	ReceivedAt  int                    `json:"received_at"`
+	RecordedBy  *string                `json:"recorded_by,omitempty" doc:"User who recorded the payment"`
+	Allocations []PaymentAllocationRes `json:"allocations,omitempty" doc:"Invoices the payment paid, only sent for a single payment"`
+	Credited    *money.Amount          `json:"credited,omitempty" doc:"Part of the amount kept as credit of the student, only sent for a single payment"`
+	Relevance   *float64               `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt   int                    `json:"created_at"`
+	UpdatedAt   int                    `json:"updated_at"`
+}
+
+type PaymentAllocationRes struct {
+	InvoiceID string       `json:"invoice_id"`
+	Amount    money.Amount `json:"amount"`
+}
+
+type GetStudentBalanceReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the student" required:"true"`
+}
+
+type GetStudentBalanceRes struct{ Body StudentBalanceRes }
+
+type StudentBalanceRes struct {
+	StudentID string       `json:"student_id"`
+	Owed      money.Amount `json:"owed" doc:"Left to pay on issued invoices"`
+	Credit    money.Amount `json:"credit" doc:"Paid beyond what was owed, used by the next invoices issued"`
+	Balance   money.Amount `json:"balance" doc:"owed minus credit, negative when the student is in credit"`
+	Currency  string       `json:"currency" doc:"ISO 4217 code of the amounts"`
+}
+
+type GetFamilyBalanceReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the parent" required:"true"`
+}
+
+type GetFamilyBalanceRes struct{ Body FamilyBalanceRes }
+
+type FamilyBalanceRes struct {
+	ParentID string              `json:"parent_id"`
+	Owed     money.Amount        `json:"owed" doc:"Sum of what the students owe"`
+	Credit   money.Amount        `json:"credit" doc:"Sum of the credit of the students"`
+	Balance  money.Amount        `json:"balance" doc:"owed minus credit"`
+	Currency string              `json:"currency" doc:"ISO 4217 code of the amounts"`
+	Students []StudentBalanceRes `json:"students" doc:"Balance of every student linked to the parent"`
+}
+
+type ListLedgerEntriesReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListLedgerEntriesResBody struct {
+	Entries   []LedgerEntryRes `json:"entries"`
+	Total     int              `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes     `json:"query"`
+	PageCursors
+}
+
+type ListLedgerEntriesRes struct {
+	Body ListLedgerEntriesResBody
+}
+
+type LedgerEntryRes struct {
+	ID        string       `json:"id"`
+	TxnID     string       `json:"txn_id" doc:"Transaction the entry belongs to, whose debits equal its credits"`
+	Account   string       `json:"account" enum:"receivable,credit,revenue,cash,card,transfer,cheque,online"`
+	StudentID *string      `json:"student_id"`
+	InvoiceID *string      `json:"invoice_id"`
+	PaymentID *string      `json:"payment_id"`
+	Debit     money.Amount `json:"debit"`
+	Credit    money.Amount `json:"credit"`
+	Memo      string       `json:"memo"`
+	CreatedAt int          `json:"created_at"`
+}
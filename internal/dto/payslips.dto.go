@@ -0,0 +1,114 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type RunPayrollReq struct {
+	AuthHeader
+	IdempotencyHeader
+	Body struct {
+		PeriodStart string   `json:"period_start" doc:"First day of the period paid" format:"date" required:"true"`
+		PeriodEnd   string   `json:"period_end" doc:"Last day of the period paid" format:"date" required:"true"`
+		TeacherIDs  []string `json:"teacher_ids,omitempty" doc:"Only pay these teachers, every teacher who taught in the period by default" maxItems:"1000" required:"false"`
+	}
+}
+
+type RunPayrollResBody struct {
+	PayslipIDs []string            `json:"payslip_ids" doc:"Draft payslips created or worked out again, one per teacher paid"`
+	Created    int                 `json:"created"`
+	Updated    int                 `json:"updated" doc:"Draft payslips of the period worked out again"`
+	Skipped    int                 `json:"skipped" doc:"Teachers whose payslip for the period is locked"`
+	Unrated    []UnratedSessionRes `json:"unrated" doc:"Sessions taught that no pay rate covers, left off the payslips"`
+}
+
+// UnratedSessionRes is a session no pay rate covers
+type UnratedSessionRes struct {
+	SessionID string `json:"session_id"`
+	TeacherID string `json:"teacher_id"`
+	GroupID   string `json:"group_id"`
+	Starts    int    `json:"starts"`
+}
+
+type RunPayrollRes struct{ Body RunPayrollResBody }
+
+type GetPayslipByIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the payslip" required:"true"`
+}
+
+type GetPayslipByIDRes struct{ Body PayslipModelRes }
+
+type AddPayslipAdjustmentReq struct {
+	AuthHeader
+	ID   string `path:"id" doc:"ID of the payslip" required:"true"`
+	Body struct {
+		Description string       `json:"description" doc:"What the adjustment is for, shown on the payslip" minLength:"1" maxLength:"500" required:"true"`
+		Amount      money.Amount `json:"amount" doc:"Amount added to the payslip, negative for a deduction" required:"true"`
+	}
+}
+
+type AddPayslipAdjustmentRes struct{ Body PayslipModelRes }
+
+type RemovePayslipAdjustmentReq struct {
+	AuthHeader
+	ID     string `path:"id" doc:"ID of the payslip" required:"true"`
+	LineID string `path:"line_id" doc:"ID of the adjustment line" required:"true"`
+}
+
+type RemovePayslipAdjustmentRes struct{ Body PayslipModelRes }
+
+type LockPayslipReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the payslip" required:"true"`
+}
+
+type LockPayslipRes struct{ Body PayslipModelRes }
+
+type ListPayslipsReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListPayslipsResBody struct {
+	Payslips  []PayslipModelRes `json:"payslips"`
+	Total     int               `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes      `json:"query"`
+	PageCursors
+}
+
+type ListPayslipsRes struct {
+	Body ListPayslipsResBody
+}
+
+type PayslipModelRes struct {
+	ID          string           `json:"id"`
+	TeacherID   string           `json:"teacher_id"`
+	PeriodStart string           `json:"period_start" format:"date"`
+	PeriodEnd   string           `json:"period_end" format:"date"`
+	Status      string           `json:"status" enum:"draft,locked"`
+	Currency    string           `json:"currency" doc:"ISO 4217 code of the amounts"`
+	Sessions    int              `json:"sessions" doc:"Sessions taught and paid"`
+	Minutes     int              `json:"minutes" doc:"Minutes taught in those sessions"`
+	Gross       money.Amount     `json:"gross" doc:"Paid for the sessions"`
+	Adjusted    money.Amount     `json:"adjusted" doc:"Sum of the adjustments"`
+	Total       money.Amount     `json:"total" doc:"gross plus adjusted"`
+	Lines       []PayslipLineRes `json:"lines,omitempty" doc:"Line items, only sent for a single payslip"`
+	LockedAt    *int             `json:"locked_at,omitempty"`
+	Relevance   *float64         `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt   int              `json:"created_at"`
+	UpdatedAt   int              `json:"updated_at"`
+}
+
+type PayslipLineRes struct {
+	ID          string        `json:"id"`
+	Kind        string        `json:"kind" enum:"session,adjustment"`
+	SessionID   *string       `json:"session_id"`
+	GroupID     *string       `json:"group_id"`
+	PayRateID   *string       `json:"pay_rate_id" doc:"Rate the session was paid at"`
+	Description string        `json:"description"`
+	Starts      *int          `json:"starts" doc:"When the session started"`
+	Minutes     *int          `json:"minutes" doc:"Length of the session"`
+	Basis       *string       `json:"basis" enum:"session,hour"`
+	Rate        *money.Amount `json:"rate"`
+	Amount      money.Amount  `json:"amount"`
+}
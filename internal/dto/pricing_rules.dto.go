@@ -0,0 +1,99 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type CreatePricingRuleReq struct {
+	AuthHeader
+	Body struct {
+		Name        string        `json:"name" doc:"Name of the rule, shown in the breakdown of prices" minLength:"1" maxLength:"200" required:"true"`
+		Kind        string        `json:"kind" doc:"scholarship for one student, sibling for the younger enrolled children of a family, discount for every student" enum:"scholarship,sibling,discount" required:"true"`
+		Percent     *int          `json:"percent,omitempty" doc:"Percentage taken off the fee, set either this or amount" minimum:"1" maximum:"100" required:"false"`
+		Amount      *money.Amount `json:"amount,omitempty" doc:"Amount taken off the monthly fee, set either this or percent" required:"false"`
+		GroupID     *string       `json:"group_id,omitempty" doc:"Only apply to enrollments in this group, every group by default" required:"false"`
+		StudentID   *string       `json:"student_id,omitempty" doc:"Student of a scholarship, required for scholarships only" required:"false"`
+		SiblingRank *int          `json:"sibling_rank,omitempty" doc:"Child of a family the sibling rule starts at, 2 for the second child enrolled, required for sibling rules only" minimum:"2" required:"false"`
+		ValidFrom   *string       `json:"valid_from,omitempty" doc:"First day the rule applies, always by default" format:"date" required:"false"`
+		ValidUntil  *string       `json:"valid_until,omitempty" doc:"Last day the rule applies, forever by default" format:"date" required:"false"`
+	}
+}
+
+type CreatePricingRuleRes struct{ Body PricingRuleModelRes }
+
+type UpdatePricingRuleReq struct {
+	AuthHeader
+	Body struct {
+		ID          string                 `json:"id" doc:"ID of the rule" required:"true"`
+		Name        Optional[string]       `json:"name" doc:"Name of the rule" minLength:"1" maxLength:"200" required:"false"`
+		Percent     Nullable[int]          `json:"percent" doc:"Percentage taken off the fee, null when the rule takes an amount" minimum:"1" maximum:"100" required:"false"`
+		Amount      Nullable[money.Amount] `json:"amount" doc:"Amount taken off the monthly fee, null when the rule takes a percentage" required:"false"`
+		GroupID     Nullable[string]       `json:"group_id" doc:"Only apply to enrollments in this group, null for every group" required:"false"`
+		StudentID   Optional[string]       `json:"student_id" doc:"Student of a scholarship" required:"false"`
+		SiblingRank Optional[int]          `json:"sibling_rank" doc:"Child of a family the sibling rule starts at" minimum:"2" required:"false"`
+		ValidFrom   Nullable[string]       `json:"valid_from" doc:"First day the rule applies, null for always" format:"date" required:"false"`
+		ValidUntil  Nullable[string]       `json:"valid_until" doc:"Last day the rule applies, null for forever" format:"date" required:"false"`
+	}
+}
+
+type UpdatePricingRuleRes struct{ Body PricingRuleModelRes }
+
+type GetPricingRuleByIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the rule" required:"true"`
+}
+
+type GetPricingRuleByIDRes struct{ Body PricingRuleModelRes }
+
+type DeletePricingRuleReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the rule" required:"true"`
+}
+
+type DeletePricingRuleResBody struct {
+	ID string `json:"id"`
+}
+
+type DeletePricingRuleRes struct {
+	Body DeletePricingRuleResBody
+}
+
+type ListPricingRulesReq struct {
+	AuthHeader
+	ListQuery
+	ExportParams
+}
+
+type ListPricingRulesResBody struct {
+	Rules     []PricingRuleModelRes `json:"rules"`
+	Total     int                   `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery ListQueryRes          `json:"query"`
+	PageCursors
+}
+
+type ListPricingRulesRes struct {
+	Body ListPricingRulesResBody
+}
+
+type PricingRuleModelRes struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Kind        string        `json:"kind" enum:"scholarship,sibling,discount"`
+	Percent     *int          `json:"percent"`
+	Amount      *money.Amount `json:"amount"`
+	GroupID     *string       `json:"group_id"`
+	StudentID   *string       `json:"student_id"`
+	SiblingRank *int          `json:"sibling_rank"`
+	ValidFrom   *string       `json:"valid_from"`
+	ValidUntil  *string       `json:"valid_until"`
+	Relevance   *float64      `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt   int           `json:"created_at"`
+	UpdatedAt   int           `json:"updated_at"`
+}
+
+// PriceAdjustmentRes is what a pricing rule took off a fee
+type PriceAdjustmentRes struct {
+	RuleID  string       `json:"rule_id"`
+	Name    string       `json:"name"`
+	Kind    string       `json:"kind" enum:"scholarship,sibling,discount"`
+	Percent *int         `json:"percent,omitempty" doc:"Percentage of the rule, taken off what the previous rules left"`
+	Amount  money.Amount `json:"amount" doc:"Amount taken off"`
+}
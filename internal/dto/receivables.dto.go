@@ -0,0 +1,98 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+type GetReceivablesAgingReq struct {
+	AuthHeader
+	AsOf string `query:"as_of" doc:"Day the receivables are aged at, today by default" format:"date" required:"false"`
+}
+
+type GetReceivablesAgingRes struct{ Body ReceivablesAgingResBody }
+
+type ReceivablesAgingResBody struct {
+	AsOf     string           `json:"as_of" format:"date"`
+	Currency string           `json:"currency" doc:"ISO 4217 code of the amounts"`
+	Totals   AgingBucketsRes  `json:"totals" doc:"What every family owes, by days past due"`
+	Families []FamilyAgingRes `json:"families" doc:"Families owing anything, the largest balance past due first"`
+}
+
+// AgingBucketsRes splits what is left to pay on issued invoices by how many
+// days past their due date they are
+type AgingBucketsRes struct {
+	Current    money.Amount `json:"current" doc:"Not due yet"`
+	Days0To30  money.Amount `json:"days_0_30" doc:"Due up to 30 days ago, today included"`
+	Days31To60 money.Amount `json:"days_31_60"`
+	Days61To90 money.Amount `json:"days_61_90"`
+	Days90Plus money.Amount `json:"days_90_plus" doc:"Due more than 90 days ago"`
+	Total      money.Amount `json:"total"`
+}
+
+type FamilyAgingRes struct {
+	StudentIDs []string        `json:"student_ids" doc:"Students sharing a parent"`
+	ParentIDs  []string        `json:"parent_ids"`
+	Buckets    AgingBucketsRes `json:"buckets"`
+}
+
+type RunRemindersReq struct {
+	AuthHeader
+	DryRun bool `query:"dry_run" doc:"Report the overdue invoices, reminders and late fees without sending or charging anything" required:"false"`
+}
+
+type RunRemindersRes struct{ Body RemindersRunResBody }
+
+type RemindersRunResBody struct {
+	AsOf     string             `json:"as_of" format:"date"`
+	DryRun   bool               `json:"dry_run"`
+	Sent     int                `json:"sent" doc:"Reminders sent"`
+	Failed   int                `json:"failed" doc:"Reminders the notification channel couldn't send, sent again by the next run"`
+	LateFees int                `json:"late_fees" doc:"Invoices charged a late fee"`
+	Families []OverdueFamilyRes `json:"families" doc:"Families with overdue invoices"`
+}
+
+type OverdueFamilyRes struct {
+	StudentIDs []string            `json:"student_ids"`
+	ParentIDs  []string            `json:"parent_ids"`
+	Overdue    money.Amount        `json:"overdue" doc:"Left to pay on the overdue invoices of the family"`
+	Level      int                 `json:"level" doc:"Highest level of reminder the invoices reached"`
+	Recipients []string            `json:"recipients" doc:"Users reminded by this run, the parents or the students without any"`
+	Error      *string             `json:"error,omitempty" doc:"Why the reminder couldn't be sent"`
+	Invoices   []OverdueInvoiceRes `json:"invoices"`
+}
+
+type OverdueInvoiceRes struct {
+	InvoiceID        string        `json:"invoice_id"`
+	Number           string        `json:"number"`
+	StudentID        string        `json:"student_id"`
+	DueDate          string        `json:"due_date" format:"date"`
+	DaysOverdue      int           `json:"days_overdue"`
+	AmountDue        money.Amount  `json:"amount_due"`
+	Level            int           `json:"level" doc:"Level of reminder reached, 0 before the first"`
+	Reminded         bool          `json:"reminded" doc:"Whether this run reminded the family of the invoice"`
+	LateFee          *money.Amount `json:"late_fee,omitempty" doc:"Late fee charged by this run"`
+	LateFeeInvoiceID *string       `json:"late_fee_invoice_id,omitempty" doc:"Invoice billing the late fee of the invoice"`
+}
+
+type GetRemindersByInvoiceIDReq struct {
+	AuthHeader
+	ID string `path:"id" doc:"ID of the invoice" required:"true"`
+}
+
+type GetRemindersByInvoiceIDRes struct {
+	Body struct {
+		Reminders []ReminderRes `json:"reminders"`
+	}
+}
+
+type ReminderRes struct {
+	ID          string       `json:"id"`
+	InvoiceID   string       `json:"invoice_id"`
+	StudentID   string       `json:"student_id"`
+	Level       int          `json:"level"`
+	DaysOverdue int          `json:"days_overdue"`
+	AmountDue   money.Amount `json:"amount_due"`
+	Recipients  []string     `json:"recipients" doc:"Users the reminder was sent to"`
+	Status      string       `json:"status" enum:"sent,failed"`
+	Error       *string      `json:"error,omitempty"`
+	CreatedAt   int          `json:"created_at"`
+	UpdatedAt   int          `json:"updated_at"`
+}
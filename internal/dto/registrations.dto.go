@@ -0,0 +1,41 @@
+package dto
+
+import "github.com/ICan-TC/users/internal/money"
+
+// RegisterStudentReq creates a student with their user, links their parents
+// and enrolls them in groups, all at once
+type RegisterStudentReq struct {
+	AuthHeader
+	IdempotencyHeader
+	Body struct {
+		Student     RegistrationStudent      `json:"student" doc:"The student and the user account to create for them" required:"true"`
+		Parents     []RegistrationParent     `json:"parents,omitempty" doc:"Parents of the student, existing or to create" required:"false"`
+		Enrollments []RegistrationEnrollment `json:"enrollments,omitempty" doc:"Groups to enroll the student in" required:"false"`
+	}
+}
+
+type RegistrationStudent struct {
+	Level string `json:"level" doc:"Level of the student" required:"true"`
+	CreateUserReqBody
+}
+
+// RegistrationParent is either an existing parent, by ID, or a new one
+// created with its user
+type RegistrationParent struct {
+	ParentID *string            `json:"parent_id,omitempty" doc:"ID of an existing parent, leave out to create one from user" required:"false"`
+	User     *CreateUserReqBody `json:"user,omitempty" doc:"User account of a new parent, leave out when parent_id is set" required:"false"`
+}
+
+type RegistrationEnrollment struct {
+	GroupID string        `json:"group_id" doc:"Group ID to enroll in" required:"true"`
+	Fee     *money.Amount `json:"fee" doc:"Fee for the enrollment, defaults to group's default fee if not specified" required:"false"`
+}
+
+type RegisterStudentRes struct{ Body RegistrationResBody }
+
+// RegistrationResBody is everything the registration created or linked
+type RegistrationResBody struct {
+	Student     StudentsModelRes     `json:"student"`
+	Parents     []ParentModelRes     `json:"parents"`
+	Enrollments []EnrollmentModelRes `json:"enrollments"`
+}
@@ -0,0 +1,81 @@
+package dto
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Search columns of users, used by every entity joined to its user
+var (
+	UserSearchColumns       = UserSearchColumnsOf("?TableAlias")
+	JoinedUserSearchColumns = UserSearchColumnsOf(`"user"`)
+)
+
+// UserSearchColumnsOf are the search columns of the user behind alias, such
+// as "student__user" for the user joined through Student.User
+func UserSearchColumnsOf(alias string) []string {
+	return []string{
+		alias + ".username",
+		alias + ".email",
+		alias + ".first_name",
+		alias + ".family_name",
+		FullNameSearchColumn(alias),
+	}
+}
+
+// FullNameSearchColumn matches "first family" so a full name typed in one go
+// is found. It is indexed as written, so keep it in sync with migration 18.
+func FullNameSearchColumn(alias string) string {
+	return fmt.Sprintf("coalesce(%[1]s.first_name, '') || ' ' || coalesce(%[1]s.family_name, '')", alias)
+}
+
+// ApplySearch keeps the rows where any of the columns fuzzily matches term,
+// ignoring case and accents, and selects the best match as `relevance`
+// between 0 and 1. Columns are trusted SQL expressions.
+func ApplySearch(q *bun.SelectQuery, term string, columns ...string) *bun.SelectQuery {
+	term = strings.TrimSpace(term)
+	if term == "" || len(columns) == 0 {
+		return q
+	}
+	e := NewSearchExpr(term, columns...)
+	return q.
+		ColumnExpr("?TableAlias.*").
+		ColumnExpr(e.Score+" AS relevance", e.ScoreArgs...).
+		Where(e.Cond, e.CondArgs...)
+}
+
+// SearchExpr holds the SQL built by NewSearchExpr, for queries that can't go
+// through ApplySearch.
+type SearchExpr struct {
+	Cond      string
+	CondArgs  []any
+	Score     string
+	ScoreArgs []any
+}
+
+// NewSearchExpr builds the match condition and relevance score of term
+// against the columns.
+func NewSearchExpr(term string, columns ...string) SearchExpr {
+	conds := make([]string, 0, len(columns))
+	scores := make([]string, 0, len(columns))
+	e := SearchExpr{}
+	for _, c := range columns {
+		// <% is the trigram word similarity operator, LIKE keeps plain substring matches
+		conds = append(conds, fmt.Sprintf(
+			`search_normalize(?) <%% search_normalize(%[1]s) OR search_normalize(%[1]s) LIKE '%%' || search_normalize(?) || '%%' ESCAPE '\'`, c))
+		e.CondArgs = append(e.CondArgs, term, escapeLike(term))
+		scores = append(scores, fmt.Sprintf("word_similarity(search_normalize(?), search_normalize(%s))", c))
+		e.ScoreArgs = append(e.ScoreArgs, term)
+	}
+	e.Cond = "(" + strings.Join(conds, " OR ") + ")"
+	e.Score = fmt.Sprintf("GREATEST(%s)", strings.Join(scores, ", "))
+	return e
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern in s, so that % and _
+// typed in a search match themselves
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
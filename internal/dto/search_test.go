@@ -0,0 +1,28 @@
+package dto
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		term, want string
+	}{
+		{term: "mehdi", want: "mehdi"},
+		{term: "100%", want: `100\%`},
+		{term: "first_name", want: `first\_name`},
+		{term: `a\b`, want: `a\\b`},
+		{term: `%_\`, want: `\%\_\\`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.term); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestNewSearchExprEscapesSubstrings(t *testing.T) {
+	e := NewSearchExpr("50%_off", "?TableAlias.name")
+	// the similarity operator takes the term as typed, LIKE its escaped form
+	if len(e.CondArgs) != 2 || e.CondArgs[0] != "50%_off" || e.CondArgs[1] != `50\%\_off` {
+		t.Fatalf("condition args %q", e.CondArgs)
+	}
+}
@@ -42,10 +42,11 @@ type GetStudentParentReq struct {
 type GetStudentParentRes struct{ Body GetStudentParentResBody }
 
 type GetStudentParentResBody struct {
-	StudentID string `json:"student_id"`
-	ParentID  string `json:"parent_id"`
-	CreatedAt int    `json:"created_at"`
-	UpdatedAt int    `json:"updated_at"`
+	StudentID string   `json:"student_id"`
+	ParentID  string   `json:"parent_id"`
+	Relevance *float64 `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt int      `json:"created_at"`
+	UpdatedAt int      `json:"updated_at"`
 }
 
 type DeleteStudentParentReq struct {
@@ -64,11 +65,13 @@ type DeleteStudentParentRes struct {
 type ListStudentParentsReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListStudentParentsResBody struct {
 	StudentParents []GetStudentParentResBody `json:"student_parents"`
-	Total          int                       `json:"total"`
-	ListQuery      ListQuery                 `json:"query"`
+	Total          int                       `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
+	ListQuery      ListQueryRes              `json:"query"`
+	PageCursors
 }
 type ListStudentParentsRes struct {
 	Body ListStudentParentsResBody
@@ -1,5 +1,7 @@
 package dto
 
+import "github.com/danielgtaylor/huma/v2/conditional"
+
 // CreateStudentReq defines the request for creating a student
 // Follows the pattern of CreateUserReq
 // Level is required, UserID is optional (for linking to a user)
@@ -25,13 +27,17 @@ type CreateStudentResBody struct {
 // Follows UpdateUserReq pattern
 type UpdateStudentReq struct {
 	AuthHeader
+	conditional.Params
 	Body struct {
-		ID     string  `json:"id" doc:"ID of the student" required:"true"`
-		Level  *string `json:"level" doc:"Level of the student" required:"false"`
-		UserID *string `json:"user_id" doc:"User ID to link the student to" required:"false"`
+		ID     string           `json:"id" doc:"ID of the student" required:"true"`
+		Level  Optional[string] `json:"level" doc:"Level of the student" required:"false"`
+		UserID Optional[string] `json:"user_id" doc:"User ID to link the student to" required:"false"`
 	}
 }
-type UpdateStudentRes struct{ Body UpdateStudentResBody }
+type UpdateStudentRes struct {
+	ETag string `header:"ETag"`
+	Body UpdateStudentResBody
+}
 type UpdateStudentResBody struct {
 	ID        string  `json:"id"`
 	Level     *string `json:"level"`
@@ -42,9 +48,13 @@ type UpdateStudentResBody struct {
 
 type GetStudentByIDReq struct {
 	AuthHeader
+	conditional.Params
 	ID string `path:"id" doc:"ID of the student" required:"true"`
 }
-type GetStudentByIDRes struct{ Body StudentsModelRes }
+type GetStudentByIDRes struct {
+	ETag string `header:"ETag"`
+	Body StudentsModelRes
+}
 
 type GetStudentResBody struct {
 	ID        string  `json:"id"`
@@ -56,6 +66,7 @@ type GetStudentResBody struct {
 
 type DeleteStudentReq struct {
 	AuthHeader
+	conditional.Params
 	ID string `path:"id" doc:"ID of the student" required:"true"`
 }
 type DeleteStudentResBody struct {
@@ -68,11 +79,13 @@ type DeleteStudentRes struct {
 type ListStudentsReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListStudentsResBody struct {
 	Students  []StudentsModelRes `json:"students"`
-	Total     int                `json:"total"`
+	Total     int                `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
 	ListQuery ListQueryRes       `json:"query"`
+	PageCursors
 }
 type ListStudentsRes struct {
 	Body ListStudentsResBody
@@ -80,10 +93,13 @@ type ListStudentsRes struct {
 
 // StudentsModelRes represents a student with embedded user information
 type StudentsModelRes struct {
-	ID        string  `json:"id"`
-	Level     *string `json:"level"`
-	UserID    *string `json:"user_id"`
-	CreatedAt int     `json:"created_at"`
-	UpdatedAt int     `json:"updated_at"`
+	ID        string   `json:"id"`
+	Level     *string  `json:"level"`
+	UserID    *string  `json:"user_id"`
+	CreatedAt int      `json:"created_at"`
+	UpdatedAt int      `json:"updated_at"`
+	Relevance *float64 `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	// ETag changes with the student and its user, sent as a header
+	ETag string `json:"-"`
 	UserModelRes
 }
@@ -24,8 +24,8 @@ type CreateTeacherResBody struct {
 type UpdateTeacherReq struct {
 	AuthHeader
 	Body struct {
-		ID     string  `json:"id" doc:"ID of the teacher" required:"true"`
-		UserID *string `json:"user_id" doc:"User ID to link the teacher to" required:"false"`
+		ID     string           `json:"id" doc:"ID of the teacher" required:"true"`
+		UserID Optional[string] `json:"user_id" doc:"User ID to link the teacher to" required:"false"`
 	}
 }
 type UpdateTeacherRes struct{ Body UpdateTeacherResBody }
@@ -63,11 +63,13 @@ type DeleteTeacherRes struct {
 type ListTeachersReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 type ListTeachersResBody struct {
 	Teachers  []TeachersModelRes `json:"teachers"`
-	Total     int                `json:"total"`
+	Total     int                `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
 	ListQuery ListQueryRes       `json:"query"`
+	PageCursors
 }
 type ListTeachersRes struct {
 	Body ListTeachersResBody
@@ -75,9 +77,10 @@ type ListTeachersRes struct {
 
 // TeachersModelRes represents a teacher with embedded user information
 type TeachersModelRes struct {
-	ID        string `json:"id"`
-	UserID    string `json:"user_id"`
-	CreatedAt int    `json:"created_at"`
-	UpdatedAt int    `json:"updated_at"`
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id"`
+	CreatedAt int      `json:"created_at"`
+	UpdatedAt int      `json:"updated_at"`
+	Relevance *float64 `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
 	UserModelRes
 }
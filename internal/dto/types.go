@@ -15,27 +15,45 @@ type ResponseType[T any] struct {
 type ListQuery struct {
 	Page     int    `query:"page" json:"page" doc:"Page number, starting from 1" default:"1" minimum:"1"`
 	PerPage  int    `query:"per_page" json:"per_page" doc:"Number of items per page" default:"10" minimum:"1" maximum:"200"`
-	SortBy   string `query:"sort_by" json:"sort_by" doc:"Sort by field" default:"created_at"`
+	SortBy   string `query:"sort_by" json:"sort_by" doc:"Sort by field, 'relevance' ranks search results by similarity" default:"created_at"`
 	SortDir  string `query:"sort_dir" json:"sort_dir" doc:"Sort direction, either 'asc' or 'desc'" enum:"asc,desc" default:"desc"`
 	Filters  string `query:"filters" json:"filters" doc:"Filters in JSON" default:"[]"`
-	Search   string `query:"search" json:"search" doc:"Search query" default:""`
+	Search   string `query:"search" json:"search" doc:"Search query, matched ignoring case, accents and small typos" default:""`
 	Includes string `query:"includes" json:"includes" doc:"Includes in JSON" default:"{}"`
+
+	Cursor    string `query:"cursor" json:"cursor" doc:"Opaque cursor from next_cursor or prev_cursor, page is ignored when set" default:""`
+	WithTotal bool   `query:"with_total" json:"with_total" doc:"Count the total number of matching items, total is -1 when false" default:"true"`
+}
+
+// ExportParams are taken by the list endpoints that can be exported, see
+// middleware.Exports
+type ExportParams struct {
+	Format  string `query:"format" doc:"Send every matching item as a csv or xlsx file instead of a page of json. Asking for text/csv or xlsx in the Accept header does the same" enum:"json,csv,xlsx" required:"false"`
+	Columns string `query:"columns" doc:"Columns of the csv or xlsx file, comma separated and in order, all of them by default" required:"false"`
 }
 
 type ListQueryRes struct {
 	Page     int      ` json:"page" doc:"Page number, starting from 1" default:"1" minimum:"1"`
 	PerPage  int      ` json:"per_page" doc:"Number of items per page" default:"10" minimum:"1" maximum:"200"`
-	SortBy   string   ` json:"sort_by" doc:"Sort by field" default:"created_at"`
+	SortBy   string   ` json:"sort_by" doc:"Sort by field, 'relevance' ranks search results by similarity" default:"created_at"`
 	SortDir  string   ` json:"sort_dir" doc:"Sort direction, either 'asc' or 'desc'" enum:"asc,desc" default:"desc"`
 	Filters  []Filter ` json:"filters" doc:"Filters in JSON" default:"[]"`
 	Search   string   ` json:"search" doc:"Search query" default:""`
 	Includes string   ` json:"includes" doc:"Includes in JSON" default:"{}"`
+
+	Cursor    string ` json:"cursor" doc:"Opaque cursor from next_cursor or prev_cursor, page is ignored when set" default:""`
+	WithTotal bool   ` json:"with_total" doc:"Count the total number of matching items, total is -1 when false" default:"true"`
 }
 
 type AuthHeader struct {
 	Authorization string `header:"Authorization" doc:"Bearer Token of the user" required:"true"`
 }
 
+// IdempotencyHeader documents the header handled by middleware.Idempotency
+type IdempotencyHeader struct {
+	IdempotencyKey string `header:"Idempotency-Key" doc:"Unique key making retries of this request return the first response instead of running it again" maxLength:"255" required:"false"`
+}
+
 type Filter struct {
 	Field string `json:"field" doc:"Field to filter by"`
 	Value string `json:"value" doc:"Value to filter by"`
@@ -48,6 +66,8 @@ func ParseFilters(filters string) ([]Filter, error) {
 	return f, err
 }
 
+// ApplyFilters keeps the rows matching every filter. Fields are trusted SQL
+// expressions, resources map the field names of requests to them.
 func ApplyFilters(filters []Filter, q *bun.SelectQuery) *bun.SelectQuery {
 	for _, f := range filters {
 		log.Debug().Msg(fmt.Sprintf("%s %s %s", f.Field, f.Rule, f.Value))
@@ -57,10 +77,9 @@ func ApplyFilters(filters []Filter, q *bun.SelectQuery) *bun.SelectQuery {
 		value := f.Value
 		switch f.Rule {
 		case "contains":
-			query := fmt.Sprintf("%s ILIKE ?", field)
-			queryVal := fmt.Sprintf("%%%s%%", value)
-			// TODO: implement inclusive/exclusive filters, WhereOr/Where
-			q = q.WhereOr(query, queryVal)
+			q = q.Where(fmt.Sprintf("%s ILIKE ?", field), fmt.Sprintf("%%%s%%", value))
+		case "ncontains":
+			q = q.Where(fmt.Sprintf("%s NOT ILIKE ?", field), fmt.Sprintf("%%%s%%", value))
 		case "eq":
 			q = q.Where(fmt.Sprintf("%s = ?", field), value)
 		case "ne":
@@ -4,6 +4,7 @@ import "time"
 
 type CreateUserReq struct {
 	AuthHeader
+	IdempotencyHeader
 	Body CreateUserReqBody
 }
 type CreateUserReqBody struct {
@@ -25,14 +26,14 @@ type CreateUserResBody struct {
 type UpdateUserReq struct {
 	AuthHeader
 	Body struct {
-		Id          string     `json:"id" doc:"ID of the user" required:"true"`
-		Username    *string    `json:"username,omitempty" doc:"Username of the user" minLength:"3" maxLength:"255"`
-		Email       *string    `json:"email" doc:"Email of the user" format:"email" required:"false"`
-		Password    *string    `json:"password" doc:"Password of the user" minLength:"8" maxLength:"255" required:"false"`
-		FirstName   *string    `json:"first_name" doc:"First name of the user" required:"false"`
-		FamilyName  *string    `json:"family_name" doc:"Family name of the user" required:"false"`
-		PhoneNumber *string    `json:"phone_number" doc:"Phone number of the user" required:"false"`
-		DateOfBirth *time.Time `json:"date_of_birth" doc:"Date of birth of the user" required:"false"`
+		Id          string              `json:"id" doc:"ID of the user" required:"true"`
+		Username    Optional[string]    `json:"username,omitempty" doc:"Username of the user" minLength:"3" maxLength:"255" required:"false"`
+		Email       Optional[string]    `json:"email" doc:"Email of the user" format:"email" required:"false"`
+		Password    Optional[string]    `json:"password" doc:"Password of the user" minLength:"8" maxLength:"255" required:"false"`
+		FirstName   Nullable[string]    `json:"first_name" doc:"First name of the user, null clears it" required:"false"`
+		FamilyName  Nullable[string]    `json:"family_name" doc:"Family name of the user, null clears it" required:"false"`
+		PhoneNumber Nullable[string]    `json:"phone_number" doc:"Phone number of the user, null clears it" required:"false"`
+		DateOfBirth Nullable[time.Time] `json:"date_of_birth" doc:"Date of birth of the user, null clears it" required:"false"`
 	}
 }
 type UpdateUserRes struct{ Body UpdateUserResBody }
@@ -68,12 +69,14 @@ type DeleteUserRes struct {
 type ListUsersReq struct {
 	AuthHeader
 	ListQuery
+	ExportParams
 }
 
 type ListUsersResBody struct {
 	Users     []UserModelRes `json:"users"`
-	Total     int            `json:"total"`
+	Total     int            `json:"total" doc:"Total number of matching items, -1 when with_total is false"`
 	ListQuery ListQueryRes   `json:"query"`
+	PageCursors
 }
 
 type ListUsersRes struct {
@@ -96,6 +99,7 @@ type UserModelRes struct {
 	EmployeeID *string `json:"employee_id"`
 	ParentID   *string `json:"parent_id"`
 
-	CreatedAt int `json:"created_at"`
-	UpdatedAt int `json:"updated_at"`
+	Relevance *float64 `json:"relevance,omitempty" doc:"Similarity to the search query between 0 and 1, only set when searching"`
+	CreatedAt int      `json:"created_at"`
+	UpdatedAt int      `json:"updated_at"`
 }
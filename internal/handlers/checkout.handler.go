@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/checkout"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type CheckoutHandler struct {
+	svc *service.CheckoutService
+	log zerolog.Logger
+}
+
+func RegisterCheckoutRoutes(api huma.API, svc *service.CheckoutService, idempotency *service.IdempotencyService) {
+	h := &CheckoutHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api)
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Checkout"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-checkout-session",
+		Method:        http.MethodPost,
+		Path:          "/invoices/{id}/checkout",
+		Summary:       "Pay an invoice online",
+		Description:   "Open a checkout page at the payment provider paying what is left on an issued invoice. A page still open for the same amount is returned instead of a new one",
+		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.CreateCheckoutSession)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-checkout-sessions-by-invoice",
+		Method:        http.MethodGet,
+		Path:          "/invoices/{id}/checkout",
+		Summary:       "Get the checkout sessions of an invoice",
+		Description:   "Get the checkout pages opened to pay an invoice, the latest first",
+		DefaultStatus: http.StatusOK,
+	}, h.GetCheckoutSessionsByInvoiceID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-checkout-session-by-id",
+		Method:        http.MethodGet,
+		Path:          "/checkout/sessions/{id}",
+		Summary:       "Get a checkout session by ID",
+		Description:   "Get a checkout session with its status and the payment it recorded",
+		DefaultStatus: http.StatusOK,
+	}, h.GetCheckoutSessionByID)
+
+	// the fake provider only runs in development and test deployments, its
+	// pages record payments and are ended by employees trying the flow
+	if _, ok := svc.Provider().(*checkout.Fake); ok {
+		huma.Register(g, huma.Operation{
+			OperationID:   "pay-fake-checkout",
+			Method:        http.MethodPost,
+			Path:          "/checkout/fake/{session_id}",
+			Summary:       "End a checkout page of the fake provider",
+			Description:   "Play the family paying, failing to pay or leaving a checkout page of the fake provider, which sends its signed webhook. Only employees may",
+			DefaultStatus: http.StatusOK,
+		}, h.PayFakeCheckout)
+	}
+
+	// Webhooks are called by the provider, which signs them instead of
+	// signing in
+	p := huma.NewGroup(api)
+	p.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Checkout"}
+	})
+
+	huma.Register(p, huma.Operation{
+		OperationID:   "receive-checkout-webhook",
+		Method:        http.MethodPost,
+		Path:          "/webhooks/{provider}",
+		Summary:       "Receive a webhook of the payment provider",
+		Description:   "Apply an event of the payment provider, signed by it. A completed checkout records its payment once, however many times it is delivered",
+		DefaultStatus: http.StatusOK,
+	}, h.ReceiveWebhook)
+}
+
+func (h *CheckoutHandler) CreateCheckoutSession(c context.Context, input *dto.CreateCheckoutSessionReq) (*dto.CreateCheckoutSessionRes, error) {
+	session, err := h.svc.CreateSession(c, middleware.CallerID(c), input.ID, input.Body.SuccessURL, input.Body.CancelURL)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", session.ID).Str("invoice_id", session.InvoiceID).
+		Stringer("amount", session.Amount).Msg("Opened checkout session")
+	return &dto.CreateCheckoutSessionRes{Body: *session}, nil
+}
+
+func (h *CheckoutHandler) GetCheckoutSessionsByInvoiceID(c context.Context, input *dto.GetCheckoutSessionsByInvoiceIDReq) (*dto.GetCheckoutSessionsByInvoiceIDRes, error) {
+	sessions, err := h.svc.GetSessionsByInvoiceID(c, input.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.GetCheckoutSessionsByInvoiceIDRes{}
+	res.Body.Sessions = sessions
+	return res, nil
+}
+
+func (h *CheckoutHandler) GetCheckoutSessionByID(c context.Context, input *dto.GetCheckoutSessionReq) (*dto.GetCheckoutSessionRes, error) {
+	session, err := h.svc.GetSessionByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetCheckoutSessionRes{Body: *session}, nil
+}
+
+func (h *CheckoutHandler) ReceiveWebhook(c context.Context, input *dto.CheckoutWebhookReq) (*dto.CheckoutWebhookRes, error) {
+	if err := h.svc.HandleWebhook(c, input.Provider, input.Header, input.RawBody); err != nil {
+		return nil, err
+	}
+	res := &dto.CheckoutWebhookRes{}
+	res.Body.Received = true
+	return res, nil
+}
+
+func (h *CheckoutHandler) PayFakeCheckout(c context.Context, input *dto.PayFakeCheckoutReq) (*dto.PayFakeCheckoutRes, error) {
+	session, err := h.svc.PayFake(c, middleware.CallerID(c), input.SessionID, input.Body.Outcome)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.PayFakeCheckoutRes{Body: *session}, nil
+}
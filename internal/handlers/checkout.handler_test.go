@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/users/internal/checkout"
+	"github.com/ICan-TC/users/internal/money"
+)
+
+const webhookSecret = "whsec_test"
+
+// checkoutAPI is a test API paid online through a fake provider
+type checkoutAPI struct {
+	*testAPI
+	fake *checkout.Fake
+}
+
+func newCheckoutAPI(t *testing.T) *checkoutAPI {
+	fake := checkout.NewFake(webhookSecret, "http://localhost:8888")
+	return &checkoutAPI{testAPI: newTestAPI(t, RouteOptions{Provider: fake}), fake: fake}
+}
+
+// openSession opens a checkout page paying the invoice and returns its ID
+// and the ID the fake provider knows it by
+func (a *checkoutAPI) openSession(invoiceID string) (string, string) {
+	a.t.Helper()
+	s := decode[struct {
+		ID     string       `json:"id"`
+		Amount money.Amount `json:"amount"`
+		Status string       `json:"status"`
+		URL    string       `json:"url"`
+	}](a.t, a.call(http.MethodPost, "/invoices/"+invoiceID+"/checkout", map[string]any{
+		"success_url": "https://example.com/paid", "cancel_url": "https://example.com/cancelled",
+	}), 201)
+	if s.Status != "open" || s.Amount != 45000 {
+		a.t.Fatalf("opened %+v", s)
+	}
+	return s.ID, path.Base(s.URL)
+}
+
+// webhook delivers a webhook the way the provider does, without signing in
+func (a *checkoutAPI) webhook(header http.Header, body []byte) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.Do(http.MethodPost, "/webhooks/fake", "Content-Type: application/json",
+		checkout.SignatureHeader+": "+header.Get(checkout.SignatureHeader), bytes.NewReader(body))
+}
+
+// deliver makes the fake provider send eventType about the session
+func (a *checkoutAPI) deliver(providerSessionID string, eventType string) (http.Header, []byte) {
+	a.t.Helper()
+	header, body, err := a.fake.Deliver(providerSessionID, eventType)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return header, body
+}
+
+type sessionRes struct {
+	Status    string  `json:"status"`
+	PaymentID *string `json:"payment_id"`
+}
+
+type invoiceRes struct {
+	Status     string       `json:"status"`
+	Total      money.Amount `json:"total"`
+	AmountPaid money.Amount `json:"amount_paid"`
+}
+
+type paymentsRes struct {
+	Payments []struct {
+		ID        string       `json:"id"`
+		InvoiceID *string      `json:"invoice_id"`
+		Method    string       `json:"method"`
+		Amount    money.Amount `json:"amount"`
+	} `json:"payments"`
+	Total int `json:"total"`
+}
+
+// checkLedger checks every transaction of the ledger is balanced and
+// returns the sum of the entries on account
+func (a *checkoutAPI) checkLedger(account string) money.Amount {
+	a.t.Helper()
+	ledger := decode[struct {
+		Entries []struct {
+			TxnID   string       `json:"txn_id"`
+			Account string       `json:"account"`
+			Debit   money.Amount `json:"debit"`
+			Credit  money.Amount `json:"credit"`
+		} `json:"entries"`
+	}](a.t, a.call(http.MethodGet, "/ledger?per_page=200"), 200)
+	txns := map[string]money.Amount{}
+	var sum money.Amount
+	for _, e := range ledger.Entries {
+		txns[e.TxnID] += e.Debit - e.Credit
+		if e.Account == account {
+			sum += e.Debit - e.Credit
+		}
+	}
+	for id, diff := range txns {
+		if diff != 0 {
+			a.t.Errorf("transaction %s is off by %s", id, diff)
+		}
+	}
+	return sum
+}
+
+func TestCheckoutWebhookPaysInvoice(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+
+	// the page still open is returned instead of a new one
+	if again, _ := a.openSession(invoiceID); again != sessionID {
+		t.Fatalf("opened %s while %s is open", again, sessionID)
+	}
+
+	header, body := a.deliver(providerID, checkout.EventCompleted)
+	expect(t, a.webhook(header, body), 200)
+
+	s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200)
+	if s.Status != "completed" || s.PaymentID == nil {
+		t.Fatalf("session %+v, want completed with a payment", s)
+	}
+	inv := decode[invoiceRes](t, a.call(http.MethodGet, "/invoices/"+invoiceID), 200)
+	if inv.Status != "paid" || inv.AmountPaid != inv.Total || inv.Total != 45000 {
+		t.Fatalf("invoice %+v, want paid in full", inv)
+	}
+	payments := decode[paymentsRes](t, a.call(http.MethodGet, "/payments/student/"+studentID), 200)
+	if payments.Total != 1 || payments.Payments[0].ID != *s.PaymentID || payments.Payments[0].Method != "online" ||
+		payments.Payments[0].Amount != 45000 || payments.Payments[0].InvoiceID == nil || *payments.Payments[0].InvoiceID != invoiceID {
+		t.Fatalf("payments %+v, want the online payment of the invoice", payments)
+	}
+	if owed := a.checkLedger("receivable"); owed != 0 {
+		t.Fatalf("receivable is %s after the invoice was paid, want 0", owed)
+	}
+	if online := a.checkLedger("online"); online != 45000 {
+		t.Fatalf("online is %s, want 45.000", online)
+	}
+
+	// a paid invoice has nothing left to pay
+	expect(t, a.call(http.MethodPost, "/invoices/"+invoiceID+"/checkout", map[string]any{
+		"success_url": "https://example.com/paid", "cancel_url": "https://example.com/cancelled",
+	}), 409)
+}
+
+func TestCheckoutWebhookDeliveredTwice(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+
+	header, body := a.deliver(providerID, checkout.EventCompleted)
+	expect(t, a.webhook(header, body), 200)
+	first := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200)
+
+	// the same delivery retried, then another completion and a late failure
+	expect(t, a.webhook(header, body), 200)
+	header, body = a.deliver(providerID, checkout.EventCompleted)
+	expect(t, a.webhook(header, body), 200)
+	header, body = a.deliver(providerID, checkout.EventFailed)
+	expect(t, a.webhook(header, body), 200)
+
+	s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200)
+	if s.Status != "completed" || *s.PaymentID != *first.PaymentID {
+		t.Fatalf("session %+v, want it completed with its first payment %s", s, *first.PaymentID)
+	}
+	if payments := decode[paymentsRes](t, a.call(http.MethodGet, "/payments/student/"+studentID), 200); payments.Total != 1 {
+		t.Fatalf("recorded %d payments, want 1", payments.Total)
+	}
+	if online := a.checkLedger("online"); online != 45000 {
+		t.Fatalf("online is %s, want 45.000", online)
+	}
+}
+
+func TestCheckoutWebhookSignature(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+	header, body := a.deliver(providerID, checkout.EventCompleted)
+
+	tampered := bytes.Replace(body, []byte(`"45.000"`), []byte(`"90.000"`), 1)
+	if bytes.Equal(tampered, body) {
+		t.Fatalf("no amount to tamper with in %s", body)
+	}
+	stale := http.Header{}
+	stale.Set(checkout.SignatureHeader, checkout.Sign([]byte(webhookSecret), time.Now().Add(-checkout.Tolerance-time.Minute), body))
+	forged := http.Header{}
+	forged.Set(checkout.SignatureHeader, checkout.Sign([]byte("whsec_other"), time.Now(), body))
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+	}{
+		{name: "tampered body", header: header, body: tampered},
+		{name: "stale", header: stale, body: body},
+		{name: "other secret", header: forged, body: body},
+		{name: "unsigned", header: http.Header{}, body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, a.webhook(tt.header, tt.body), 401)
+		})
+	}
+
+	s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200)
+	if s.Status != "open" || s.PaymentID != nil {
+		t.Fatalf("session %+v after rejected webhooks, want it open", s)
+	}
+	if payments := decode[paymentsRes](t, a.call(http.MethodGet, "/payments/student/"+studentID), 200); payments.Total != 0 {
+		t.Fatalf("recorded %d payments from rejected webhooks", payments.Total)
+	}
+	expect(t, a.Do(http.MethodPost, "/webhooks/other", checkout.SignatureHeader+": "+header.Get(checkout.SignatureHeader), bytes.NewReader(body)), 404)
+
+	// the genuine delivery still goes through
+	expect(t, a.webhook(header, body), 200)
+}
+
+func TestCheckoutWebhookOtherCurrency(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+
+	// a genuine delivery the server can't record, acknowledged so the
+	// provider doesn't retry it forever
+	_, body := a.deliver(providerID, checkout.EventCompleted)
+	e := checkout.Event{}
+	if err := json.Unmarshal(body, &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Currency = "EUR"
+	body, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set(checkout.SignatureHeader, checkout.Sign([]byte(webhookSecret), time.Now(), body))
+	expect(t, a.webhook(header, body), 200)
+	expect(t, a.webhook(header, body), 200)
+
+	if s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200); s.Status != "open" || s.PaymentID != nil {
+		t.Fatalf("session %+v, want it left open", s)
+	}
+	if payments := decode[paymentsRes](t, a.call(http.MethodGet, "/payments/student/"+studentID), 200); payments.Total != 0 {
+		t.Fatalf("recorded %d payments in another currency", payments.Total)
+	}
+	if inv := decode[invoiceRes](t, a.call(http.MethodGet, "/invoices/"+invoiceID), 200); inv.Status != "issued" || inv.AmountPaid != 0 {
+		t.Fatalf("invoice %+v, want it left unpaid", inv)
+	}
+}
+
+func TestCheckoutCompletedAfterExpired(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+
+	header, body := a.deliver(providerID, checkout.EventExpired)
+	expect(t, a.webhook(header, body), 200)
+	if s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200); s.Status != "expired" {
+		t.Fatalf("session is %s, want expired", s.Status)
+	}
+
+	// the provider took the money before the page expired, the events came
+	// out of order
+	header, body = a.deliver(providerID, checkout.EventCompleted)
+	expect(t, a.webhook(header, body), 200)
+	s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200)
+	if s.Status != "completed" || s.PaymentID == nil {
+		t.Fatalf("session %+v, want completed with a payment", s)
+	}
+	if inv := decode[invoiceRes](t, a.call(http.MethodGet, "/invoices/"+invoiceID), 200); inv.Status != "paid" {
+		t.Fatalf("invoice is %s, want paid", inv.Status)
+	}
+	if payments := decode[paymentsRes](t, a.call(http.MethodGet, "/payments/student/"+studentID), 200); payments.Total != 1 {
+		t.Fatalf("recorded %d payments, want 1", payments.Total)
+	}
+	a.checkLedger("online")
+}
+
+func TestCheckoutFakePage(t *testing.T) {
+	a := newCheckoutAPI(t)
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	sessionID, providerID := a.openSession(invoiceID)
+
+	// ending a page records a payment, so only employees may
+	expect(t, a.Post("/checkout/fake/"+providerID, map[string]any{"outcome": "paid"}), 401)
+	expect(t, a.call(http.MethodPost, "/checkout/fake/"+providerID, map[string]any{"outcome": "paid"}), 403)
+	if s := decode[sessionRes](t, a.call(http.MethodGet, "/checkout/sessions/"+sessionID), 200); s.Status != "open" {
+		t.Fatalf("session is %s after refused payments, want open", s.Status)
+	}
+
+	a.hire(a.userID)
+	s := decode[sessionRes](t, a.call(http.MethodPost, "/checkout/fake/"+providerID, map[string]any{"outcome": "paid"}), 200)
+	if s.Status != "completed" || s.PaymentID == nil {
+		t.Fatalf("session %+v, want completed with a payment", s)
+	}
+	if inv := decode[invoiceRes](t, a.call(http.MethodGet, "/invoices/"+invoiceID), 200); inv.Status != "paid" {
+		t.Fatalf("invoice is %s, want paid", inv.Status)
+	}
+}
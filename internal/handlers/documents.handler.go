@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/document"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type DocumentsHandler struct {
+	svc *service.DocumentsService
+	log zerolog.Logger
+}
+
+// pdfResponses documents the PDF files returned instead of JSON
+func pdfResponses() map[string]*huma.Response {
+	return map[string]*huma.Response{
+		"200": {
+			Content: map[string]*huma.MediaType{
+				document.ContentTypePDF: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+			},
+		},
+	}
+}
+
+func RegisterDocumentsRoutes(api huma.API, svc *service.DocumentsService) {
+	h := &DocumentsHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api)
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Documents"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-invoice-pdf",
+		Method:        http.MethodGet,
+		Path:          "/invoices/{id}.pdf",
+		Summary:       "Print an invoice",
+		Description:   "Render an invoice as a PDF file with the balance of the family and a QR code verifying it",
+		DefaultStatus: http.StatusOK,
+		Responses:     pdfResponses(),
+	}, h.GetInvoicePDF)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-payment-receipt-pdf",
+		Method:        http.MethodGet,
+		Path:          "/payments/{id}.pdf",
+		Summary:       "Print a payment receipt",
+		Description:   "Render a receipt of a payment as a PDF file with the invoices it paid, the balance of the family and a QR code verifying it",
+		DefaultStatus: http.StatusOK,
+		Responses:     pdfResponses(),
+	}, h.GetPaymentReceiptPDF)
+
+	// Verification is public, it is reached by scanning a printed document
+	p := huma.NewGroup(api)
+	p.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Documents"}
+	})
+
+	huma.Register(p, huma.Operation{
+		OperationID:   "verify-document",
+		Method:        http.MethodGet,
+		Path:          "/verify/{kind}/{id}",
+		Summary:       "Verify a printed document",
+		Description:   "Check an invoice or receipt was handed out by the center, using the code of its QR code. Only its number, status, date and amount are returned",
+		DefaultStatus: http.StatusOK,
+	}, h.VerifyDocument)
+}
+
+func pdfRes(name string, body []byte) *dto.DocumentPDFRes {
+	return &dto.DocumentPDFRes{
+		ContentType:        document.ContentTypePDF,
+		ContentDisposition: fmt.Sprintf("inline; filename=%q", name+".pdf"),
+		Body:               body,
+	}
+}
+
+func (h *DocumentsHandler) GetInvoicePDF(c context.Context, input *dto.GetInvoicePDFReq) (*dto.DocumentPDFRes, error) {
+	body, err := h.svc.InvoicePDF(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("invoice_id", input.ID).Int("size", len(body)).Msg("Rendered invoice")
+	return pdfRes("invoice-"+input.ID, body), nil
+}
+
+func (h *DocumentsHandler) GetPaymentReceiptPDF(c context.Context, input *dto.GetPaymentReceiptReq) (*dto.DocumentPDFRes, error) {
+	body, err := h.svc.ReceiptPDF(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("payment_id", input.ID).Int("size", len(body)).Msg("Rendered receipt")
+	return pdfRes("receipt-"+input.ID, body), nil
+}
+
+func (h *DocumentsHandler) VerifyDocument(c context.Context, input *dto.VerifyDocumentReq) (*dto.VerifyDocumentRes, error) {
+	res, err := h.svc.Verify(c, input.Kind, input.ID, input.Code)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.VerifyDocumentRes{Body: *res}, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/ICan-TC/users/internal/document"
+	"github.com/oklog/ulid/v2"
+)
+
+// verifyCode is the code the QR code of a document carries, signed with the
+// secret of the test API
+func verifyCode(kind string, id string) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte("document/" + kind + "/" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// payInvoice records a cash payment of the student and returns its ID
+func (a *testAPI) payInvoice(studentID string, invoiceID string, amount string) string {
+	a.t.Helper()
+	return decode[struct {
+		ID string `json:"id"`
+	}](a.t, a.call("POST", "/payments", map[string]any{
+		"student_id": studentID, "invoice_id": invoiceID, "method": "cash", "amount": amount,
+	}), 201).ID
+}
+
+func TestDocumentsPDF(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	studentID := a.createStudent("student")
+	invoiceID := a.issueInvoice(studentID, a.createTeacher("teacher"))
+	paymentID := a.payInvoice(studentID, invoiceID, "45.000")
+
+	for _, path := range []string{"/invoices/" + invoiceID + ".pdf", "/payments/" + paymentID + ".pdf"} {
+		resp := a.call("GET", path)
+		expect(t, resp, 200)
+		if ct := resp.Header().Get("Content-Type"); ct != document.ContentTypePDF {
+			t.Fatalf("%s: content type %q, want %q", path, ct, document.ContentTypePDF)
+		}
+		if !bytes.HasPrefix(resp.Body.Bytes(), []byte("%PDF-")) {
+			t.Fatalf("%s: body isn't a PDF file", path)
+		}
+		// documents are only printed for the signed in
+		expect(t, a.Get(path), 401)
+	}
+
+	unknown := ulid.Make().String()
+	expect(t, a.call("GET", "/invoices/"+unknown+".pdf"), 404)
+	expect(t, a.call("GET", "/payments/"+unknown+".pdf"), 404)
+}
+
+func TestDocumentsVerify(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	studentID := a.createStudent("student")
+	teacherID := a.createTeacher("teacher")
+	invoiceID := a.issueInvoice(studentID, teacherID)
+	paymentID := a.payInvoice(studentID, invoiceID, "45.000")
+	unknown := ulid.Make().String()
+
+	tests := []struct {
+		name     string
+		kind, id string
+		code     string
+		status   int
+	}{
+		{"invoice", "invoice", invoiceID, verifyCode("invoice", invoiceID), 200},
+		{"receipt", "receipt", paymentID, verifyCode("receipt", paymentID), 200},
+		{"code of another invoice", "invoice", unknown, verifyCode("invoice", invoiceID), 404},
+		{"code of the invoice as a receipt", "receipt", invoiceID, verifyCode("invoice", invoiceID), 404},
+		{"tampered code", "invoice", invoiceID, verifyCode("invoice", invoiceID)[1:] + "A", 404},
+		{"genuine code of a missing invoice", "invoice", unknown, verifyCode("invoice", unknown), 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// verification is public, no token is sent
+			resp := a.Get("/verify/" + tt.kind + "/" + tt.id + "?code=" + url.QueryEscape(tt.code))
+			if tt.status != 200 {
+				expect(t, resp, tt.status)
+				return
+			}
+			got := decode[struct {
+				ID       string `json:"id"`
+				Amount   string `json:"amount"`
+				Currency string `json:"currency"`
+			}](t, resp, 200)
+			if got.ID != tt.id || got.Amount != "45.000" || got.Currency != "TND" {
+				t.Fatalf("verified %+v, want %s of 45.000 TND", got, tt.id)
+			}
+		})
+	}
+}
@@ -2,12 +2,12 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/middleware"
-	"github.com/ICan-TC/users/internal/models"
 	"github.com/ICan-TC/users/internal/service"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/rs/zerolog"
@@ -31,7 +31,7 @@ func RegisterEmployeesRoutes(api huma.API, svc *service.EmployeesService) {
 		Method:        http.MethodPost,
 		Path:          "",
 		Summary:       "Create an employee",
-		Description:   "Create an employee",
+		Description:   "Create an employee, with a first record of their role and salary. Only HR may",
 		DefaultStatus: http.StatusCreated,
 	}, h.CreateEmployee)
 
@@ -40,7 +40,7 @@ func RegisterEmployeesRoutes(api huma.API, svc *service.EmployeesService) {
 		Method:        http.MethodPatch,
 		Path:          "",
 		Summary:       "Update an employee",
-		Description:   "Update an employee",
+		Description:   "Update an employee. A role, salary or status takes effect today, through a record. Only HR may",
 		DefaultStatus: http.StatusOK,
 	}, h.UpdateEmployee)
 
@@ -62,6 +62,15 @@ func RegisterEmployeesRoutes(api huma.API, svc *service.EmployeesService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteEmployee)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-employee",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a employee",
+		Description:   "List the records that deleting a employee would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteEmployee)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-employees",
 		Method:        http.MethodGet,
@@ -69,70 +78,74 @@ func RegisterEmployeesRoutes(api huma.API, svc *service.EmployeesService) {
 		Summary:       "List employees",
 		Description:   "List employees",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListEmployees)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "set-employee-permissions",
+		Method:        http.MethodPut,
+		Path:          "/{id}/permissions",
+		Summary:       "Set the permissions of an employee",
+		Description:   "Replace the permissions of an employee, such as hr. Only HR may, and the last employee holding hr can't lose it",
+		DefaultStatus: http.StatusOK,
+	}, h.SetEmployeePermissions)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-employee-records",
+		Method:        http.MethodGet,
+		Path:          "/{id}/records",
+		Summary:       "List the records of an employee",
+		Description:   "List the role, salary and status of an employee over time, the latest first. Only HR may",
+		DefaultStatus: http.StatusOK,
+	}, h.ListEmployeeRecords)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-employee-record",
+		Method:        http.MethodPost,
+		Path:          "/{id}/records",
+		Summary:       "Record a change of an employee",
+		Description:   "Change the role, salary or status of an employee from a day on, keeping what was before. Only HR may",
+		DefaultStatus: http.StatusCreated,
+	}, h.CreateEmployeeRecord)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "delete-employee-record",
+		Method:        http.MethodDelete,
+		Path:          "/{id}/records/{record_id}",
+		Summary:       "Delete a record of an employee",
+		Description:   "Delete a record entered by mistake, the employee going back to the record before. Only HR may",
+		DefaultStatus: http.StatusOK,
+	}, h.DeleteEmployeeRecord)
 }
 
 func (h *EmployeesHandler) CreateEmployee(c context.Context, input *dto.CreateEmployeeReq) (*dto.CreateEmployeeRes, error) {
-	employee, err := h.svc.CreateEmployee(c, input.Body.UserID, input.Body.Role, input.Body.Salary)
+	employee, err := h.svc.CreateEmployee(c, middleware.CallerID(c), *input)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
-	h.log.Info().Str("id", employee.EmployeeID).Str("user_id", employee.UserID).Str("role", employee.Role).
-		Float64("salary", employee.Salary).Any("created", employee.CreatedAt).
+	h.log.Info().Str("id", employee.ID).Str("user_id", employee.UserID).Str("role", employee.Role).
+		Any("created", employee.CreatedAt).
 		Msg("Created employee")
-	return &dto.CreateEmployeeRes{
-		Body: dto.CreateEmployeeResBody{
-			ID:        employee.EmployeeID,
-			UserID:    employee.UserID,
-			Role:      employee.Role,
-			Salary:    employee.Salary,
-			CreatedAt: int(employee.CreatedAt.Unix()),
-			UpdatedAt: int(employee.UpdatedAt.Unix()),
-		},
-	}, nil
+	return &dto.CreateEmployeeRes{Body: *employee}, nil
 }
 
 func (h *EmployeesHandler) UpdateEmployee(c context.Context, input *dto.UpdateEmployeeReq) (*dto.UpdateEmployeeRes, error) {
-	m := models.Employees{EmployeeID: input.Body.ID}
-	if input.Body.Role != nil {
-		m.Role = *input.Body.Role
-	}
-	if input.Body.Salary != nil {
-		m.Salary = *input.Body.Salary
-	}
-	employee, err := h.svc.UpdateEmployee(c, m)
+	employee, err := h.svc.UpdateEmployee(c, middleware.CallerID(c), *input)
 	if err != nil {
 		return nil, err
 	}
-	return &dto.UpdateEmployeeRes{
-		Body: dto.UpdateEmployeeResBody{
-			ID:        employee.EmployeeID,
-			UserID:    employee.UserID,
-			Role:      employee.Role,
-			Salary:    employee.Salary,
-			CreatedAt: int(employee.CreatedAt.Unix()),
-			UpdatedAt: int(employee.UpdatedAt.Unix()),
-		},
-	}, nil
+	return &dto.UpdateEmployeeRes{Body: *employee}, nil
 }
 
 func (h *EmployeesHandler) GetEmployeeByID(c context.Context, input *dto.GetEmployeeByIDReq) (*dto.GetEmployeeByIDRes, error) {
-	employee, err := h.svc.GetEmployeeByID(c, input.ID)
+	employee, err := h.svc.GetEmployeeByID(c, middleware.CallerID(c), input.ID)
 	if err != nil {
 		return nil, err
 	}
 	h.log.Info().Str("id", input.ID).Any("created", employee.CreatedAt).
 		Msg("Get employee by ID")
-	return &dto.GetEmployeeByIDRes{
-		Body: dto.GetEmployeeResBody{
-			ID:        employee.EmployeeID,
-			UserID:    employee.UserID,
-			Role:      employee.Role,
-			Salary:    employee.Salary,
-			CreatedAt: int(employee.CreatedAt.Unix()),
-			UpdatedAt: int(employee.UpdatedAt.Unix()),
-		},
-	}, nil
+	return &dto.GetEmployeeByIDRes{Body: *employee}, nil
 }
 
 func (h *EmployeesHandler) DeleteEmployee(c context.Context, input *dto.DeleteEmployeeReq) (*dto.DeleteEmployeeRes, error) {
@@ -146,6 +159,52 @@ func (h *EmployeesHandler) DeleteEmployee(c context.Context, input *dto.DeleteEm
 	}, nil
 }
 
+func (h *EmployeesHandler) PreviewDeleteEmployee(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteEmployee(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
+
 func (h *EmployeesHandler) ListEmployees(c context.Context, input *dto.ListEmployeesReq) (*dto.ListEmployeesRes, error) {
-	return h.svc.GetEmployees(c, input)
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("employees", func(w io.Writer) error {
+			return h.svc.ExportEmployees(c, middleware.CallerID(c), input, export.Format, w)
+		})
+	}
+	return h.svc.GetEmployees(c, middleware.CallerID(c), input)
+}
+
+func (h *EmployeesHandler) SetEmployeePermissions(c context.Context, input *dto.SetEmployeePermissionsReq) (*dto.SetEmployeePermissionsRes, error) {
+	employee, err := h.svc.SetPermissions(c, middleware.CallerID(c), input.ID, input.Body.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Strs("permissions", employee.Permissions).Str("by", middleware.CallerID(c)).
+		Msg("Set employee permissions")
+	return &dto.SetEmployeePermissionsRes{Body: *employee}, nil
+}
+
+func (h *EmployeesHandler) ListEmployeeRecords(c context.Context, input *dto.ListEmployeeRecordsReq) (*dto.ListEmployeeRecordsRes, error) {
+	return h.svc.GetRecords(c, middleware.CallerID(c), input.ID)
+}
+
+func (h *EmployeesHandler) CreateEmployeeRecord(c context.Context, input *dto.CreateEmployeeRecordReq) (*dto.CreateEmployeeRecordRes, error) {
+	record, err := h.svc.AddRecord(c, middleware.CallerID(c), *input)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.CreateEmployeeRecordRes{Body: *record}, nil
+}
+
+func (h *EmployeesHandler) DeleteEmployeeRecord(c context.Context, input *dto.DeleteEmployeeRecordReq) (*dto.DeleteEmployeeRecordRes, error) {
+	if err := h.svc.DeleteRecord(c, middleware.CallerID(c), input.ID, input.RecordID); err != nil {
+		return nil, err
+	}
+	return &dto.DeleteEmployeeRecordRes{
+		Body: dto.DeleteEmployeeRecordResBody{
+			ID: input.RecordID,
+		},
+	}, nil
 }
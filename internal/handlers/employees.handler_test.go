@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ICan-TC/users/internal/models"
+)
+
+func TestEmployeesSalaries(t *testing.T) {
+	type employee struct {
+		ID     string  `json:"id"`
+		Salary *string `json:"salary"`
+	}
+	salaryFilter := "/employees?filters=" + url.QueryEscape(`[{"field":"salary","rule":"gt","value":"1000"}]`)
+	tests := []struct {
+		name string
+		// hire makes the caller an employee holding permissions
+		hire        bool
+		permissions []string
+		hr          bool
+	}{
+		{name: "hr", hire: true, permissions: []string{models.PermissionHR}, hr: true},
+		{name: "employee without hr", hire: true},
+		{name: "not an employee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t, RouteOptions{})
+			_, staffUserID := a.signup("staff")
+			staffID := a.hire(staffUserID)
+			if tt.hire {
+				a.hire(a.userID, tt.permissions...)
+			}
+			read, write := 403, 403
+			if tt.hr {
+				read, write = 200, 200
+			}
+
+			// salaries are left out of what others read
+			list := decode[struct {
+				Employees []employee `json:"employees"`
+			}](t, a.call("GET", "/employees"), 200)
+			if len(list.Employees) == 0 {
+				t.Fatal("no employees listed")
+			}
+			for _, e := range list.Employees {
+				if (e.Salary != nil) != tt.hr {
+					t.Fatalf("listed salary of %s = %v, want shown %v", e.ID, e.Salary, tt.hr)
+				}
+			}
+			got := decode[employee](t, a.call("GET", "/employees/"+staffID), 200)
+			if (got.Salary != nil) != tt.hr {
+				t.Fatalf("salary = %v, want shown %v", got.Salary, tt.hr)
+			}
+			if tt.hr && *got.Salary != "1200.000" {
+				t.Fatalf("salary = %s, want 1200.000", *got.Salary)
+			}
+
+			// nor can they be told apart by filtering or sorting on them
+			expect(t, a.call("GET", "/employees?sort_by=salary"), read)
+			expect(t, a.call("GET", salaryFilter), read)
+			expect(t, a.call("GET", "/employees?format=csv&columns=id,salary"), read)
+
+			// and only HR changes them
+			expect(t, a.call("PATCH", "/employees", map[string]any{"id": staffID, "salary": "1300.000"}), write)
+			if tt.hr {
+				write = 201
+			}
+			expect(t, a.call("POST", "/employees/"+staffID+"/records", map[string]any{"effective_from": "2030-01-01", "salary": "1400.000"}), write)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
@@ -18,7 +19,7 @@ type EnrollmentsHandler struct {
 	log zerolog.Logger
 }
 
-func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
+func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService, idempotency *service.IdempotencyService) {
 	h := &EnrollmentsHandler{svc: svc, log: logging.L()}
 	g := huma.NewGroup(api, "/enrollments")
 	g.UseSimpleModifier(func(op *huma.Operation) {
@@ -33,6 +34,7 @@ func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
 		Summary:       "Create an enrollment",
 		Description:   "Create an enrollment",
 		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
 	}, h.CreateEnrollment)
 
 	huma.Register(g, huma.Operation{
@@ -44,6 +46,24 @@ func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.UpdateEnrollment)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-enrollments-bulk",
+		Method:        http.MethodPost,
+		Path:          "/bulk",
+		Summary:       "Create enrollments in bulk",
+		Description:   "Create enrollments in bulk, up to 1000 at once. Items are validated one by one. In all_or_nothing mode every item is saved or none, and the response is a 422 when any failed. In best_effort mode the valid items are saved. Every item gets a result: created, updated, conflict, invalid or not_found with a reason",
+		DefaultStatus: http.StatusOK,
+	}, h.BulkCreateEnrollments)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "update-enrollments-bulk",
+		Method:        http.MethodPatch,
+		Path:          "/bulk",
+		Summary:       "Update enrollments in bulk",
+		Description:   "Update enrollments in bulk, up to 1000 at once. Items are validated one by one. In all_or_nothing mode every item is saved or none, and the response is a 422 when any failed. In best_effort mode the valid items are saved. Every item gets a result: created, updated, conflict, invalid or not_found with a reason",
+		DefaultStatus: http.StatusOK,
+	}, h.BulkUpdateEnrollments)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "get-enrollment-by-id",
 		Method:        http.MethodGet,
@@ -53,6 +73,16 @@ func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.GetEnrollmentByID)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "withdraw-enrollment",
+		Method:        http.MethodPost,
+		Path:          "/{student_id}/{group_id}/withdraw",
+		Summary:       "Withdraw a student from a group",
+		Description:   "End an enrollment on end_date, after which it is no longer billed. Invoices already billing it later are prorated again and credited the difference, see docs/proration.md",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.WithdrawEnrollment)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "delete-enrollment",
 		Method:        http.MethodDelete,
@@ -69,6 +99,8 @@ func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
 		Summary:       "List enrollments",
 		Description:   "List enrollments",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListEnrollments)
 
 	huma.Register(g, huma.Operation{
@@ -91,12 +123,12 @@ func RegisterEnrollmentsRoutes(api huma.API, svc *service.EnrollmentsService) {
 }
 
 func (h *EnrollmentsHandler) CreateEnrollment(c context.Context, input *dto.CreateEnrollmentReq) (*dto.CreateEnrollmentRes, error) {
-	enrollment, err := h.svc.CreateEnrollment(c, input.Body.StudentID, input.Body.GroupID, input.Body.Fee)
+	enrollment, err := h.svc.CreateEnrollment(c, input.Body.StudentID, input.Body.GroupID, input.Body.Fee, input.Body.StartDate)
 	if err != nil {
 		return nil, err
 	}
 	h.log.Info().Str("student_id", enrollment.StudentID).Str("group_id", enrollment.GroupID).
-		Float64("fee", enrollment.Fee).Any("created", enrollment.CreatedAt).
+		Stringer("fee", enrollment.Fee).Any("created", enrollment.CreatedAt).
 		Msg("Created enrollment")
 	return &dto.CreateEnrollmentRes{
 		Body: *h.svc.ModelToRes(enrollment),
@@ -105,10 +137,9 @@ func (h *EnrollmentsHandler) CreateEnrollment(c context.Context, input *dto.Crea
 
 func (h *EnrollmentsHandler) UpdateEnrollment(c context.Context, input *dto.UpdateEnrollmentReq) (*dto.UpdateEnrollmentRes, error) {
 	m := models.Enrollments{StudentID: input.Body.StudentID, GroupID: input.Body.GroupID}
-	if input.Body.Fee != nil {
-		m.Fee = *input.Body.Fee
-	}
-	enrollment, err := h.svc.UpdateEnrollment(c, m)
+	patch := dto.Patch{}
+	dto.PatchValue(&patch, "fee", input.Body.Fee, &m.Fee)
+	enrollment, err := h.svc.UpdateEnrollment(c, m, patch)
 	if err != nil {
 		return nil, err
 	}
@@ -117,6 +148,24 @@ func (h *EnrollmentsHandler) UpdateEnrollment(c context.Context, input *dto.Upda
 	}, nil
 }
 
+func (h *EnrollmentsHandler) BulkCreateEnrollments(c context.Context, input *dto.BulkCreateEnrollmentsReq) (*dto.BulkRes[dto.EnrollmentModelRes], error) {
+	res, err := h.svc.BulkCreateEnrollments(c, input.Mode, input.Body.Items)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("mode", input.Mode).Int("succeeded", res.Body.Succeeded).Int("failed", res.Body.Failed).Msg("Bulk created enrollments")
+	return res, nil
+}
+
+func (h *EnrollmentsHandler) BulkUpdateEnrollments(c context.Context, input *dto.BulkUpdateEnrollmentsReq) (*dto.BulkRes[dto.EnrollmentModelRes], error) {
+	res, err := h.svc.BulkUpdateEnrollments(c, input.Mode, input.Body.Items)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("mode", input.Mode).Int("succeeded", res.Body.Succeeded).Int("failed", res.Body.Failed).Msg("Bulk updated enrollments")
+	return res, nil
+}
+
 func (h *EnrollmentsHandler) GetEnrollmentByID(c context.Context, input *dto.GetEnrollmentByIDReq) (*dto.GetEnrollmentByIDRes, error) {
 	enrollment, err := h.svc.GetEnrollmentByID(c, input.StudentID, input.GroupID)
 	if err != nil {
@@ -130,6 +179,18 @@ func (h *EnrollmentsHandler) GetEnrollmentByID(c context.Context, input *dto.Get
 	}, nil
 }
 
+func (h *EnrollmentsHandler) WithdrawEnrollment(c context.Context, input *dto.WithdrawEnrollmentReq) (*dto.WithdrawEnrollmentRes, error) {
+	res, err := h.svc.WithdrawEnrollment(c, input.StudentID, input.GroupID, input.Body.EndDate, input.Body.RefundMethod)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("student_id", input.StudentID).Str("group_id", input.GroupID).
+		Str("end_date", *res.Enrollment.EndDate).Int("invoices", len(res.Invoices)).
+		Stringer("credited", res.Credited).Stringer("refunded", res.Refunded).
+		Msg("Withdrew enrollment")
+	return &dto.WithdrawEnrollmentRes{Body: *res}, nil
+}
+
 func (h *EnrollmentsHandler) DeleteEnrollment(c context.Context, input *dto.DeleteEnrollmentReq) (*dto.DeleteEnrollmentRes, error) {
 	if err := h.svc.DeleteEnrollment(c, input.StudentID, input.GroupID); err != nil {
 		return nil, err
@@ -143,6 +204,11 @@ func (h *EnrollmentsHandler) DeleteEnrollment(c context.Context, input *dto.Dele
 }
 
 func (h *EnrollmentsHandler) ListEnrollments(c context.Context, input *dto.ListEnrollmentsReq) (*dto.ListEnrollmentsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("enrollments", func(w io.Writer) error {
+			return h.svc.ExportEnrollments(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetEnrollments(c, input)
 }
 
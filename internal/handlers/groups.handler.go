@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
@@ -62,6 +64,15 @@ func RegisterGroupsRoutes(api huma.API, svc *service.GroupsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteGroup)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-group",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a group",
+		Description:   "List the records that deleting a group would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteGroup)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-groups",
 		Method:        http.MethodGet,
@@ -69,6 +80,8 @@ func RegisterGroupsRoutes(api huma.API, svc *service.GroupsService) {
 		Summary:       "List groups",
 		Description:   "List groups",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListGroups)
 }
 
@@ -88,33 +101,23 @@ func (h *GroupsHandler) CreateGroup(c context.Context, input *dto.CreateGroupReq
 
 func (h *GroupsHandler) UpdateGroup(c context.Context, input *dto.UpdateGroupReq) (*dto.UpdateGroupRes, error) {
 	m := models.Groups{GroupID: input.Body.ID}
-	if input.Body.Name != nil {
-		m.Name = *input.Body.Name
-	}
-	if input.Body.Description != nil {
-		m.Description = *input.Body.Description
-	}
-	if input.Body.TeacherID != nil {
-		m.TeacherID = *input.Body.TeacherID
-	}
-	if input.Body.DefaultFee != nil {
-		m.DefaultFee = *input.Body.DefaultFee
-	}
-	if input.Body.Subject != nil {
-		m.Subject = *input.Body.Subject
-	}
-	if input.Body.Level != nil {
-		m.Level = *input.Body.Level
-	}
-	if input.Body.Metadata != nil {
-		m.Metadata = input.Body.Metadata
-	}
-	group, err := h.svc.UpdateGroup(c, m)
+	patch := dto.Patch{}
+	dto.PatchValue(&patch, "name", input.Body.Name, &m.Name)
+	dto.PatchZero(&patch, "description", input.Body.Description, &m.Description)
+	dto.PatchValue(&patch, "teacher_id", input.Body.TeacherID, &m.TeacherID)
+	dto.PatchValue(&patch, "default_fee", input.Body.DefaultFee, &m.DefaultFee)
+	dto.PatchValue(&patch, "subject", input.Body.Subject, &m.Subject)
+	dto.PatchValue(&patch, "level", input.Body.Level, &m.Level)
+	// Merged with the stored metadata by the service
+	dto.PatchZero(&patch, "metadata", input.Body.Metadata, &m.Metadata)
+	group, err := h.svc.UpdateGroup(c, m, patch, &input.Params)
 	if err != nil {
 		return nil, err
 	}
+	res := h.svc.ModelToRes(group)
 	return &dto.UpdateGroupRes{
-		Body: *h.svc.ModelToRes(group),
+		ETag: dto.QuoteETag(res.ETag),
+		Body: *res,
 	}, nil
 }
 
@@ -123,15 +126,19 @@ func (h *GroupsHandler) GetGroupByID(c context.Context, input *dto.GetGroupByIDR
 	if err != nil {
 		return nil, err
 	}
+	if err := input.PreconditionFailed(group.ETag, time.Unix(int64(group.UpdatedAt), 0)); err != nil {
+		return nil, err
+	}
 	h.log.Info().Str("id", input.ID).Int("created_at", group.CreatedAt).
 		Msg("Get group by ID")
 	return &dto.GetGroupByIDRes{
+		ETag: dto.QuoteETag(group.ETag),
 		Body: *group,
 	}, nil
 }
 
 func (h *GroupsHandler) DeleteGroup(c context.Context, input *dto.DeleteGroupReq) (*dto.DeleteGroupRes, error) {
-	if err := h.svc.DeleteGroup(c, input.ID); err != nil {
+	if err := h.svc.DeleteGroup(c, input.ID, &input.Params); err != nil {
 		return nil, err
 	}
 	return &dto.DeleteGroupRes{
@@ -141,6 +148,19 @@ func (h *GroupsHandler) DeleteGroup(c context.Context, input *dto.DeleteGroupReq
 	}, nil
 }
 
+func (h *GroupsHandler) PreviewDeleteGroup(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteGroup(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
+
 func (h *GroupsHandler) ListGroups(c context.Context, input *dto.ListGroupsReq) (*dto.ListGroupsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("groups", func(w io.Writer) error {
+			return h.svc.ExportGroups(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetGroups(c, input)
 }
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGroupsCRUD(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	teacherID := a.createTeacher("teacher")
+	g := a.createGroup("English B1", teacherID)
+	if g.Name != "English B1" || g.TeacherID != teacherID || g.DefaultFee != "45.000" {
+		t.Fatalf("created %+v", g)
+	}
+
+	got := decode[groupRes](t, a.call(http.MethodGet, "/groups/"+g.ID), 200)
+	if got.ID != g.ID || got.Description != "Evening class" {
+		t.Fatalf("got %+v, want %+v", got, g)
+	}
+
+	patched := decode[groupRes](t, a.call(http.MethodPatch, "/groups", map[string]any{"id": g.ID, "name": "English B2", "default_fee": "50"}), 200)
+	if patched.Name != "English B2" || patched.DefaultFee != "50.000" || patched.Description != "Evening class" {
+		t.Fatalf("patched %+v", patched)
+	}
+
+	list := decode[struct {
+		Groups []groupRes `json:"groups"`
+		Total  int        `json:"total"`
+	}](t, a.call(http.MethodGet, "/groups"), 200)
+	if list.Total != 1 || len(list.Groups) != 1 || list.Groups[0].Name != "English B2" {
+		t.Fatalf("listed %+v", list)
+	}
+
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID), 200)
+	expect(t, a.call(http.MethodGet, "/groups/"+g.ID), 404)
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID), 404)
+	expect(t, a.call(http.MethodPatch, "/groups", map[string]any{"id": g.ID, "name": "Gone"}), 404)
+	list = decode[struct {
+		Groups []groupRes `json:"groups"`
+		Total  int        `json:"total"`
+	}](t, a.call(http.MethodGet, "/groups"), 200)
+	if list.Total != 0 || len(list.Groups) != 0 {
+		t.Fatalf("listed %+v after the deletion", list)
+	}
+
+	// without a token nothing is served
+	expect(t, a.Get("/groups"), 401)
+}
+
+func TestGroupsCursorPagination(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	teacherID := a.createTeacher("teacher")
+	want := map[string]bool{}
+	for i := range 7 {
+		want[a.createGroup(fmt.Sprintf("Group %d", i), teacherID).ID] = true
+	}
+
+	type page struct {
+		Groups     []groupRes `json:"groups"`
+		Total      int        `json:"total"`
+		NextCursor *string    `json:"next_cursor"`
+		PrevCursor *string    `json:"prev_cursor"`
+	}
+	seen := map[string]bool{}
+	var pages []page
+	path := "/groups?per_page=3"
+	for {
+		p := decode[page](t, a.call(http.MethodGet, path), 200)
+		pages = append(pages, p)
+		for _, g := range p.Groups {
+			if seen[g.ID] {
+				t.Fatalf("group %s listed twice", g.ID)
+			}
+			seen[g.ID] = true
+		}
+		if p.NextCursor == nil {
+			break
+		}
+		if len(pages) > 3 {
+			t.Fatal("the cursors don't end")
+		}
+		path = "/groups?per_page=3&cursor=" + url.QueryEscape(*p.NextCursor)
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("listed %v, want %v", seen, want)
+	}
+	if len(pages) != 3 || len(pages[0].Groups) != 3 || len(pages[2].Groups) != 1 {
+		t.Fatalf("got %d pages, want pages of 3, 3 and 1", len(pages))
+	}
+	if pages[0].PrevCursor != nil || pages[1].PrevCursor == nil {
+		t.Fatal("only the first page should have no previous cursor")
+	}
+
+	// the previous cursor of the second page leads back to the first one
+	back := decode[page](t, a.call(http.MethodGet, "/groups?per_page=3&cursor="+url.QueryEscape(*pages[1].PrevCursor)), 200)
+	if len(back.Groups) != 3 {
+		t.Fatalf("went back to %d groups, want 3", len(back.Groups))
+	}
+	for i, g := range back.Groups {
+		if g.ID != pages[0].Groups[i].ID {
+			t.Fatalf("went back to %s at %d, want %s", g.ID, i, pages[0].Groups[i].ID)
+		}
+	}
+
+	expect(t, a.call(http.MethodGet, "/groups?cursor=garbage"), 400)
+}
+
+func TestGroupsSortByRelevance(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	teacherID := a.createTeacher("teacher")
+	a.createGroup("Algebra revision", teacherID)
+	a.createGroup("Algebra", teacherID)
+	a.createGroup("Geometry", teacherID)
+
+	list := decode[struct {
+		Groups []groupRes `json:"groups"`
+	}](t, a.call(http.MethodGet, "/groups?search=algebra&sort_by=relevance"), 200)
+	if len(list.Groups) != 2 || list.Groups[0].Name != "Algebra" {
+		t.Fatalf("listed %+v, want both algebra groups, the closest match first", list.Groups)
+	}
+	// there is nothing to rank without a term
+	expect(t, a.call(http.MethodGet, "/groups?sort_by=relevance"), 400)
+	expect(t, a.call(http.MethodGet, "/groups?search=%20&sort_by=relevance"), 400)
+}
+
+func TestGroupsMergePatch(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	g := a.createGroup("English B1", a.createTeacher("teacher"))
+
+	// an empty patch changes nothing
+	same := decode[groupRes](t, a.call(http.MethodPatch, "/groups", map[string]any{"id": g.ID}), 200)
+	if !reflect.DeepEqual(same, g) {
+		t.Fatalf("empty patch gave %+v, want %+v", same, g)
+	}
+
+	// metadata keys merge recursively and null removes one
+	merged := decode[groupRes](t, a.call(http.MethodPatch, "/groups", map[string]any{
+		"id": g.ID, "metadata": map[string]any{"room": nil, "schedule": map[string]any{"hour": 19}, "floor": 1},
+	}), 200)
+	wantMeta := map[string]any{"floor": 1.0, "schedule": map[string]any{"day": "mon", "hour": 19.0}}
+	if !reflect.DeepEqual(merged.Metadata, wantMeta) {
+		t.Fatalf("merged metadata %v, want %v", merged.Metadata, wantMeta)
+	}
+
+	// null clears the nullable fields
+	cleared := decode[groupRes](t, a.call(http.MethodPatch, "/groups", map[string]any{"id": g.ID, "description": nil, "metadata": nil}), 200)
+	if cleared.Description != "" || cleared.Metadata != nil || cleared.Name != g.Name {
+		t.Fatalf("cleared %+v", cleared)
+	}
+
+	// and is refused for the required ones
+	for _, field := range []string{"name", "teacher_id", "default_fee"} {
+		t.Run(field, func(t *testing.T) {
+			expect(t, a.call(http.MethodPatch, "/groups", map[string]any{"id": g.ID, field: nil}), 422)
+		})
+	}
+	if got := decode[groupRes](t, a.call(http.MethodGet, "/groups/"+g.ID), 200); got.Name != g.Name {
+		t.Fatalf("a refused patch changed the name to %q", got.Name)
+	}
+}
+
+func TestGroupsETag(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	g := a.createGroup("English B1", a.createTeacher("teacher"))
+
+	resp := a.call(http.MethodGet, "/groups/"+g.ID)
+	expect(t, resp, 200)
+	etag := resp.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	expect(t, a.call(http.MethodGet, "/groups/"+g.ID, "If-None-Match: "+etag), 304)
+
+	resp = a.call(http.MethodPatch, "/groups", "If-Match: "+etag, map[string]any{"id": g.ID, "name": "English B2"})
+	expect(t, resp, 200)
+	next := resp.Header().Get("ETag")
+	if next == "" || next == etag {
+		t.Fatalf("PATCH sent the ETag %q, want a new one after %q", next, etag)
+	}
+	expect(t, a.call(http.MethodGet, "/groups/"+g.ID, "If-None-Match: "+etag), 200)
+
+	// the old ETag is stale for both writes
+	expect(t, a.call(http.MethodPatch, "/groups", "If-Match: "+etag, map[string]any{"id": g.ID, "name": "English C1"}), 412)
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID, "If-Match: "+etag), 412)
+	if got := decode[groupRes](t, a.call(http.MethodGet, "/groups/"+g.ID), 200); got.Name != "English B2" {
+		t.Fatalf("a stale write changed the name to %q", got.Name)
+	}
+
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID, "If-Match: "+next), 200)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/lib/tokens"
+	"github.com/ICan-TC/users/internal/config"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/adapters/humachi"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/go-chi/chi/v5"
+	"github.com/oklog/ulid/v2"
+)
+
+// testSecret signs the tokens of the test API, AuthMiddleware checking them
+// against the config loaded by TestMain
+const testSecret = "test-secret"
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(`Server:
+  Port: 8888
+  LogLevel: error
+  LogFormat: text
+  Store: memory
+  IdempotencyKeyTTL: 86400
+Auth:
+  Secret: %s
+  AccessTokenTTL: 86400
+  RefreshTokenTTL: 86400
+  RateLimit: 1000
+Billing:
+  Center: test
+  Currency: TND
+  Decimals: 3
+  Proration: none
+  Provider: none
+  DueDays: 15
+  ReminderDays: 7,21,45
+  LateFee: none
+`, testSecret)), 0o600); err != nil {
+		panic(err)
+	}
+	os.Setenv("CONFIG_PATH", path)
+	config.Load()
+	os.Exit(m.Run())
+}
+
+// testAPI serves the whole API over a memory store, calling it as the user
+// it signed up
+type testAPI struct {
+	humatest.TestAPI
+	t      *testing.T
+	store  *service.MemoryStore
+	token  string
+	userID string
+}
+
+// newTestAPI registers every route over a new memory store, with opts
+// completed by defaults, and signs up a user
+func newTestAPI(t *testing.T, opts RouteOptions) *testAPI {
+	t.Helper()
+	tp, err := tokens.NewTokenProvider(tokens.TokenProviderArgs{Secret: testSecret, AccessTokenTTL: 86400, RefreshTokenTTL: 86400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Tokens = tp
+	if opts.Center == "" {
+		opts.Center = "test"
+	}
+	if opts.Proration == "" {
+		opts.Proration = "none"
+	}
+	if opts.Secret == "" {
+		opts.Secret = testSecret
+	}
+	if opts.IdempotencyTTL == 0 {
+		opts.IdempotencyTTL = time.Hour
+	}
+	// chi serves the routes as in the server, such as /invoices/{id}.pdf
+	api := humatest.Wrap(t, humachi.New(chi.NewMux(), huma.DefaultConfig("Test API", "1.0.0")))
+	a := &testAPI{TestAPI: api, t: t, store: service.NewMemoryStore()}
+	RegisterRoutes(api, a.store, opts)
+	a.token, a.userID = a.signup("caller")
+	return a
+}
+
+// signup signs a user up and returns their access token and ID
+func (a *testAPI) signup(username string) (string, string) {
+	a.t.Helper()
+	resp := a.Post("/auth/signup", map[string]any{
+		"username": username, "email": username + "@example.com", "password": "password123",
+	})
+	tok := decode[struct {
+		AccessToken string `json:"access_token"`
+	}](a.t, resp, 200)
+	claims := decode[map[string]any](a.t, a.Post("/auth/verify", map[string]any{"token": tok.AccessToken}), 200)
+	id, _ := claims["sub"].(string)
+	if id == "" {
+		a.t.Fatalf("no subject in the claims %v", claims)
+	}
+	return tok.AccessToken, id
+}
+
+// call sends a request as the signed up user. args are headers such as
+// "If-Match: ..." and at most one body, as for humatest.
+func (a *testAPI) call(method string, path string, args ...any) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.Do(method, path, append([]any{"Authorization: Bearer " + a.token}, args...)...)
+}
+
+// decode checks the status of resp and decodes its JSON body
+func decode[T any](t *testing.T, resp *httptest.ResponseRecorder, status int) T {
+	t.Helper()
+	var v T
+	if resp.Code != status {
+		t.Fatalf("status %d, want %d: %s", resp.Code, status, resp.Body.String())
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", resp.Body.String(), err)
+	}
+	return v
+}
+
+// expect checks the status of resp
+func expect(t *testing.T, resp *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if resp.Code != status {
+		t.Fatalf("status %d, want %d: %s", resp.Code, status, strings.TrimSpace(resp.Body.String()))
+	}
+}
+
+// hire makes the user an employee holding permissions, with the record of
+// their salary since 2020, straight in the store as only HR may hire through
+// the API
+func (a *testAPI) hire(userID string, permissions ...string) string {
+	a.t.Helper()
+	m := models.Employees{
+		EmployeeID:  ulid.Make().String(),
+		UserID:      userID,
+		Role:        "secretary",
+		Salary:      1200000,
+		Status:      models.EmployeeActive,
+		Permissions: permissions,
+	}
+	if err := service.NewRepository[models.Employees](a.store).Insert(a.t.Context(), &m); err != nil {
+		a.t.Fatal(err)
+	}
+	r := models.EmployeeRecords{
+		RecordID:      ulid.Make().String(),
+		EmployeeID:    m.EmployeeID,
+		EffectiveFrom: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Role:          m.Role,
+		Salary:        m.Salary,
+		Status:        m.Status,
+	}
+	if err := service.NewRepository[models.EmployeeRecords](a.store).Insert(a.t.Context(), &r); err != nil {
+		a.t.Fatal(err)
+	}
+	return m.EmployeeID
+}
+
+// createStudent signs a user up and makes them a student, whose ID is the
+// user's
+func (a *testAPI) createStudent(username string) string {
+	a.t.Helper()
+	_, userID := a.signup(username)
+	return decode[struct {
+		ID string `json:"id"`
+	}](a.t, a.call("POST", "/students", map[string]any{"level": "A1", "user_id": userID}), 201).ID
+}
+
+// createTeacher signs a user up and makes them a teacher
+func (a *testAPI) createTeacher(username string) string {
+	a.t.Helper()
+	_, userID := a.signup(username)
+	return decode[struct {
+		ID string `json:"id"`
+	}](a.t, a.call("POST", "/teachers", map[string]any{"user_id": userID}), 201).ID
+}
+
+// createGroup creates a group taught by teacherID
+func (a *testAPI) createGroup(name string, teacherID string) groupRes {
+	a.t.Helper()
+	return decode[groupRes](a.t, a.call("POST", "/groups", map[string]any{
+		"name": name, "description": "Evening class", "teacher_id": teacherID, "default_fee": "45.000",
+		"subject": "English", "level": "B1", "metadata": map[string]any{"room": "2", "schedule": map[string]any{"day": "mon", "hour": 18}},
+	}), 201)
+}
+
+// groupRes is a group as the API sends it
+type groupRes struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	TeacherID   string         `json:"teacher_id"`
+	DefaultFee  string         `json:"default_fee"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+// issueInvoice enrolls the student in a new group of teacherID and issues
+// the invoice of the current month, 45.000 with the default fee
+func (a *testAPI) issueInvoice(studentID string, teacherID string) string {
+	a.t.Helper()
+	g := a.createGroup("Group of "+studentID, teacherID)
+	expect(a.t, a.call("POST", "/enrollments", map[string]any{"student_id": studentID, "group_id": g.ID}), 201)
+	ids := decode[struct {
+		InvoiceIDs []string `json:"invoice_ids"`
+	}](a.t, a.call("POST", "/invoices/generate", map[string]any{
+		"period": "monthly", "period_start": time.Now().Format(time.DateOnly), "student_ids": []string{studentID},
+	}), 201).InvoiceIDs
+	if len(ids) != 1 {
+		a.t.Fatalf("generated %d invoices, want 1", len(ids))
+	}
+	expect(a.t, a.call("POST", "/invoices/"+ids[0]+"/issue"), 200)
+	return ids[0]
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type ImportsHandler struct {
+	svc *service.ImportsService
+	log zerolog.Logger
+}
+
+func RegisterImportsRoutes(api huma.API, svc *service.ImportsService) {
+	h := &ImportsHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/imports")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Imports"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID: "create-import",
+		Method:      http.MethodPost,
+		Path:        "",
+		Summary:     "Upload students and parents",
+		Description: "Upload a CSV or XLSX file of students, one per row, with optionally a parent each, and get a dry run report of the problems of every row. Nothing is created until the import is committed. Large files are validated in the background and answered with 202",
+		// room for the multipart envelope around the file
+		MaxBodyBytes:  service.MaxImportBytes + 1<<20,
+		DefaultStatus: http.StatusCreated,
+	}, h.CreateImport)
+
+	huma.Register(g, huma.Operation{
+		OperationID: "list-imports",
+		Method:      http.MethodGet,
+		Path:        "",
+		Summary:     "List imports",
+		Description: "List the imports you started, without their rows",
+	}, h.ListImports)
+
+	huma.Register(g, huma.Operation{
+		OperationID: "get-import",
+		Method:      http.MethodGet,
+		Path:        "/{id}",
+		Summary:     "Get an import",
+		Description: "Get an import with its dry run report, poll it while it is validating or committing",
+	}, h.GetImport)
+
+	huma.Register(g, huma.Operation{
+		OperationID: "commit-import",
+		Method:      http.MethodPost,
+		Path:        "/{id}/commit",
+		Summary:     "Commit an import",
+		Description: "Create the students, parents and links of a validated import in a single transaction. The rows are checked again first, if new problems turned up the import goes back to validated with the new report. Large imports are committed in the background and answered with 202",
+	}, h.CommitImport)
+}
+
+func (h *ImportsHandler) CreateImport(c context.Context, input *dto.CreateImportReq) (*dto.ImportRes, error) {
+	form := input.RawBody.Data()
+	data, err := io.ReadAll(io.LimitReader(form.File, service.MaxImportBytes+1))
+	if err != nil {
+		return nil, huma.Error400BadRequest("file can't be read", err)
+	}
+	if len(data) > service.MaxImportBytes {
+		return nil, huma.NewError(http.StatusRequestEntityTooLarge, "file is larger than 10MB, split it")
+	}
+	mapping := map[string]string{}
+	if form.Mapping != "" {
+		if err := json.Unmarshal([]byte(form.Mapping), &mapping); err != nil {
+			return nil, huma.Error422UnprocessableEntity("mapping is invalid", &huma.ErrorDetail{
+				Message:  "expected a JSON object of strings",
+				Location: "body.mapping",
+				Value:    form.Mapping,
+			})
+		}
+	}
+
+	job, err := h.svc.CreateImport(c, middleware.CallerID(c), form.File.Filename, data, mapping)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("import_id", job.ImportID).Int("rows", job.TotalRows).Str("status", job.Status).Msg("Created import")
+	return importRes(h.svc, job, http.StatusCreated), nil
+}
+
+func (h *ImportsHandler) ListImports(c context.Context, input *dto.ListImportsReq) (*dto.ListImportsRes, error) {
+	return h.svc.GetImports(c, middleware.CallerID(c), input)
+}
+
+func (h *ImportsHandler) GetImport(c context.Context, input *dto.GetImportReq) (*dto.ImportRes, error) {
+	job, err := h.svc.GetImport(c, middleware.CallerID(c), input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.ImportRes{Status: http.StatusOK, Body: *h.svc.ModelToRes(job, input.Rows)}, nil
+}
+
+func (h *ImportsHandler) CommitImport(c context.Context, input *dto.CommitImportReq) (*dto.ImportRes, error) {
+	job, err := h.svc.CommitImport(c, middleware.CallerID(c), input.ID, input.SkipInvalid)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("import_id", job.ImportID).Str("status", job.Status).Int("students", job.CreatedStudents).
+		Int("parents", job.CreatedParents).Msg("Committed import")
+	return importRes(h.svc, job, http.StatusOK), nil
+}
+
+// importRes answers with 202 while the job goes on in the background
+func importRes(svc *service.ImportsService, job *models.ImportJobs, status int) *dto.ImportRes {
+	if job.Status == models.ImportValidating || job.Status == models.ImportCommitting {
+		status = http.StatusAccepted
+	}
+	return &dto.ImportRes{Status: status, Body: *svc.ModelToRes(job, "issues")}
+}
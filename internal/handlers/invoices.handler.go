@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type InvoicesHandler struct {
+	svc *service.InvoicesService
+	log zerolog.Logger
+}
+
+func RegisterInvoicesRoutes(api huma.API, svc *service.InvoicesService, idempotency *service.IdempotencyService) {
+	h := &InvoicesHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/invoices")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Invoices"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "generate-invoices",
+		Method:        http.MethodPost,
+		Path:          "/generate",
+		Summary:       "Generate the invoices of a period",
+		Description:   "Create a draft invoice for every student with active enrollments, with a line per enrollment. Monthly invoices bill the calendar month of period_start, term invoices bill each monthly fee once per month from period_start to period_end. Students already invoiced for the period are skipped",
+		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.GenerateInvoices)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-invoices",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "List invoices",
+		Description:   "List invoices",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListInvoices)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-invoice-by-id",
+		Method:        http.MethodGet,
+		Path:          "/{id}",
+		Summary:       "Get an invoice by ID",
+		Description:   "Get an invoice by ID with its lines",
+		DefaultStatus: http.StatusOK,
+	}, h.GetInvoiceByID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "issue-invoice",
+		Method:        http.MethodPost,
+		Path:          "/{id}/issue",
+		Summary:       "Issue an invoice",
+		Description:   "Issue a draft invoice, giving it the next legal number of the center. The total becomes owed by the student, and the credit of the student pays it first",
+		DefaultStatus: http.StatusOK,
+	}, h.IssueInvoice)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "void-invoice",
+		Method:        http.MethodPost,
+		Path:          "/{id}/void",
+		Summary:       "Void an invoice",
+		Description:   "Void a draft or issued invoice. An issued invoice keeps its number, and what was paid on it becomes credit of the student",
+		DefaultStatus: http.StatusOK,
+	}, h.VoidInvoice)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-invoices-by-student",
+		Method:        http.MethodGet,
+		Path:          "/student/{student_id}",
+		Summary:       "Get all invoices of a student",
+		Description:   "Get all invoices of a specific student",
+		DefaultStatus: http.StatusOK,
+	}, h.GetInvoicesByStudentID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-invoices-by-parent",
+		Method:        http.MethodGet,
+		Path:          "/parent/{parent_id}",
+		Summary:       "Get all invoices of a parent's children",
+		Description:   "Get all invoices of the students linked to a parent",
+		DefaultStatus: http.StatusOK,
+	}, h.GetInvoicesByParentID)
+}
+
+func (h *InvoicesHandler) GenerateInvoices(c context.Context, input *dto.GenerateInvoicesReq) (*dto.GenerateInvoicesRes, error) {
+	res, err := h.svc.GenerateInvoices(c, input.Body.Period, input.Body.PeriodStart, input.Body.PeriodEnd, input.Body.StudentIDs)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("period", input.Body.Period).Str("period_start", input.Body.PeriodStart).
+		Int("created", res.Created).Int("skipped", res.Skipped).
+		Msg("Generated invoices")
+	return &dto.GenerateInvoicesRes{Body: *res}, nil
+}
+
+func (h *InvoicesHandler) ListInvoices(c context.Context, input *dto.ListInvoicesReq) (*dto.ListInvoicesRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("invoices", func(w io.Writer) error {
+			return h.svc.ExportInvoices(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetInvoices(c, input)
+}
+
+func (h *InvoicesHandler) GetInvoiceByID(c context.Context, input *dto.GetInvoiceByIDReq) (*dto.GetInvoiceByIDRes, error) {
+	invoice, err := h.svc.GetInvoiceByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetInvoiceByIDRes{Body: *invoice}, nil
+}
+
+func (h *InvoicesHandler) IssueInvoice(c context.Context, input *dto.IssueInvoiceReq) (*dto.IssueInvoiceRes, error) {
+	invoice, err := h.svc.IssueInvoice(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", invoice.ID).Str("number", *invoice.Number).Msg("Issued invoice")
+	return &dto.IssueInvoiceRes{Body: *invoice}, nil
+}
+
+func (h *InvoicesHandler) VoidInvoice(c context.Context, input *dto.VoidInvoiceReq) (*dto.VoidInvoiceRes, error) {
+	invoice, err := h.svc.VoidInvoice(c, input.ID, input.Body.Reason)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", invoice.ID).Str("reason", input.Body.Reason).Msg("Voided invoice")
+	return &dto.VoidInvoiceRes{Body: *invoice}, nil
+}
+
+func (h *InvoicesHandler) GetInvoicesByStudentID(c context.Context, input *dto.GetInvoicesByStudentIDReq) (*dto.GetInvoicesByStudentIDRes, error) {
+	result, err := h.svc.GetInvoicesByStudentID(c, input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("student_id", input.StudentID).Int("count", len(result.Body.Invoices)).
+		Msg("Get invoices by student ID")
+	return result, nil
+}
+
+func (h *InvoicesHandler) GetInvoicesByParentID(c context.Context, input *dto.GetInvoicesByParentIDReq) (*dto.GetInvoicesByParentIDRes, error) {
+	result, err := h.svc.GetInvoicesByParentID(c, input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("parent_id", input.ParentID).Int("count", len(result.Body.Invoices)).
+		Msg("Get invoices by parent ID")
+	return result, nil
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
@@ -62,6 +63,15 @@ func RegisterParentsRoutes(api huma.API, svc *service.ParentsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteParent)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-parent",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a parent",
+		Description:   "List the records that deleting a parent would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteParent)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-parents",
 		Method:        http.MethodGet,
@@ -69,13 +79,15 @@ func RegisterParentsRoutes(api huma.API, svc *service.ParentsService) {
 		Summary:       "List parents",
 		Description:   "List parents",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListParents)
 }
 
 func (h *ParentsHandler) CreateParent(c context.Context, input *dto.CreateParentReq) (*dto.CreateParentRes, error) {
 	parent, err := h.svc.CreateParent(c, input.Body.UserID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
 	h.log.Info().Str("id", parent.ParentID).Str("user_id", parent.UserID).Any("created", parent.CreatedAt).
 		Msg("Created parent")
@@ -91,10 +103,9 @@ func (h *ParentsHandler) CreateParent(c context.Context, input *dto.CreateParent
 
 func (h *ParentsHandler) UpdateParent(c context.Context, input *dto.UpdateParentReq) (*dto.UpdateParentRes, error) {
 	m := models.Parents{ParentID: input.Body.ID}
-	if input.Body.UserID != nil {
-		m.UserID = *input.Body.UserID
-	}
-	parent, err := h.svc.UpdateParent(c, m)
+	patch := dto.Patch{}
+	dto.PatchValue(&patch, "user_id", input.Body.UserID, &m.UserID)
+	parent, err := h.svc.UpdateParent(c, m, patch)
 	if err != nil {
 		return nil, err
 	}
@@ -133,6 +144,19 @@ func (h *ParentsHandler) DeleteParent(c context.Context, input *dto.DeleteParent
 	}, nil
 }
 
+func (h *ParentsHandler) PreviewDeleteParent(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteParent(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
+
 func (h *ParentsHandler) ListParents(c context.Context, input *dto.ListParentsReq) (*dto.ListParentsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("parents", func(w io.Writer) error {
+			return h.svc.ExportParents(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetParents(c, input)
 }
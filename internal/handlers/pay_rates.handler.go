@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type PayRatesHandler struct {
+	svc *service.PayRatesService
+	log zerolog.Logger
+}
+
+func RegisterPayRatesRoutes(api huma.API, svc *service.PayRatesService) {
+	h := &PayRatesHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/pay-rates")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Payroll"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-pay-rate",
+		Method:        http.MethodPost,
+		Path:          "",
+		Summary:       "Create a pay rate",
+		Description:   "Create what a teacher, a group or a teacher in a group is paid per session or per hour taught",
+		DefaultStatus: http.StatusCreated,
+	}, h.CreatePayRate)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "update-pay-rate",
+		Method:        http.MethodPatch,
+		Path:          "",
+		Summary:       "Update a pay rate",
+		Description:   "Update a pay rate, its teacher and group can't change. Payslips already worked out keep the rate they were paid at until the payroll runs again",
+		DefaultStatus: http.StatusOK,
+	}, h.UpdatePayRate)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-pay-rate-by-id",
+		Method:        http.MethodGet,
+		Path:          "/{id}",
+		Summary:       "Get a pay rate by ID",
+		Description:   "Get a pay rate by ID",
+		DefaultStatus: http.StatusOK,
+	}, h.GetPayRateByID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "delete-pay-rate",
+		Method:        http.MethodDelete,
+		Path:          "/{id}",
+		Summary:       "Delete a pay rate",
+		Description:   "Delete a pay rate, which stops paying the sessions of the next payroll runs",
+		DefaultStatus: http.StatusOK,
+	}, h.DeletePayRate)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-pay-rates",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "List pay rates",
+		Description:   "List pay rates",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListPayRates)
+}
+
+func (h *PayRatesHandler) CreatePayRate(c context.Context, input *dto.CreatePayRateReq) (*dto.CreatePayRateRes, error) {
+	rate, err := h.svc.CreatePayRate(c, *input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", rate.ID).Str("basis", rate.Basis).Stringer("rate", rate.Rate).Msg("Created pay rate")
+	return &dto.CreatePayRateRes{Body: *rate}, nil
+}
+
+func (h *PayRatesHandler) UpdatePayRate(c context.Context, input *dto.UpdatePayRateReq) (*dto.UpdatePayRateRes, error) {
+	rate, err := h.svc.UpdatePayRate(c, *input)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.UpdatePayRateRes{Body: *rate}, nil
+}
+
+func (h *PayRatesHandler) GetPayRateByID(c context.Context, input *dto.GetPayRateByIDReq) (*dto.GetPayRateByIDRes, error) {
+	rate, err := h.svc.GetPayRateByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetPayRateByIDRes{Body: *rate}, nil
+}
+
+func (h *PayRatesHandler) DeletePayRate(c context.Context, input *dto.DeletePayRateReq) (*dto.DeletePayRateRes, error) {
+	if err := h.svc.DeletePayRate(c, input.ID); err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Msg("Deleted pay rate")
+	return &dto.DeletePayRateRes{Body: dto.DeletePayRateResBody{ID: input.ID}}, nil
+}
+
+func (h *PayRatesHandler) ListPayRates(c context.Context, input *dto.ListPayRatesReq) (*dto.ListPayRatesRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("pay-rates", func(w io.Writer) error {
+			return h.svc.ExportPayRates(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetPayRates(c, input)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type PaymentsHandler struct {
+	svc *service.PaymentsService
+	log zerolog.Logger
+}
+
+func RegisterPaymentsRoutes(api huma.API, svc *service.PaymentsService, idempotency *service.IdempotencyService) {
+	h := &PaymentsHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/payments")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Payments"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-payment",
+		Method:        http.MethodPost,
+		Path:          "",
+		Summary:       "Record a payment",
+		Description:   "Record a payment of a student. It pays the given issued invoice, or the open invoices of the student from the oldest, and what they don't need becomes credit of the student",
+		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.CreatePayment)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-payments",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "List payments",
+		Description:   "List payments",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListPayments)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-payment-by-id",
+		Method:        http.MethodGet,
+		Path:          "/{id}",
+		Summary:       "Get a payment by ID",
+		Description:   "Get a payment by ID with the invoices it paid and the credit it left",
+		DefaultStatus: http.StatusOK,
+	}, h.GetPaymentByID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-payments-by-student",
+		Method:        http.MethodGet,
+		Path:          "/student/{student_id}",
+		Summary:       "Get all payments of a student",
+		Description:   "Get all payments of a specific student",
+		DefaultStatus: http.StatusOK,
+	}, h.GetPaymentsByStudentID)
+
+	b := huma.NewGroup(api)
+	b.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Payments"}
+	})
+	b.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(b, huma.Operation{
+		OperationID:   "get-student-balance",
+		Method:        http.MethodGet,
+		Path:          "/students/{id}/balance",
+		Summary:       "Get the balance of a student",
+		Description:   "Get what a student owes on issued invoices and their credit",
+		DefaultStatus: http.StatusOK,
+	}, h.GetStudentBalance)
+
+	huma.Register(b, huma.Operation{
+		OperationID:   "get-family-balance",
+		Method:        http.MethodGet,
+		Path:          "/parents/{id}/balance",
+		Summary:       "Get the balance of a family",
+		Description:   "Get the balance of every student linked to a parent and their sum",
+		DefaultStatus: http.StatusOK,
+	}, h.GetFamilyBalance)
+
+	huma.Register(b, huma.Operation{
+		OperationID:   "list-ledger-entries",
+		Method:        http.MethodGet,
+		Path:          "/ledger",
+		Summary:       "List ledger entries",
+		Description:   "List the entries posted to the ledger by invoices and payments",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListLedgerEntries)
+}
+
+func (h *PaymentsHandler) CreatePayment(c context.Context, input *dto.CreatePaymentReq) (*dto.CreatePaymentRes, error) {
+	payment, err := h.svc.CreatePayment(c, middleware.CallerID(c), *input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", payment.ID).Str("student_id", payment.StudentID).
+		Str("method", payment.Method).Stringer("amount", payment.Amount).
+		Msg("Recorded payment")
+	return &dto.CreatePaymentRes{Body: *payment}, nil
+}
+
+func (h *PaymentsHandler) ListPayments(c context.Context, input *dto.ListPaymentsReq) (*dto.ListPaymentsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("payments", func(w io.Writer) error {
+			return h.svc.ExportPayments(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetPayments(c, input)
+}
+
+func (h *PaymentsHandler) GetPaymentByID(c context.Context, input *dto.GetPaymentByIDReq) (*dto.GetPaymentByIDRes, error) {
+	payment, err := h.svc.GetPaymentByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetPaymentByIDRes{Body: *payment}, nil
+}
+
+func (h *PaymentsHandler) GetPaymentsByStudentID(c context.Context, input *dto.GetPaymentsByStudentIDReq) (*dto.GetPaymentsByStudentIDRes, error) {
+	result, err := h.svc.GetPaymentsByStudentID(c, input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("student_id", input.StudentID).Int("count", len(result.Body.Payments)).
+		Msg("Get payments by student ID")
+	return result, nil
+}
+
+func (h *PaymentsHandler) GetStudentBalance(c context.Context, input *dto.GetStudentBalanceReq) (*dto.GetStudentBalanceRes, error) {
+	balance, err := h.svc.GetStudentBalance(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetStudentBalanceRes{Body: *balance}, nil
+}
+
+func (h *PaymentsHandler) GetFamilyBalance(c context.Context, input *dto.GetFamilyBalanceReq) (*dto.GetFamilyBalanceRes, error) {
+	balance, err := h.svc.GetFamilyBalance(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetFamilyBalanceRes{Body: *balance}, nil
+}
+
+func (h *PaymentsHandler) ListLedgerEntries(c context.Context, input *dto.ListLedgerEntriesReq) (*dto.ListLedgerEntriesRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("ledger", func(w io.Writer) error {
+			return h.svc.ExportLedgerEntries(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetLedgerEntries(c, input)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type PayslipsHandler struct {
+	svc *service.PayrollService
+	log zerolog.Logger
+}
+
+func RegisterPayslipsRoutes(api huma.API, svc *service.PayrollService, idempotency *service.IdempotencyService) {
+	h := &PayslipsHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/payslips")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Payroll"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "run-payroll",
+		Method:        http.MethodPost,
+		Path:          "/run",
+		Summary:       "Run the payroll of a period",
+		Description:   "Work out a draft payslip for every teacher who taught from period_start to period_end, with a line per session held, not cancelled and over, paid at its pay rate. Draft payslips of the period are worked out again keeping their adjustments, locked ones are skipped",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.RunPayroll)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-payslips",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "List payslips",
+		Description:   "List payslips, exported one row per teacher and period",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListPayslips)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-payslip-by-id",
+		Method:        http.MethodGet,
+		Path:          "/{id}",
+		Summary:       "Get a payslip by ID",
+		Description:   "Get a payslip by ID with its lines",
+		DefaultStatus: http.StatusOK,
+	}, h.GetPayslipByID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "add-payslip-adjustment",
+		Method:        http.MethodPost,
+		Path:          "/{id}/adjustments",
+		Summary:       "Add an adjustment to a payslip",
+		Description:   "Add a bonus, or a deduction with a negative amount, to a draft payslip",
+		DefaultStatus: http.StatusOK,
+	}, h.AddAdjustment)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "remove-payslip-adjustment",
+		Method:        http.MethodDelete,
+		Path:          "/{id}/adjustments/{line_id}",
+		Summary:       "Remove an adjustment from a payslip",
+		Description:   "Remove an adjustment from a draft payslip",
+		DefaultStatus: http.StatusOK,
+	}, h.RemoveAdjustment)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "lock-payslip",
+		Method:        http.MethodPost,
+		Path:          "/{id}/lock",
+		Summary:       "Lock a payslip",
+		Description:   "Make a draft payslip final. Payroll runs leave it alone and its adjustments can't change",
+		DefaultStatus: http.StatusOK,
+	}, h.LockPayslip)
+}
+
+func (h *PayslipsHandler) RunPayroll(c context.Context, input *dto.RunPayrollReq) (*dto.RunPayrollRes, error) {
+	res, err := h.svc.RunPayroll(c, input.Body.PeriodStart, input.Body.PeriodEnd, input.Body.TeacherIDs)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("period_start", input.Body.PeriodStart).Str("period_end", input.Body.PeriodEnd).
+		Int("created", res.Created).Int("updated", res.Updated).Int("skipped", res.Skipped).Int("unrated", len(res.Unrated)).
+		Msg("Ran payroll")
+	return &dto.RunPayrollRes{Body: *res}, nil
+}
+
+func (h *PayslipsHandler) ListPayslips(c context.Context, input *dto.ListPayslipsReq) (*dto.ListPayslipsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("payslips", func(w io.Writer) error {
+			return h.svc.ExportPayslips(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetPayslips(c, input)
+}
+
+func (h *PayslipsHandler) GetPayslipByID(c context.Context, input *dto.GetPayslipByIDReq) (*dto.GetPayslipByIDRes, error) {
+	payslip, err := h.svc.GetPayslipByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetPayslipByIDRes{Body: *payslip}, nil
+}
+
+func (h *PayslipsHandler) AddAdjustment(c context.Context, input *dto.AddPayslipAdjustmentReq) (*dto.AddPayslipAdjustmentRes, error) {
+	payslip, err := h.svc.AddAdjustment(c, input.ID, input.Body.Description, input.Body.Amount)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Stringer("amount", input.Body.Amount).Msg("Added payslip adjustment")
+	return &dto.AddPayslipAdjustmentRes{Body: *payslip}, nil
+}
+
+func (h *PayslipsHandler) RemoveAdjustment(c context.Context, input *dto.RemovePayslipAdjustmentReq) (*dto.RemovePayslipAdjustmentRes, error) {
+	payslip, err := h.svc.RemoveAdjustment(c, input.ID, input.LineID)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Str("line_id", input.LineID).Msg("Removed payslip adjustment")
+	return &dto.RemovePayslipAdjustmentRes{Body: *payslip}, nil
+}
+
+func (h *PayslipsHandler) LockPayslip(c context.Context, input *dto.LockPayslipReq) (*dto.LockPayslipRes, error) {
+	payslip, err := h.svc.LockPayslip(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Stringer("total", payslip.Total).Msg("Locked payslip")
+	return &dto.LockPayslipRes{Body: *payslip}, nil
+}
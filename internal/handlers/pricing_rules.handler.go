@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type PricingRulesHandler struct {
+	svc *service.PricingRulesService
+	log zerolog.Logger
+}
+
+func RegisterPricingRulesRoutes(api huma.API, svc *service.PricingRulesService) {
+	h := &PricingRulesHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/pricing-rules")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Pricing Rules"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-pricing-rule",
+		Method:        http.MethodPost,
+		Path:          "",
+		Summary:       "Create a pricing rule",
+		Description:   "Create a scholarship, sibling rule or discount lowering the fees of enrollments",
+		DefaultStatus: http.StatusCreated,
+	}, h.CreatePricingRule)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "update-pricing-rule",
+		Method:        http.MethodPatch,
+		Path:          "",
+		Summary:       "Update a pricing rule",
+		Description:   "Update a pricing rule, its kind can't change. Invoices already generated keep the prices they were generated with",
+		DefaultStatus: http.StatusOK,
+	}, h.UpdatePricingRule)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-pricing-rule-by-id",
+		Method:        http.MethodGet,
+		Path:          "/{id}",
+		Summary:       "Get a pricing rule by ID",
+		Description:   "Get a pricing rule by ID",
+		DefaultStatus: http.StatusOK,
+	}, h.GetPricingRuleByID)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "delete-pricing-rule",
+		Method:        http.MethodDelete,
+		Path:          "/{id}",
+		Summary:       "Delete a pricing rule",
+		Description:   "Delete a pricing rule, which stops applying to the fees priced from then on",
+		DefaultStatus: http.StatusOK,
+	}, h.DeletePricingRule)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "list-pricing-rules",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "List pricing rules",
+		Description:   "List pricing rules",
+		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
+	}, h.ListPricingRules)
+}
+
+func (h *PricingRulesHandler) CreatePricingRule(c context.Context, input *dto.CreatePricingRuleReq) (*dto.CreatePricingRuleRes, error) {
+	rule, err := h.svc.CreatePricingRule(c, *input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", rule.ID).Str("kind", rule.Kind).Str("name", rule.Name).Msg("Created pricing rule")
+	return &dto.CreatePricingRuleRes{Body: *rule}, nil
+}
+
+func (h *PricingRulesHandler) UpdatePricingRule(c context.Context, input *dto.UpdatePricingRuleReq) (*dto.UpdatePricingRuleRes, error) {
+	rule, err := h.svc.UpdatePricingRule(c, *input)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.UpdatePricingRuleRes{Body: *rule}, nil
+}
+
+func (h *PricingRulesHandler) GetPricingRuleByID(c context.Context, input *dto.GetPricingRuleByIDReq) (*dto.GetPricingRuleByIDRes, error) {
+	rule, err := h.svc.GetPricingRuleByID(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetPricingRuleByIDRes{Body: *rule}, nil
+}
+
+func (h *PricingRulesHandler) DeletePricingRule(c context.Context, input *dto.DeletePricingRuleReq) (*dto.DeletePricingRuleRes, error) {
+	if err := h.svc.DeletePricingRule(c, input.ID); err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("id", input.ID).Msg("Deleted pricing rule")
+	return &dto.DeletePricingRuleRes{Body: dto.DeletePricingRuleResBody{ID: input.ID}}, nil
+}
+
+func (h *PricingRulesHandler) ListPricingRules(c context.Context, input *dto.ListPricingRulesReq) (*dto.ListPricingRulesRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("pricing-rules", func(w io.Writer) error {
+			return h.svc.ExportPricingRules(c, input, export.Format, w)
+		})
+	}
+	return h.svc.GetPricingRules(c, input)
+}
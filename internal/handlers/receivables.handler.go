@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type ReceivablesHandler struct {
+	svc *service.ReceivablesService
+	log zerolog.Logger
+}
+
+func RegisterReceivablesRoutes(api huma.API, svc *service.ReceivablesService) {
+	h := &ReceivablesHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api)
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Receivables"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-receivables-aging",
+		Method:        http.MethodGet,
+		Path:          "/receivables/aging",
+		Summary:       "Get the receivables aging report",
+		Description:   "Get what each family owes on issued invoices, split by days past due: not due yet, 0-30, 31-60, 61-90 and over 90",
+		DefaultStatus: http.StatusOK,
+	}, h.GetReceivablesAging)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "run-reminders",
+		Method:        http.MethodPost,
+		Path:          "/receivables/reminders/run",
+		Summary:       "Run the overdue reminders",
+		Description:   "Charge the late fees due and remind families of their overdue invoices now, as the hourly job does. Reminders already sent aren't sent again",
+		DefaultStatus: http.StatusOK,
+	}, h.RunReminders)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "get-reminders-by-invoice",
+		Method:        http.MethodGet,
+		Path:          "/invoices/{id}/reminders",
+		Summary:       "Get the reminders of an invoice",
+		Description:   "Get the reminders sent about an overdue invoice, one per level reached",
+		DefaultStatus: http.StatusOK,
+	}, h.GetRemindersByInvoiceID)
+}
+
+func (h *ReceivablesHandler) GetReceivablesAging(c context.Context, input *dto.GetReceivablesAgingReq) (*dto.GetReceivablesAgingRes, error) {
+	var asOf *string
+	if input.AsOf != "" {
+		asOf = &input.AsOf
+	}
+	aging, err := h.svc.GetAging(c, asOf)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetReceivablesAgingRes{Body: *aging}, nil
+}
+
+func (h *ReceivablesHandler) RunReminders(c context.Context, input *dto.RunRemindersReq) (*dto.RunRemindersRes, error) {
+	run, err := h.svc.RunReminders(c, input.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("caller_id", middleware.CallerID(c)).Bool("dry_run", run.DryRun).
+		Int("sent", run.Sent).Int("failed", run.Failed).Int("late_fees", run.LateFees).Msg("Ran overdue reminders")
+	return &dto.RunRemindersRes{Body: *run}, nil
+}
+
+func (h *ReceivablesHandler) GetRemindersByInvoiceID(c context.Context, input *dto.GetRemindersByInvoiceIDReq) (*dto.GetRemindersByInvoiceIDRes, error) {
+	return h.svc.GetRemindersByInvoiceID(c, input.ID)
+}
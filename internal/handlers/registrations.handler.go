@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type RegistrationsHandler struct {
+	svc *service.RegistrationsService
+	log zerolog.Logger
+}
+
+func RegisterRegistrationsRoutes(api huma.API, svc *service.RegistrationsService, idempotency *service.IdempotencyService) {
+	h := &RegistrationsHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/registrations")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Registrations"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "register-student",
+		Method:        http.MethodPost,
+		Path:          "",
+		Summary:       "Register a student",
+		Description:   "Create a student with their user, create or link their parents and enroll them in groups in a single transaction. Returns everything that was created or linked",
+		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
+	}, h.RegisterStudent)
+}
+
+func (h *RegistrationsHandler) RegisterStudent(c context.Context, input *dto.RegisterStudentReq) (*dto.RegisterStudentRes, error) {
+	res, err := h.svc.RegisterStudent(c, input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("student_id", res.Student.ID).Int("parents", len(res.Parents)).
+		Int("enrollments", len(res.Enrollments)).Msg("Registered student")
+	return &dto.RegisterStudentRes{Body: *res}, nil
+}
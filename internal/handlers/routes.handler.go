@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/lib/tokens"
+	"github.com/ICan-TC/users/internal/checkout"
+	"github.com/ICan-TC/users/internal/document"
+	"github.com/ICan-TC/users/internal/notify"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// RouteOptions configures the services built by RegisterRoutes
+type RouteOptions struct {
+	Tokens *tokens.TokenProvider
+	// BootstrapHRUserID is the user counting as HR while no employee holds
+	// the hr permission
+	BootstrapHRUserID string
+	// IdempotencyTTL is how long the response to an Idempotency-Key is replayed
+	IdempotencyTTL time.Duration
+	// Center is the billing center invoices are numbered for
+	Center string
+	// Proration is the policy prorating enrollments covering part of a
+	// billed period
+	Proration string
+	// Branding is what invoices and receipts show of the center
+	Branding document.Branding
+	// PublicURL is where the QR codes of invoices and receipts link to
+	PublicURL string
+	// Secret signs the verification codes of invoices and receipts
+	Secret string
+	// Provider is the payment provider invoices are paid online through,
+	// online payments are off when nil
+	Provider checkout.Provider
+	// DueDays is how many days after being issued invoices are due
+	DueDays int
+	// Notifier is the channel overdue reminders are sent through, reminders
+	// are off when nil
+	Notifier notify.Notifier
+	// ReminderDays are the days overdue each level of reminder is sent at
+	ReminderDays []int
+	// LateFee is the fee charged on invoices overdue for too long
+	LateFee service.LateFeePolicy
+}
+
+// Jobs are the background work of the services built by RegisterRoutes. A
+// job whose service was skipped is nil.
+type Jobs struct {
+	// Idempotency deletes expired keys
+	Idempotency *service.IdempotencyService
+	// Employees brings employees to the records in effect
+	Employees *service.EmployeesService
+	// Receivables reminds families of overdue invoices and charges late fees
+	Receivables *service.ReceivablesService
+}
+
+// Run starts the jobs, which stop when ctx is done
+func (j Jobs) Run(ctx context.Context) {
+	if j.Idempotency != nil {
+		go j.Idempotency.RunCleanup(ctx, time.Hour)
+	}
+	if j.Employees != nil {
+		go j.Employees.RunRefresh(ctx, time.Hour)
+	}
+	if j.Receivables != nil {
+		go j.Receivables.RunSchedule(ctx, time.Hour)
+	}
+}
+
+// RegisterRoutes builds the services over store and registers their routes
+// on api. Services the store can't run are skipped. It serves the server as
+// well as handler tests, which pass a service.MemoryStore and a humatest API.
+// The server runs the returned jobs, tests may leave them.
+func RegisterRoutes(api huma.API, store service.Store, opts RouteOptions) Jobs {
+	l := logging.L()
+	jobs := Jobs{}
+
+	idempotencySvc, err := service.NewIdempotencyService(store, opts.IdempotencyTTL)
+	if err != nil {
+		l.Err(err).Msg("Skipping Idempotency Service, Idempotency-Key headers are ignored")
+		idempotencySvc = nil
+	} else {
+		jobs.Idempotency = idempotencySvc
+	}
+
+	usersSvc, err := service.NewUsersService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Users Service")
+	} else {
+		RegisterUsersRoutes(api, usersSvc, idempotencySvc)
+	}
+
+	studentsSvc, err := service.NewStudentsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Students Service")
+	} else {
+		RegisterStudentsRoutes(api, studentsSvc)
+	}
+
+	teachersSvc, err := service.NewTeachersService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Teachers Service")
+	} else {
+		RegisterTeachersRoutes(api, teachersSvc)
+	}
+
+	employeesSvc, err := service.NewEmployeesService(store, opts.BootstrapHRUserID)
+	if err != nil {
+		l.Err(err).Msg("Skipping Employees Service")
+	} else {
+		RegisterEmployeesRoutes(api, employeesSvc)
+		jobs.Employees = employeesSvc
+	}
+
+	parentsSvc, err := service.NewParentsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Parents Service")
+	} else {
+		RegisterParentsRoutes(api, parentsSvc)
+	}
+
+	studentParentsSvc, err := service.NewStudentParentsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping StudentParents Service")
+	} else {
+		RegisterStudentParentsRoutes(api, studentParentsSvc)
+	}
+
+	groupsSvc, err := service.NewGroupsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Groups Service")
+	} else {
+		RegisterGroupsRoutes(api, groupsSvc)
+	}
+
+	pricingRulesSvc, err := service.NewPricingRulesService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Pricing Rules Service")
+	} else {
+		RegisterPricingRulesRoutes(api, pricingRulesSvc)
+	}
+
+	enrollmentsSvc, err := service.NewEnrollmentsService(store, opts.Proration)
+	if err != nil {
+		l.Err(err).Msg("Skipping Enrollments Service")
+	} else {
+		RegisterEnrollmentsRoutes(api, enrollmentsSvc, idempotencySvc)
+	}
+
+	registrationsSvc, err := service.NewRegistrationsService(store, usersSvc, studentsSvc, parentsSvc, studentParentsSvc, enrollmentsSvc)
+	if err != nil {
+		l.Err(err).Msg("Skipping Registrations Service")
+	} else {
+		RegisterRegistrationsRoutes(api, registrationsSvc, idempotencySvc)
+	}
+
+	invoicesSvc, err := service.NewInvoicesService(store, opts.Center, opts.Proration, opts.DueDays)
+	if err != nil {
+		l.Err(err).Msg("Skipping Invoices Service")
+	} else {
+		RegisterInvoicesRoutes(api, invoicesSvc, idempotencySvc)
+	}
+
+	paymentsSvc, err := service.NewPaymentsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Payments Service")
+	} else {
+		RegisterPaymentsRoutes(api, paymentsSvc, idempotencySvc)
+	}
+
+	checkoutSvc, err := service.NewCheckoutService(store, opts.Provider, paymentsSvc)
+	if err != nil {
+		l.Err(err).Msg("Skipping Checkout Service, invoices can't be paid online")
+	} else {
+		RegisterCheckoutRoutes(api, checkoutSvc, idempotencySvc)
+	}
+
+	receivablesSvc, err := service.NewReceivablesService(store, invoicesSvc, opts.Notifier, opts.ReminderDays, opts.LateFee)
+	if err != nil {
+		l.Err(err).Msg("Skipping Receivables Service, overdue invoices aren't followed up")
+	} else {
+		RegisterReceivablesRoutes(api, receivablesSvc)
+		jobs.Receivables = receivablesSvc
+	}
+
+	documentsSvc, err := service.NewDocumentsService(store, opts.Branding, opts.PublicURL, opts.Secret)
+	if err != nil {
+		l.Err(err).Msg("Skipping Documents Service")
+	} else {
+		RegisterDocumentsRoutes(api, documentsSvc)
+	}
+
+	payRatesSvc, err := service.NewPayRatesService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Pay Rates Service")
+	} else {
+		RegisterPayRatesRoutes(api, payRatesSvc)
+	}
+
+	payrollSvc, err := service.NewPayrollService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Payroll Service")
+	} else {
+		RegisterPayslipsRoutes(api, payrollSvc, idempotencySvc)
+	}
+
+	importsSvc, err := service.NewImportsService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Imports Service")
+	} else {
+		if err := importsSvc.FailInterrupted(context.Background()); err != nil {
+			l.Err(err).Msg("Failed to clean up interrupted imports")
+		}
+		RegisterImportsRoutes(api, importsSvc)
+	}
+
+	searchSvc, err := service.NewSearchService(store)
+	if err != nil {
+		l.Err(err).Msg("Skipping Search Service")
+	} else {
+		RegisterSearchRoutes(api, searchSvc)
+	}
+
+	tokensSvc := service.NewTokensService(opts.Tokens, store)
+	authSvc, err := service.NewAuthService(usersSvc, tokensSvc)
+	if err != nil {
+		l.Err(err).Msg("Skipping Auth Service")
+	} else {
+		RegisterAuthRoutes(api, authSvc)
+	}
+
+	return jobs
+}
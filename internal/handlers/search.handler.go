@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/middleware"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+type SearchHandler struct {
+	svc *service.SearchService
+	log zerolog.Logger
+}
+
+func RegisterSearchRoutes(api huma.API, svc *service.SearchService) {
+	h := &SearchHandler{svc: svc, log: logging.L()}
+	g := huma.NewGroup(api, "/search")
+	g.UseSimpleModifier(func(op *huma.Operation) {
+		op.Tags = []string{"Search"}
+	})
+	g.UseMiddleware(middleware.AuthMiddleware)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "global-search",
+		Method:        http.MethodGet,
+		Path:          "",
+		Summary:       "Search users and groups",
+		Description:   "Search users and groups at once, ranked by relevance. User hits carry their student, parent, teacher and employee IDs. Only records visible to the caller are returned",
+		DefaultStatus: http.StatusOK,
+	}, h.Search)
+}
+
+func (h *SearchHandler) Search(c context.Context, input *dto.GlobalSearchReq) (*dto.GlobalSearchRes, error) {
+	res, err := h.svc.Search(c, middleware.CallerID(c), input)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("q", input.Q).Int("hits", len(res.Body.Hits)).Msg("Global search")
+	return res, nil
+}
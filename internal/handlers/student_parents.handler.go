@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
@@ -34,6 +35,15 @@ func RegisterStudentParentsRoutes(api huma.API, svc *service.StudentParentsServi
 		DefaultStatus: http.StatusCreated,
 	}, h.CreateStudentParent)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-student-parents-bulk",
+		Method:        http.MethodPost,
+		Path:          "/bulk",
+		Summary:       "Link students to parents in bulk",
+		Description:   "Link students to parents in bulk, up to 1000 at once. Items are validated one by one. In all_or_nothing mode every item is saved or none, and the response is a 422 when any failed. In best_effort mode the valid items are saved. Every item gets a result: created, updated, conflict, invalid or not_found with a reason",
+		DefaultStatus: http.StatusOK,
+	}, h.BulkCreateStudentParents)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "update-student-parent",
 		Method:        http.MethodPatch,
@@ -68,6 +78,8 @@ func RegisterStudentParentsRoutes(api huma.API, svc *service.StudentParentsServi
 		Summary:       "List student-parent relationships",
 		Description:   "List student-parent relationships",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListStudentParents)
 }
 
@@ -133,5 +145,19 @@ func (h *StudentParentsHandler) DeleteStudentParent(c context.Context, input *dt
 }
 
 func (h *StudentParentsHandler) ListStudentParents(c context.Context, input *dto.ListStudentParentsReq) (*dto.ListStudentParentsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("student-parents", func(w io.Writer) error {
+			return h.svc.ExportStudentParents(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetStudentParents(c, input)
 }
+
+func (h *StudentParentsHandler) BulkCreateStudentParents(c context.Context, input *dto.BulkCreateStudentParentsReq) (*dto.BulkRes[dto.GetStudentParentResBody], error) {
+	res, err := h.svc.BulkCreateStudentParents(c, input.Mode, input.Body.Items)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("mode", input.Mode).Int("succeeded", res.Body.Succeeded).Int("failed", res.Body.Failed).Msg("Bulk linked students to parents")
+	return res, nil
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
@@ -44,6 +46,24 @@ func RegisterStudentsRoutes(api huma.API, svc *service.StudentsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.UpdateStudent)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "create-students-bulk",
+		Method:        http.MethodPost,
+		Path:          "/bulk",
+		Summary:       "Create students in bulk",
+		Description:   "Create students in bulk, up to 1000 at once. Items are validated one by one. In all_or_nothing mode every item is saved or none, and the response is a 422 when any failed. In best_effort mode the valid items are saved. Every item gets a result: created, updated, conflict, invalid or not_found with a reason",
+		DefaultStatus: http.StatusOK,
+	}, h.BulkCreateStudents)
+
+	huma.Register(g, huma.Operation{
+		OperationID:   "update-students-bulk",
+		Method:        http.MethodPatch,
+		Path:          "/bulk",
+		Summary:       "Update students in bulk",
+		Description:   "Update students in bulk, up to 1000 at once. Items are validated one by one. In all_or_nothing mode every item is saved or none, and the response is a 422 when any failed. In best_effort mode the valid items are saved. Every item gets a result: created, updated, conflict, invalid or not_found with a reason",
+		DefaultStatus: http.StatusOK,
+	}, h.BulkUpdateStudents)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "get-student-by-id",
 		Method:        http.MethodGet,
@@ -62,6 +82,15 @@ func RegisterStudentsRoutes(api huma.API, svc *service.StudentsService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteStudent)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-student",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a student",
+		Description:   "List the records that deleting a student would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteStudent)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-students",
 		Method:        http.MethodGet,
@@ -69,13 +98,15 @@ func RegisterStudentsRoutes(api huma.API, svc *service.StudentsService) {
 		Summary:       "List students",
 		Description:   "List students",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListStudents)
 }
 
 func (h *StudentsHandler) CreateStudent(c context.Context, input *dto.CreateStudentReq) (*dto.CreateStudentRes, error) {
 	student, err := h.svc.CreateStudent(c, input.Body.Level, input.Body.UserID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
 	h.log.Info().Str("id", student.StudentID).Str("level", *student.Level).Any("created", student.CreatedAt).
 		Msg("Created student")
@@ -92,17 +123,15 @@ func (h *StudentsHandler) CreateStudent(c context.Context, input *dto.CreateStud
 
 func (h *StudentsHandler) UpdateStudent(c context.Context, input *dto.UpdateStudentReq) (*dto.UpdateStudentRes, error) {
 	m := models.Students{StudentID: input.Body.ID}
-	if input.Body.Level != nil {
-		m.Level = input.Body.Level
-	}
-	if input.Body.UserID != nil {
-		m.UserID = input.Body.UserID
-	}
-	student, err := h.svc.UpdateStudent(c, m)
+	patch := dto.Patch{}
+	dto.PatchValuePtr(&patch, "level", input.Body.Level, &m.Level)
+	dto.PatchValuePtr(&patch, "user_id", input.Body.UserID, &m.UserID)
+	student, err := h.svc.UpdateStudent(c, m, patch, &input.Params)
 	if err != nil {
 		return nil, err
 	}
 	return &dto.UpdateStudentRes{
+		ETag: dto.QuoteETag(service.StudentETag(student)),
 		Body: dto.UpdateStudentResBody{
 			ID:        student.StudentID,
 			Level:     student.Level,
@@ -113,20 +142,42 @@ func (h *StudentsHandler) UpdateStudent(c context.Context, input *dto.UpdateStud
 	}, nil
 }
 
+func (h *StudentsHandler) BulkCreateStudents(c context.Context, input *dto.BulkCreateStudentsReq) (*dto.BulkRes[dto.StudentsModelRes], error) {
+	res, err := h.svc.BulkCreateStudents(c, input.Mode, input.Body.Items)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("mode", input.Mode).Int("succeeded", res.Body.Succeeded).Int("failed", res.Body.Failed).Msg("Bulk created students")
+	return res, nil
+}
+
+func (h *StudentsHandler) BulkUpdateStudents(c context.Context, input *dto.BulkUpdateStudentsReq) (*dto.BulkRes[dto.StudentsModelRes], error) {
+	res, err := h.svc.BulkUpdateStudents(c, input.Mode, input.Body.Items)
+	if err != nil {
+		return nil, err
+	}
+	h.log.Info().Str("mode", input.Mode).Int("succeeded", res.Body.Succeeded).Int("failed", res.Body.Failed).Msg("Bulk updated students")
+	return res, nil
+}
+
 func (h *StudentsHandler) GetStudentByID(c context.Context, input *dto.GetStudentByIDReq) (*dto.GetStudentByIDRes, error) {
 	student, err := h.svc.GetStudentByID(c, input.ID)
 	if err != nil {
 		return nil, err
 	}
+	if err := input.PreconditionFailed(student.ETag, time.Unix(int64(student.UpdatedAt), 0)); err != nil {
+		return nil, err
+	}
 	h.log.Info().Str("id", input.ID).Int("created", student.CreatedAt).
 		Msg("Get student by ID")
 	return &dto.GetStudentByIDRes{
+		ETag: dto.QuoteETag(student.ETag),
 		Body: *student,
 	}, nil
 }
 
 func (h *StudentsHandler) DeleteStudent(c context.Context, input *dto.DeleteStudentReq) (*dto.DeleteStudentRes, error) {
-	if err := h.svc.DeleteStudent(c, input.ID); err != nil {
+	if err := h.svc.DeleteStudent(c, input.ID, &input.Params); err != nil {
 		return nil, err
 	}
 	return &dto.DeleteStudentRes{
@@ -136,6 +187,19 @@ func (h *StudentsHandler) DeleteStudent(c context.Context, input *dto.DeleteStud
 	}, nil
 }
 
+func (h *StudentsHandler) PreviewDeleteStudent(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteStudent(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
+
 func (h *StudentsHandler) ListStudents(c context.Context, input *dto.ListStudentsReq) (*dto.ListStudentsRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("students", func(w io.Writer) error {
+			return h.svc.ExportStudents(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetStudents(c, input)
 }
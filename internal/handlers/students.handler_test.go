@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/service"
+)
+
+func TestStudentsETag(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	id := a.createStudent("student")
+
+	resp := a.call(http.MethodGet, "/students/"+id)
+	expect(t, resp, 200)
+	etag := resp.Header().Get("ETag")
+	if etag != `"1.1"` {
+		t.Fatalf("ETag %s, want \"1.1\"", etag)
+	}
+	expect(t, a.call(http.MethodGet, "/students/"+id, "If-None-Match: "+etag), 304)
+
+	resp = a.call(http.MethodPatch, "/students", "If-Match: "+etag, map[string]any{"id": id, "level": "A2"})
+	expect(t, resp, 200)
+	if got := resp.Header().Get("ETag"); got != `"2.1"` {
+		t.Fatalf("PATCH sent the ETag %s, want \"2.1\"", got)
+	}
+	expect(t, a.call(http.MethodPatch, "/students", "If-Match: "+etag, map[string]any{"id": id, "level": "B1"}), 412)
+
+	// editing the embedded user changes the student's ETag too
+	expect(t, a.call(http.MethodPatch, "/users", map[string]any{"id": id, "first_name": "Amira"}), 200)
+	expect(t, a.call(http.MethodDelete, "/students/"+id, `If-Match: "2.1"`), 412)
+	expect(t, a.call(http.MethodGet, "/students/"+id, `If-None-Match: "2.2"`), 304)
+	expect(t, a.call(http.MethodDelete, "/students/"+id, `If-Match: "2.2"`), 200)
+}
+
+func TestStudentsSoftDelete(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	id := a.createStudent("student")
+
+	expect(t, a.call(http.MethodDelete, "/students/"+id), 200)
+	expect(t, a.call(http.MethodGet, "/students/"+id), 404)
+	list := decode[struct {
+		Total int `json:"total"`
+	}](t, a.call(http.MethodGet, "/students"), 200)
+	if list.Total != 0 {
+		t.Fatalf("listed %d students after the deletion", list.Total)
+	}
+	// the user is kept, only the student is gone
+	expect(t, a.call(http.MethodGet, "/users/"+id), 200)
+
+	// the row is still there: reviving it only sets the level and keeps
+	// the user it belonged to
+	level := "B2"
+	m := models.Students{StudentID: id, Level: &level}
+	if err := service.NewRepository[models.Students](a.store).Revive(context.Background(), &m, "level"); err != nil {
+		t.Fatal(err)
+	}
+	if m.UserID == nil || *m.UserID != id {
+		t.Fatalf("revived the student with the user %v, want %s", m.UserID, id)
+	}
+	expect(t, a.call(http.MethodGet, "/students/"+id), 200)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
@@ -62,6 +63,15 @@ func RegisterTeachersRoutes(api huma.API, svc *service.TeachersService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteTeacher)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-teacher",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a teacher",
+		Description:   "List the records that deleting a teacher would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteTeacher)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-teachers",
 		Method:        http.MethodGet,
@@ -69,13 +79,15 @@ func RegisterTeachersRoutes(api huma.API, svc *service.TeachersService) {
 		Summary:       "List teachers",
 		Description:   "List teachers",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListTeachers)
 }
 
 func (h *TeachersHandler) CreateTeacher(c context.Context, input *dto.CreateTeacherReq) (*dto.CreateTeacherRes, error) {
 	teacher, err := h.svc.CreateTeacher(c, input.Body.UserID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
 	h.log.Info().Str("id", teacher.TeacherID).Str("user_id", *teacher.UserID).Any("created", teacher.CreatedAt).
 		Msg("Created teacher")
@@ -91,10 +103,9 @@ func (h *TeachersHandler) CreateTeacher(c context.Context, input *dto.CreateTeac
 
 func (h *TeachersHandler) UpdateTeacher(c context.Context, input *dto.UpdateTeacherReq) (*dto.UpdateTeacherRes, error) {
 	m := models.Teachers{TeacherID: input.Body.ID}
-	if input.Body.UserID != nil {
-		m.UserID = input.Body.UserID
-	}
-	teacher, err := h.svc.UpdateTeacher(c, m)
+	patch := dto.Patch{}
+	dto.PatchValuePtr(&patch, "user_id", input.Body.UserID, &m.UserID)
+	teacher, err := h.svc.UpdateTeacher(c, m, patch)
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +142,19 @@ func (h *TeachersHandler) DeleteTeacher(c context.Context, input *dto.DeleteTeac
 	}, nil
 }
 
+func (h *TeachersHandler) PreviewDeleteTeacher(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteTeacher(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
+
 func (h *TeachersHandler) ListTeachers(c context.Context, input *dto.ListTeachersReq) (*dto.ListTeachersRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("teachers", func(w io.Writer) error {
+			return h.svc.ExportTeachers(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetTeachers(c, input)
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestTeachersDeletionRestricted(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	teacherID := a.createTeacher("teacher")
+	g := a.createGroup("English B1", teacherID)
+	userID := decode[struct {
+		UserID string `json:"user_id"`
+	}](t, a.call(http.MethodGet, "/teachers/"+teacherID), 200).UserID
+
+	preview := decode[deletionPreview](t, a.call(http.MethodGet, "/teachers/"+teacherID+"/deletion-preview"), 200)
+	i := slices.IndexFunc(preview.Affected, func(d deletionImpact) bool { return d.Entity == "groups" })
+	if preview.Allowed || i < 0 || preview.Affected[i].Policy != "restrict" || !slices.Equal(preview.Affected[i].IDs, []string{g.ID}) {
+		t.Fatalf("preview %+v, want the group to restrict the deletion", preview)
+	}
+
+	expect(t, a.call(http.MethodDelete, "/teachers/"+teacherID), 409)
+	// the cascade from the teacher's user is held back by the group too
+	if preview := decode[deletionPreview](t, a.call(http.MethodGet, "/users/"+userID+"/deletion-preview"), 200); preview.Allowed {
+		t.Fatalf("preview %+v, want the group to restrict deleting the user", preview)
+	}
+	expect(t, a.call(http.MethodDelete, "/users/"+userID), 409)
+	expect(t, a.call(http.MethodGet, "/teachers/"+teacherID), 200)
+	expect(t, a.call(http.MethodGet, "/users/"+userID), 200)
+
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID), 200)
+	preview = decode[deletionPreview](t, a.call(http.MethodGet, "/teachers/"+teacherID+"/deletion-preview"), 200)
+	if !preview.Allowed {
+		t.Fatalf("preview %+v, want the deletion allowed once the group is gone", preview)
+	}
+	expect(t, a.call(http.MethodDelete, "/teachers/"+teacherID), 200)
+	expect(t, a.call(http.MethodGet, "/teachers/"+teacherID), 404)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/ICan-TC/lib/logging"
@@ -18,7 +19,7 @@ type UsersHandler struct {
 	log zerolog.Logger
 }
 
-func RegisterUsersRoutes(api huma.API, svc *service.UsersService) {
+func RegisterUsersRoutes(api huma.API, svc *service.UsersService, idempotency *service.IdempotencyService) {
 	h := &UsersHandler{svc: svc, log: logging.L()}
 	g := huma.NewGroup(api, "/users")
 	g.UseSimpleModifier(func(op *huma.Operation) {
@@ -33,6 +34,7 @@ func RegisterUsersRoutes(api huma.API, svc *service.UsersService) {
 		Summary:       "Create a user",
 		Description:   "Create a user",
 		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{middleware.Idempotency(api, idempotency)},
 	}, h.CreateUser)
 
 	huma.Register(g, huma.Operation{
@@ -71,6 +73,15 @@ func RegisterUsersRoutes(api huma.API, svc *service.UsersService) {
 		DefaultStatus: http.StatusOK,
 	}, h.DeleteUser)
 
+	huma.Register(g, huma.Operation{
+		OperationID:   "preview-delete-user",
+		Method:        http.MethodGet,
+		Path:          "/{id}/deletion-preview",
+		Summary:       "Preview deleting a user",
+		Description:   "List the records that deleting a user would cascade to, detach or be blocked by, without deleting anything",
+		DefaultStatus: http.StatusOK,
+	}, h.PreviewDeleteUser)
+
 	huma.Register(g, huma.Operation{
 		OperationID:   "list-users",
 		Method:        http.MethodGet,
@@ -78,6 +89,8 @@ func RegisterUsersRoutes(api huma.API, svc *service.UsersService) {
 		Summary:       "List users",
 		Description:   "List users",
 		DefaultStatus: http.StatusOK,
+		Middlewares:   huma.Middlewares{middleware.Exports},
+		Responses:     middleware.ExportResponses(),
 	}, h.ListUsers)
 
 }
@@ -85,7 +98,7 @@ func RegisterUsersRoutes(api huma.API, svc *service.UsersService) {
 func (h *UsersHandler) CreateUser(c context.Context, input *dto.CreateUserReq) (*dto.CreateUserRes, error) {
 	user, err := h.svc.CreateUser(c, &input.Body)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
 	h.log.Info().Str("username", input.Body.Username).Str("email", input.Body.Email).Str("id", user.ID).Any("created", user.CreatedAt).
 		Msg("Created user")
@@ -98,28 +111,15 @@ func (h *UsersHandler) CreateUser(c context.Context, input *dto.CreateUserReq) (
 
 func (h *UsersHandler) UpdateUser(c context.Context, input *dto.UpdateUserReq) (*dto.UpdateUserRes, error) {
 	m := models.Users{UserID: input.Body.Id}
-	if input.Body.Username != nil {
-		m.Username = *input.Body.Username
-	}
-	if input.Body.Email != nil {
-		m.Email = *input.Body.Email
-	}
-	if input.Body.Password != nil {
-		m.PasswordHash = *input.Body.Password
-	}
-	if input.Body.FirstName != nil {
-		m.FirstName = input.Body.FirstName
-	}
-	if input.Body.FamilyName != nil {
-		m.FamilyName = input.Body.FamilyName
-	}
-	if input.Body.PhoneNumber != nil {
-		m.PhoneNumber = input.Body.PhoneNumber
-	}
-	if input.Body.DateOfBirth != nil {
-		m.DateOfBirth = input.Body.DateOfBirth
-	}
-	user, err := h.svc.UpdateUser(c, m)
+	patch := dto.Patch{}
+	dto.PatchValue(&patch, "username", input.Body.Username, &m.Username)
+	dto.PatchValue(&patch, "email", input.Body.Email, &m.Email)
+	dto.PatchValue(&patch, "password_hash", input.Body.Password, &m.PasswordHash)
+	dto.PatchPtr(&patch, "first_name", input.Body.FirstName, &m.FirstName)
+	dto.PatchPtr(&patch, "family_name", input.Body.FamilyName, &m.FamilyName)
+	dto.PatchPtr(&patch, "phone_number", input.Body.PhoneNumber, &m.PhoneNumber)
+	dto.PatchPtr(&patch, "date_of_birth", input.Body.DateOfBirth, &m.DateOfBirth)
+	user, err := h.svc.UpdateUser(c, m, patch)
 	if err != nil {
 		return nil, err
 	}
@@ -158,6 +158,19 @@ func (h *UsersHandler) DeleteUser(c context.Context, input *dto.DeleteUserReq) (
 		},
 	}, nil
 }
+
+func (h *UsersHandler) PreviewDeleteUser(c context.Context, input *dto.DeletionPreviewReq) (*dto.DeletionPreviewRes, error) {
+	plan, err := h.svc.PreviewDeleteUser(c, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.DeletionPreviewRes{Body: *plan}, nil
+}
 func (h *UsersHandler) ListUsers(c context.Context, input *dto.ListUsersReq) (*dto.ListUsersRes, error) {
+	if export := middleware.ExportFrom(c); export != nil {
+		return nil, export.Stream("users", func(w io.Writer) error {
+			return h.svc.ExportUsers(c, input, export.Format, w)
+		})
+	}
 	return h.svc.GetUsers(c, input)
 }
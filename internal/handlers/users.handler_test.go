@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// userRes is a user as the API sends it
+type userRes struct {
+	ID          string  `json:"id"`
+	Username    string  `json:"username"`
+	FirstName   *string `json:"first_name"`
+	PhoneNumber *string `json:"phone_number"`
+}
+
+func TestUsersMergePatch(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	path := "/users/" + a.userID
+
+	u := decode[userRes](t, a.call(http.MethodPatch, "/users", map[string]any{"id": a.userID, "first_name": "Amira", "phone_number": "+21620000000"}), 200)
+	if u.FirstName == nil || *u.FirstName != "Amira" || u.PhoneNumber == nil {
+		t.Fatalf("patched %+v", u)
+	}
+
+	// an absent field is left alone and null clears a nullable one
+	u = decode[userRes](t, a.call(http.MethodPatch, "/users", map[string]any{"id": a.userID, "phone_number": nil}), 200)
+	if u.FirstName == nil || *u.FirstName != "Amira" || u.PhoneNumber != nil {
+		t.Fatalf("patched %+v", u)
+	}
+
+	for _, field := range []string{"username", "email", "password"} {
+		t.Run(field, func(t *testing.T) {
+			expect(t, a.call(http.MethodPatch, "/users", map[string]any{"id": a.userID, field: nil}), 422)
+		})
+	}
+	if got := decode[userRes](t, a.call(http.MethodGet, path), 200); got.Username != "caller" {
+		t.Fatalf("a refused patch changed the username to %q", got.Username)
+	}
+}
+
+func TestUsersDeletionCascades(t *testing.T) {
+	a := newTestAPI(t, RouteOptions{})
+	studentID := a.createStudent("student")
+	g := a.createGroup("English B1", a.createTeacher("teacher"))
+	expect(t, a.call(http.MethodPost, "/enrollments", map[string]any{"student_id": studentID, "group_id": g.ID}), 201)
+	_, parentUserID := a.signup("parent")
+	parentID := decode[struct {
+		ID string `json:"id"`
+	}](t, a.call(http.MethodPost, "/parents", map[string]any{"user_id": parentUserID}), 201).ID
+	expect(t, a.call(http.MethodPost, "/student-parents", map[string]any{"student_id": studentID, "parent_id": parentID}), 201)
+
+	// the group can't go while the student is enrolled
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID), 409)
+
+	preview := decode[deletionPreview](t, a.call(http.MethodGet, "/users/"+studentID+"/deletion-preview"), 200)
+	if !preview.Allowed {
+		t.Fatalf("deleting the user isn't allowed: %+v", preview)
+	}
+	for _, want := range []struct{ entity, policy string }{
+		{"students", "cascade_soft_delete"},
+		{"enrollments", "cascade_soft_delete"},
+		{"student_parents", "detach"},
+	} {
+		if n := preview.count(want.entity, want.policy); n != 1 {
+			t.Errorf("preview %s %s %d times, want once", want.policy, want.entity, n)
+		}
+	}
+	// the preview changed nothing
+	expect(t, a.call(http.MethodGet, "/students/"+studentID), 200)
+
+	expect(t, a.call(http.MethodDelete, "/users/"+studentID), 200)
+	expect(t, a.call(http.MethodGet, "/users/"+studentID), 404)
+	expect(t, a.call(http.MethodGet, "/students/"+studentID), 404)
+	expect(t, a.call(http.MethodGet, "/enrollments/"+studentID+"/"+g.ID), 404)
+	expect(t, a.call(http.MethodGet, "/student-parents/"+studentID+"/"+parentID), 404)
+	// the parent is detached, not deleted
+	expect(t, a.call(http.MethodGet, "/parents/"+parentID), 200)
+	// and the enrollment no longer holds the group back
+	expect(t, a.call(http.MethodDelete, "/groups/"+g.ID), 200)
+}
+
+// deletionPreview is the response of a deletion-preview endpoint
+type deletionPreview struct {
+	Allowed  bool             `json:"allowed"`
+	Affected []deletionImpact `json:"affected"`
+}
+
+type deletionImpact struct {
+	Entity string   `json:"entity"`
+	Policy string   `json:"policy"`
+	Count  int      `json:"count"`
+	IDs    []string `json:"ids"`
+}
+
+// count is the number of entity records the preview applies policy to
+func (p deletionPreview) count(entity string, policy string) int {
+	n := 0
+	for _, a := range p.Affected {
+		if a.Entity == entity && a.Policy == policy {
+			n += a.Count
+		}
+	}
+	return n
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 )
 
+type claimsKey struct{}
+
 func AuthMiddleware(hc huma.Context, next func(huma.Context)) {
 	ctx := hc.Context()
 	h := hc.Header("Authorization")
@@ -30,7 +33,7 @@ func AuthMiddleware(hc huma.Context, next func(huma.Context)) {
 		return
 	}
 
-	_, err := tokens.ParseToken(ctx, splits[1], config.Get().Auth.Secret, "access")
+	claims, err := tokens.ParseToken(ctx, splits[1], config.Get().Auth.Secret, "access")
 	if err != nil {
 		hc.SetStatus(http.StatusUnauthorized)
 		hc.SetHeader("Content-Type", "text/plain")
@@ -39,5 +42,20 @@ func AuthMiddleware(hc huma.Context, next func(huma.Context)) {
 		)
 		return
 	}
-	next(hc)
+	next(huma.WithValue(hc, claimsKey{}, claims))
+}
+
+// Claims returns the access token claims of the caller, nil outside of
+// routes using AuthMiddleware.
+func Claims(ctx context.Context) *tokens.UserClaims {
+	claims, _ := ctx.Value(claimsKey{}).(*tokens.UserClaims)
+	return claims
+}
+
+// CallerID returns the user ID of the caller, empty when unauthenticated.
+func CallerID(ctx context.Context) string {
+	if claims := Claims(ctx); claims != nil {
+		return claims.Subject
+	}
+	return ""
 }
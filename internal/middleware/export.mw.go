@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/negotiation"
+)
+
+type exportKey struct{}
+
+// exportAccept are the content types a list endpoint can answer with, JSON
+// first so */* keeps getting JSON
+var exportAccept = []string{"application/json", "text/csv", spreadsheet.ContentTypeXLSX}
+
+// Export is a spreadsheet export asked of a list endpoint. The handler
+// streams it with Stream and returns no output.
+type Export struct {
+	Format  string
+	hc      huma.Context
+	started bool
+}
+
+// exportContext keeps Huma from setting the status of a response already
+// being streamed
+type exportContext struct {
+	humaContext
+	export *Export
+}
+
+func (c *exportContext) SetStatus(code int) {
+	if !c.export.started {
+		c.humaContext.SetStatus(code)
+	}
+}
+
+// Exports turns a list operation into an export of its whole result when
+// format=csv or format=xlsx is passed, or the Accept header prefers CSV or
+// XLSX over JSON. Handlers check for it with ExportFrom.
+func Exports(hc huma.Context, next func(huma.Context)) {
+	format := hc.Query("format")
+	if format == "" {
+		switch negotiation.SelectQValueFast(hc.Header("Accept"), exportAccept) {
+		case "text/csv":
+			format = spreadsheet.FormatCSV
+		case spreadsheet.ContentTypeXLSX:
+			format = spreadsheet.FormatXLSX
+		}
+	}
+	// anything else is left to the validation of the format parameter
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		next(hc)
+		return
+	}
+	e := &Export{Format: format}
+	e.hc = &exportContext{humaContext: hc, export: e}
+	next(huma.WithValue(e.hc, exportKey{}, e))
+}
+
+// ExportFrom returns the export asked of the operation, nil when the caller
+// wants a JSON page.
+func ExportFrom(ctx context.Context) *Export {
+	e, _ := ctx.Value(exportKey{}).(*Export)
+	return e
+}
+
+// Stream sends the file write writes as an attachment named after name and
+// the date. The response only starts with the first byte written, errors
+// before it are sent as usual. Later ones abort the connection so the
+// client doesn't mistake a truncated file for a complete one.
+func (e *Export) Stream(name string, write func(w io.Writer) error) error {
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("2006-01-02"), e.Format)
+	w := &exportWriter{export: e, filename: filename}
+	if err := write(w); err != nil {
+		if !e.started {
+			return err
+		}
+		log := logging.L()
+		log.Err(err).Str("filename", filename).Msg("Export failed while streaming")
+		panic(http.ErrAbortHandler)
+	}
+	w.start()
+	return nil
+}
+
+type exportWriter struct {
+	export   *Export
+	filename string
+}
+
+func (w *exportWriter) start() {
+	e := w.export
+	if e.started {
+		return
+	}
+	e.hc.SetHeader("Content-Type", spreadsheet.ContentType(e.Format))
+	e.hc.SetHeader("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, strings.ReplaceAll(w.filename, `"`, "")))
+	e.hc.SetStatus(http.StatusOK)
+	e.started = true
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	w.start()
+	return w.export.hc.BodyWriter().Write(p)
+}
+
+// ExportResponses documents the files sent by Exports next to the JSON
+// response of a list operation.
+func ExportResponses() map[string]*huma.Response {
+	return map[string]*huma.Response{
+		"200": {
+			Content: map[string]*huma.MediaType{
+				"application/json":          {},
+				"text/csv":                  {Schema: &huma.Schema{Type: huma.TypeString}},
+				spreadsheet.ContentTypeXLSX: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+			},
+		},
+	}
+}
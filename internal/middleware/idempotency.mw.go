@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/service"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotentBodySize = 1024 * 1024
+)
+
+// Idempotency makes an operation safe to retry. The first response sent for
+// an Idempotency-Key header is stored with a hash of the request and replayed
+// for every retry by the same user. Reusing a key with another request fails
+// with 422, and a retry arriving while the first request still runs gets a
+// 409. Server errors and panics are not stored so the request can be
+// retried, and a claim outliving the idempotency lease, whose server died
+// mid-request, is taken over by the next retry.
+//
+// It must run after AuthMiddleware, keys are scoped to the caller. Without a
+// service, in stores without a database, the header is ignored.
+func Idempotency(api huma.API, svc *service.IdempotencyService) func(huma.Context, func(huma.Context)) {
+	log := logging.L().With().Str("middleware", "idempotency").Logger()
+	return func(hc huma.Context, next func(huma.Context)) {
+		key := hc.Header(IdempotencyKeyHeader)
+		if key == "" || svc == nil {
+			next(hc)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			huma.WriteErr(api, hc, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		userID := CallerID(hc.Context())
+		if userID == "" {
+			huma.WriteErr(api, hc, http.StatusUnauthorized, "Idempotency-Key requires an authenticated caller")
+			return
+		}
+
+		limit := hc.Operation().MaxBodyBytes
+		if limit <= 0 {
+			limit = defaultIdempotentBodySize
+		}
+		body, err := io.ReadAll(io.LimitReader(hc.BodyReader(), limit+1))
+		if err != nil {
+			huma.WriteErr(api, hc, http.StatusBadRequest, "couldn't read request body", err)
+			return
+		}
+		hash := sha256.New()
+		io.WriteString(hash, hc.Method()+" "+hc.URL().Path+"\n")
+		hash.Write(body)
+
+		// Bookkeeping must survive the client hanging up mid-request
+		ctx := context.WithoutCancel(hc.Context())
+		rec := &models.IdempotencyKeys{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hex.EncodeToString(hash.Sum(nil)),
+			Method:      hc.Method(),
+			Path:        hc.URL().Path,
+		}
+		existing, err := svc.Claim(ctx, rec)
+		if err != nil {
+			huma.WriteErr(api, hc, http.StatusInternalServerError, "couldn't check Idempotency-Key")
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != rec.RequestHash:
+				huma.WriteErr(api, hc, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+			case existing.CompletedAt == nil:
+				huma.WriteErr(api, hc, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			default:
+				for name, values := range existing.ResponseHeaders {
+					for _, v := range values {
+						hc.AppendHeader(name, v)
+					}
+				}
+				hc.SetHeader(IdempotentReplayedHeader, "true")
+				hc.SetStatus(existing.StatusCode)
+				hc.BodyWriter().Write(existing.ResponseBody)
+			}
+			return
+		}
+
+		// a handler panicking leaves nothing to replay, the key is released
+		// so the retry runs
+		defer func() {
+			if r := recover(); r != nil {
+				svc.Release(ctx, rec)
+				panic(r)
+			}
+		}()
+		rc := &recordingContext{humaContext: hc, body: bytes.NewReader(body), header: http.Header{}}
+		next(rc)
+
+		if rc.status == 0 {
+			rc.status = http.StatusOK
+		}
+		if rc.status >= http.StatusInternalServerError {
+			svc.Release(ctx, rec)
+			return
+		}
+		rec.StatusCode = rc.status
+		rec.ResponseHeaders = rc.header
+		rec.ResponseBody = rc.buf.Bytes()
+		if err := svc.Complete(ctx, rec); err != nil {
+			log.Err(err).Str("key", key).Msg("Response sent but not stored, releasing the key")
+			svc.Release(ctx, rec)
+		}
+	}
+}
+
+// humaContext lets recordingContext embed huma.Context, whose Context method
+// would clash with the embedded field name.
+type humaContext = huma.Context
+
+// recordingContext hands a buffered request body to the handler and keeps a
+// copy of the status, headers and body it writes.
+type recordingContext struct {
+	humaContext
+	body   io.Reader
+	status int
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (c *recordingContext) BodyReader() io.Reader {
+	return c.body
+}
+
+func (c *recordingContext) SetStatus(code int) {
+	c.status = code
+	c.humaContext.SetStatus(code)
+}
+
+func (c *recordingContext) SetHeader(name, value string) {
+	c.header.Set(name, value)
+	c.humaContext.SetHeader(name, value)
+}
+
+func (c *recordingContext) AppendHeader(name, value string) {
+	c.header.Add(name, value)
+	c.humaContext.AppendHeader(name, value)
+}
+
+func (c *recordingContext) BodyWriter() io.Writer {
+	return io.MultiWriter(c.humaContext.BodyWriter(), &c.buf)
+}
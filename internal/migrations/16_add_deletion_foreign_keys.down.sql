@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS enrollments_group_id_idx;
+DROP INDEX IF EXISTS groups_teacher_id_idx;
+
+ALTER TABLE student_parents
+	DROP CONSTRAINT IF EXISTS student_parents_parent_id_fkey,
+	DROP CONSTRAINT IF EXISTS student_parents_student_id_fkey;
+
+ALTER TABLE parents DROP CONSTRAINT IF EXISTS parents_user_id_fkey;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ DEFAULT NULL;
+
+-- Rows left behind by earlier hard deletes would make the constraints below
+-- fail. Parents whose user is gone go first, soft deleting them wouldn't do
+-- as the constraint checks every row, then the links left without a student
+-- or a parent, theirs included.
+DELETE FROM parents p
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = p.user_id);
+
+DELETE FROM student_parents sp
+WHERE NOT EXISTS (SELECT 1 FROM students s WHERE s.id = sp.student_id)
+   OR NOT EXISTS (SELECT 1 FROM parents p WHERE p.id = sp.parent_id);
+
+ALTER TABLE parents
+	ADD CONSTRAINT parents_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE student_parents
+	ADD CONSTRAINT student_parents_student_id_fkey FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+	ADD CONSTRAINT student_parents_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES parents(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS groups_teacher_id_idx ON groups(teacher_id);
+CREATE INDEX IF NOT EXISTS enrollments_group_id_idx ON enrollments(group_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS enrollments_created_at_pk_idx;
+DROP INDEX IF EXISTS groups_created_at_id_idx;
+DROP INDEX IF EXISTS students_created_at_id_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
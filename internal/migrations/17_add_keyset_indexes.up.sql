@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users(created_at, id);
+CREATE INDEX IF NOT EXISTS students_created_at_id_idx ON students(created_at, id);
+CREATE INDEX IF NOT EXISTS groups_created_at_id_idx ON groups(created_at, id);
+CREATE INDEX IF NOT EXISTS enrollments_created_at_pk_idx ON enrollments(created_at, student_id, group_id);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS groups_description_trgm_idx;
+DROP INDEX IF EXISTS groups_level_trgm_idx;
+DROP INDEX IF EXISTS groups_subject_trgm_idx;
+DROP INDEX IF EXISTS groups_name_trgm_idx;
+
+DROP INDEX IF EXISTS students_level_trgm_idx;
+
+DROP INDEX IF EXISTS users_full_name_trgm_idx;
+DROP INDEX IF EXISTS users_family_name_trgm_idx;
+DROP INDEX IF EXISTS users_first_name_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_username_trgm_idx;
+
+DROP FUNCTION IF EXISTS search_normalize(text);
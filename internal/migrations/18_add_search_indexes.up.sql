@@ -0,0 +1,20 @@
+-- unaccent() is only STABLE, so it can't be used in an index directly.
+-- Passing the dictionary explicitly makes the wrapper safe to mark IMMUTABLE.
+CREATE OR REPLACE FUNCTION search_normalize(text) RETURNS text
+LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+AS $$ SELECT lower(public.unaccent('public.unaccent'::regdictionary, $1)) $$;
+
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING gin (search_normalize(username) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING gin (search_normalize(email) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_first_name_trgm_idx ON users USING gin (search_normalize(first_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_family_name_trgm_idx ON users USING gin (search_normalize(family_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx ON users USING gin (
+	search_normalize(coalesce(first_name, '') || ' ' || coalesce(family_name, '')) gin_trgm_ops
+);
+
+CREATE INDEX IF NOT EXISTS students_level_trgm_idx ON students USING gin (search_normalize(level) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS groups_name_trgm_idx ON groups USING gin (search_normalize(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS groups_subject_trgm_idx ON groups USING gin (search_normalize(subject) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS groups_level_trgm_idx ON groups USING gin (search_normalize(level) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS groups_description_trgm_idx ON groups USING gin (search_normalize(description) gin_trgm_ops);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS groups_bump_version ON groups;
+DROP TRIGGER IF EXISTS students_bump_version ON students;
+DROP TRIGGER IF EXISTS users_bump_version ON users;
+DROP FUNCTION IF EXISTS bump_row_version();
+
+ALTER TABLE groups DROP COLUMN IF EXISTS version;
+ALTER TABLE students DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
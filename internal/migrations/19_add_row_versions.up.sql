@@ -0,0 +1,22 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE students ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- Every effective change bumps the version and updated_at, which the ETags
+-- are derived from, whatever code path issued the UPDATE.
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS trigger AS $$
+BEGIN
+    IF NEW IS DISTINCT FROM OLD THEN
+        NEW.version := OLD.version + 1;
+        NEW.updated_at := now();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_bump_version BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+CREATE TRIGGER students_bump_version BEFORE UPDATE ON students
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+CREATE TRIGGER groups_bump_version BEFORE UPDATE ON groups
+    FOR EACH ROW EXECUTE FUNCTION bump_row_version();
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS import_jobs (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	filename TEXT NOT NULL,
+	format TEXT NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('validating', 'validated', 'committing', 'committed', 'failed')),
+	mapping JSONB NOT NULL DEFAULT '{}',
+	rows JSONB NOT NULL DEFAULT '[]',
+	total_rows INT NOT NULL DEFAULT 0,
+	valid_rows INT NOT NULL DEFAULT 0,
+	invalid_rows INT NOT NULL DEFAULT 0,
+	created_students INT NOT NULL DEFAULT 0,
+	created_parents INT NOT NULL DEFAULT 0,
+	created_links INT NOT NULL DEFAULT 0,
+	error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	committed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS import_jobs_user_id_idx ON import_jobs(user_id, created_at DESC);
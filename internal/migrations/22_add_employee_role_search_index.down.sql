@@ -0,0 +1 @@
+DROP INDEX IF EXISTS employees_role_trgm_idx;
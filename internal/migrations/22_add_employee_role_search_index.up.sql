@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS employees_role_trgm_idx ON employees USING gin (search_normalize(role) gin_trgm_ops);
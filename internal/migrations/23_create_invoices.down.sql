@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invoice_sequences;
+DROP TABLE IF EXISTS invoice_lines;
+DROP TABLE IF EXISTS invoices;
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS invoices (
+	id TEXT PRIMARY KEY,
+	center TEXT NOT NULL,
+	-- set when the invoice is issued, drafts have no legal number yet
+	number TEXT,
+	student_id TEXT NOT NULL REFERENCES students(id),
+	period TEXT NOT NULL CHECK (period IN ('monthly', 'term')),
+	period_start DATE NOT NULL,
+	period_end DATE NOT NULL CHECK (period_end >= period_start),
+	status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'issued', 'paid', 'void')),
+	total DECIMAL(10,3) NOT NULL DEFAULT 0,
+	issued_at TIMESTAMPTZ,
+	paid_at TIMESTAMPTZ,
+	voided_at TIMESTAMPTZ,
+	void_reason TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (center, number)
+);
+
+-- A student is billed once per period, voiding an invoice allows a new one
+CREATE UNIQUE INDEX IF NOT EXISTS invoices_student_period_idx ON invoices(student_id, period_start, period_end)
+	WHERE status <> 'void';
+CREATE INDEX IF NOT EXISTS invoices_created_at_id_idx ON invoices(created_at, id);
+CREATE INDEX IF NOT EXISTS invoices_number_trgm_idx ON invoices USING gin (search_normalize(number) gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+	id TEXT PRIMARY KEY,
+	invoice_id TEXT NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+	group_id TEXT REFERENCES groups(id),
+	position INT NOT NULL,
+	description TEXT NOT NULL,
+	quantity INT NOT NULL CHECK (quantity > 0),
+	unit_price DECIMAL(10,3) NOT NULL,
+	amount DECIMAL(10,3) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS invoice_lines_invoice_id_idx ON invoice_lines(invoice_id, position);
+
+-- The last number issued per center and year, locked while issuing so
+-- numbers have no gaps
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+	center TEXT NOT NULL,
+	year INT NOT NULL,
+	last_number INT NOT NULL,
+	PRIMARY KEY (center, year)
+);
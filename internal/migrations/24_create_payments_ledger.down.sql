@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS payments;
+ALTER TABLE invoices DROP COLUMN IF EXISTS amount_paid;
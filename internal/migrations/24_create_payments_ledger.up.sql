@@ -0,0 +1,42 @@
+-- What payments covered so far, the invoice is paid once it reaches total
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_paid DECIMAL(10,3) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS payments (
+	id TEXT PRIMARY KEY,
+	student_id TEXT NOT NULL REFERENCES students(id),
+	-- the invoice the payment was made for, NULL when it settles the oldest
+	-- open invoices of the student
+	invoice_id TEXT REFERENCES invoices(id),
+	method TEXT NOT NULL CHECK (method IN ('cash', 'card', 'transfer', 'cheque')),
+	amount DECIMAL(10,3) NOT NULL CHECK (amount > 0),
+	reference TEXT,
+	received_at TIMESTAMPTZ NOT NULL,
+	recorded_by TEXT REFERENCES users(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payments_student_id_idx ON payments(student_id);
+CREATE INDEX IF NOT EXISTS payments_created_at_id_idx ON payments(created_at, id);
+CREATE INDEX IF NOT EXISTS payments_reference_trgm_idx ON payments USING gin (search_normalize(reference) gin_trgm_ops);
+
+-- Every money movement is a transaction of entries sharing txn_id whose
+-- debits equal their credits. Entries are never changed, mistakes are
+-- reversed by new transactions.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+	id TEXT PRIMARY KEY,
+	txn_id TEXT NOT NULL,
+	account TEXT NOT NULL CHECK (account IN ('receivable', 'credit', 'revenue', 'cash', 'card', 'transfer', 'cheque')),
+	student_id TEXT REFERENCES students(id),
+	invoice_id TEXT REFERENCES invoices(id),
+	payment_id TEXT REFERENCES payments(id),
+	debit DECIMAL(10,3) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+	credit DECIMAL(10,3) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+	memo TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_student_id_idx ON ledger_entries(student_id, account);
+CREATE INDEX IF NOT EXISTS ledger_entries_txn_id_idx ON ledger_entries(txn_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_payment_id_idx ON ledger_entries(payment_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_created_at_id_idx ON ledger_entries(created_at, id);
@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+ALTER TABLE invoices DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,4 @@
+-- Invoices and payments keep the currency of their center, amounts of other
+-- rows are in the currency of the center they belong to
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'TND' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'TND' CHECK (currency ~ '^[A-Z]{3}$');
@@ -0,0 +1,5 @@
+ALTER TABLE invoice_lines DROP COLUMN IF EXISTS adjustments;
+ALTER TABLE invoice_lines DROP COLUMN IF EXISTS list_price;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS adjustments;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS effective_fee;
+DROP TABLE IF EXISTS pricing_rules;
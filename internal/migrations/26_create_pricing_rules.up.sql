@@ -0,0 +1,40 @@
+-- Rules lowering the fees of enrollments, see docs/pricing.md
+CREATE TABLE IF NOT EXISTS pricing_rules (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL CHECK (kind IN ('scholarship', 'sibling', 'discount')),
+	percent INT CHECK (percent BETWEEN 1 AND 100),
+	amount DECIMAL(10,3) CHECK (amount > 0),
+	-- the group the rule is limited to, every group when NULL
+	group_id TEXT REFERENCES groups(id),
+	-- the student of a scholarship
+	student_id TEXT REFERENCES students(id),
+	-- the child of a family, counted from 1 in order of enrollment, a
+	-- sibling rule starts at
+	sibling_rank INT CHECK (sibling_rank >= 2),
+	valid_from DATE,
+	valid_until DATE CHECK (valid_until >= valid_from),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	deleted_at TIMESTAMPTZ,
+	CHECK ((percent IS NULL) <> (amount IS NULL)),
+	CHECK ((kind = 'scholarship') = (student_id IS NOT NULL)),
+	CHECK ((kind = 'sibling') = (sibling_rank IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS pricing_rules_created_at_id_idx ON pricing_rules(created_at, id);
+CREATE INDEX IF NOT EXISTS pricing_rules_student_id_idx ON pricing_rules(student_id);
+CREATE INDEX IF NOT EXISTS pricing_rules_group_id_idx ON pricing_rules(group_id);
+CREATE INDEX IF NOT EXISTS pricing_rules_name_trgm_idx ON pricing_rules USING gin (search_normalize(name) gin_trgm_ops);
+
+-- fee stays the price asked, effective_fee is what the rules leave of it
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS effective_fee DECIMAL(10,3);
+UPDATE enrollments SET effective_fee = fee WHERE effective_fee IS NULL;
+ALTER TABLE enrollments ALTER COLUMN effective_fee SET NOT NULL;
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS adjustments JSONB NOT NULL DEFAULT '[]';
+
+-- unit_price is what is billed after the rules, list_price the fee before
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS list_price DECIMAL(10,3);
+UPDATE invoice_lines SET list_price = unit_price WHERE list_price IS NULL;
+ALTER TABLE invoice_lines ALTER COLUMN list_price SET NOT NULL;
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS adjustments JSONB NOT NULL DEFAULT '[]';
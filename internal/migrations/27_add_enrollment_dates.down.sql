@@ -0,0 +1,6 @@
+ALTER TABLE invoices DROP COLUMN IF EXISTS amount_credited;
+ALTER TABLE invoice_lines DROP COLUMN IF EXISTS proration;
+ALTER TABLE invoice_lines DROP COLUMN IF EXISTS covered_to;
+ALTER TABLE invoice_lines DROP COLUMN IF EXISTS covered_from;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS end_date;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS start_date;
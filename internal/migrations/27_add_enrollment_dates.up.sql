@@ -0,0 +1,19 @@
+-- An enrollment is billed from start_date, and up to end_date once withdrawn
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS start_date DATE;
+UPDATE enrollments SET start_date = created_at::date WHERE start_date IS NULL;
+ALTER TABLE enrollments ALTER COLUMN start_date SET NOT NULL;
+ALTER TABLE enrollments ALTER COLUMN start_date SET DEFAULT CURRENT_DATE;
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS end_date DATE CHECK (end_date >= start_date);
+
+-- The days of the period a line bills, and how it was prorated when they
+-- aren't all of them
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS covered_from DATE;
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS covered_to DATE;
+UPDATE invoice_lines l SET covered_from = i.period_start, covered_to = i.period_end
+	FROM invoices i WHERE i.id = l.invoice_id AND l.covered_from IS NULL;
+ALTER TABLE invoice_lines ALTER COLUMN covered_from SET NOT NULL;
+ALTER TABLE invoice_lines ALTER COLUMN covered_to SET NOT NULL;
+ALTER TABLE invoice_lines ADD COLUMN IF NOT EXISTS proration JSONB;
+
+-- What withdrawals took off issued invoices
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_credited DECIMAL(10,3) NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS group_sessions_starts_idx;
+DROP TABLE IF EXISTS payslip_lines;
+DROP TABLE IF EXISTS payslips;
+DROP TABLE IF EXISTS pay_rates;
@@ -0,0 +1,60 @@
+-- What teachers are paid per session or per hour, for a teacher, a group or
+-- a teacher in a group
+CREATE TABLE IF NOT EXISTS pay_rates (
+	id TEXT PRIMARY KEY,
+	teacher_id TEXT REFERENCES teachers(id),
+	group_id TEXT REFERENCES groups(id),
+	basis TEXT NOT NULL CHECK (basis IN ('session', 'hour')),
+	rate DECIMAL(10,3) NOT NULL CHECK (rate > 0),
+	valid_from DATE,
+	valid_until DATE CHECK (valid_until >= valid_from),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	deleted_at TIMESTAMPTZ,
+	CHECK (teacher_id IS NOT NULL OR group_id IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS pay_rates_created_at_id_idx ON pay_rates(created_at, id);
+CREATE INDEX IF NOT EXISTS pay_rates_teacher_id_idx ON pay_rates(teacher_id);
+CREATE INDEX IF NOT EXISTS pay_rates_group_id_idx ON pay_rates(group_id);
+
+CREATE TABLE IF NOT EXISTS payslips (
+	id TEXT PRIMARY KEY,
+	teacher_id TEXT NOT NULL REFERENCES teachers(id),
+	period_start DATE NOT NULL,
+	period_end DATE NOT NULL CHECK (period_end >= period_start),
+	status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'locked')),
+	sessions INT NOT NULL DEFAULT 0,
+	minutes INT NOT NULL DEFAULT 0,
+	gross DECIMAL(10,3) NOT NULL DEFAULT 0,
+	adjusted DECIMAL(10,3) NOT NULL DEFAULT 0,
+	total DECIMAL(10,3) NOT NULL DEFAULT 0 CHECK (total >= 0),
+	locked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (teacher_id, period_start, period_end)
+);
+
+CREATE INDEX IF NOT EXISTS payslips_created_at_id_idx ON payslips(created_at, id);
+
+-- A line per session taught, and the adjustments added by hand
+CREATE TABLE IF NOT EXISTS payslip_lines (
+	id TEXT PRIMARY KEY,
+	payslip_id TEXT NOT NULL REFERENCES payslips(id) ON DELETE CASCADE,
+	position INT NOT NULL,
+	kind TEXT NOT NULL CHECK (kind IN ('session', 'adjustment')),
+	session_id TEXT REFERENCES group_sessions(id),
+	group_id TEXT REFERENCES groups(id),
+	pay_rate_id TEXT REFERENCES pay_rates(id),
+	description TEXT NOT NULL,
+	starts TIMESTAMPTZ,
+	minutes INT,
+	basis TEXT CHECK (basis IN ('session', 'hour')),
+	rate DECIMAL(10,3),
+	amount DECIMAL(10,3) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK ((kind = 'session') = (session_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS payslip_lines_payslip_id_idx ON payslip_lines(payslip_id, position);
+CREATE INDEX IF NOT EXISTS group_sessions_starts_idx ON group_sessions(starts);
@@ -0,0 +1,5 @@
+ALTER TABLE employees DROP COLUMN IF EXISTS permissions;
+ALTER TABLE employees DROP COLUMN IF EXISTS contract_end;
+ALTER TABLE employees DROP COLUMN IF EXISTS contract_start;
+ALTER TABLE employees DROP COLUMN IF EXISTS status;
+DROP TABLE IF EXISTS employee_records;
@@ -0,0 +1,33 @@
+-- The role, salary and status of an employee from a day on, see
+-- docs/employees.md. employees keeps the values of the record in effect.
+CREATE TABLE IF NOT EXISTS employee_records (
+	id TEXT PRIMARY KEY,
+	employee_id TEXT NOT NULL REFERENCES employees(id),
+	effective_from DATE NOT NULL,
+	role TEXT NOT NULL,
+	salary DECIMAL(10,3) NOT NULL CHECK (salary >= 0),
+	status TEXT NOT NULL CHECK (status IN ('active', 'on_leave', 'left')),
+	note TEXT,
+	-- the user who recorded it
+	created_by TEXT REFERENCES users(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS employee_records_employee_id_effective_from_idx
+	ON employee_records(employee_id, effective_from) WHERE deleted_at IS NULL;
+
+-- every employee starts with a record of what they have now, keyed by the
+-- employee as it is their first
+INSERT INTO employee_records (id, employee_id, effective_from, role, salary, status, created_at, updated_at)
+SELECT id, id, created_at::date, role, salary, 'active', created_at, created_at
+FROM employees
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+	CHECK (status IN ('active', 'on_leave', 'left'));
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS contract_start DATE;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS contract_end DATE CHECK (contract_end >= contract_start);
+-- what the employee may do on top of what every employee does, such as hr
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS permissions TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS checkout_sessions;
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+	CHECK (account IN ('receivable', 'credit', 'revenue', 'cash', 'card', 'transfer', 'cheque'));
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+	CHECK (method IN ('cash', 'card', 'transfer', 'cheque'));
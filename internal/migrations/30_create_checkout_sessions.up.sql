@@ -0,0 +1,34 @@
+-- Payments made online through a payment provider, each with its own ledger
+-- account holding what the provider collected
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+	CHECK (method IN ('cash', 'card', 'transfer', 'cheque', 'online'));
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_account_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_account_check
+	CHECK (account IN ('receivable', 'credit', 'revenue', 'cash', 'card', 'transfer', 'cheque', 'online'));
+
+-- A checkout page opened at a provider to pay an invoice. The session is
+-- completed once, by the first webhook saying the money was taken, which
+-- records the payment.
+CREATE TABLE IF NOT EXISTS checkout_sessions (
+	id TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	provider_session_id TEXT NOT NULL,
+	invoice_id TEXT NOT NULL REFERENCES invoices(id),
+	student_id TEXT NOT NULL REFERENCES students(id),
+	currency TEXT NOT NULL,
+	amount DECIMAL(10,3) NOT NULL CHECK (amount > 0),
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'completed', 'failed', 'expired')),
+	url TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	payment_id TEXT REFERENCES payments(id),
+	last_event_id TEXT,
+	created_by TEXT REFERENCES users(id),
+	completed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (provider, provider_session_id)
+);
+
+CREATE INDEX IF NOT EXISTS checkout_sessions_invoice_id_idx ON checkout_sessions(invoice_id);
+CREATE INDEX IF NOT EXISTS checkout_sessions_created_at_id_idx ON checkout_sessions(created_at, id);
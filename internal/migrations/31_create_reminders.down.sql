@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS reminders;
+DROP INDEX IF EXISTS invoices_open_due_date_idx;
+ALTER TABLE invoices DROP COLUMN IF EXISTS late_fee_invoice_id;
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_period_check;
+-- late fee invoices are legal records and are kept, unchecked
+ALTER TABLE invoices ADD CONSTRAINT invoices_period_check
+	CHECK (period IN ('monthly', 'term')) NOT VALID;
+ALTER TABLE invoices DROP COLUMN IF EXISTS due_date;
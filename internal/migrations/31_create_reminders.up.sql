@@ -0,0 +1,33 @@
+-- When an issued invoice is due, set when it is issued. Invoices issued
+-- before are given the default of 15 days.
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS due_date DATE;
+UPDATE invoices SET due_date = (issued_at AT TIME ZONE 'UTC')::date + 15
+	WHERE issued_at IS NOT NULL AND due_date IS NULL;
+
+-- Late fees are billed by invoices of their own, and an invoice is charged
+-- one at most
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_period_check;
+ALTER TABLE invoices ADD CONSTRAINT invoices_period_check
+	CHECK (period IN ('monthly', 'term', 'late_fee'));
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS late_fee_invoice_id TEXT REFERENCES invoices(id);
+
+CREATE INDEX IF NOT EXISTS invoices_open_due_date_idx ON invoices(due_date) WHERE status = 'issued';
+
+-- The reminders sent about overdue invoices, one per invoice and level
+CREATE TABLE IF NOT EXISTS reminders (
+	id TEXT PRIMARY KEY,
+	invoice_id TEXT NOT NULL REFERENCES invoices(id),
+	student_id TEXT NOT NULL REFERENCES students(id),
+	level INT NOT NULL CHECK (level > 0),
+	days_overdue INT NOT NULL,
+	amount_due DECIMAL(10,3) NOT NULL,
+	-- users the reminder was sent to
+	recipients TEXT[] NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL CHECK (status IN ('sent', 'failed')),
+	error TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (invoice_id, level)
+);
+
+CREATE INDEX IF NOT EXISTS reminders_created_at_id_idx ON reminders(created_at, id);
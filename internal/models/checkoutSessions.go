@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Statuses of a checkout session
+const (
+	CheckoutOpen      = "open"
+	CheckoutCompleted = "completed"
+	CheckoutFailed    = "failed"
+	CheckoutExpired   = "expired"
+)
+
+// CheckoutSessions are the checkout pages opened at a payment provider to
+// pay invoices online
+type CheckoutSessions struct {
+	bun.BaseModel     `bun:"table:checkout_sessions,alias:chk"`
+	SessionID         string       `bun:"id,pk"`
+	Provider          string       `bun:"provider"`
+	ProviderSessionID string       `bun:"provider_session_id"`
+	InvoiceID         string       `bun:"invoice_id"`
+	StudentID         string       `bun:"student_id"`
+	Currency          string       `bun:"currency"`
+	Amount            money.Amount `bun:"amount"`
+	Status            string       `bun:"status"`
+	URL               string       `bun:"url"`
+	ExpiresAt         time.Time    `bun:"expires_at"`
+	// PaymentID is the payment recorded once the session completed
+	PaymentID *string `bun:"payment_id"`
+	// LastEventID is the last webhook event applied to the session
+	LastEventID *string    `bun:"last_event_id"`
+	CreatedBy   *string    `bun:"created_by"`
+	CompletedAt *time.Time `bun:"completed_at"`
+	CreatedAt   time.Time  `bun:"created_at,default:current_timestamp"`
+	UpdatedAt   time.Time  `bun:"updated_at,default:current_timestamp"`
+	Relevance   float64    `bun:"relevance,scanonly"`
+
+	Invoice *Invoices `bun:"rel:belongs-to,join:invoice_id=id"`
+}
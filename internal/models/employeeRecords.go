@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// EmployeeRecords are the role, salary and status of an employee from
+// EffectiveFrom until the next record. A record holds all three, so each one
+// reads on its own.
+type EmployeeRecords struct {
+	bun.BaseModel `bun:"table:employee_records,alias:empr"`
+	RecordID      string       `bun:"id,pk"`
+	EmployeeID    string       `bun:"employee_id"`
+	EffectiveFrom time.Time    `bun:"effective_from,type:date"`
+	Role          string       `bun:"role"`
+	Salary        money.Amount `bun:"salary"`
+	Status        string       `bun:"status"`
+	Note          *string      `bun:"note"`
+	CreatedBy     *string      `bun:"created_by"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time    `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time    `bun:"deleted_at,soft_delete,nullzero"`
+
+	Employee *Employees `bun:"rel:belongs-to,join:employee_id=id"`
+}
@@ -1,20 +1,44 @@
 package models
 
 import (
+	"slices"
 	"time"
 
+	"github.com/ICan-TC/users/internal/money"
 	"github.com/uptrace/bun"
 )
 
+// Statuses of an employee
+const (
+	EmployeeActive  = "active"
+	EmployeeOnLeave = "on_leave"
+	EmployeeLeft    = "left"
+)
+
+// PermissionHR lets an employee see salaries and change employment records
+const PermissionHR = "hr"
+
+// Employees are the staff of the center. Role, Salary and Status are those
+// of the record in effect, see EmployeeRecords.
 type Employees struct {
 	bun.BaseModel `bun:"table:employees,alias:emp"`
-	EmployeeID    string    `bun:"id,pk"`
-	Role          string    `bun:"role"`
-	Salary        float64   `bun:"salary"`
-	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	EmployeeID    string       `bun:"id,pk"`
+	Role          string       `bun:"role"`
+	Salary        money.Amount `bun:"salary"`
+	Status        string       `bun:"status"`
+	ContractStart *time.Time   `bun:"contract_start,type:date"`
+	ContractEnd   *time.Time   `bun:"contract_end,type:date"`
+	Permissions   []string     `bun:"permissions,array"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time    `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time    `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64      `bun:"relevance,scanonly"`
 
 	UserID string `bun:"user_id"`
 	User   *Users `bun:"rel:belongs-to,join:user_id=id"`
 }
+
+// Can tells whether the employee holds permission
+func (e *Employees) Can(permission string) bool {
+	return slices.Contains(e.Permissions, permission)
+}
@@ -3,17 +3,23 @@ package models
 import (
 	"time"
 
+	"github.com/ICan-TC/users/internal/money"
 	"github.com/uptrace/bun"
 )
 
 type Enrollments struct {
 	bun.BaseModel `bun:"table:enrollments,alias:enr"`
-	StudentID     string    `bun:"student_id,pk"`
-	GroupID       string    `bun:"group_id,pk"`
-	Fee           float64   `bun:"fee"`
-	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
-	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	StudentID     string            `bun:"student_id,pk"`
+	GroupID       string            `bun:"group_id,pk"`
+	Fee           money.Amount      `bun:"fee"`
+	EffectiveFee  money.Amount      `bun:"effective_fee"`
+	Adjustments   []PriceAdjustment `bun:"adjustments,type:jsonb"`
+	StartDate     time.Time         `bun:"start_date,type:date"`
+	EndDate       *time.Time        `bun:"end_date,type:date"`
+	CreatedAt     time.Time         `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time         `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time         `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64           `bun:"relevance,scanonly"`
 
 	Student *Students `bun:"rel:belongs-to,join:student_id=id"`
 	Group   *Groups   `bun:"rel:belongs-to,join:group_id=id"`
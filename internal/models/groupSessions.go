@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// GroupSessions are the scheduled sessions of a group
+type GroupSessions struct {
+	bun.BaseModel `bun:"table:group_sessions,alias:gses"`
+	SessionID     string     `bun:"id,pk"`
+	GroupID       string     `bun:"group_id"`
+	Starts        time.Time  `bun:"starts"`
+	Ends          time.Time  `bun:"ends"`
+	TeacherID     string     `bun:"teacher_id"`
+	IsOnline      bool       `bun:"is_online"`
+	Room          *string    `bun:"room"`
+	CancelledAt   *time.Time `bun:"cancelled_at"`
+	CreatedAt     time.Time  `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time  `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time  `bun:"deleted_at,soft_delete,nullzero"`
+
+	Group *Groups `bun:"rel:belongs-to,join:group_id=id"`
+}
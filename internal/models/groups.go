@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/ICan-TC/users/internal/money"
 	"github.com/uptrace/bun"
 )
 
@@ -10,15 +11,17 @@ type Groups struct {
 	bun.BaseModel `bun:"table:groups,alias:grp"`
 	GroupID       string                 `bun:"id,pk"`
 	Name          string                 `bun:"name"`
-	Description   string                 `bun:"description"`
+	Description   string                 `bun:"description,nullzero"`
 	TeacherID     string                 `bun:"teacher_id"`
-	DefaultFee    float64                `bun:"default_fee"`
+	DefaultFee    money.Amount           `bun:"default_fee"`
 	Subject       string                 `bun:"subject"`
 	Level         string                 `bun:"level"`
-	Metadata      map[string]interface{} `bun:"metadata,type:jsonb"`
+	Metadata      map[string]interface{} `bun:"metadata,type:jsonb,nullzero"`
 	CreatedAt     time.Time              `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time              `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time              `bun:"deleted_at,default:null"`
+	Version       int64                  `bun:"version,nullzero,notnull,default:1"`
+	DeletedAt     time.Time              `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64                `bun:"relevance,scanonly"`
 
 	Teacher *Teachers `bun:"rel:belongs-to,join:teacher_id=id"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type IdempotencyKeys struct {
+	bun.BaseModel   `bun:"table:idempotency_keys,alias:idk"`
+	UserID          string              `bun:"user_id,pk"`
+	Key             string              `bun:"key,pk"`
+	RequestHash     string              `bun:"request_hash"`
+	Method          string              `bun:"method"`
+	Path            string              `bun:"path"`
+	StatusCode      int                 `bun:"status_code,nullzero"`
+	ResponseHeaders map[string][]string `bun:"response_headers,type:jsonb"`
+	ResponseBody    []byte              `bun:"response_body"`
+	CreatedAt       time.Time           `bun:"created_at,default:current_timestamp"`
+	CompletedAt     *time.Time          `bun:"completed_at"`
+	ExpiresAt       time.Time           `bun:"expires_at"`
+}
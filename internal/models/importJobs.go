@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Statuses of an import job
+const (
+	ImportValidating = "validating"
+	ImportValidated  = "validated"
+	ImportCommitting = "committing"
+	ImportCommitted  = "committed"
+	ImportFailed     = "failed"
+)
+
+type ImportJobs struct {
+	bun.BaseModel   `bun:"table:import_jobs,alias:imp"`
+	ImportID        string            `bun:"id,pk"`
+	UserID          string            `bun:"user_id"`
+	Filename        string            `bun:"filename"`
+	Format          string            `bun:"format"`
+	Status          string            `bun:"status"`
+	Mapping         map[string]string `bun:"mapping,type:jsonb"`
+	Rows            []ImportRow       `bun:"rows,type:jsonb"`
+	TotalRows       int               `bun:"total_rows"`
+	ValidRows       int               `bun:"valid_rows"`
+	InvalidRows     int               `bun:"invalid_rows"`
+	CreatedStudents int               `bun:"created_students"`
+	CreatedParents  int               `bun:"created_parents"`
+	CreatedLinks    int               `bun:"created_links"`
+	Error           *string           `bun:"error"`
+	CreatedAt       time.Time         `bun:"created_at,default:current_timestamp"`
+	UpdatedAt       time.Time         `bun:"updated_at,default:current_timestamp"`
+	CommittedAt     *time.Time        `bun:"committed_at"`
+}
+
+// ImportRow is a data row of an import file, one student and optionally one
+// of their parents, with what the dry run found about it.
+type ImportRow struct {
+	Line     int           `json:"line"`
+	Student  ImportPerson  `json:"student"`
+	Parent   *ImportPerson `json:"parent,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	// ParentUserID is the existing user the parent resolved to, if any, and
+	// ParentID the existing parent
+	ParentUserID string `json:"parent_user_id,omitempty"`
+	ParentID     string `json:"parent_id,omitempty"`
+}
+
+type ImportPerson struct {
+	Username    string `json:"username,omitempty"`
+	Email       string `json:"email,omitempty"`
+	FirstName   string `json:"first_name,omitempty"`
+	FamilyName  string `json:"family_name,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+	Level       string `json:"level,omitempty"`
+}
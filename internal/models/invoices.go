@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Statuses of an invoice
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+// Billing periods of an invoice
+const (
+	PeriodMonthly = "monthly"
+	PeriodTerm    = "term"
+	// PeriodLateFee bills the late fees charged on a day, its period is
+	// that day
+	PeriodLateFee = "late_fee"
+)
+
+// Policies prorating the fee of an enrollment billed for part of a period
+const (
+	// ProrateNone bills the whole period whatever part of it is covered
+	ProrateNone = "none"
+	// ProrateDays bills the share of the days of the period covered
+	ProrateDays = "days"
+	// ProrateSessions bills the share of the sessions of the group in the
+	// period covered
+	ProrateSessions = "sessions"
+)
+
+// Proration is how much of a period a line bills: units of total days or
+// sessions under policy
+type Proration struct {
+	Policy string `json:"policy"`
+	Units  int    `json:"units"`
+	Total  int    `json:"total"`
+}
+
+type Invoices struct {
+	bun.BaseModel `bun:"table:invoices,alias:inv"`
+	InvoiceID     string       `bun:"id,pk"`
+	Center        string       `bun:"center"`
+	Currency      string       `bun:"currency"`
+	Number        *string      `bun:"number"`
+	StudentID     string       `bun:"student_id"`
+	Period        string       `bun:"period"`
+	PeriodStart   time.Time    `bun:"period_start,type:date"`
+	PeriodEnd     time.Time    `bun:"period_end,type:date"`
+	Status        string       `bun:"status"`
+	Total         money.Amount `bun:"total"`
+	AmountPaid    money.Amount `bun:"amount_paid"`
+	// AmountCredited is what withdrawals took off the total once issued
+	AmountCredited money.Amount `bun:"amount_credited"`
+	IssuedAt       *time.Time   `bun:"issued_at"`
+	// DueDate is set when the invoice is issued
+	DueDate *time.Time `bun:"due_date,type:date"`
+	// LateFeeInvoiceID is the invoice billing the late fee charged on this
+	// one
+	LateFeeInvoiceID *string    `bun:"late_fee_invoice_id"`
+	PaidAt           *time.Time `bun:"paid_at"`
+	VoidedAt         *time.Time `bun:"voided_at"`
+	VoidReason       *string    `bun:"void_reason"`
+	CreatedAt        time.Time  `bun:"created_at,default:current_timestamp"`
+	UpdatedAt        time.Time  `bun:"updated_at,default:current_timestamp"`
+	Relevance        float64    `bun:"relevance,scanonly"`
+
+	Student *Students      `bun:"rel:belongs-to,join:student_id=id"`
+	Lines   []InvoiceLines `bun:"rel:has-many,join:id=invoice_id"`
+}
+
+type InvoiceLines struct {
+	bun.BaseModel `bun:"table:invoice_lines,alias:invl"`
+	LineID        string            `bun:"id,pk"`
+	InvoiceID     string            `bun:"invoice_id"`
+	GroupID       *string           `bun:"group_id"`
+	Position      int               `bun:"position"`
+	Description   string            `bun:"description"`
+	Quantity      int               `bun:"quantity"`
+	ListPrice     money.Amount      `bun:"list_price"`
+	UnitPrice     money.Amount      `bun:"unit_price"`
+	Adjustments   []PriceAdjustment `bun:"adjustments,type:jsonb"`
+	Amount        money.Amount      `bun:"amount"`
+	CoveredFrom   time.Time         `bun:"covered_from,type:date"`
+	CoveredTo     time.Time         `bun:"covered_to,type:date"`
+	// Proration is nil when the line bills the whole period
+	Proration *Proration `bun:"proration,type:jsonb"`
+}
+
+// InvoiceSequences holds the last number issued by a center in a year
+type InvoiceSequences struct {
+	bun.BaseModel `bun:"table:invoice_sequences,alias:invs"`
+	Center        string `bun:"center,pk"`
+	Year          int    `bun:"year,pk"`
+	LastNumber    int    `bun:"last_number"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Accounts of the ledger besides the payment methods. Receivable and credit
+// are kept per student.
+const (
+	// AccountReceivable is what students owe on issued invoices
+	AccountReceivable = "receivable"
+	// AccountCredit is what students paid beyond what they owed
+	AccountCredit = "credit"
+	// AccountRevenue is what was billed
+	AccountRevenue = "revenue"
+)
+
+type LedgerEntries struct {
+	bun.BaseModel `bun:"table:ledger_entries,alias:led"`
+	EntryID       string       `bun:"id,pk"`
+	TxnID         string       `bun:"txn_id"`
+	Account       string       `bun:"account"`
+	StudentID     *string      `bun:"student_id"`
+	InvoiceID     *string      `bun:"invoice_id"`
+	PaymentID     *string      `bun:"payment_id"`
+	Debit         money.Amount `bun:"debit"`
+	Credit        money.Amount `bun:"credit"`
+	Memo          string       `bun:"memo"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+}
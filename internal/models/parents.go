@@ -13,6 +13,7 @@ type StudentParents struct {
 	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
 	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	Relevance     float64   `bun:"relevance,scanonly"`
 
 	Student *Students `bun:"rel:belongs-to,join:student_id=id"`
 	Parent  *Parents  `bun:"rel:belongs-to,join:parent_id=id"`
@@ -24,7 +25,8 @@ type Parents struct {
 	UserID        string    `bun:"user_id"`
 	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	DeletedAt     time.Time `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64   `bun:"relevance,scanonly"`
 
 	User     *Users      `bun:"rel:belongs-to,join:user_id=id"`
 	Students []*Students `bun:"m2m:student_parents,join:Parent=Student"`
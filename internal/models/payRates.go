@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Bases of a pay rate
+const (
+	PerSession = "session"
+	PerHour    = "hour"
+)
+
+// PayRates are what teachers are paid for the sessions they teach. A rate
+// is for a teacher, a group, or a teacher in a group.
+type PayRates struct {
+	bun.BaseModel `bun:"table:pay_rates,alias:payr"`
+	RateID        string       `bun:"id,pk"`
+	TeacherID     *string      `bun:"teacher_id"`
+	GroupID       *string      `bun:"group_id"`
+	Basis         string       `bun:"basis"`
+	Rate          money.Amount `bun:"rate"`
+	ValidFrom     *time.Time   `bun:"valid_from,type:date"`
+	ValidUntil    *time.Time   `bun:"valid_until,type:date"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time    `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time    `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64      `bun:"relevance,scanonly"`
+
+	Teacher *Teachers `bun:"rel:belongs-to,join:teacher_id=id"`
+	Group   *Groups   `bun:"rel:belongs-to,join:group_id=id"`
+}
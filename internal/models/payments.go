@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Methods of a payment, each one has its ledger account of the same name
+const (
+	PaymentCash     = "cash"
+	PaymentCard     = "card"
+	PaymentTransfer = "transfer"
+	PaymentCheque   = "cheque"
+	// PaymentOnline is paid through a payment provider, see CheckoutSessions
+	PaymentOnline = "online"
+)
+
+type Payments struct {
+	bun.BaseModel `bun:"table:payments,alias:pay"`
+	PaymentID     string       `bun:"id,pk"`
+	StudentID     string       `bun:"student_id"`
+	InvoiceID     *string      `bun:"invoice_id"`
+	Method        string       `bun:"method"`
+	Currency      string       `bun:"currency"`
+	Amount        money.Amount `bun:"amount"`
+	Reference     *string      `bun:"reference"`
+	ReceivedAt    time.Time    `bun:"received_at"`
+	RecordedBy    *string      `bun:"recorded_by"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time    `bun:"updated_at,default:current_timestamp"`
+	Relevance     float64      `bun:"relevance,scanonly"`
+
+	Student *Students `bun:"rel:belongs-to,join:student_id=id"`
+}
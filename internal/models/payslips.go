@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Statuses of a payslip
+const (
+	PayslipDraft  = "draft"
+	PayslipLocked = "locked"
+)
+
+// Kinds of payslip line
+const (
+	LineSession    = "session"
+	LineAdjustment = "adjustment"
+)
+
+// Payslips are what a teacher earned over a period: the sessions they
+// taught and the adjustments added by hand
+type Payslips struct {
+	bun.BaseModel `bun:"table:payslips,alias:psl"`
+	PayslipID     string       `bun:"id,pk"`
+	TeacherID     string       `bun:"teacher_id"`
+	PeriodStart   time.Time    `bun:"period_start,type:date"`
+	PeriodEnd     time.Time    `bun:"period_end,type:date"`
+	Status        string       `bun:"status"`
+	Sessions      int          `bun:"sessions"`
+	Minutes       int          `bun:"minutes"`
+	Gross         money.Amount `bun:"gross"`
+	Adjusted      money.Amount `bun:"adjusted"`
+	Total         money.Amount `bun:"total"`
+	LockedAt      *time.Time   `bun:"locked_at"`
+	CreatedAt     time.Time    `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time    `bun:"updated_at,default:current_timestamp"`
+	Relevance     float64      `bun:"relevance,scanonly"`
+
+	Teacher *Teachers      `bun:"rel:belongs-to,join:teacher_id=id"`
+	Lines   []PayslipLines `bun:"rel:has-many,join:id=payslip_id"`
+}
+
+type PayslipLines struct {
+	bun.BaseModel `bun:"table:payslip_lines,alias:psll"`
+	LineID        string        `bun:"id,pk"`
+	PayslipID     string        `bun:"payslip_id"`
+	Position      int           `bun:"position"`
+	Kind          string        `bun:"kind"`
+	SessionID     *string       `bun:"session_id"`
+	GroupID       *string       `bun:"group_id"`
+	PayRateID     *string       `bun:"pay_rate_id"`
+	Description   string        `bun:"description"`
+	Starts        *time.Time    `bun:"starts"`
+	Minutes       *int          `bun:"minutes"`
+	Basis         *string       `bun:"basis"`
+	Rate          *money.Amount `bun:"rate"`
+	Amount        money.Amount  `bun:"amount"`
+	CreatedAt     time.Time     `bun:"created_at,default:current_timestamp"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Kinds of pricing rule, applied in this order
+const (
+	// RuleScholarship lowers the fees of one student
+	RuleScholarship = "scholarship"
+	// RuleSibling lowers the fees of the younger enrolled children of a family
+	RuleSibling = "sibling"
+	// RuleDiscount lowers the fees of every student
+	RuleDiscount = "discount"
+)
+
+type PricingRules struct {
+	bun.BaseModel `bun:"table:pricing_rules,alias:prr"`
+	RuleID        string        `bun:"id,pk"`
+	Name          string        `bun:"name"`
+	Kind          string        `bun:"kind"`
+	Percent       *int          `bun:"percent"`
+	Amount        *money.Amount `bun:"amount"`
+	GroupID       *string       `bun:"group_id"`
+	StudentID     *string       `bun:"student_id"`
+	SiblingRank   *int          `bun:"sibling_rank"`
+	ValidFrom     *time.Time    `bun:"valid_from,type:date"`
+	ValidUntil    *time.Time    `bun:"valid_until,type:date"`
+	CreatedAt     time.Time     `bun:"created_at,default:current_timestamp"`
+	UpdatedAt     time.Time     `bun:"updated_at,default:current_timestamp"`
+	DeletedAt     time.Time     `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64       `bun:"relevance,scanonly"`
+
+	Group   *Groups   `bun:"rel:belongs-to,join:group_id=id"`
+	Student *Students `bun:"rel:belongs-to,join:student_id=id"`
+}
+
+// PriceAdjustment is what a pricing rule took off a fee, kept with the
+// enrollments and invoice lines it priced
+type PriceAdjustment struct {
+	RuleID  string       `json:"rule_id"`
+	Name    string       `json:"name"`
+	Kind    string       `json:"kind"`
+	Percent *int         `json:"percent,omitempty"`
+	Amount  money.Amount `json:"amount"`
+}
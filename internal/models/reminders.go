@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/uptrace/bun"
+)
+
+// Statuses of a reminder
+const (
+	ReminderSent   = "sent"
+	ReminderFailed = "failed"
+)
+
+// Reminders are the reminders sent about an overdue invoice, one per level
+// of escalation reached
+type Reminders struct {
+	bun.BaseModel `bun:"table:reminders,alias:rem"`
+	ReminderID    string       `bun:"id,pk"`
+	InvoiceID     string       `bun:"invoice_id"`
+	StudentID     string       `bun:"student_id"`
+	Level         int          `bun:"level"`
+	DaysOverdue   int          `bun:"days_overdue"`
+	AmountDue     money.Amount `bun:"amount_due"`
+	// Recipients are the users the reminder was sent to
+	Recipients []string  `bun:"recipients,array"`
+	Status     string    `bun:"status"`
+	Error      *string   `bun:"error"`
+	CreatedAt  time.Time `bun:"created_at,default:current_timestamp"`
+	UpdatedAt  time.Time `bun:"updated_at,default:current_timestamp"`
+}
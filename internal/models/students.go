@@ -12,7 +12,9 @@ type Students struct {
 	Level         *string   `bun:"level"`
 	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	Version       int64     `bun:"version,nullzero,notnull,default:1"`
+	DeletedAt     time.Time `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64   `bun:"relevance,scanonly"`
 
 	UserID *string `bun:"user_id"`
 	User   *Users  `bun:"rel:belongs-to,join:user_id=id"`
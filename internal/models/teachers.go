@@ -11,7 +11,8 @@ type Teachers struct {
 	TeacherID     string    `bun:"id,pk"`
 	CreatedAt     time.Time `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:"updated_at,default:current_timestamp"`
-	DeletedAt     time.Time `bun:"deleted_at,default:null"`
+	DeletedAt     time.Time `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64   `bun:"relevance,scanonly"`
 
 	UserID *string `bun:"user_id"`
 	User   *Users  `bun:"rel:belongs-to,join:user_id=id"`
@@ -17,6 +17,9 @@ type Users struct {
 	DateOfBirth   *time.Time `bun:"date_of_birth"`
 	CreatedAt     time.Time  `bun:"created_at,default:current_timestamp"`
 	UpdatedAt     time.Time  `bun:"updated_at,default:current_timestamp"`
+	Version       int64      `bun:"version,nullzero,notnull,default:1"`
+	DeletedAt     time.Time  `bun:"deleted_at,soft_delete,nullzero"`
+	Relevance     float64    `bun:"relevance,scanonly"`
 
 	UserID   string     `bun:"id,pk"`
 	Student  *Students  `bun:"rel:has-one,join:id=user_id"`
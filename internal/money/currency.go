@@ -0,0 +1,40 @@
+package money
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Currency is the currency amounts are in
+type Currency struct {
+	// Code is the ISO 4217 code, such as TND
+	Code string
+	// Decimals is how many decimals amounts are given with, at most Scale
+	Decimals int
+}
+
+// TND is the Tunisian dinar, divided in 1000 millimes
+var TND = Currency{Code: "TND", Decimals: 3}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// center is the currency of the center the deployment serves
+var center = TND
+
+// SetCenterCurrency sets the currency of the center, TND by default. It is
+// called once at startup, before amounts are read or written.
+func SetCenterCurrency(c Currency) error {
+	if !currencyCode.MatchString(c.Code) {
+		return fmt.Errorf("%q is not an ISO 4217 currency code", c.Code)
+	}
+	if c.Decimals < 0 || c.Decimals > Scale {
+		return fmt.Errorf("currencies have 0 to %d decimals, %s has %d", Scale, c.Code, c.Decimals)
+	}
+	center = c
+	return nil
+}
+
+// CenterCurrency returns the currency of the center
+func CenterCurrency() Currency {
+	return center
+}
@@ -0,0 +1,189 @@
+// Package money holds exact amounts of money. An Amount counts thousandths of
+// the currency unit, the scale of the DECIMAL(10,3) columns, so sums and
+// multiples of amounts are exact where float64 drifts.
+//
+// Amounts travel as decimal strings such as "100.500": in JSON, in the
+// database and in filters.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Scale is the number of decimals an Amount keeps
+const Scale = 3
+
+// unit is the Amount of one currency unit
+const unit = 1000
+
+// maxWhole is the number of digits before the point DECIMAL(10,3) holds
+const maxWhole = 7
+
+// Amount is an exact amount of money in thousandths of the currency unit.
+// Amounts add and subtract with + and -.
+type Amount int64
+
+// Parse reads a decimal amount with at most Scale decimals, such as "12",
+// "12.5" or "-0.125"
+func Parse(s string) (Amount, error) {
+	return parse(s, Scale)
+}
+
+func parse(s string, decimals int) (Amount, error) {
+	t := strings.TrimSpace(s)
+	neg := strings.HasPrefix(t, "-")
+	t = strings.TrimPrefix(strings.TrimPrefix(t, "-"), "+")
+	whole, frac, dotted := strings.Cut(t, ".")
+	if whole == "" || (dotted && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%q is not an amount", s)
+	}
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("%q has more than %d decimals", s, decimals)
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > maxWhole {
+		return 0, fmt.Errorf("%q is too large, amounts have at most %d digits before the point", s, maxWhole)
+	}
+	units, _ := strconv.ParseInt("0"+whole, 10, 64)
+	thousandths, _ := strconv.ParseInt((frac + "000")[:Scale], 10, 64)
+	a := Amount(units*unit + thousandths)
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Times returns a multiplied by n
+func (a Amount) Times(n int) Amount {
+	return a * Amount(n)
+}
+
+// Percent returns p percent of a, rounded half away from zero to the
+// decimals of the center currency
+func (a Amount) Percent(p int) Amount {
+	return a.Share(p, 100)
+}
+
+// Share returns n d-ths of a, rounded half away from zero to the decimals of
+// the center currency
+func (a Amount) Share(n, d int) Amount {
+	step := int64(math.Pow10(Scale - CenterCurrency().Decimals))
+	num, den := int64(a)*int64(n), int64(d)*step
+	sign := int64(1)
+	if num < 0 {
+		sign, num = -1, -num
+	}
+	return Amount(sign * (num + den/2) / den * step)
+}
+
+// String formats a with the decimals of the center currency, or with all of
+// them when it has more
+func (a Amount) String() string {
+	return a.format(CenterCurrency().Decimals)
+}
+
+// format writes a with decimals decimals, keeping any further non-zero ones
+func (a Amount) format(decimals int) string {
+	sign, v := "", int64(a)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	s := fmt.Sprintf("%s%d.%03d", sign, v/unit, v%unit)
+	for cut := Scale - decimals; cut > 0 && strings.HasSuffix(s, "0"); cut-- {
+		s = s[:len(s)-1]
+	}
+	return strings.TrimSuffix(s, ".")
+}
+
+// Float64 approximates a for spreadsheets, whose numbers are float64. Money
+// is never computed with it.
+func (a Amount) Float64() float64 {
+	return float64(a) / unit
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON reads a decimal string with at most the decimals of the
+// center currency. Bare numbers are read the same way, exactly, though the
+// schema of request bodies only lets strings through.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+	v, err := parse(s, CenterCurrency().Decimals)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText reads amounts of filters and cursors, with up to Scale
+// decimals
+func (a *Amount) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value writes a to the database exactly, with Scale decimals
+func (a Amount) Value() (driver.Value, error) {
+	return a.format(Scale), nil
+}
+
+// Scan reads a DECIMAL column
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		return a.UnmarshalText(v)
+	case string:
+		return a.UnmarshalText([]byte(v))
+	case int64:
+		*a = Amount(v * unit)
+	case float64:
+		*a = Amount(math.Round(v * unit))
+	default:
+		return fmt.Errorf("can't scan %T into an amount", src)
+	}
+	return nil
+}
+
+// Schema documents amounts as decimal strings in the OpenAPI spec
+func (Amount) Schema(r huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		Type:        huma.TypeString,
+		Pattern:     fmt.Sprintf(`^[-+]?[0-9]{1,%d}(\.[0-9]{1,%d})?$`, maxWhole, Scale),
+		Description: fmt.Sprintf("Amount of %s as a decimal string with up to %d decimals", CenterCurrency().Code, CenterCurrency().Decimals),
+		Examples:    []any{Amount(100500).String()},
+	}
+}
@@ -0,0 +1,204 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// withCurrency makes c the center currency until the test ends
+func withCurrency(t *testing.T, c Currency) {
+	t.Helper()
+	prev := CenterCurrency()
+	if err := SetCenterCurrency(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { center = prev })
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  bool
+	}{
+		{in: "0", want: 0},
+		{in: "12", want: 12000},
+		{in: "12.5", want: 12500},
+		{in: "12.500", want: 12500},
+		{in: "0.001", want: 1},
+		{in: "-0.125", want: -125},
+		{in: "+3.2", want: 3200},
+		{in: " 7.05 ", want: 7050},
+		{in: "0009999999.999", want: 9999999999},
+		{in: "-9999999.999", want: -9999999999},
+		{in: "", err: true},
+		{in: "-", err: true},
+		{in: ".5", err: true},
+		{in: "5.", err: true},
+		{in: "1.2345", err: true},
+		{in: "1e3", err: true},
+		{in: "1,5", err: true},
+		{in: "--1", err: true},
+		{in: "10000000", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %d, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Parse(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		in       Amount
+		want     string
+	}{
+		{currency: TND, in: 0, want: "0.000"},
+		{currency: TND, in: 100500, want: "100.500"},
+		{currency: TND, in: 1, want: "0.001"},
+		{currency: TND, in: -125, want: "-0.125"},
+		{currency: TND, in: -100000, want: "-100.000"},
+		{currency: Currency{Code: "EUR", Decimals: 2}, in: 12500, want: "12.50"},
+		{currency: Currency{Code: "EUR", Decimals: 2}, in: -12500, want: "-12.50"},
+		// decimals beyond those of the currency are kept, not rounded away
+		{currency: Currency{Code: "EUR", Decimals: 2}, in: 12505, want: "12.505"},
+		{currency: Currency{Code: "JPY", Decimals: 0}, in: 1500000, want: "1500"},
+		{currency: Currency{Code: "JPY", Decimals: 0}, in: 1500500, want: "1500.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency.Code+"/"+tt.want, func(t *testing.T) {
+			withCurrency(t, tt.currency)
+			if got := tt.in.String(); got != tt.want {
+				t.Fatalf("%d.String() = %q, want %q", tt.in, got, tt.want)
+			}
+			back, err := Parse(tt.in.String())
+			if err != nil || back != tt.in {
+				t.Fatalf("Parse(%q) = %d, %v, want %d", tt.in.String(), back, err, tt.in)
+			}
+			value, _ := tt.in.Value()
+			var scanned Amount
+			if err := scanned.Scan(value); err != nil || scanned != tt.in {
+				t.Fatalf("Scan(Value()) = %d, %v, want %d", scanned, err, tt.in)
+			}
+		})
+	}
+}
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		name     string
+		decimals int
+		a        Amount
+		n, d     int
+		want     Amount
+	}{
+		{name: "exact", decimals: 3, a: 90000, n: 1, d: 3, want: 30000},
+		{name: "rounds down", decimals: 3, a: 100000, n: 1, d: 3, want: 33333},
+		{name: "rounds up", decimals: 3, a: 100000, n: 2, d: 3, want: 66667},
+		{name: "half away from zero", decimals: 3, a: 1, n: 1, d: 2, want: 1},
+		{name: "negative half away from zero", decimals: 3, a: -1, n: 1, d: 2, want: -1},
+		{name: "negative rounds", decimals: 3, a: -100000, n: 2, d: 3, want: -66667},
+		{name: "whole", decimals: 3, a: 45000, n: 30, d: 30, want: 45000},
+		{name: "nothing", decimals: 3, a: 45000, n: 0, d: 30, want: 0},
+		{name: "to cents", decimals: 2, a: 100000, n: 1, d: 3, want: 33330},
+		{name: "cents half away from zero", decimals: 2, a: 10, n: 1, d: 2, want: 10},
+		{name: "to units", decimals: 0, a: 100000, n: 2, d: 3, want: 67000},
+		{name: "negative to units", decimals: 0, a: -1500, n: 1, d: 1, want: -2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCurrency(t, Currency{Code: "XTS", Decimals: tt.decimals})
+			if got := tt.a.Share(tt.n, tt.d); got != tt.want {
+				t.Fatalf("%d.Share(%d, %d) = %d, want %d", tt.a, tt.n, tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentAndTimes(t *testing.T) {
+	withCurrency(t, TND)
+	if got := Amount(45000).Percent(10); got != 4500 {
+		t.Fatalf("Percent(10) = %d, want 4500", got)
+	}
+	if got := Amount(333).Percent(50); got != 167 {
+		t.Fatalf("Percent(50) = %d, want 167", got)
+	}
+	if got := Amount(-45500).Times(3); got != -136500 {
+		t.Fatalf("Times(3) = %d, want -136500", got)
+	}
+	// a tenth added ten times is exactly one, which float64 misses
+	var sum Amount
+	for range 10 {
+		sum += Amount(100)
+	}
+	if sum != 1000 {
+		t.Fatalf("sum = %d, want 1000", sum)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	withCurrency(t, TND)
+	b, err := json.Marshal(struct {
+		Amount Amount `json:"amount"`
+	}{Amount: -100500})
+	if err != nil || string(b) != `{"amount":"-100.500"}` {
+		t.Fatalf("Marshal = %s, %v, want the amount as a string", b, err)
+	}
+
+	tests := []struct {
+		in   string
+		want Amount
+		err  bool
+	}{
+		{in: `"100.5"`, want: 100500},
+		{in: `"-0.125"`, want: -125},
+		{in: `100.5`, want: 100500},
+		{in: `"1.2345"`, err: true},
+		{in: `"abc"`, err: true},
+		{in: `1e2`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var got Amount
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %d, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Unmarshal(%s) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+
+	// the decimals accepted from clients are those of the center currency
+	withCurrency(t, Currency{Code: "EUR", Decimals: 2})
+	var got Amount
+	if err := json.Unmarshal([]byte(`"1.005"`), &got); err == nil {
+		t.Fatalf("Unmarshal(1.005) in EUR = %d, want an error", got)
+	}
+}
+
+func TestSetCenterCurrency(t *testing.T) {
+	withCurrency(t, TND)
+	for _, c := range []Currency{{Code: "tnd", Decimals: 3}, {Code: "TN", Decimals: 3}, {Code: "USD", Decimals: 4}, {Code: "USD", Decimals: -1}} {
+		if err := SetCenterCurrency(c); err == nil {
+			t.Errorf("SetCenterCurrency(%+v) succeeded, want an error", c)
+		}
+	}
+	if CenterCurrency() != TND {
+		t.Fatalf("CenterCurrency() = %+v after refused changes, want TND", CenterCurrency())
+	}
+}
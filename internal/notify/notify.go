@@ -0,0 +1,50 @@
+// Package notify sends messages to the users of the center through the
+// notification channel of the deployment.
+package notify
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// Recipient is a user a message is sent to, reached by whichever of their
+// contacts the channel uses
+type Recipient struct {
+	UserID string
+	Name   string
+	Email  string
+	Phone  string
+}
+
+// Message is a text sent to one or more users
+type Message struct {
+	To      []Recipient
+	Subject string
+	Body    string
+}
+
+// Notifier is a notification channel
+type Notifier interface {
+	// Send delivers m to every recipient, failing when it couldn't
+	Send(ctx context.Context, m Message) error
+}
+
+// Log is the channel of deployments without any: it writes the messages to
+// the log, where operators can pick them up
+type Log struct {
+	log zerolog.Logger
+}
+
+// NewLog returns a channel writing messages to log
+func NewLog(log zerolog.Logger) *Log {
+	return &Log{log: log}
+}
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	for _, r := range m.To {
+		l.log.Info().Str("user_id", r.UserID).Str("email", r.Email).Str("phone", r.Phone).
+			Str("subject", m.Subject).Str("body", m.Body).Msg("Notification")
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	"github.com/ICan-TC/lib/logging"
@@ -32,13 +31,23 @@ type Tokens struct {
 }
 
 func (s *AuthService) Signup(ctx context.Context, email, username, password string) (*dto.UserModelRes, *tokens.TokensPair, error) {
-	u, err := s.usvc.CreateUser(ctx, &dto.CreateUserReqBody{Email: email, Username: username, Password: password})
-	if err != nil {
-		return nil, nil, err
-	}
-	t, err := s.tsvc.TokensPair(ctx, u.ID, u.Username, u.Email)
+	var u *dto.UserModelRes
+	var t *tokens.TokensPair
+	// no account is left behind without its refresh token
+	err := s.usvc.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		var err error
+		u, err = s.usvc.CreateUser(ctx, &dto.CreateUserReqBody{Email: email, Username: username, Password: password})
+		if err != nil {
+			return err
+		}
+		t, err = s.tsvc.TokensPair(ctx, u.ID, u.Username, u.Email)
+		if err != nil {
+			s.log.Err(err).Msg("could not create tokens")
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		s.log.Err(err).Msg("could not create tokens")
 		return nil, nil, err
 	}
 	return u, t, nil
@@ -47,9 +56,6 @@ func (s *AuthService) Signup(ctx context.Context, email, username, password stri
 func (s *AuthService) Login(ctx context.Context, username, password string) (*dto.UserModelRes, *tokens.TokensPair, error) {
 	u, err := s.usvc.GetUserByField(ctx, "username", username, true)
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, nil, huma.Error404NotFound("user not found")
-		}
 		return nil, nil, err
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(*u.PasswordHash), []byte(password)); err != nil {
@@ -58,7 +64,7 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*dt
 	t, err := s.tsvc.TokensPair(ctx, u.ID, u.Username, u.Email)
 	if err != nil {
 		s.log.Err(err).Msg("could not create tokens")
-		return nil, nil, huma.Error500InternalServerError(err.Error())
+		return nil, nil, err
 	}
 	return u, t, nil
 }
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// errBulkRolledBack aborts the transaction of an all_or_nothing batch that
+// has failed items.
+var errBulkRolledBack = errors.New("bulk batch rolled back")
+
+// bulk tracks the outcome of every item of a bulk request. Items are first
+// validated one by one, then the valid ones are saved with as few statements
+// as possible.
+type bulk[T any] struct {
+	mode    string
+	results []dto.BulkItemResult[T]
+}
+
+func newBulk[T any](mode string, n int) *bulk[T] {
+	b := &bulk[T]{mode: mode, results: make([]dto.BulkItemResult[T], n)}
+	for i := range b.results {
+		b.results[i].Index = i
+	}
+	return b
+}
+
+// pending reports whether item i has no outcome yet.
+func (b *bulk[T]) pending(i int) bool {
+	return b.results[i].Status == ""
+}
+
+func (b *bulk[T]) fail(i int, status string, reason string) {
+	b.results[i].Status = status
+	b.results[i].Reason = reason
+}
+
+func (b *bulk[T]) done(i int, status string, item *T) {
+	b.results[i].Status = status
+	b.results[i].Item = item
+}
+
+// failErr records the error the database returned for item i. It returns
+// the error back when it isn't about the item itself.
+func (b *bulk[T]) failErr(log zerolog.Logger, i int, err error, entity string) error {
+	err = dbError(log, err, entity)
+	var statusErr huma.StatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+	switch statusErr.GetStatus() {
+	case http.StatusConflict:
+		b.fail(i, dto.BulkConflict, bulkReason(err))
+	case http.StatusNotFound:
+		b.fail(i, dto.BulkNotFound, bulkReason(err))
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		b.fail(i, dto.BulkInvalid, bulkReason(err))
+	default:
+		return err
+	}
+	return nil
+}
+
+func (b *bulk[T]) succeeded() int {
+	return countStatus(b.results, dto.BulkCreated, dto.BulkUpdated)
+}
+
+func (b *bulk[T]) failed() int {
+	return countStatus(b.results, dto.BulkConflict, dto.BulkInvalid, dto.BulkNotFound)
+}
+
+// run saves the validated items in a transaction. save must give an outcome
+// to every pending item, it is run again from the validated state when the
+// transaction is retried. An all_or_nothing batch with a failed item is
+// rolled back, or not even started, and its valid items are reported as
+// skipped. Bulk writes need a database.
+func (b *bulk[T]) run(ctx context.Context, db *bun.DB, save func(ctx context.Context, tx bun.Tx) error) (*dto.BulkRes[T], error) {
+	if db == nil {
+		return nil, errNeedsDatabase
+	}
+	atomic := b.mode != dto.BulkBestEffort
+	if !atomic || b.failed() == 0 {
+		validated := slices.Clone(b.results)
+		err := runInTx(ctx, db, nil, func(ctx context.Context, tx bun.Tx) error {
+			copy(b.results, validated)
+			if err := save(ctx, tx); err != nil {
+				return err
+			}
+			if atomic && b.failed() > 0 {
+				return errBulkRolledBack
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBulkRolledBack) {
+			return nil, err
+		}
+	}
+
+	res := &dto.BulkRes[T]{Status: http.StatusOK}
+	if atomic && b.failed() > 0 {
+		res.Status = http.StatusUnprocessableEntity
+		for i, r := range b.results {
+			if r.Status == "" || r.Status == dto.BulkCreated || r.Status == dto.BulkUpdated {
+				b.results[i] = dto.BulkItemResult[T]{Index: i, Status: dto.BulkSkipped, Reason: "not saved because other items failed"}
+			}
+		}
+	}
+	res.Body = dto.BulkResBody[T]{
+		Mode:      b.mode,
+		Committed: b.succeeded() > 0,
+		Succeeded: b.succeeded(),
+		Failed:    b.failed(),
+		Results:   b.results,
+	}
+	return res, nil
+}
+
+// save runs the statement saving all rows at once in a savepoint. When it
+// trips over a constraint, the rows of items idx are saved one at a time
+// instead, each in its own savepoint, so the failing ones get the blame and
+// the others go through.
+func (b *bulk[T]) save(ctx context.Context, tx bun.Tx, log zerolog.Logger, entity string, idx []int, all func(ctx context.Context, tx bun.Tx) error, one func(ctx context.Context, tx bun.Tx, k int) error) error {
+	if len(idx) == 0 {
+		return nil
+	}
+	err := tx.RunInTx(ctx, nil, all)
+	if err == nil {
+		return nil
+	}
+	if !isConstraintViolation(err) {
+		return dbError(log, err, entity)
+	}
+	for k, i := range idx {
+		err := tx.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return one(ctx, tx, k)
+		})
+		if err == nil {
+			continue
+		}
+		if !isConstraintViolation(err) {
+			return dbError(log, err, entity)
+		}
+		if err := b.failErr(log, i, err, entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func countStatus[T any](results []dto.BulkItemResult[T], statuses ...string) int {
+	n := 0
+	for _, r := range results {
+		if slices.Contains(statuses, r.Status) {
+			n++
+		}
+	}
+	return n
+}
+
+// isConstraintViolation reports whether err is an integrity constraint
+// violation, SQLSTATE class 23, which one bad row can cause.
+func isConstraintViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Field('C'), "23")
+}
+
+// bulkReason flattens a Huma error into a single line.
+func bulkReason(err error) string {
+	var model *huma.ErrorModel
+	if errors.As(err, &model) && len(model.Errors) > 0 {
+		msgs := []string{}
+		for _, d := range model.Errors {
+			msgs = append(msgs, d.Message)
+		}
+		return model.Detail + ": " + strings.Join(msgs, ", ")
+	}
+	return err.Error()
+}
+
+// existingIDs returns which of ids are in column of the model's table,
+// soft-deleted rows left out.
+func existingIDs(ctx context.Context, db bun.IDB, model any, column string, ids []string) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows := []string{}
+	if err := db.NewSelect().Model(model).Column(column).Where("? IN (?)", bun.Ident(column), bun.In(ids)).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, id := range rows {
+		found[id] = true
+	}
+	return found, nil
+}
+
+// bulkUpdate writes the patches of rows, one bulk statement per set of
+// changed columns, and returns the rows that were found, as updated.
+func bulkUpdate[M any](ctx context.Context, db bun.IDB, rows []M, patches []dto.Patch) ([]M, error) {
+	groups := map[string][]M{}
+	keys := []string{}
+	for k, patch := range patches {
+		key := strings.Join(patch.Columns, ",")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rows[k])
+	}
+	updated := []M{}
+	for _, key := range keys {
+		group := groups[key]
+		res := []M{}
+		if _, err := db.NewUpdate().Model(&group).
+			Column(strings.Split(key, ",")...).
+			Bulk().
+			Set("updated_at = NOW()").
+			Returning("?TableAlias.*").
+			Exec(ctx, &res); err != nil {
+			return nil, err
+		}
+		updated = append(updated, res...)
+	}
+	return updated, nil
+}
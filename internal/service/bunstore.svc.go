@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+// PostgresStore keeps records in Postgres through bun
+type PostgresStore struct {
+	db *bun.DB
+}
+
+func NewPostgresStore(db *bun.DB) *PostgresStore {
+	db.RegisterModel((*models.StudentParents)(nil))
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) DB() *bun.DB {
+	return s.db
+}
+
+func (s *PostgresStore) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	return runInTx(ctx, s.db, opts, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx)
+	})
+}
+
+// planDeletion walks the policies starting at the given record and collects
+// every row the deletion would touch, without changing anything.
+func (s *PostgresStore) planDeletion(ctx context.Context, entity string, id string) (*deletionPlan, error) {
+	db := conn(ctx, s.db)
+	root, ok := deleteEntities[entity]
+	if !ok {
+		return nil, huma.Error500InternalServerError("no deletion policy for " + entity)
+	}
+	exists, err := db.NewSelect().Table(entity).
+		Where("? = ?", bun.Ident(root.Key), id).
+		Where("? IS NULL", bun.Ident(root.SoftColumn)).
+		Exists(ctx)
+	if err != nil {
+		return nil, dbError(logging.L(), err, root.Name)
+	}
+	if !exists {
+		return nil, huma.Error404NotFound(root.Name + " not found")
+	}
+
+	return walkDeletion(entity, id, func(rel deleteRelation, refs []string) (deletionStep, error) {
+		child := deleteEntities[rel.Entity]
+		q := db.NewSelect().Table(rel.Entity).Where("? IN (?)", bun.Ident(rel.Column), bun.In(refs))
+		if child.SoftColumn != "" {
+			q = q.Where("? IS NULL", bun.Ident(child.SoftColumn))
+		}
+		st := deletionStep{Entity: rel.Entity, Column: rel.Column, Policy: rel.Policy, Refs: refs}
+		if child.Key != "" {
+			if err := q.Column(child.Key).Scan(ctx, &st.IDs); err != nil {
+				return st, dbError(logging.L(), err, child.Name)
+			}
+			st.Count = len(st.IDs)
+			return st, nil
+		}
+		n, err := q.Count(ctx)
+		if err != nil {
+			return st, dbError(logging.L(), err, child.Name)
+		}
+		st.Count = n
+		return st, nil
+	})
+}
+
+// applyDeletion runs the steps of plan and soft-deletes its record
+func (s *PostgresStore) applyDeletion(ctx context.Context, plan *deletionPlan) error {
+	db := conn(ctx, s.db)
+	log := logging.L()
+	for _, st := range plan.Steps {
+		child := deleteEntities[st.Entity]
+		var err error
+		switch st.Policy {
+		case DeleteCascade:
+			_, err = db.NewUpdate().Table(st.Entity).
+				Set("? = NOW()", bun.Ident(child.SoftColumn)).
+				Where("? IN (?)", bun.Ident(st.Column), bun.In(st.Refs)).
+				Where("? IS NULL", bun.Ident(child.SoftColumn)).
+				Exec(ctx)
+		case DeleteDetach:
+			_, err = db.NewDelete().Table(st.Entity).
+				Where("? IN (?)", bun.Ident(st.Column), bun.In(st.Refs)).
+				Exec(ctx)
+		}
+		if err != nil {
+			log.Err(err).Str("entity", st.Entity).Str("policy", string(st.Policy)).Msg("Couldn't apply deletion policy")
+			return dbError(log, err, child.Name)
+		}
+	}
+
+	root := deleteEntities[plan.Entity]
+	if _, err := db.NewUpdate().Table(plan.Entity).
+		Set("? = NOW()", bun.Ident(root.SoftColumn)).
+		Where("? = ?", bun.Ident(root.Key), plan.ID).
+		Exec(ctx); err != nil {
+		return dbError(log, err, root.Name)
+	}
+	return nil
+}
+
+func (s *PostgresStore) sumLedger(ctx context.Context, studentIDs []string, accounts []string) ([]ledgerSum, error) {
+	sums := []ledgerSum{}
+	if len(studentIDs) == 0 {
+		return sums, nil
+	}
+	err := conn(ctx, s.db).NewSelect().Model((*models.LedgerEntries)(nil)).
+		Column("student_id", "account").
+		ColumnExpr("SUM(debit) - SUM(credit) AS net").
+		Where("student_id IN (?)", bun.In(studentIDs)).
+		Where("account IN (?)", bun.In(accounts)).
+		Group("student_id", "account").
+		Scan(ctx, &sums)
+	return sums, err
+}
+
+// bunRepository is the Repository of M in Postgres
+type bunRepository[M any] struct {
+	db    *bun.DB
+	table *schema.Table
+}
+
+func newBunRepository[M any](db *bun.DB) *bunRepository[M] {
+	return &bunRepository[M]{db: db, table: db.Table(reflect.TypeFor[M]())}
+}
+
+// query selects model joined with relations
+func (r *bunRepository[M]) query(ctx context.Context, model any, relations ...string) *bun.SelectQuery {
+	q := conn(ctx, r.db).NewSelect().Model(model)
+	for _, rel := range relations {
+		q = q.Relation(rel)
+	}
+	return q
+}
+
+// listQuery selects the rows matching the search, filters and columns of spec
+func (r *bunRepository[M]) listQuery(ctx context.Context, rows *[]M, spec ListSpec) *bun.SelectQuery {
+	q := r.query(ctx, rows, spec.Relations...)
+	q = dto.ApplySearch(q, spec.Params.Search, spec.Search...)
+	q = dto.ApplyFilters(spec.Filters, q)
+	for _, c := range slices.Sorted(maps.Keys(spec.Where)) {
+		switch v := spec.Where[c]; {
+		case !isList(v):
+			q = q.Where("?TableAlias.? = ?", bun.Ident(c), v)
+		case reflect.ValueOf(v).Len() == 0:
+			q = q.Where("FALSE")
+		default:
+			q = q.Where("?TableAlias.? IN (?)", bun.Ident(c), bun.In(v))
+		}
+	}
+	return q
+}
+
+func (r *bunRepository[M]) List(ctx context.Context, spec ListSpec) (*RowPage[M], error) {
+	rows := []M{}
+	q := r.listQuery(ctx, &rows, spec)
+	page, err := dto.NewPage[M](r.db, spec.Params)
+	if err != nil {
+		return nil, err
+	}
+	q = page.Apply(q)
+	if spec.Stable {
+		// rows tied on a computed sort column could swap between pages
+		for _, pk := range r.table.PKs {
+			q = q.OrderExpr("?TableAlias.?", bun.Ident(pk.Name))
+		}
+	}
+	if err := q.Scan(ctx); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	res := &RowPage[M]{More: len(rows) > spec.Params.PerPage}
+	res.Rows, res.Cursors = page.Trim(rows)
+	return res, nil
+}
+
+func (r *bunRepository[M]) Count(ctx context.Context, spec ListSpec) (int, error) {
+	return r.listQuery(ctx, &[]M{}, spec).Count(ctx)
+}
+
+func (r *bunRepository[M]) Get(ctx context.Context, m *M, relations ...string) error {
+	return r.query(ctx, m, relations...).WherePK().Scan(ctx)
+}
+
+func (r *bunRepository[M]) GetBy(ctx context.Context, m *M, column string, value any) error {
+	return conn(ctx, r.db).NewSelect().Model(m).Where("?TableAlias.? = ?", bun.Ident(column), value).Scan(ctx)
+}
+
+func (r *bunRepository[M]) Lock(ctx context.Context, m *M, relations ...string) error {
+	return r.query(ctx, m, relations...).WherePK().For("UPDATE OF ?TableAlias").Scan(ctx)
+}
+
+func (r *bunRepository[M]) Insert(ctx context.Context, m *M) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(m).Returning("*").Exec(ctx, m)
+	return err
+}
+
+func (r *bunRepository[M]) Revive(ctx context.Context, m *M, columns ...string) error {
+	soft := r.table.SoftDeleteField
+	pks := make([]string, len(r.table.PKs))
+	for i, pk := range r.table.PKs {
+		pks[i] = string(pk.SQLName)
+	}
+	q := conn(ctx, r.db).NewInsert().Model(m).
+		On("CONFLICT (?) DO UPDATE", bun.Safe(strings.Join(pks, ", ")))
+	for _, c := range columns {
+		q = q.Set("? = EXCLUDED.?", bun.Ident(c), bun.Ident(c))
+	}
+	res, err := q.
+		Set("? = NULL", soft.SQLName).
+		Set("created_at = NOW()").
+		Set("updated_at = NOW()").
+		Where("?TableAlias.? IS NOT NULL", soft.SQLName).
+		Returning("*").
+		Exec(ctx, m)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return &constraintError{code: pgUniqueViolation}
+	}
+	return nil
+}
+
+func (r *bunRepository[M]) Update(ctx context.Context, m *M, columns ...string) error {
+	db := conn(ctx, r.db)
+	if len(columns) == 0 {
+		return db.NewSelect().Model(m).WherePK().Scan(ctx)
+	}
+	q := db.NewUpdate().Model(m).Column(columns...)
+	if r.table.HasField("updated_at") {
+		q = q.Set("updated_at = NOW()")
+	}
+	return q.
+		WherePK().
+		Returning("*").
+		Scan(ctx)
+}
+
+func (r *bunRepository[M]) Delete(ctx context.Context, m *M) error {
+	res, err := conn(ctx, r.db).NewDelete().Model(m).WherePK().Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
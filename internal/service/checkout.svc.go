@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/checkout"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// CheckoutService lets families pay their invoices online: it opens checkout
+// pages at the payment provider and records the payments its webhooks
+// report. See docs/checkout.md.
+type CheckoutService struct {
+	store     Store
+	log       zerolog.Logger
+	provider  checkout.Provider
+	payments  *PaymentsService
+	sessions  Repository[models.CheckoutSessions]
+	invoices  Repository[models.Invoices]
+	employees Repository[models.Employees]
+}
+
+func NewCheckoutService(store Store, provider checkout.Provider, payments *PaymentsService) (*CheckoutService, error) {
+	log := logging.L().With().Str("service", "checkout.svc").Logger()
+	if provider == nil {
+		return nil, fmt.Errorf("no payment provider is configured")
+	}
+	if payments == nil {
+		return nil, fmt.Errorf("payments service is required")
+	}
+	return &CheckoutService{
+		store:     store,
+		log:       log,
+		provider:  provider,
+		payments:  payments,
+		sessions:  NewRepository[models.CheckoutSessions](store),
+		invoices:  NewRepository[models.Invoices](store),
+		employees: NewRepository[models.Employees](store),
+	}, nil
+}
+
+// Provider is the payment provider sessions are opened at
+func (s *CheckoutService) Provider() checkout.Provider {
+	return s.provider
+}
+
+// CreateSession opens a checkout page paying what is left on the issued
+// invoice. A page still open for the same amount is returned instead of
+// opening another one.
+func (s *CheckoutService) CreateSession(ctx context.Context, createdBy string, invoiceID string, successURL string, cancelURL string) (*dto.CheckoutSessionRes, error) {
+	if _, err := ulid.Parse(invoiceID); err != nil {
+		return nil, huma.Error400BadRequest("invoiceID is invalid", err)
+	}
+	inv := models.Invoices{InvoiceID: invoiceID}
+	if err := s.invoices.Get(ctx, &inv, "Student.User"); err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	if inv.Status != models.InvoiceIssued {
+		return nil, huma.Error409Conflict(fmt.Sprintf("invoice is %s, only issued invoices can be paid", inv.Status))
+	}
+	amount := owedOn(&inv)
+	if amount <= 0 {
+		return nil, huma.Error409Conflict("nothing is left to pay on the invoice")
+	}
+	if inv.Currency != money.CenterCurrency().Code {
+		return nil, huma.Error409Conflict(fmt.Sprintf("invoice is in %s, payments are in %s", inv.Currency, money.CenterCurrency().Code))
+	}
+
+	open, err := listAll(ctx, s.sessions, ListSpec{Where: map[string]any{
+		"invoice_id": invoiceID,
+		"provider":   s.provider.Name(),
+		"status":     models.CheckoutOpen,
+	}})
+	if err != nil {
+		return nil, dbError(s.log, err, "checkout session")
+	}
+	for _, m := range open {
+		if m.Amount == amount && time.Now().Before(m.ExpiresAt.Add(-5*time.Minute)) {
+			return sessionToRes(&m), nil
+		}
+	}
+
+	m := models.CheckoutSessions{
+		SessionID: ulid.Make().String(),
+		Provider:  s.provider.Name(),
+		InvoiceID: inv.InvoiceID,
+		StudentID: inv.StudentID,
+		Currency:  inv.Currency,
+		Amount:    amount,
+		Status:    models.CheckoutOpen,
+	}
+	if createdBy != "" {
+		m.CreatedBy = &createdBy
+	}
+	req := checkout.SessionRequest{
+		Reference:   m.SessionID,
+		Amount:      amount,
+		Currency:    inv.Currency,
+		Description: "Invoice " + ptrValue(inv.Number),
+		SuccessURL:  successURL,
+		CancelURL:   cancelURL,
+	}
+	if inv.Student != nil && inv.Student.User != nil {
+		req.Email = inv.Student.User.Email
+	}
+	session, err := s.provider.CreateSession(ctx, req)
+	if err != nil {
+		s.log.Err(err).Str("invoice_id", invoiceID).Str("provider", s.provider.Name()).Msg("Couldn't open checkout session")
+		return nil, huma.Error502BadGateway("the payment provider couldn't open a checkout page")
+	}
+	m.ProviderSessionID, m.URL, m.ExpiresAt = session.ID, session.URL, session.ExpiresAt
+	if err := s.sessions.Insert(ctx, &m); err != nil {
+		s.log.Err(err).Str("invoice_id", invoiceID).Msg("Couldn't insert checkout session")
+		return nil, dbError(s.log, err, "checkout session")
+	}
+	return sessionToRes(&m), nil
+}
+
+func (s *CheckoutService) GetSessionByID(ctx context.Context, id string) (*dto.CheckoutSessionRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("sessionID is invalid", err)
+	}
+	m := models.CheckoutSessions{SessionID: id}
+	if err := s.sessions.Get(ctx, &m); err != nil {
+		return nil, dbError(s.log, err, "checkout session")
+	}
+	return sessionToRes(&m), nil
+}
+
+// GetSessionsByInvoiceID lists the checkout sessions opened for the invoice,
+// the latest first
+func (s *CheckoutService) GetSessionsByInvoiceID(ctx context.Context, invoiceID string) ([]dto.CheckoutSessionRes, error) {
+	sessions, err := listAll(ctx, s.sessions, ListSpec{
+		Where:  map[string]any{"invoice_id": invoiceID},
+		Params: dto.ListQuery{SortBy: "created_at", SortDir: "desc"},
+	})
+	if err != nil {
+		return nil, dbError(s.log, err, "checkout session")
+	}
+	res := make([]dto.CheckoutSessionRes, len(sessions))
+	for i := range sessions {
+		res[i] = *sessionToRes(&sessions[i])
+	}
+	return res, nil
+}
+
+// HandleWebhook applies a webhook delivery of the provider named provider.
+// Deliveries are retried by providers and may come twice or out of order: a
+// session completes once, with the payment of the first completion event,
+// and later events about it are acknowledged without changing anything.
+func (s *CheckoutService) HandleWebhook(ctx context.Context, provider string, header http.Header, body []byte) error {
+	if provider != s.provider.Name() {
+		return huma.Error404NotFound("payment provider not found")
+	}
+	e, err := s.provider.ParseEvent(header, body)
+	if errors.Is(err, checkout.ErrInvalidSignature) {
+		s.log.Warn().Err(err).Str("provider", provider).Msg("Rejected webhook")
+		return huma.Error401Unauthorized("webhook signature is invalid")
+	}
+	if err != nil {
+		return huma.Error400BadRequest("webhook is invalid", err)
+	}
+	log := s.log.With().Str("provider", provider).Str("event_id", e.ID).Str("type", e.Type).Str("session_id", e.Reference).Logger()
+	if _, err := ulid.Parse(e.Reference); err != nil {
+		log.Warn().Msg("Ignored webhook of a session not opened here")
+		return nil
+	}
+
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	return s.store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		m := models.CheckoutSessions{SessionID: e.Reference}
+		if err := s.sessions.Lock(ctx, &m); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				log.Warn().Msg("Ignored webhook of an unknown session")
+				return nil
+			}
+			return dbError(s.log, err, "checkout session")
+		}
+		if m.Provider != provider || m.ProviderSessionID != e.SessionID {
+			log.Warn().Msg("Ignored webhook not matching its session")
+			return nil
+		}
+		if m.Status == models.CheckoutCompleted {
+			log.Info().Msg("Ignored webhook of a completed session")
+			return nil
+		}
+		columns := []string{"status", "last_event_id"}
+		m.LastEventID = &e.ID
+		switch e.Type {
+		case checkout.EventCompleted:
+			// answering an error would have the provider retry forever
+			if e.Currency != money.CenterCurrency().Code || e.Amount <= 0 {
+				log.Error().Str("currency", e.Currency).Stringer("amount", e.Amount).
+					Msg("Ignored completed checkout that can't be recorded as a payment")
+				return nil
+			}
+			payment, err := s.pay(ctx, &m, e)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			m.Status, m.PaymentID, m.CompletedAt = models.CheckoutCompleted, &payment.PaymentID, &now
+			columns = append(columns, "payment_id", "completed_at")
+			log.Info().Str("payment_id", payment.PaymentID).Stringer("amount", payment.Amount).Msg("Recorded online payment")
+		case checkout.EventFailed, checkout.EventExpired:
+			if m.Status != models.CheckoutOpen {
+				return nil
+			}
+			m.Status = models.CheckoutFailed
+			if e.Type == checkout.EventExpired {
+				m.Status = models.CheckoutExpired
+			}
+		default:
+			log.Info().Msg("Ignored webhook of an unknown type")
+			return nil
+		}
+		if err := s.sessions.Update(ctx, &m, columns...); err != nil {
+			return dbError(s.log, err, "checkout session")
+		}
+		return nil
+	})
+}
+
+// pay records what the provider took for the session. It pays the invoice
+// of the session while it is still issued, or else the open invoices of the
+// student, and what is left becomes credit: the money was taken either way.
+func (s *CheckoutService) pay(ctx context.Context, m *models.CheckoutSessions, e *checkout.Event) (*models.Payments, error) {
+	reference := s.provider.Name() + ":" + e.SessionID
+	if e.Transaction != "" {
+		reference = s.provider.Name() + ":" + e.Transaction
+	}
+	p := models.Payments{
+		PaymentID:  ulid.Make().String(),
+		StudentID:  m.StudentID,
+		Method:     models.PaymentOnline,
+		Currency:   e.Currency,
+		Amount:     e.Amount,
+		Reference:  &reference,
+		ReceivedAt: time.Now(),
+	}
+	inv := models.Invoices{InvoiceID: m.InvoiceID}
+	if err := s.invoices.Get(ctx, &inv); err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	if inv.Status == models.InvoiceIssued {
+		p.InvoiceID = &inv.InvoiceID
+	}
+	if err := s.payments.record(ctx, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PayFake plays the family ending the checkout page of the fake provider with
+// outcome, paid, failed or expired, and applies the webhook it sends. Only
+// employees may, as it records payments.
+func (s *CheckoutService) PayFake(ctx context.Context, callerID string, providerSessionID string, outcome string) (*dto.CheckoutSessionRes, error) {
+	fake, ok := s.provider.(*checkout.Fake)
+	if !ok {
+		return nil, huma.Error404NotFound("fake payment provider not found")
+	}
+	caller := models.Employees{}
+	if err := s.employees.GetBy(ctx, &caller, "user_id", callerID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, huma.Error403Forbidden("only employees may end fake checkout pages")
+		}
+		return nil, dbError(s.log, err, "employee")
+	}
+	m := models.CheckoutSessions{}
+	if err := s.sessions.GetBy(ctx, &m, "provider_session_id", providerSessionID); err != nil {
+		return nil, dbError(s.log, err, "checkout session")
+	}
+	eventType := map[string]string{
+		"paid":    checkout.EventCompleted,
+		"failed":  checkout.EventFailed,
+		"expired": checkout.EventExpired,
+	}[outcome]
+	header, body, err := fake.Deliver(providerSessionID, eventType)
+	if err != nil {
+		return nil, huma.Error404NotFound("checkout session not found", err)
+	}
+	if err := s.HandleWebhook(ctx, fake.Name(), header, body); err != nil {
+		return nil, err
+	}
+	return s.GetSessionByID(ctx, m.SessionID)
+}
+
+func sessionToRes(m *models.CheckoutSessions) *dto.CheckoutSessionRes {
+	res := &dto.CheckoutSessionRes{
+		ID:          m.SessionID,
+		Provider:    m.Provider,
+		InvoiceID:   m.InvoiceID,
+		StudentID:   m.StudentID,
+		Currency:    m.Currency,
+		Amount:      m.Amount,
+		Status:      m.Status,
+		URL:         m.URL,
+		ExpiresAt:   int(m.ExpiresAt.Unix()),
+		PaymentID:   m.PaymentID,
+		CompletedAt: unixPtr(m.CompletedAt),
+		CreatedBy:   m.CreatedBy,
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// SQLSTATE codes translated by dbError
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgSerializationFailed = "40001"
+)
+
+// pgKeyDetail picks the columns out of a constraint error detail such as
+// `Key (student_id, group_id)=(...) already exists.`
+var pgKeyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// dbError translates an error returned by the database into a Huma error
+// that is safe to send to clients. Huma errors pass through untouched, so it
+// can wrap the result of a transaction. entity names the record in messages,
+// e.g. "student". Anything unexpected is logged and becomes a bare 500.
+func dbError(log zerolog.Logger, err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return huma.Error404NotFound(entity + " not found")
+	}
+
+	var code, table, constraint string
+	var columns []string
+	var pgErr pgdriver.Error
+	var cErr *constraintError
+	switch {
+	case errors.As(err, &cErr):
+		code, columns = cErr.code, cErr.columns
+	case errors.As(err, &pgErr):
+		code, table, constraint = pgErr.Field('C'), pgErr.Field('t'), pgErr.Field('n')
+		columns = pgErrorColumns(pgErr)
+	default:
+		log.Err(err).Str("entity", entity).Msg("Database error")
+		return huma.Error500InternalServerError("internal server error")
+	}
+	switch code {
+	case pgUniqueViolation:
+		return huma.Error409Conflict(entity+" already exists", fieldDetails(columns, "is already taken")...)
+	case pgForeignKeyViolation:
+		if stillReferenced(table, constraint) {
+			return huma.Error409Conflict(entity + " is still referenced by other records")
+		}
+		return huma.Error422UnprocessableEntity("referenced record not found", fieldDetails(columns, "refers to a missing record")...)
+	case pgCheckViolation:
+		return huma.Error422UnprocessableEntity(entity+" is invalid", &huma.ErrorDetail{
+			Message:  fmt.Sprintf("violates the %s rule", constraint),
+			Location: "body",
+		})
+	case pgNotNullViolation:
+		return huma.Error422UnprocessableEntity(entity+" is incomplete", fieldDetails(columns, "is required")...)
+	case pgSerializationFailed:
+		return &retryableError{
+			StatusError: huma.Error409Conflict(entity + " was changed by a concurrent request, retry"),
+			cause:       err,
+		}
+	}
+	log.Err(err).Str("entity", entity).Str("sqlstate", code).Msg("Database error")
+	return huma.Error500InternalServerError("internal server error")
+}
+
+// stillReferenced tells the foreign key violation of deleting a row that
+// other rows still reference from the one of a row referencing a missing
+// record. Postgres reports the first on the referenced table and the second
+// on the table holding the constraint, which every foreign key is named
+// after (<table>_<column>_fkey). The only table referencing itself, invoices,
+// is never hard deleted, so a violation reported on it is taken for the
+// second.
+func stillReferenced(table, constraint string) bool {
+	return table != "" && !strings.HasPrefix(constraint, table+"_")
+}
+
+// constraintError is a constraint broken in a store without a database.
+// dbError translates it like the Postgres error of the same SQLSTATE.
+type constraintError struct {
+	code    string
+	columns []string
+}
+
+func (e *constraintError) Error() string {
+	return fmt.Sprintf("SQLSTATE %s on %s", e.code, strings.Join(e.columns, ", "))
+}
+
+// retryableError is the 409 sent for a serialization failure. It keeps the
+// database error so runInTx can still tell the transaction is worth retrying.
+type retryableError struct {
+	huma.StatusError
+	cause error
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.cause
+}
+
+func pgErrorColumns(pgErr pgdriver.Error) []string {
+	if c := pgErr.Field('c'); c != "" {
+		return []string{c}
+	}
+	m := pgKeyDetail.FindStringSubmatch(pgErr.Field('D'))
+	if m == nil {
+		return nil
+	}
+	columns := strings.Split(m[1], ",")
+	for i, c := range columns {
+		columns[i] = strings.TrimSpace(c)
+	}
+	return columns
+}
+
+func fieldDetails(columns []string, message string) []error {
+	details := []error{}
+	for _, c := range columns {
+		details = append(details, &huma.ErrorDetail{
+			Message:  c + " " + message,
+			Location: "body." + c,
+		})
+	}
+	return details
+}
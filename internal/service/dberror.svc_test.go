@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestStillReferenced(t *testing.T) {
+	tests := []struct {
+		table, constraint string
+		want              bool
+	}{
+		// deleting a student that has enrollments
+		{"students", "enrollments_student_id_fkey", true},
+		// enrolling a missing student
+		{"enrollments", "enrollments_student_id_fkey", false},
+		// deleting a student that has parents
+		{"students", "student_parents_student_id_fkey", true},
+		// a late fee pointing at a missing invoice
+		{"invoices", "invoices_late_fee_invoice_id_fkey", false},
+		// the memory store reports no table
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := stillReferenced(tt.table, tt.constraint); got != tt.want {
+			t.Errorf("stillReferenced(%q, %q) = %v, want %v", tt.table, tt.constraint, got, tt.want)
+		}
+	}
+}
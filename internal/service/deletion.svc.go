@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+// DeletePolicy describes what happens to the rows referencing a record when
+// that record is deleted.
+type DeletePolicy string
+
+const (
+	// DeleteRestrict refuses the deletion while referencing rows exist.
+	DeleteRestrict DeletePolicy = "restrict"
+	// DeleteCascade soft-deletes the referencing rows together with the record.
+	DeleteCascade DeletePolicy = "cascade_soft_delete"
+	// DeleteDetach removes the link rows and leaves the other side untouched.
+	DeleteDetach DeletePolicy = "detach"
+)
+
+type deleteRelation struct {
+	Entity string
+	Column string
+	Policy DeletePolicy
+}
+
+type deleteEntity struct {
+	Name string
+	// Key is the primary key column, empty for composite-key tables which
+	// never have dependents of their own.
+	Key string
+	// SoftColumn is stamped instead of removing the row, empty for link
+	// tables that are hard deleted.
+	SoftColumn string
+	Relations  []deleteRelation
+}
+
+// deleteEntities is the deletion policy of every relation, keyed by table.
+// See docs/deletion-policies.md.
+var deleteEntities = map[string]deleteEntity{
+	"users": {Name: "user", Key: "id", SoftColumn: "deleted_at", Relations: []deleteRelation{
+		{Entity: "refresh_tokens", Column: "user_id", Policy: DeleteCascade},
+		{Entity: "students", Column: "user_id", Policy: DeleteCascade},
+		{Entity: "teachers", Column: "user_id", Policy: DeleteCascade},
+		{Entity: "employees", Column: "user_id", Policy: DeleteCascade},
+		{Entity: "parents", Column: "user_id", Policy: DeleteCascade},
+	}},
+	"refresh_tokens": {Name: "refresh token", Key: "id", SoftColumn: "revoked_at"},
+	"students": {Name: "student", Key: "id", SoftColumn: "deleted_at", Relations: []deleteRelation{
+		{Entity: "enrollments", Column: "student_id", Policy: DeleteCascade},
+		{Entity: "student_parents", Column: "student_id", Policy: DeleteDetach},
+		{Entity: "pricing_rules", Column: "student_id", Policy: DeleteCascade},
+	}},
+	"teachers": {Name: "teacher", Key: "id", SoftColumn: "deleted_at", Relations: []deleteRelation{
+		{Entity: "groups", Column: "teacher_id", Policy: DeleteRestrict},
+		{Entity: "pay_rates", Column: "teacher_id", Policy: DeleteCascade},
+	}},
+	"employees": {Name: "employee", Key: "id", SoftColumn: "deleted_at"},
+	"parents": {Name: "parent", Key: "id", SoftColumn: "deleted_at", Relations: []deleteRelation{
+		{Entity: "student_parents", Column: "parent_id", Policy: DeleteDetach},
+	}},
+	"groups": {Name: "group", Key: "id", SoftColumn: "deleted_at", Relations: []deleteRelation{
+		{Entity: "enrollments", Column: "group_id", Policy: DeleteRestrict},
+		{Entity: "pricing_rules", Column: "group_id", Policy: DeleteCascade},
+		{Entity: "pay_rates", Column: "group_id", Policy: DeleteCascade},
+	}},
+	"enrollments":     {Name: "enrollment", SoftColumn: "deleted_at"},
+	"student_parents": {Name: "student-parent relationship"},
+	"pricing_rules":   {Name: "pricing rule", Key: "id", SoftColumn: "deleted_at"},
+	"pay_rates":       {Name: "pay rate", Key: "id", SoftColumn: "deleted_at"},
+}
+
+type deletionStep struct {
+	Entity string
+	Column string
+	Policy DeletePolicy
+	// Refs are the IDs of the records being deleted that the rows point to.
+	Refs  []string
+	IDs   []string
+	Count int
+}
+
+type deletionPlan struct {
+	Entity string
+	ID     string
+	Steps  []deletionStep
+}
+
+// Blocked returns the restrict steps that have referencing rows.
+func (p *deletionPlan) Blocked() []deletionStep {
+	blocked := []deletionStep{}
+	for _, st := range p.Steps {
+		if st.Policy == DeleteRestrict && st.Count > 0 {
+			blocked = append(blocked, st)
+		}
+	}
+	return blocked
+}
+
+// walkDeletion collects the steps of deleting the given record, starting at
+// its relations. step reads the live rows of a relation pointing at refs.
+func walkDeletion(entity string, id string, step func(rel deleteRelation, refs []string) (deletionStep, error)) (*deletionPlan, error) {
+	plan := &deletionPlan{Entity: entity, ID: id}
+	type pending struct {
+		entity string
+		ids    []string
+	}
+	queue := []pending{{entity: entity, ids: []string{id}}}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, rel := range deleteEntities[cur.entity].Relations {
+			st, err := step(rel, cur.ids)
+			if err != nil {
+				return nil, err
+			}
+			if st.Count == 0 {
+				continue
+			}
+			plan.Steps = append(plan.Steps, st)
+			if rel.Policy == DeleteCascade && len(deleteEntities[rel.Entity].Relations) > 0 {
+				queue = append(queue, pending{entity: rel.Entity, ids: st.IDs})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// previewDeletion reports what deleting the record would do.
+func previewDeletion(ctx context.Context, store Store, entity string, id string) (*dto.DeletionPlanRes, error) {
+	plan, err := store.planDeletion(ctx, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	return deletionPlanToRes(plan), nil
+}
+
+// deleteWithPolicies soft-deletes the record and applies the policy of every
+// relation pointing at it in a single transaction. Nothing is changed when a
+// restrict policy blocks the deletion.
+func deleteWithPolicies(ctx context.Context, store Store, log zerolog.Logger, entity string, id string) error {
+	return deleteWithPoliciesIf(ctx, store, log, entity, id, nil)
+}
+
+// deleteWithPoliciesIf is deleteWithPolicies guarded by check, which runs
+// first in the transaction and aborts the deletion when it fails.
+func deleteWithPoliciesIf(ctx context.Context, store Store, log zerolog.Logger, entity string, id string, check func(ctx context.Context) error) error {
+	return store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if check != nil {
+			if err := check(ctx); err != nil {
+				return err
+			}
+		}
+		plan, err := store.planDeletion(ctx, entity, id)
+		if err != nil {
+			return err
+		}
+		if blocked := plan.Blocked(); len(blocked) > 0 {
+			reasons := []string{}
+			for _, st := range blocked {
+				reasons = append(reasons, fmt.Sprintf("%d %s through %s", st.Count, st.Entity, st.Column))
+			}
+			return huma.Error409Conflict(fmt.Sprintf("%s is still referenced by %s", deleteEntities[entity].Name, strings.Join(reasons, ", ")))
+		}
+		if err := store.applyDeletion(ctx, plan); err != nil {
+			return err
+		}
+		log.Info().Str("entity", entity).Str("id", id).Int("steps", len(plan.Steps)).Msg("Deleted record")
+		return nil
+	})
+}
+
+func deletionPlanToRes(p *deletionPlan) *dto.DeletionPlanRes {
+	res := &dto.DeletionPlanRes{
+		Entity:   p.Entity,
+		ID:       p.ID,
+		Allowed:  len(p.Blocked()) == 0,
+		Affected: []dto.DeletionImpactRes{},
+	}
+	for _, st := range p.Steps {
+		res.Affected = append(res.Affected, dto.DeletionImpactRes{
+			Entity: st.Entity,
+			Via:    st.Column,
+			Policy: string(st.Policy),
+			Count:  st.Count,
+			IDs:    st.IDs,
+		})
+	}
+	return res
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/document"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// Kinds of documents handed to families
+const (
+	DocumentInvoice = "invoice"
+	DocumentReceipt = "receipt"
+)
+
+// DocumentsService renders invoices and payment receipts as PDF files and
+// checks the verification codes printed on them. See docs/documents.md.
+type DocumentsService struct {
+	store     Store
+	log       zerolog.Logger
+	branding  document.Branding
+	publicURL string
+	secret    []byte
+	invoices  Repository[models.Invoices]
+	payments  Repository[models.Payments]
+	students  Repository[models.Students]
+	ledger    *ledger
+}
+
+// NewDocumentsService renders documents under branding, their QR codes
+// linking to publicURL and signed with secret. The logo and font of branding
+// must be readable files when set.
+func NewDocumentsService(store Store, branding document.Branding, publicURL string, secret string) (*DocumentsService, error) {
+	log := logging.L().With().Str("service", "documents.svc").Logger()
+	for _, path := range []string{branding.LogoPath, branding.FontPath} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("branding file: %w", err)
+		}
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("a secret is needed to sign verification codes")
+	}
+	s := &DocumentsService{
+		store:     store,
+		log:       log,
+		branding:  branding,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		secret:    []byte(secret),
+	}
+	s.invoices = NewRepository[models.Invoices](store)
+	s.payments = NewRepository[models.Payments](store)
+	s.students = NewRepository[models.Students](store)
+	s.ledger = newLedger(store, log)
+	return s, nil
+}
+
+// InvoicePDF renders the invoice with the balance of the family of its
+// student. Drafts are stamped and have no verification code.
+func (s *DocumentsService) InvoicePDF(ctx context.Context, id string) ([]byte, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("invoiceID is invalid", err)
+	}
+	inv := models.Invoices{InvoiceID: id}
+	if err := s.invoices.Get(ctx, &inv, "Lines", "Student.User"); err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	currency := inv.Currency
+	d := &document.Document{
+		Title:   "Invoice",
+		Number:  cmp.Or(ptrValue(inv.Number), "Draft"),
+		Date:    inv.CreatedAt.Format(time.DateOnly),
+		To:      recipient(inv.Student),
+		Details: []document.Field{{Label: "Period", Value: inv.PeriodStart.Format(time.DateOnly) + " to " + inv.PeriodEnd.Format(time.DateOnly)}},
+		Items: document.Table{Columns: []document.Column{
+			{Title: "Description", Width: 5},
+			{Title: "Covered", Width: 3},
+			{Title: "Qty", Width: 1, Right: true},
+			{Title: "Unit price", Width: 2, Right: true},
+			{Title: "Amount", Width: 2, Right: true},
+		}},
+		Totals: []document.Field{{Label: "Total (" + currency + ")", Value: inv.Total.String()}},
+	}
+	if inv.IssuedAt != nil {
+		d.Date = inv.IssuedAt.Format(time.DateOnly)
+	}
+	d.Details = append(d.Details, document.Field{Label: "Date", Value: d.Date})
+	if inv.DueDate != nil {
+		d.Details = append(d.Details, document.Field{Label: "Due", Value: inv.DueDate.Format(time.DateOnly)})
+	}
+	switch inv.Status {
+	case models.InvoiceDraft:
+		d.Stamp = "DRAFT"
+	case models.InvoiceVoid:
+		d.Stamp = "VOID"
+		if inv.VoidReason != nil {
+			d.Notes = append(d.Notes, "Voided: "+*inv.VoidReason)
+		}
+	case models.InvoicePaid:
+		d.Stamp = "PAID"
+	}
+	lines := slices.SortedFunc(slices.Values(inv.Lines), func(a, b models.InvoiceLines) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+	for _, l := range lines {
+		d.Items.Rows = append(d.Items.Rows, []string{
+			lineDescription(&l),
+			l.CoveredFrom.Format(time.DateOnly) + " to " + l.CoveredTo.Format(time.DateOnly),
+			fmt.Sprint(l.Quantity),
+			l.UnitPrice.String(),
+			l.Amount.String(),
+		})
+	}
+	if inv.Status != models.InvoiceDraft {
+		if inv.AmountCredited > 0 {
+			d.Totals = append(d.Totals, document.Field{Label: "Credited", Value: (-inv.AmountCredited).String()})
+		}
+		d.Totals = append(d.Totals, document.Field{Label: "Paid", Value: (-inv.AmountPaid).String()})
+		if inv.Status == models.InvoiceIssued {
+			d.Totals = append(d.Totals, document.Field{Label: "Due (" + currency + ")", Value: owedOn(&inv).String()})
+		}
+		d.VerifyURL = s.verifyURL(DocumentInvoice, inv.InvoiceID)
+	}
+	if err := s.familyBalance(ctx, inv.StudentID, d); err != nil {
+		return nil, err
+	}
+	return s.render(d)
+}
+
+// ReceiptPDF renders a receipt of the payment, with the invoices it paid and
+// the balance of the family of its student
+func (s *DocumentsService) ReceiptPDF(ctx context.Context, id string) ([]byte, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("paymentID is invalid", err)
+	}
+	p := models.Payments{PaymentID: id}
+	if err := s.payments.Get(ctx, &p, "Student.User"); err != nil {
+		return nil, dbError(s.log, err, "payment")
+	}
+	received := p.ReceivedAt.Format(time.DateOnly)
+	d := &document.Document{
+		Title:  "Receipt",
+		Number: p.PaymentID,
+		Date:   received,
+		To:     recipient(p.Student),
+		Details: []document.Field{
+			{Label: "Received", Value: received},
+			{Label: "Method", Value: p.Method},
+		},
+		Items: document.Table{Columns: []document.Column{
+			{Title: "Paid for", Width: 6},
+			{Title: "Period", Width: 4},
+			{Title: "Amount", Width: 2, Right: true},
+		}},
+		Totals:    []document.Field{{Label: "Received (" + p.Currency + ")", Value: p.Amount.String()}},
+		VerifyURL: s.verifyURL(DocumentReceipt, p.PaymentID),
+	}
+	if p.Reference != nil {
+		d.Details = append(d.Details, document.Field{Label: "Reference", Value: *p.Reference})
+	}
+	entries, err := listAll(ctx, s.ledger.entries, ListSpec{Where: map[string]any{"payment_id": p.PaymentID}})
+	if err != nil {
+		return nil, dbError(s.log, err, "ledger entry")
+	}
+	paid := map[string]money.Amount{}
+	credited := money.Amount(0)
+	for _, e := range entries {
+		switch e.Account {
+		case models.AccountReceivable:
+			paid[*e.InvoiceID] += e.Credit
+		case models.AccountCredit:
+			credited += e.Credit
+		}
+	}
+	if len(paid) > 0 {
+		invoices, err := listAll(ctx, s.invoices, ListSpec{Where: map[string]any{"id": slices.Collect(maps.Keys(paid))}})
+		if err != nil {
+			return nil, dbError(s.log, err, "invoice")
+		}
+		slices.SortFunc(invoices, func(a, b models.Invoices) int {
+			return cmp.Compare(ptrValue(a.Number), ptrValue(b.Number))
+		})
+		for _, inv := range invoices {
+			d.Items.Rows = append(d.Items.Rows, []string{
+				"Invoice " + ptrValue(inv.Number),
+				inv.PeriodStart.Format(time.DateOnly) + " to " + inv.PeriodEnd.Format(time.DateOnly),
+				paid[inv.InvoiceID].String(),
+			})
+		}
+	}
+	if credited > 0 {
+		d.Items.Rows = append(d.Items.Rows, []string{"Credit kept for the next invoices", "", credited.String()})
+	}
+	if err := s.familyBalance(ctx, p.StudentID, d); err != nil {
+		return nil, err
+	}
+	return s.render(d)
+}
+
+// familyBalance adds to d what the student and the students sharing a
+// parent with them owe today
+func (s *DocumentsService) familyBalance(ctx context.Context, studentID string, d *document.Document) error {
+	ids, err := familyOf(ctx, s.store, s.log, studentID)
+	if err != nil {
+		return err
+	}
+	balances, err := s.ledger.balances(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	students, err := listAll(ctx, s.students, ListSpec{Where: map[string]any{"id": ids}, Relations: []string{"User"}})
+	if err != nil {
+		return dbError(s.log, err, "student")
+	}
+	names := make(map[string]string, len(students))
+	for _, st := range students {
+		names[st.StudentID] = studentName(&st)
+	}
+	d.BalanceTitle = "Family balance on " + time.Now().Format(time.DateOnly) + " (" + money.CenterCurrency().Code + ")"
+	d.Balance.Columns = []document.Column{
+		{Title: "Student", Width: 6},
+		{Title: "Owed", Width: 2, Right: true},
+		{Title: "Credit", Width: 2, Right: true},
+		{Title: "Balance", Width: 2, Right: true},
+	}
+	total := studentBalance{}
+	for _, id := range ids {
+		b := balances[id]
+		total.Owed += b.Owed
+		total.Credit += b.Credit
+		d.Balance.Rows = append(d.Balance.Rows, []string{cmp.Or(names[id], id), b.Owed.String(), b.Credit.String(), (b.Owed - b.Credit).String()})
+	}
+	if len(ids) > 1 {
+		d.Balance.Footer = []string{"Total", total.Owed.String(), total.Credit.String(), (total.Owed - total.Credit).String()}
+	}
+	return nil
+}
+
+func (s *DocumentsService) render(d *document.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := document.Render(&buf, s.branding, d); err != nil {
+		s.log.Err(err).Str("title", d.Title).Str("number", d.Number).Msg("Couldn't render document")
+		return nil, huma.Error500InternalServerError("couldn't render the document")
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyCode signs the kind and ID of a document, so only documents handed
+// out by the center verify
+func (s *DocumentsService) verifyCode(kind string, id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("document/" + kind + "/" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// verifyURL is the link encoded in the QR code of a document, empty when
+// the API has no public URL
+func (s *DocumentsService) verifyURL(kind string, id string) string {
+	if s.publicURL == "" {
+		return ""
+	}
+	return s.publicURL + "/verify/" + kind + "/" + id + "?code=" + url.QueryEscape(s.verifyCode(kind, id))
+}
+
+// Verify returns what a genuine document shows as it stands now. Anything
+// not handed out by the center, drafts included, is not found.
+func (s *DocumentsService) Verify(ctx context.Context, kind string, id string, code string) (*dto.VerifyDocumentResBody, error) {
+	notFound := huma.Error404NotFound("document not found")
+	if !hmac.Equal([]byte(code), []byte(s.verifyCode(kind, id))) {
+		return nil, notFound
+	}
+	res := &dto.VerifyDocumentResBody{Kind: kind, ID: id}
+	switch kind {
+	case DocumentInvoice:
+		inv := models.Invoices{InvoiceID: id}
+		if err := s.invoices.Get(ctx, &inv); err != nil {
+			return nil, dbError(s.log, err, "document")
+		}
+		if inv.IssuedAt == nil {
+			return nil, notFound
+		}
+		res.Number, res.Status = inv.Number, &inv.Status
+		res.Date = inv.IssuedAt.Format(time.DateOnly)
+		res.Amount, res.Currency = inv.Total, inv.Currency
+	case DocumentReceipt:
+		p := models.Payments{PaymentID: id}
+		if err := s.payments.Get(ctx, &p); err != nil {
+			return nil, dbError(s.log, err, "document")
+		}
+		res.Date = p.ReceivedAt.Format(time.DateOnly)
+		res.Amount, res.Currency = p.Amount, p.Currency
+	default:
+		return nil, notFound
+	}
+	return res, nil
+}
+
+// recipient is the name and contacts of the student a document is for
+func recipient(st *models.Students) []string {
+	if st == nil {
+		return nil
+	}
+	lines := []string{studentName(st)}
+	if u := st.User; u != nil {
+		lines = append(lines, u.Email)
+		if u.PhoneNumber != nil {
+			lines = append(lines, *u.PhoneNumber)
+		}
+	}
+	return lines
+}
+
+// studentName is the full name of the student's user, or their username
+func studentName(st *models.Students) string {
+	if st.User == nil {
+		return st.StudentID
+	}
+	return userName(st.User)
+}
+
+// userName is the full name of the user, or their username
+func userName(u *models.Users) string {
+	name := strings.TrimSpace(ptrValue(u.FirstName) + " " + ptrValue(u.FamilyName))
+	return cmp.Or(name, u.Username)
+}
+
+// lineDescription is the description of an invoice line with the pricing
+// rules and proration that changed its price
+func lineDescription(l *models.InvoiceLines) string {
+	parts := []string{l.Description}
+	for _, a := range l.Adjustments {
+		parts = append(parts, fmt.Sprintf("%s: -%s", a.Name, a.Amount))
+	}
+	if l.ListPrice != l.UnitPrice && len(l.Adjustments) == 0 {
+		parts = append(parts, "List price: "+l.ListPrice.String())
+	}
+	if p := l.Proration; p != nil {
+		parts = append(parts, fmt.Sprintf("Prorated: %d of %d %s", p.Units, p.Total, prorationUnit(p.Policy)))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func prorationUnit(policy string) string {
+	if policy == models.ProrateSessions {
+		return "sessions"
+	}
+	return "days"
+}
+
+func ptrValue[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
@@ -2,119 +2,694 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 )
 
+// EmployeesService keeps the staff and their employment records. The role,
+// salary and status of an employee are those of the record in effect, and
+// salaries are only shown to HR. See docs/employees.md.
 type EmployeesService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	log   zerolog.Logger
+	// bootstrapHR is the user counting as HR while no employee holds it,
+	// nobody when empty
+	bootstrapHR string
+	crud        *resource[models.Employees, dto.GetEmployeeResBody]
+	// staff is crud exporting no salaries, for callers who aren't HR
+	staff   *resource[models.Employees, dto.GetEmployeeResBody]
+	records Repository[models.EmployeeRecords]
 }
 
-func NewEmployeesService(db *bun.DB) (*EmployeesService, error) {
+func NewEmployeesService(store Store, bootstrapHR string) (*EmployeesService, error) {
 	log := logging.L().With().Str("service", "employees.svc").Logger()
-	return &EmployeesService{log: log, db: db}, nil
+	s := &EmployeesService{log: log, store: store, bootstrapHR: bootstrapHR}
+	s.records = NewRepository[models.EmployeeRecords](store)
+	spec := resourceSpec[models.Employees, dto.GetEmployeeResBody]{
+		Relations: []string{"User"},
+		Search:    append([]string{"?TableAlias.role"}, dto.JoinedUserSearchColumns...),
+		Filters: withUserFilters(`"user"`, map[string]string{
+			"role":           "?TableAlias.role",
+			"salary":         "?TableAlias.salary",
+			"status":         "?TableAlias.status",
+			"contract_start": "?TableAlias.contract_start",
+			"contract_end":   "?TableAlias.contract_end",
+			"user_id":        "?TableAlias.user_id",
+		}),
+		Columns: employeeColumns,
+		ToRes:   s.ModelToRes,
+	}
+	s.crud = newResource(store, log, spec)
+	spec.Columns = slices.DeleteFunc(slices.Clone(employeeColumns), func(c spreadsheet.Column[models.Employees]) bool {
+		return c.Name == "salary"
+	})
+	s.staff = newResource(store, log, spec)
+	return s, nil
+}
+
+// canHR tells whether the caller may see salaries and change employment
+// records: an employee holding the hr permission, or the bootstrap HR user
+// while no employee holds it, so that the first one can be granted it
+func (s *EmployeesService) canHR(ctx context.Context, callerID string) (bool, error) {
+	caller := models.Employees{}
+	err := s.crud.repo.GetBy(ctx, &caller, "user_id", callerID)
+	switch {
+	case err == nil && caller.Can(models.PermissionHR):
+		return true, nil
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return false, dbError(s.log, err, "employee")
+	case s.bootstrapHR == "" || callerID != s.bootstrapHR:
+		return false, nil
+	}
+	holders, err := s.hrHolders(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(holders) == 0, nil
 }
 
-func (s *EmployeesService) GetEmployees(ctx context.Context, params *dto.ListEmployeesReq) (*dto.ListEmployeesRes, error) {
-	total, err := s.db.NewSelect().Model((*models.Employees)(nil)).Count(ctx)
+// requireHR refuses callers who aren't HR, see canHR
+func (s *EmployeesService) requireHR(ctx context.Context, callerID string) error {
+	hr, err := s.canHR(ctx, callerID)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return err
 	}
-	var employees []models.Employees
-	res := &dto.ListEmployeesRes{
-		Body: dto.ListEmployeesResBody{
-			Total:     0,
-			ListQuery: params.ListQuery,
-			Employees: nil,
-		},
+	if !hr {
+		return huma.Error403Forbidden("only HR may see salaries and change employment records")
 	}
-	res.Body.Total = total
+	return nil
+}
 
-	q := s.db.NewSelect().Model(&employees)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("(role ILIKE ? OR user_id ILIKE ?)", search, search)
+// hrHolders returns the IDs of the employees holding the hr permission
+func (s *EmployeesService) hrHolders(ctx context.Context) ([]string, error) {
+	all, err := listAll(ctx, s.crud.repo, ListSpec{})
+	if err != nil {
+		return nil, dbError(s.log, err, "employee")
 	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	ids := []string{}
+	for _, e := range all {
+		if e.Can(models.PermissionHR) {
+			ids = append(ids, e.EmployeeID)
+		}
+	}
+	return ids, nil
+}
 
-	if err := q.Scan(ctx, &employees); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
+// checkSalaryQuery refuses filtering or sorting on salaries to callers who
+// can't see them, which would tell them apart all the same
+func checkSalaryQuery(params dto.ListQuery) error {
+	forbidden := huma.Error403Forbidden("only HR may filter or sort on salaries")
+	if params.SortBy == "salary" {
+		return forbidden
+	}
+	if strings.TrimSpace(params.Filters) == "" {
+		return nil
+	}
+	// malformed filters are reported by the listing
+	filters, _ := dto.ParseFilters(params.Filters)
+	for _, f := range filters {
+		if f.Field == "salary" {
+			return forbidden
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
 	}
+	return nil
+}
 
-	resEmployees := []dto.GetEmployeeResBody{}
-	for _, emp := range employees {
-		newEmployee := dto.GetEmployeeResBody{
-			ID:        emp.EmployeeID,
-			UserID:    emp.UserID,
-			Role:      emp.Role,
-			Salary:    emp.Salary,
-			CreatedAt: int(emp.CreatedAt.Unix()),
-			UpdatedAt: int(emp.UpdatedAt.Unix()),
+func (s *EmployeesService) GetEmployees(ctx context.Context, callerID string, params *dto.ListEmployeesReq) (*dto.ListEmployeesRes, error) {
+	hr, err := s.canHR(ctx, callerID)
+	if err != nil {
+		return nil, err
+	}
+	if !hr {
+		if err := checkSalaryQuery(params.ListQuery); err != nil {
+			return nil, err
+		}
+	}
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.ListEmployeesRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Employees = l.Items
+	if !hr {
+		for i := range res.Body.Employees {
+			res.Body.Employees[i].Salary = nil
 		}
-		resEmployees = append(resEmployees, newEmployee)
 	}
-	res.Body.Employees = resEmployees
 	return res, nil
 }
 
-func (s *EmployeesService) GetEmployeeByID(ctx context.Context, id string) (*models.Employees, error) {
+var employeeColumns = slices.Concat(
+	[]spreadsheet.Column[models.Employees]{
+		{Name: "id", Value: func(m *models.Employees) any { return m.EmployeeID }},
+		{Name: "role", Value: func(m *models.Employees) any { return m.Role }},
+		{Name: "salary", Value: func(m *models.Employees) any { return m.Salary }},
+		{Name: "status", Value: func(m *models.Employees) any { return m.Status }},
+		{Name: "contract_start", Value: func(m *models.Employees) any { return cellString(datePtr(m.ContractStart)) }},
+		{Name: "contract_end", Value: func(m *models.Employees) any { return cellString(datePtr(m.ContractEnd)) }},
+		{Name: "permissions", Value: func(m *models.Employees) any { return strings.Join(m.Permissions, ",") }},
+		{Name: "user_id", Value: func(m *models.Employees) any { return m.UserID }},
+	},
+	userColumns("", func(m *models.Employees) *models.Users { return m.User }),
+	[]spreadsheet.Column[models.Employees]{
+		{Name: "created_at", Value: func(m *models.Employees) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Employees) any { return m.UpdatedAt }},
+	},
+)
+
+// ExportEmployees writes every employee matching params to w, without
+// salaries unless the caller is HR
+func (s *EmployeesService) ExportEmployees(ctx context.Context, callerID string, params *dto.ListEmployeesReq, format string, w io.Writer) error {
+	hr, err := s.canHR(ctx, callerID)
+	if err != nil {
+		return err
+	}
+	if hr {
+		return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+	}
+	if err := checkSalaryQuery(params.ListQuery); err != nil {
+		return err
+	}
+	for _, c := range strings.Split(params.Columns, ",") {
+		if strings.TrimSpace(c) == "salary" {
+			return huma.Error403Forbidden("only HR may export salaries")
+		}
+	}
+	return s.staff.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+func (s *EmployeesService) GetEmployeeByID(ctx context.Context, callerID string, id string) (*dto.GetEmployeeResBody, error) {
+	hr, err := s.canHR(ctx, callerID)
+	if err != nil {
+		return nil, err
+	}
 	m := models.Employees{EmployeeID: id}
-	if err := s.db.NewSelect().Model(&m).WherePK("id").Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get employee")
-		return nil, huma.Error404NotFound("employee not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
-	return &m, nil
+	res := s.ModelToRes(&m)
+	if !hr {
+		res.Salary = nil
+	}
+	return res, nil
 }
 
-func (s *EmployeesService) CreateEmployee(ctx context.Context, userID string, role string, salary float64) (*models.Employees, error) {
-	if _, err := ulid.Parse(userID); err != nil {
+// CreateEmployee makes the user an employee, with a first record of their
+// role and salary taking effect when the contract starts, today by default
+func (s *EmployeesService) CreateEmployee(ctx context.Context, callerID string, input dto.CreateEmployeeReq) (*dto.GetEmployeeResBody, error) {
+	in := input.Body
+	if _, err := ulid.Parse(in.UserID); err != nil {
 		return nil, huma.Error400BadRequest("userID is invalid", err)
 	}
 	m := models.Employees{
-		EmployeeID: userID,
-		UserID:     userID,
-		Role:       role,
-		Salary:     salary,
+		EmployeeID:  in.UserID,
+		UserID:      in.UserID,
+		Role:        in.Role,
+		Salary:      in.Salary,
+		Status:      models.EmployeeActive,
+		Permissions: []string{},
+	}
+	var err error
+	if m.ContractStart, err = parseDatePtr(in.ContractStart, "body.contract_start"); err != nil {
+		return nil, err
+	}
+	if m.ContractEnd, err = parseDatePtr(in.ContractEnd, "body.contract_end"); err != nil {
+		return nil, err
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert employee")
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := validateContract(&m); err != nil {
+		return nil, err
 	}
-	return &m, nil
+	first := models.EmployeeRecords{
+		RecordID:      ulid.Make().String(),
+		EmployeeID:    m.EmployeeID,
+		EffectiveFrom: dateOf(time.Now()),
+		Role:          in.Role,
+		Salary:        in.Salary,
+		Status:        models.EmployeeActive,
+		CreatedBy:     &callerID,
+	}
+	if m.ContractStart != nil {
+		first.EffectiveFrom = *m.ContractStart
+	}
+	if err := validateRecord(&first); err != nil {
+		return nil, err
+	}
+	err = s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.requireHR(ctx, callerID); err != nil {
+			return err
+		}
+		if err := s.crud.Create(ctx, &m); err != nil {
+			return err
+		}
+		if err := s.records.Insert(ctx, &first); err != nil {
+			return dbError(s.log, err, "employee record")
+		}
+		return s.refresh(ctx, &m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
 }
 
-func (s *EmployeesService) UpdateEmployee(ctx context.Context, employee models.Employees) (*models.Employees, error) {
-	m := employee
-	m.EmployeeID = employee.EmployeeID
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("employee not found")
+// UpdateEmployee applies a merge patch to an employee. A role, salary or
+// status sent takes effect today, through a record of today.
+func (s *EmployeesService) UpdateEmployee(ctx context.Context, callerID string, input dto.UpdateEmployeeReq) (*dto.GetEmployeeResBody, error) {
+	in := input.Body
+	m := models.Employees{EmployeeID: in.ID}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.requireHR(ctx, callerID); err != nil {
+			return err
+		}
+		m = models.Employees{EmployeeID: in.ID}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		patch := dto.Patch{}
+		var contractStart, contractEnd *string
+		dto.PatchPtr(&patch, "contract_start", in.ContractStart, &contractStart)
+		dto.PatchPtr(&patch, "contract_end", in.ContractEnd, &contractEnd)
+		var err error
+		if patch.Has("contract_start") {
+			if m.ContractStart, err = parseDatePtr(contractStart, "body.contract_start"); err != nil {
+				return err
+			}
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		if patch.Has("contract_end") {
+			if m.ContractEnd, err = parseDatePtr(contractEnd, "body.contract_end"); err != nil {
+				return err
+			}
+		}
+		if err := validateContract(&m); err != nil {
+			return err
+		}
+		if err := s.crud.Update(ctx, &m, patch); err != nil {
+			return err
+		}
+
+		if in.Role.Sent || in.Salary.Sent || in.Status.Sent {
+			records, err := s.recordsOf(ctx, m.EmployeeID)
+			if err != nil {
+				return err
+			}
+			today := dateOf(time.Now())
+			r := models.EmployeeRecords{RecordID: ulid.Make().String(), EmployeeID: m.EmployeeID, EffectiveFrom: today, CreatedBy: &callerID}
+			if base := inEffect(records, today); base != nil {
+				r.Role, r.Salary, r.Status = base.Role, base.Salary, base.Status
+				if base.EffectiveFrom.Equal(today) {
+					r = *base
+				}
+			}
+			changed := dto.Patch{}
+			dto.PatchValue(&changed, "role", in.Role, &r.Role)
+			dto.PatchValue(&changed, "salary", in.Salary, &r.Salary)
+			dto.PatchValue(&changed, "status", in.Status, &r.Status)
+			if err := validateRecord(&r); err != nil {
+				return err
+			}
+			if r.CreatedAt.IsZero() {
+				err = s.records.Insert(ctx, &r)
+			} else {
+				err = s.records.Update(ctx, &r, changed.Columns...)
+			}
+			if err != nil {
+				return dbError(s.log, err, "employee record")
+			}
+		}
+		return s.refresh(ctx, &m)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &m, nil
+	return s.ModelToRes(&m), nil
 }
 
-func (s *EmployeesService) DeleteEmployee(ctx context.Context, id string) error {
+// validateContract checks the contract of m doesn't end before it starts
+func validateContract(m *models.Employees) error {
+	if m.ContractStart != nil && m.ContractEnd != nil && m.ContractEnd.Before(*m.ContractStart) {
+		return huma.Error422UnprocessableEntity("contract is invalid", &huma.ErrorDetail{
+			Message: "the contract ends before it starts", Location: "body.contract_end",
+		})
+	}
+	return nil
+}
+
+// validateRecord checks r has a role and a salary that isn't negative
+func validateRecord(r *models.EmployeeRecords) error {
+	invalid := func(location string, message string) error {
+		return huma.Error422UnprocessableEntity("employee record is invalid", &huma.ErrorDetail{
+			Message: message, Location: location,
+		})
+	}
+	switch {
+	case strings.TrimSpace(r.Role) == "":
+		return invalid("body.role", "expected a role")
+	case r.Salary < 0:
+		return invalid("body.salary", "expected a salary of zero or more")
+	}
+	return nil
+}
+
+// recordsOf returns the live records of an employee, the earliest first
+func (s *EmployeesService) recordsOf(ctx context.Context, employeeID string) ([]models.EmployeeRecords, error) {
+	records, err := listAll(ctx, s.records, ListSpec{Where: map[string]any{"employee_id": employeeID}})
+	if err != nil {
+		return nil, dbError(s.log, err, "employee record")
+	}
+	slices.SortFunc(records, func(a, b models.EmployeeRecords) int {
+		return a.EffectiveFrom.Compare(b.EffectiveFrom)
+	})
+	return records, nil
+}
+
+// inEffect returns the record of records, sorted by recordsOf, in effect on
+// day, nil before the first one
+func inEffect(records []models.EmployeeRecords, day time.Time) *models.EmployeeRecords {
+	var found *models.EmployeeRecords
+	for i, r := range records {
+		if r.EffectiveFrom.After(day) {
+			break
+		}
+		found = &records[i]
+	}
+	return found
+}
+
+// current derives the role, salary and status of m on day from its records:
+// those of the record in effect, or of the first one when none is yet. An
+// employee whose contract ended has left.
+func current(m *models.Employees, records []models.EmployeeRecords, day time.Time) (string, money.Amount, string) {
+	r := inEffect(records, day)
+	if r == nil && len(records) > 0 {
+		r = &records[0]
+	}
+	role, salary, status := m.Role, m.Salary, m.Status
+	if r != nil {
+		role, salary, status = r.Role, r.Salary, r.Status
+	}
+	if m.ContractEnd != nil && m.ContractEnd.Before(day) {
+		status = models.EmployeeLeft
+	}
+	return role, salary, status
+}
+
+// refresh writes the current role, salary and status of m, see current
+func (s *EmployeesService) refresh(ctx context.Context, m *models.Employees) error {
+	records, err := s.recordsOf(ctx, m.EmployeeID)
+	if err != nil {
+		return err
+	}
+	role, salary, status := current(m, records, dateOf(time.Now()))
+	if role == m.Role && salary == m.Salary && status == m.Status {
+		return nil
+	}
+	m.Role, m.Salary, m.Status = role, salary, status
+	return s.crud.Update(ctx, m, dto.Patch{Columns: []string{"role", "salary", "status"}})
+}
+
+// RefreshEmployees brings every employee to their current values, for
+// records and contract ends reached since they last changed, and returns how
+// many changed
+func (s *EmployeesService) RefreshEmployees(ctx context.Context) (int, error) {
+	n := 0
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		n = 0
+		all, err := listAll(ctx, s.crud.repo, ListSpec{})
+		if err != nil {
+			return dbError(s.log, err, "employee")
+		}
+		for _, m := range all {
+			before := m
+			if err := s.refresh(ctx, &m); err != nil {
+				return err
+			}
+			if m.Role != before.Role || m.Salary != before.Salary || m.Status != before.Status {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// RunRefresh runs RefreshEmployees every interval until ctx is done.
+func (s *EmployeesService) RunRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.RefreshEmployees(ctx)
+			if err != nil {
+				s.log.Err(err).Msg("Couldn't refresh employees")
+				continue
+			}
+			if n > 0 {
+				s.log.Info().Int("changed", n).Msg("Refreshed employees from their records")
+			}
+		}
+	}
+}
+
+// GetRecords lists the records of an employee, the latest first
+func (s *EmployeesService) GetRecords(ctx context.Context, callerID string, id string) (*dto.ListEmployeeRecordsRes, error) {
+	if err := s.requireHR(ctx, callerID); err != nil {
+		return nil, err
+	}
 	m := models.Employees{EmployeeID: id}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("employee not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
+	}
+	records, err := s.recordsOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	inForce := inEffect(records, dateOf(time.Now()))
+	res := &dto.ListEmployeeRecordsRes{}
+	res.Body.Records = []dto.EmployeeRecordRes{}
+	for i := len(records) - 1; i >= 0; i-- {
+		res.Body.Records = append(res.Body.Records, *recordToRes(&records[i], inForce))
+	}
+	return res, nil
+}
+
+// AddRecord records a change of role, salary or status from a day on.
+// Whatever isn't given stays as in effect that day.
+func (s *EmployeesService) AddRecord(ctx context.Context, callerID string, input dto.CreateEmployeeRecordReq) (*dto.EmployeeRecordRes, error) {
+	in := input.Body
+	day, err := time.Parse(time.DateOnly, in.EffectiveFrom)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("effective_from is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "body.effective_from", Value: in.EffectiveFrom,
+		})
+	}
+	r := models.EmployeeRecords{
+		RecordID:      ulid.Make().String(),
+		EmployeeID:    input.ID,
+		EffectiveFrom: day,
+		Status:        models.EmployeeActive,
+		Note:          in.Note,
+		CreatedBy:     &callerID,
+	}
+	var records []models.EmployeeRecords
+	err = s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.requireHR(ctx, callerID); err != nil {
+			return err
+		}
+		m := models.Employees{EmployeeID: input.ID}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		if records, err = s.recordsOf(ctx, m.EmployeeID); err != nil {
+			return err
+		}
+		base := inEffect(records, day)
+		if base != nil && base.EffectiveFrom.Equal(day) {
+			return huma.Error409Conflict("a record of the employee already takes effect on " + in.EffectiveFrom)
 		}
-		return huma.Error500InternalServerError(err.Error())
+		if base != nil {
+			r.Role, r.Salary, r.Status = base.Role, base.Salary, base.Status
+		} else if in.Salary == nil {
+			return huma.Error422UnprocessableEntity("employee record is invalid", &huma.ErrorDetail{
+				Message: "expected a salary, no record is in effect that day", Location: "body.salary",
+			})
+		}
+		if in.Role != nil {
+			r.Role = *in.Role
+		}
+		if in.Salary != nil {
+			r.Salary = *in.Salary
+		}
+		if in.Status != nil {
+			r.Status = *in.Status
+		}
+		if err := validateRecord(&r); err != nil {
+			return err
+		}
+		if err := s.records.Insert(ctx, &r); err != nil {
+			return dbError(s.log, err, "employee record")
+		}
+		records = append(records, r)
+		slices.SortFunc(records, func(a, b models.EmployeeRecords) int {
+			return a.EffectiveFrom.Compare(b.EffectiveFrom)
+		})
+		return s.refresh(ctx, &m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recordToRes(&r, inEffect(records, dateOf(time.Now()))), nil
+}
+
+// DeleteRecord deletes a record entered by mistake. The only record of an
+// employee can't be deleted.
+func (s *EmployeesService) DeleteRecord(ctx context.Context, callerID string, id string, recordID string) error {
+	return s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.requireHR(ctx, callerID); err != nil {
+			return err
+		}
+		m := models.Employees{EmployeeID: id}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		records, err := s.recordsOf(ctx, id)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(records, func(r models.EmployeeRecords) bool { return r.RecordID == recordID })
+		if i < 0 {
+			return huma.Error404NotFound("employee record not found")
+		}
+		if len(records) == 1 {
+			return huma.Error409Conflict("the only record of an employee can't be deleted")
+		}
+		if err := s.records.Delete(ctx, &records[i]); err != nil {
+			return dbError(s.log, err, "employee record")
+		}
+		return s.refresh(ctx, &m)
+	})
+}
+
+// SetPermissions replaces the permissions of an employee. The last holder
+// of hr can't lose it, which would open HR to everybody again.
+func (s *EmployeesService) SetPermissions(ctx context.Context, callerID string, id string, permissions []string) (*dto.GetEmployeeResBody, error) {
+	m := models.Employees{EmployeeID: id}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.requireHR(ctx, callerID); err != nil {
+			return err
+		}
+		m = models.Employees{EmployeeID: id}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		if m.Can(models.PermissionHR) && !slices.Contains(permissions, models.PermissionHR) {
+			if err := s.checkNotLastHR(ctx, id); err != nil {
+				return err
+			}
+		}
+		m.Permissions = slices.Compact(slices.Sorted(slices.Values(permissions)))
+		return s.crud.Update(ctx, &m, dto.Patch{Columns: []string{"permissions"}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// checkNotLastHR refuses to take hr from the employee id when nobody else
+// holds it
+func (s *EmployeesService) checkNotLastHR(ctx context.Context, id string) error {
+	holders, err := s.hrHolders(ctx)
+	if err != nil {
+		return err
+	}
+	if len(holders) == 1 && holders[0] == id {
+		return huma.Error409Conflict("the employee is the last one holding hr, grant it to another employee first")
 	}
 	return nil
 }
+
+// DeleteEmployee deletes an employee, unless they are the last holder of
+// hr. Their records are kept as history.
+func (s *EmployeesService) DeleteEmployee(ctx context.Context, id string) error {
+	return s.crud.DeleteIf(ctx, &models.Employees{EmployeeID: id}, func(ctx context.Context) error {
+		return s.checkNotLastHR(ctx, id)
+	})
+}
+
+// PreviewDeleteEmployee reports the records deleting the employee would affect
+func (s *EmployeesService) PreviewDeleteEmployee(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
+}
+
+// ModelToRes maps an employee with its salary, which callers who aren't HR
+// must clear
+func (s *EmployeesService) ModelToRes(m *models.Employees) *dto.GetEmployeeResBody {
+	if m == nil {
+		return nil
+	}
+	salary := m.Salary
+	res := &dto.GetEmployeeResBody{
+		ID:            m.EmployeeID,
+		UserID:        m.UserID,
+		Role:          m.Role,
+		Salary:        &salary,
+		Status:        m.Status,
+		ContractStart: datePtr(m.ContractStart),
+		ContractEnd:   datePtr(m.ContractEnd),
+		Permissions:   m.Permissions,
+	}
+	if res.Permissions == nil {
+		res.Permissions = []string{}
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
+
+// recordToRes maps a record, inForce being the record in effect today
+func recordToRes(r *models.EmployeeRecords, inForce *models.EmployeeRecords) *dto.EmployeeRecordRes {
+	res := &dto.EmployeeRecordRes{
+		ID:            r.RecordID,
+		EmployeeID:    r.EmployeeID,
+		EffectiveFrom: r.EffectiveFrom.Format(time.DateOnly),
+		Role:          r.Role,
+		Salary:        r.Salary,
+		Status:        r.Status,
+		Note:          r.Note,
+		InEffect:      inForce != nil && inForce.RecordID == r.RecordID,
+		CreatedBy:     r.CreatedBy,
+	}
+	if !r.CreatedAt.IsZero() {
+		res.CreatedAt = int(r.CreatedAt.Unix())
+	}
+	if !r.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(r.UpdatedAt.Unix())
+	}
+	return res
+}
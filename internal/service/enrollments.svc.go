@@ -2,11 +2,16 @@ package service
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"io"
+	"slices"
+	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
@@ -14,52 +19,111 @@ import (
 )
 
 type EnrollmentsService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store  Store
+	groups Repository[models.Groups]
+	// db is nil in stores without a database
+	db     *bun.DB
+	log    zerolog.Logger
+	crud   *resource[models.Enrollments, dto.EnrollmentModelRes]
+	pricer *pricer
+	// invoices, lines, ledger and prorater credit withdrawals
+	invoices Repository[models.Invoices]
+	lines    Repository[models.InvoiceLines]
+	ledger   *ledger
+	prorater *prorater
 }
 
-func NewEnrollmentsService(db *bun.DB) (*EnrollmentsService, error) {
+func NewEnrollmentsService(store Store, proration string) (*EnrollmentsService, error) {
 	log := logging.L().With().Str("service", "enrollments.svc").Logger()
-	return &EnrollmentsService{log: log, db: db}, nil
+	s := &EnrollmentsService{log: log, store: store, db: store.DB()}
+	s.groups = NewRepository[models.Groups](store)
+	s.pricer = newPricer(store, log)
+	s.invoices = NewRepository[models.Invoices](store)
+	s.lines = NewRepository[models.InvoiceLines](store)
+	s.ledger = newLedger(store, log)
+	s.prorater = newProrater(store, log, proration)
+	s.crud = newResource(store, log, resourceSpec[models.Enrollments, dto.EnrollmentModelRes]{
+		Relations: []string{"Student.User", "Group"},
+		Search:    append(dto.UserSearchColumnsOf(`"student__user"`), `"group".name`),
+		Filters: map[string]string{
+			"student_id":    "?TableAlias.student_id",
+			"group_id":      "?TableAlias.group_id",
+			"fee":           "?TableAlias.fee",
+			"effective_fee": "?TableAlias.effective_fee",
+			"start_date":    "?TableAlias.start_date",
+			"end_date":      "?TableAlias.end_date",
+		},
+		Columns: enrollmentColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *EnrollmentsService) GetEnrollments(ctx context.Context, params *dto.ListEnrollmentsReq) (*dto.ListEnrollmentsRes, error) {
-	total, err := s.db.NewSelect().Model((*models.Enrollments)(nil)).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-	var enrollments []models.Enrollments
-	res := &dto.ListEnrollmentsRes{
-		Body: dto.ListEnrollmentsResBody{
-			Total:       0,
-			ListQuery:   params.ListQuery,
-			Enrollments: nil,
-		},
+		return nil, err
 	}
-	res.Body.Total = total
+	return &dto.ListEnrollmentsRes{Body: enrollmentsListBody(l, params.ListQuery)}, nil
+}
 
-	q := s.db.NewSelect().Model(&enrollments)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("(student_id ILIKE ? OR group_id ILIKE ?)", search, search)
+func enrollmentsListBody(l *listing[dto.EnrollmentModelRes], params dto.ListQuery) dto.ListEnrollmentsResBody {
+	return dto.ListEnrollmentsResBody{
+		Enrollments: l.Items,
+		Total:       l.Total,
+		ListQuery:   l.Query(params),
+		PageCursors: l.Cursors,
 	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+}
 
-	if err := q.Scan(ctx, &enrollments); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
+var enrollmentColumns = slices.Concat(
+	[]spreadsheet.Column[models.Enrollments]{
+		{Name: "student_id", Value: func(m *models.Enrollments) any { return m.StudentID }},
+		{Name: "group_id", Value: func(m *models.Enrollments) any { return m.GroupID }},
+		{Name: "fee", Value: func(m *models.Enrollments) any { return m.Fee }},
+		{Name: "effective_fee", Value: func(m *models.Enrollments) any { return m.EffectiveFee }},
+		{Name: "start_date", Value: func(m *models.Enrollments) any { return m.StartDate.Format(time.DateOnly) }},
+		{Name: "end_date", Value: func(m *models.Enrollments) any { return cellString(datePtr(m.EndDate)) }},
+	},
+	userColumns("student_", func(m *models.Enrollments) *models.Users {
+		if m.Student == nil {
+			return nil
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+		return m.Student.User
+	}),
+	[]spreadsheet.Column[models.Enrollments]{
+		{Name: "student_level", Value: func(m *models.Enrollments) any {
+			if m.Student == nil {
+				return nil
+			}
+			return cellString(m.Student.Level)
+		}},
+		{Name: "group_name", Value: func(m *models.Enrollments) any {
+			if m.Group == nil {
+				return nil
+			}
+			return m.Group.Name
+		}},
+		{Name: "group_subject", Value: func(m *models.Enrollments) any {
+			if m.Group == nil {
+				return nil
+			}
+			return m.Group.Subject
+		}},
+		{Name: "group_default_fee", Value: func(m *models.Enrollments) any {
+			if m.Group == nil {
+				return nil
+			}
+			return m.Group.DefaultFee
+		}},
+		{Name: "created_at", Value: func(m *models.Enrollments) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Enrollments) any { return m.UpdatedAt }},
+	},
+)
 
-	resEnrollments := []dto.EnrollmentModelRes{}
-	for _, enr := range enrollments {
-		resEnrollments = append(resEnrollments, *s.ModelToRes(&enr))
-	}
-	res.Body.Enrollments = resEnrollments
-	return res, nil
+// ExportEnrollments writes every enrollment matching params to w
+func (s *EnrollmentsService) ExportEnrollments(ctx context.Context, params *dto.ListEnrollmentsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *EnrollmentsService) GetEnrollmentByID(ctx context.Context, studentID, groupID string) (*dto.EnrollmentModelRes, error) {
@@ -71,53 +135,129 @@ func (s *EnrollmentsService) GetEnrollmentByID(ctx context.Context, studentID, g
 	}
 
 	m := models.Enrollments{StudentID: studentID, GroupID: groupID}
-	if err := s.db.NewSelect().Model(&m).WherePK().Scan(ctx); err != nil {
-		s.log.Err(err).Msg("Couldn't get enrollment")
-		return nil, huma.Error404NotFound("enrollment not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m), nil
 }
 
-func (s *EnrollmentsService) CreateEnrollment(ctx context.Context, studentID string, groupID string, fee *float64) (*models.Enrollments, error) {
+// CreateEnrollment enrolls the student in the group from startDate, today
+// when nil. Invoices bill it from that day on.
+func (s *EnrollmentsService) CreateEnrollment(ctx context.Context, studentID string, groupID string, fee *money.Amount, startDate *string) (*models.Enrollments, error) {
 	if _, err := ulid.Parse(studentID); err != nil {
 		return nil, huma.Error400BadRequest("studentID is invalid", err)
 	}
 	if _, err := ulid.Parse(groupID); err != nil {
 		return nil, huma.Error400BadRequest("groupID is invalid", err)
 	}
+	start, err := parseDateOr(startDate, "body.start_date")
+	if err != nil {
+		return nil, err
+	}
 
 	// If fee not specified, fetch group's default fee
 	actualFee := fee
 	if fee == nil {
 		group := models.Groups{GroupID: groupID}
-		if err := s.db.NewSelect().Model(&group).WherePK("id").Scan(ctx); err != nil {
-			s.log.Err(err).Msg("Couldn't get group for default fee")
-			return nil, huma.Error404NotFound("group not found")
+		if err := s.groups.Get(ctx, &group); err != nil {
+			return nil, dbError(s.log, err, "group")
 		}
 		actualFee = &group.DefaultFee
 	}
 
-	m := models.Enrollments{
+	rows := []models.Enrollments{{
 		StudentID: studentID,
 		GroupID:   groupID,
 		Fee:       *actualFee,
-	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
+		StartDate: start,
+	}}
+	if err := s.price(ctx, rows); err != nil {
+		return nil, err
+	}
+	m := rows[0]
+	// A withdrawn enrollment keeps its row, so re-enrolling revives it
+	if err := s.crud.repo.Revive(ctx, &m, "fee", "effective_fee", "adjustments", "start_date", "end_date"); err != nil {
 		s.log.Err(err).Msg("Couldn't insert enrollment")
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, dbError(s.log, err, "enrollment")
 	}
 	return &m, nil
 }
 
-func (s *EnrollmentsService) UpdateEnrollment(ctx context.Context, enrollment models.Enrollments) (*models.Enrollments, error) {
-	m := enrollment
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK().Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("enrollment not found")
+// parseDateOr reads the date s, today when nil
+func parseDateOr(s *string, location string) (time.Time, error) {
+	if s == nil {
+		return dateOf(time.Now()), nil
+	}
+	t, err := parseDatePtr(s, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return *t, nil
+}
+
+// price sets the effective fee of rows from their fee and the pricing rules
+// valid on the day each starts
+func (s *EnrollmentsService) price(ctx context.Context, rows []models.Enrollments) error {
+	quotes, err := s.pricer.priceOnStart(ctx, rows)
+	if err != nil {
+		return err
+	}
+	for i, q := range quotes {
+		rows[i].EffectiveFee = q.Fee
+		rows[i].Adjustments = q.Adjustments
+	}
+	return nil
+}
+
+// UpdateEnrollment applies patch to the enrollment, pricing it again when
+// its fee changes
+func (s *EnrollmentsService) UpdateEnrollment(ctx context.Context, enrollment models.Enrollments, patch dto.Patch) (*models.Enrollments, error) {
+	rows := []models.Enrollments{enrollment}
+	repriced := patch.Has("fee")
+	if repriced {
+		patch.Columns = append(patch.Columns, "effective_fee", "adjustments")
+	}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if repriced {
+			if err := s.loadStartDates(ctx, rows); err != nil {
+				return err
+			}
+			if err := s.price(ctx, rows); err != nil {
+				return err
+			}
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		return s.crud.Update(ctx, &rows[0], patch)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &m, nil
+	return &rows[0], nil
+}
+
+// loadStartDates sets the start date of rows to the one of their saved
+// enrollment, so they are priced again on the day they started. Rows of a
+// missing enrollment keep none, updating them fails anyway.
+func (s *EnrollmentsService) loadStartDates(ctx context.Context, rows []models.Enrollments) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	studentIDs, groupIDs := []string{}, []string{}
+	for _, r := range rows {
+		studentIDs = append(studentIDs, r.StudentID)
+		groupIDs = append(groupIDs, r.GroupID)
+	}
+	saved, err := listAll(ctx, s.crud.repo, ListSpec{Where: map[string]any{"student_id": studentIDs, "group_id": groupIDs}})
+	if err != nil {
+		return dbError(s.log, err, "enrollment")
+	}
+	starts := map[string]time.Time{}
+	for _, e := range saved {
+		starts[e.StudentID+"/"+e.GroupID] = e.StartDate
+	}
+	for i := range rows {
+		rows[i].StartDate = starts[rows[i].StudentID+"/"+rows[i].GroupID]
+	}
+	return nil
 }
 
 func (s *EnrollmentsService) DeleteEnrollment(ctx context.Context, studentID, groupID string) error {
@@ -128,14 +268,347 @@ func (s *EnrollmentsService) DeleteEnrollment(ctx context.Context, studentID, gr
 		return huma.Error400BadRequest("groupID is invalid", err)
 	}
 
+	return s.crud.Delete(ctx, &models.Enrollments{StudentID: studentID, GroupID: groupID})
+}
+
+// WithdrawEnrollment ends the enrollment on endDate, today when nil, which
+// stops it being billed after that day. Invoices already billing it later are
+// charged again for the days it covered under the same proration policy:
+// drafts are changed, issued and paid invoices are credited the difference.
+// A credit first lowers what is owed on the invoice, what was paid beyond it
+// becomes credit of the student, or is paid back with refundMethod when set.
+func (s *EnrollmentsService) WithdrawEnrollment(ctx context.Context, studentID, groupID string, endDate *string, refundMethod *string) (*dto.WithdrawEnrollmentResBody, error) {
+	if _, err := ulid.Parse(studentID); err != nil {
+		return nil, huma.Error400BadRequest("studentID is invalid", err)
+	}
+	if _, err := ulid.Parse(groupID); err != nil {
+		return nil, huma.Error400BadRequest("groupID is invalid", err)
+	}
+	end, err := parseDateOr(endDate, "body.end_date")
+	if err != nil {
+		return nil, err
+	}
+
+	res := &dto.WithdrawEnrollmentResBody{}
 	m := models.Enrollments{StudentID: studentID, GroupID: groupID}
-	if _, err := s.db.NewDelete().Model(&m).WherePK().Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("enrollment not found")
+	err = s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		*res = dto.WithdrawEnrollmentResBody{Invoices: []dto.WithdrawalInvoiceRes{}}
+		m = models.Enrollments{StudentID: studentID, GroupID: groupID}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		if m.EndDate != nil {
+			return huma.Error409Conflict("enrollment was already withdrawn on " + m.EndDate.Format(time.DateOnly))
+		}
+		if end.Before(m.StartDate) {
+			return huma.Error422UnprocessableEntity("end_date is invalid", &huma.ErrorDetail{
+				Message: "the enrollment starts on " + m.StartDate.Format(time.DateOnly), Location: "body.end_date", Value: end.Format(time.DateOnly),
+			})
+		}
+		m.EndDate = &end
+		if err := s.crud.repo.Update(ctx, &m, "end_date"); err != nil {
+			return dbError(s.log, err, "enrollment")
+		}
+
+		invoices, err := listAll(ctx, s.invoices, ListSpec{Where: map[string]any{
+			"student_id": studentID,
+			"status":     []string{models.InvoiceDraft, models.InvoiceIssued, models.InvoicePaid},
+		}})
+		if err != nil {
+			return dbError(s.log, err, "invoice")
+		}
+		slices.SortFunc(invoices, func(a, b models.Invoices) int { return a.PeriodStart.Compare(b.PeriodStart) })
+		for _, inv := range invoices {
+			if !inv.PeriodEnd.After(end) {
+				continue
+			}
+			off, freed, err := s.creditWithdrawal(ctx, &inv, groupID, end)
+			if err != nil {
+				return err
+			}
+			if off == 0 {
+				continue
+			}
+			res.Invoices = append(res.Invoices, dto.WithdrawalInvoiceRes{InvoiceID: inv.InvoiceID, Status: inv.Status, Amount: off})
+			if freed == 0 {
+				continue
+			}
+			if refundMethod == nil {
+				res.Credited += freed
+				continue
+			}
+			refund := &txn{memo: "refund of the withdrawal from invoice " + *inv.Number, studentID: studentID}
+			refund.add(models.AccountCredit, &inv.InvoiceID, freed, 0).
+				add(*refundMethod, &inv.InvoiceID, 0, freed)
+			if err := s.ledger.post(ctx, refund); err != nil {
+				return err
+			}
+			res.Refunded += freed
 		}
-		return huma.Error500InternalServerError(err.Error())
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	res.Enrollment = *s.ModelToRes(&m)
+	return res, nil
+}
+
+// creditWithdrawal charges the line of inv billing groupID again for the days
+// up to end and takes the difference off inv. It returns what was taken off
+// and, for issued and paid invoices, the part of it that was already paid and
+// is now credit of the student.
+func (s *EnrollmentsService) creditWithdrawal(ctx context.Context, inv *models.Invoices, groupID string, end time.Time) (money.Amount, money.Amount, error) {
+	lines, err := listAll(ctx, s.lines, ListSpec{Where: map[string]any{"invoice_id": inv.InvoiceID, "group_id": groupID}})
+	if err != nil {
+		return 0, 0, dbError(s.log, err, "invoice line")
+	}
+	if len(lines) == 0 || !lines[0].CoveredTo.After(end) {
+		return 0, 0, nil
+	}
+	line := lines[0]
+	if err := s.invoices.Lock(ctx, inv); err != nil {
+		return 0, 0, dbError(s.log, err, "invoice")
+	}
+	full := line.UnitPrice.Times(line.Quantity)
+	amount, proration, err := s.prorater.charge(ctx, groupID, full, inv.PeriodStart, inv.PeriodEnd, line.CoveredFrom, end)
+	if err != nil {
+		return 0, 0, err
+	}
+	off := line.Amount - amount
+	if off <= 0 {
+		return 0, 0, nil
+	}
+
+	if inv.Status == models.InvoiceDraft {
+		// drafts aren't owed yet, so they are billed again as if generated now
+		if end.Before(line.CoveredFrom) {
+			err = s.lines.Delete(ctx, &line)
+		} else {
+			line.Amount, line.CoveredTo, line.Proration = amount, end, proration
+			err = s.lines.Update(ctx, &line, "amount", "covered_to", "proration")
+		}
+		if err != nil {
+			return 0, 0, dbError(s.log, err, "invoice line")
+		}
+		inv.Total -= off
+		if err := s.invoices.Update(ctx, inv, "total"); err != nil {
+			return 0, 0, dbError(s.log, err, "invoice")
+		}
+		return off, 0, nil
+	}
+
+	owed := max(min(off, owedOn(inv)), 0)
+	freed := off - owed
+	inv.AmountCredited += off
+	inv.AmountPaid -= freed
+	settle(inv, 0)
+	credit := &txn{memo: "withdrawal credited to invoice " + *inv.Number, studentID: inv.StudentID}
+	credit.add(models.AccountRevenue, &inv.InvoiceID, off, 0).
+		add(models.AccountReceivable, &inv.InvoiceID, 0, owed).
+		add(models.AccountCredit, &inv.InvoiceID, 0, freed)
+	if err := s.ledger.post(ctx, credit); err != nil {
+		return 0, 0, err
+	}
+	if err := s.invoices.Update(ctx, inv, append([]string{"amount_credited"}, settledColumns...)...); err != nil {
+		return 0, 0, dbError(s.log, err, "invoice")
+	}
+	return off, freed, nil
+}
+
+// BulkCreateEnrollments enrolls every item's student in its group. As with
+// CreateEnrollment the fee defaults to the group's and a withdrawn enrollment
+// is revived.
+func (s *EnrollmentsService) BulkCreateEnrollments(ctx context.Context, mode string, items []dto.BulkCreateEnrollmentItem) (*dto.BulkRes[dto.EnrollmentModelRes], error) {
+	b := newBulk[dto.EnrollmentModelRes](mode, len(items))
+	studentIDs := []string{}
+	groupIDs := []string{}
+	starts := make([]time.Time, len(items))
+	seen := map[string]int{}
+	for i, it := range items {
+		if _, err := ulid.Parse(it.StudentID); err != nil {
+			b.fail(i, dto.BulkInvalid, "student_id is invalid")
+			continue
+		}
+		if _, err := ulid.Parse(it.GroupID); err != nil {
+			b.fail(i, dto.BulkInvalid, "group_id is invalid")
+			continue
+		}
+		start, err := parseDateOr(it.StartDate, "start_date")
+		if err != nil {
+			b.fail(i, dto.BulkInvalid, "start_date is invalid")
+			continue
+		}
+		starts[i] = start
+		key := it.StudentID + "/" + it.GroupID
+		if j, ok := seen[key]; ok {
+			b.fail(i, dto.BulkConflict, fmt.Sprintf("same enrollment as item %d", j))
+			continue
+		}
+		seen[key] = i
+		studentIDs = append(studentIDs, it.StudentID)
+		groupIDs = append(groupIDs, it.GroupID)
+	}
+
+	return b.run(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		students, err := existingIDs(ctx, tx, (*models.Students)(nil), "id", studentIDs)
+		if err != nil {
+			return dbError(s.log, err, "student")
+		}
+		groups := []models.Groups{}
+		if len(groupIDs) > 0 {
+			if err := tx.NewSelect().Model(&groups).Column("id", "default_fee").Where("grp.id IN (?)", bun.In(groupIDs)).Scan(ctx); err != nil {
+				return dbError(s.log, err, "group")
+			}
+		}
+		defaultFees := map[string]money.Amount{}
+		for _, g := range groups {
+			defaultFees[g.GroupID] = g.DefaultFee
+		}
+
+		rows := []models.Enrollments{}
+		idx := []int{}
+		for i, it := range items {
+			if !b.pending(i) {
+				continue
+			}
+			if !students[it.StudentID] {
+				b.fail(i, dto.BulkInvalid, "student_id refers to a missing student")
+				continue
+			}
+			fee, ok := defaultFees[it.GroupID]
+			if !ok {
+				b.fail(i, dto.BulkInvalid, "group_id refers to a missing group")
+				continue
+			}
+			if it.Fee != nil {
+				fee = *it.Fee
+			}
+			rows = append(rows, models.Enrollments{StudentID: it.StudentID, GroupID: it.GroupID, Fee: fee, StartDate: starts[i]})
+			idx = append(idx, i)
+		}
+		if err := s.price(ctx, rows); err != nil {
+			return err
+		}
+
+		created := map[string]*models.Enrollments{}
+		insert := func(ctx context.Context, tx bun.Tx, rows []models.Enrollments) error {
+			res := []models.Enrollments{}
+			if _, err := tx.NewInsert().Model(&rows).
+				On("CONFLICT (student_id, group_id) DO UPDATE").
+				Set("fee = EXCLUDED.fee").
+				Set("effective_fee = EXCLUDED.effective_fee").
+				Set("adjustments = EXCLUDED.adjustments").
+				Set("start_date = EXCLUDED.start_date").
+				Set("end_date = NULL").
+				Set("deleted_at = NULL").
+				Set("created_at = NOW()").
+				Set("updated_at = NOW()").
+				Where("enr.deleted_at IS NOT NULL").
+				Returning("*").
+				Exec(ctx, &res); err != nil {
+				return err
+			}
+			for i := range res {
+				created[res[i].StudentID+"/"+res[i].GroupID] = &res[i]
+			}
+			return nil
+		}
+		if err := b.save(ctx, tx, s.log, "enrollment", idx,
+			func(ctx context.Context, tx bun.Tx) error { return insert(ctx, tx, rows) },
+			func(ctx context.Context, tx bun.Tx, k int) error { return insert(ctx, tx, rows[k:k+1]) },
+		); err != nil {
+			return err
+		}
+
+		for k, i := range idx {
+			if !b.pending(i) {
+				continue
+			}
+			m, ok := created[rows[k].StudentID+"/"+rows[k].GroupID]
+			if !ok {
+				b.fail(i, dto.BulkConflict, "enrollment already exists")
+				continue
+			}
+			b.done(i, dto.BulkCreated, s.ModelToRes(m))
+		}
+		return nil
+	})
+}
+
+// BulkUpdateEnrollments applies a merge patch to every item's enrollment.
+func (s *EnrollmentsService) BulkUpdateEnrollments(ctx context.Context, mode string, items []dto.BulkUpdateEnrollmentItem) (*dto.BulkRes[dto.EnrollmentModelRes], error) {
+	b := newBulk[dto.EnrollmentModelRes](mode, len(items))
+	rows := []models.Enrollments{}
+	patches := []dto.Patch{}
+	idx := []int{}
+	seen := map[string]int{}
+	for i, it := range items {
+		if _, err := ulid.Parse(it.StudentID); err != nil {
+			b.fail(i, dto.BulkInvalid, "student_id is invalid")
+			continue
+		}
+		if _, err := ulid.Parse(it.GroupID); err != nil {
+			b.fail(i, dto.BulkInvalid, "group_id is invalid")
+			continue
+		}
+		key := it.StudentID + "/" + it.GroupID
+		if j, ok := seen[key]; ok {
+			b.fail(i, dto.BulkConflict, fmt.Sprintf("same enrollment as item %d", j))
+			continue
+		}
+		seen[key] = i
+		m := models.Enrollments{StudentID: it.StudentID, GroupID: it.GroupID}
+		patch := dto.Patch{}
+		dto.PatchValue(&patch, "fee", it.Fee, &m.Fee)
+		if patch.Empty() {
+			b.fail(i, dto.BulkInvalid, "nothing to update")
+			continue
+		}
+		patch.Columns = append(patch.Columns, "effective_fee", "adjustments")
+		rows = append(rows, m)
+		patches = append(patches, patch)
+		idx = append(idx, i)
+	}
+
+	return b.run(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := s.loadStartDates(ctx, rows); err != nil {
+			return err
+		}
+		if err := s.price(ctx, rows); err != nil {
+			return err
+		}
+		updated := map[string]*models.Enrollments{}
+		update := func(ctx context.Context, tx bun.Tx, rows []models.Enrollments, patches []dto.Patch) error {
+			res, err := bulkUpdate(ctx, tx, rows, patches)
+			if err != nil {
+				return err
+			}
+			for i := range res {
+				updated[res[i].StudentID+"/"+res[i].GroupID] = &res[i]
+			}
+			return nil
+		}
+		if err := b.save(ctx, tx, s.log, "enrollment", idx,
+			func(ctx context.Context, tx bun.Tx) error { return update(ctx, tx, rows, patches) },
+			func(ctx context.Context, tx bun.Tx, k int) error { return update(ctx, tx, rows[k:k+1], patches[k:k+1]) },
+		); err != nil {
+			return err
+		}
+
+		for k, i := range idx {
+			if !b.pending(i) {
+				continue
+			}
+			m, ok := updated[rows[k].StudentID+"/"+rows[k].GroupID]
+			if !ok {
+				b.fail(i, dto.BulkNotFound, "enrollment not found")
+				continue
+			}
+			b.done(i, dto.BulkUpdated, s.ModelToRes(m))
+		}
+		return nil
+	})
 }
 
 func (s *EnrollmentsService) ModelToRes(m *models.Enrollments) *dto.EnrollmentModelRes {
@@ -143,9 +616,16 @@ func (s *EnrollmentsService) ModelToRes(m *models.Enrollments) *dto.EnrollmentMo
 		return nil
 	}
 	res := &dto.EnrollmentModelRes{
-		StudentID: m.StudentID,
-		GroupID:   m.GroupID,
-		Fee:       m.Fee,
+		StudentID:    m.StudentID,
+		GroupID:      m.GroupID,
+		Fee:          m.Fee,
+		EffectiveFee: m.EffectiveFee,
+		Adjustments:  adjustmentsToRes(m.Adjustments),
+		StartDate:    m.StartDate.Format(time.DateOnly),
+		EndDate:      datePtr(m.EndDate),
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
 	}
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
@@ -156,90 +636,26 @@ func (s *EnrollmentsService) ModelToRes(m *models.Enrollments) *dto.EnrollmentMo
 	return res
 }
 
+// GetEnrollmentsByGroupID lists the enrollments of a group
 func (s *EnrollmentsService) GetEnrollmentsByGroupID(ctx context.Context, params *dto.GetEnrollmentsByGroupIDReq) (*dto.GetEnrollmentsByGroupIDRes, error) {
-	// Validate groupID
 	if _, err := ulid.Parse(params.GroupID); err != nil {
 		return nil, huma.Error400BadRequest("groupID is invalid", err)
 	}
-
-	total, err := s.db.NewSelect().Model((*models.Enrollments)(nil)).Where("group_id = ?", params.GroupID).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, map[string]any{"group_id": params.GroupID})
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-
-	var enrollments []models.Enrollments
-	res := &dto.GetEnrollmentsByGroupIDRes{
-		Body: dto.ListEnrollmentsResBody{
-			Total:       total,
-			ListQuery:   params.ListQuery,
-			Enrollments: nil,
-		},
-	}
-
-	q := s.db.NewSelect().Model(&enrollments).Where("group_id = ?", params.GroupID)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("student_id ILIKE ?", search)
-	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
-
-	if err := q.Scan(ctx, &enrollments); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-
-	resEnrollments := []dto.EnrollmentModelRes{}
-	for _, enr := range enrollments {
-		resEnrollments = append(resEnrollments, *s.ModelToRes(&enr))
+		return nil, err
 	}
-	res.Body.Enrollments = resEnrollments
-	return res, nil
+	return &dto.GetEnrollmentsByGroupIDRes{Body: enrollmentsListBody(l, params.ListQuery)}, nil
 }
 
+// GetEnrollmentsByStudentID lists the enrollments of a student
 func (s *EnrollmentsService) GetEnrollmentsByStudentID(ctx context.Context, params *dto.GetEnrollmentsByStudentIDReq) (*dto.GetEnrollmentsByStudentIDRes, error) {
-	// Validate studentID
 	if _, err := ulid.Parse(params.StudentID); err != nil {
 		return nil, huma.Error400BadRequest("studentID is invalid", err)
 	}
-
-	total, err := s.db.NewSelect().Model((*models.Enrollments)(nil)).Where("student_id = ?", params.StudentID).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, map[string]any{"student_id": params.StudentID})
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-
-	var enrollments []models.Enrollments
-	res := &dto.GetEnrollmentsByStudentIDRes{
-		Body: dto.ListEnrollmentsResBody{
-			Total:       total,
-			ListQuery:   params.ListQuery,
-			Enrollments: nil,
-		},
+		return nil, err
 	}
-
-	q := s.db.NewSelect().Model(&enrollments).Where("student_id = ?", params.StudentID)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("group_id ILIKE ?", search)
-	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
-
-	if err := q.Scan(ctx, &enrollments); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-
-	resEnrollments := []dto.EnrollmentModelRes{}
-	for _, enr := range enrollments {
-		resEnrollments = append(resEnrollments, *s.ModelToRes(&enr))
-	}
-	res.Body.Enrollments = resEnrollments
-	return res, nil
+	return &dto.GetEnrollmentsByStudentIDRes{Body: enrollmentsListBody(l, params.ListQuery)}, nil
 }
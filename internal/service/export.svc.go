@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// exportBatch is the number of rows read at a time by an export
+const exportBatch = 1000
+
+// exportList writes every row of repo matching spec to w, sorted as its
+// pages would be, keeping only one batch of rows in memory. The rows are
+// read in a single read-only snapshot so batches don't skip or repeat rows
+// written meanwhile. Nothing is written before the first batch is read, so
+// bad parameters still fail the request cleanly.
+func exportList[M any](ctx context.Context, store Store, repo Repository[M], spec ListSpec, columns string, all []spreadsheet.Column[M], format string, w io.Writer) error {
+	picked, err := spreadsheet.SelectColumns(all, columns)
+	if err != nil {
+		return huma.Error422UnprocessableEntity("columns are invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "query.columns", Value: columns,
+		})
+	}
+	header := make([]any, len(picked))
+	for i, c := range picked {
+		header[i] = c.Name
+	}
+
+	spec.Params.Page, spec.Params.PerPage, spec.Params.Cursor = 1, exportBatch, ""
+	spec.Stable = true
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	return store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		var out spreadsheet.Writer
+		for {
+			page, err := repo.List(ctx, spec)
+			if err != nil {
+				return err
+			}
+
+			if out == nil {
+				if out, err = spreadsheet.NewWriter(w, format); err != nil {
+					return err
+				}
+				if err := out.WriteRow(header); err != nil {
+					return err
+				}
+			}
+			for i := range page.Rows {
+				cells := make([]any, len(picked))
+				for k, c := range picked {
+					cells[k] = c.Value(&page.Rows[i])
+				}
+				if err := out.WriteRow(cells); err != nil {
+					return err
+				}
+			}
+
+			if !page.More {
+				break
+			}
+			if page.Cursors.NextCursor != nil {
+				spec.Params.Cursor = *page.Cursors.NextCursor
+			} else {
+				spec.Params.Page++
+			}
+		}
+		return out.Close()
+	})
+}
+
+// Cells of optional values, nil leaving the cell empty
+
+func cellString(v *string) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func cellTime(v *time.Time) any {
+	if v == nil || v.IsZero() {
+		return nil
+	}
+	return *v
+}
+
+// userColumns are the columns of the user of M, named after prefix
+func userColumns[M any](prefix string, user func(*M) *models.Users) []spreadsheet.Column[M] {
+	field := func(value func(u *models.Users) any) func(*M) any {
+		return func(m *M) any {
+			if u := user(m); u != nil {
+				return value(u)
+			}
+			return nil
+		}
+	}
+	return []spreadsheet.Column[M]{
+		{Name: prefix + "username", Value: field(func(u *models.Users) any { return u.Username })},
+		{Name: prefix + "email", Value: field(func(u *models.Users) any { return u.Email })},
+		{Name: prefix + "first_name", Value: field(func(u *models.Users) any { return cellString(u.FirstName) })},
+		{Name: prefix + "family_name", Value: field(func(u *models.Users) any { return cellString(u.FamilyName) })},
+		{Name: prefix + "phone_number", Value: field(func(u *models.Users) any { return cellString(u.PhoneNumber) })},
+		{Name: prefix + "date_of_birth", Value: field(func(u *models.Users) any { return cellTime(u.DateOfBirth) })},
+	}
+}
@@ -2,76 +2,94 @@ package service
 
 import (
 	"context"
-	"strings"
+	"io"
+	"slices"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/conditional"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 )
 
 type GroupsService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.Groups, dto.GroupModelRes]
 }
 
-func NewGroupsService(db *bun.DB) (*GroupsService, error) {
+func NewGroupsService(store Store) (*GroupsService, error) {
 	log := logging.L().With().Str("service", "groups.svc").Logger()
-	return &GroupsService{log: log, db: db}, nil
+	s := &GroupsService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.Groups, dto.GroupModelRes]{
+		ExportRelations: []string{"Teacher.User"},
+		Search:          []string{"?TableAlias.name", "?TableAlias.subject", "?TableAlias.level", "?TableAlias.description"},
+		Filters: map[string]string{
+			"name":        "?TableAlias.name",
+			"subject":     "?TableAlias.subject",
+			"level":       "?TableAlias.level",
+			"teacher_id":  "?TableAlias.teacher_id",
+			"default_fee": "?TableAlias.default_fee",
+		},
+		Columns: groupColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *GroupsService) GetGroups(ctx context.Context, params *dto.ListGroupsReq) (*dto.ListGroupsRes, error) {
-	total, err := s.db.NewSelect().Model((*models.Groups)(nil)).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-	var groups []models.Groups
-	res := &dto.ListGroupsRes{
-		Body: dto.ListGroupsResBody{
-			Total:     0,
-			ListQuery: params.ListQuery,
-			Groups:    nil,
-		},
+		return nil, err
 	}
-	res.Body.Total = total
-
-	q := s.db.NewSelect().Model(&groups)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("(name ILIKE ? OR subject ILIKE ? OR level ILIKE ?)", search, search, search)
-	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListGroupsRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Groups = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &groups); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
+var groupColumns = slices.Concat(
+	[]spreadsheet.Column[models.Groups]{
+		{Name: "id", Value: func(m *models.Groups) any { return m.GroupID }},
+		{Name: "name", Value: func(m *models.Groups) any { return m.Name }},
+		{Name: "subject", Value: func(m *models.Groups) any { return m.Subject }},
+		{Name: "level", Value: func(m *models.Groups) any { return m.Level }},
+		{Name: "description", Value: func(m *models.Groups) any { return m.Description }},
+		{Name: "default_fee", Value: func(m *models.Groups) any { return m.DefaultFee }},
+		{Name: "teacher_id", Value: func(m *models.Groups) any { return m.TeacherID }},
+	},
+	userColumns("teacher_", func(m *models.Groups) *models.Users {
+		if m.Teacher == nil {
+			return nil
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+		return m.Teacher.User
+	}),
+	[]spreadsheet.Column[models.Groups]{
+		{Name: "created_at", Value: func(m *models.Groups) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Groups) any { return m.UpdatedAt }},
+	},
+)
 
-	resGroups := []dto.GroupModelRes{}
-	for _, grp := range groups {
-		resGroups = append(resGroups, *s.ModelToRes(&grp))
-	}
-	res.Body.Groups = resGroups
-	return res, nil
+// ExportGroups writes every group matching params to w
+func (s *GroupsService) ExportGroups(ctx context.Context, params *dto.ListGroupsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *GroupsService) GetGroupByID(ctx context.Context, id string) (*dto.GroupModelRes, error) {
 	m := models.Groups{GroupID: id}
-	if err := s.db.NewSelect().Model(&m).WherePK("id").Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get group")
-		return nil, huma.Error404NotFound("group not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m), nil
 }
 
-func (s *GroupsService) CreateGroup(ctx context.Context, name string, description string, teacherID string, defaultFee float64, subject string, level string, metadata map[string]interface{}) (*models.Groups, error) {
+func (s *GroupsService) CreateGroup(ctx context.Context, name string, description string, teacherID string, defaultFee money.Amount, subject string, level string, metadata map[string]interface{}) (*models.Groups, error) {
 	if _, err := ulid.Parse(teacherID); err != nil {
 		return nil, huma.Error400BadRequest("teacherID is invalid", err)
 	}
@@ -86,36 +104,65 @@ func (s *GroupsService) CreateGroup(ctx context.Context, name string, descriptio
 		Level:       level,
 		Metadata:    metadata,
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert group")
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *GroupsService) UpdateGroup(ctx context.Context, group models.Groups) (*models.Groups, error) {
+func (s *GroupsService) UpdateGroup(ctx context.Context, group models.Groups, patch dto.Patch, cond *conditional.Params) (*models.Groups, error) {
 	m := group
-	m.GroupID = group.GroupID
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("group not found")
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.checkPrecondition(ctx, group.GroupID, cond); err != nil {
+			return err
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		if patch.Has("metadata") && m.Metadata != nil {
+			// metadata holds a merge patch of the stored document
+			cur := models.Groups{GroupID: m.GroupID}
+			if err := s.crud.Lock(ctx, &cur); err != nil {
+				return err
+			}
+			var stored any
+			if cur.Metadata != nil {
+				stored = cur.Metadata
+			}
+			m.Metadata, _ = dto.MergePatch(stored, m.Metadata).(map[string]any)
+		}
+		return s.crud.Update(ctx, &m, patch)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *GroupsService) DeleteGroup(ctx context.Context, id string) error {
+func (s *GroupsService) DeleteGroup(ctx context.Context, id string, cond *conditional.Params) error {
+	return s.crud.DeleteIf(ctx, &models.Groups{GroupID: id}, func(ctx context.Context) error {
+		return s.checkPrecondition(ctx, id, cond)
+	})
+}
+
+// checkPrecondition locks the group and fails with 412 when the If-Match or
+// If-None-Match headers don't match its current ETag.
+func (s *GroupsService) checkPrecondition(ctx context.Context, id string, cond *conditional.Params) error {
+	if cond == nil || !cond.HasConditionalParams() {
+		return nil
+	}
 	m := models.Groups{GroupID: id}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("group not found")
-		}
-		return huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Lock(ctx, &m); err != nil {
+		return err
+	}
+	if err := cond.PreconditionFailed(dto.ETag(m.Version), m.UpdatedAt); err != nil {
+		return err
 	}
 	return nil
 }
 
+// PreviewDeleteGroup reports the records deleting the group would affect
+func (s *GroupsService) PreviewDeleteGroup(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
+}
+
 func (s *GroupsService) ModelToRes(m *models.Groups) *dto.GroupModelRes {
 	if m == nil {
 		return nil
@@ -130,6 +177,10 @@ func (s *GroupsService) ModelToRes(m *models.Groups) *dto.GroupModelRes {
 		Level:       m.Level,
 		Metadata:    m.Metadata,
 	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	res.ETag = dto.ETag(m.Version)
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
 	}
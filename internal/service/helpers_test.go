@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/oklog/ulid/v2"
+)
+
+// seed inserts m into the store
+func seed[M any](t *testing.T, store Store, m *M) {
+	t.Helper()
+	if err := NewRepository[M](store).Insert(t.Context(), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// seedUser inserts a user
+func seedUser(t *testing.T, store Store, username string) string {
+	t.Helper()
+	u := models.Users{UserID: ulid.Make().String(), Username: username, Email: username + "@example.com"}
+	seed(t, store, &u)
+	return u.UserID
+}
+
+// seedStudent inserts a user and their student
+func seedStudent(t *testing.T, store Store, username string) string {
+	t.Helper()
+	userID := seedUser(t, store, username)
+	level := "A1"
+	seed(t, store, &models.Students{StudentID: userID, UserID: &userID, Level: &level})
+	return userID
+}
+
+// seedTeacher inserts a user and their teacher
+func seedTeacher(t *testing.T, store Store, username string) string {
+	t.Helper()
+	userID := seedUser(t, store, username)
+	m := models.Teachers{TeacherID: ulid.Make().String(), UserID: &userID}
+	seed(t, store, &m)
+	return m.TeacherID
+}
+
+// seedGroup inserts a group of the teacher
+func seedGroup(t *testing.T, store Store, teacherID string, fee money.Amount) string {
+	t.Helper()
+	m := models.Groups{GroupID: ulid.Make().String(), Name: "Group", TeacherID: teacherID, DefaultFee: fee, Subject: "English", Level: "B1"}
+	seed(t, store, &m)
+	return m.GroupID
+}
+
+// seedParent inserts a user, their parent and links them to the students
+func seedParent(t *testing.T, store Store, username string, studentIDs ...string) string {
+	t.Helper()
+	m := models.Parents{ParentID: ulid.Make().String(), UserID: seedUser(t, store, username)}
+	seed(t, store, &m)
+	for _, id := range studentIDs {
+		seed(t, store, &models.StudentParents{StudentID: id, ParentID: m.ParentID})
+	}
+	return m.ParentID
+}
+
+// seedInvoice inserts an invoice of the student issued at issuedAt for
+// total, numbered n
+func seedInvoice(t *testing.T, store Store, studentID string, n int, issuedAt time.Time, total money.Amount) models.Invoices {
+	t.Helper()
+	number := fmt.Sprintf("TEST-%d-%06d", issuedAt.Year(), n)
+	due := issuedAt.AddDate(0, 0, 15)
+	inv := models.Invoices{
+		InvoiceID:   ulid.Make().String(),
+		Center:      "test",
+		Currency:    money.CenterCurrency().Code,
+		Number:      &number,
+		StudentID:   studentID,
+		Period:      models.PeriodMonthly,
+		PeriodStart: issuedAt,
+		PeriodEnd:   issuedAt.AddDate(0, 1, -1),
+		Status:      models.InvoiceIssued,
+		Total:       total,
+		IssuedAt:    &issuedAt,
+		DueDate:     &due,
+	}
+	if err := NewRepository[models.Invoices](store).Insert(t.Context(), &inv); err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+// day is midnight UTC of the date
+func day(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// checkBalanced fails the test unless the debits of every transaction of
+// the ledger equal its credits
+func checkBalanced(t *testing.T, store Store) []models.LedgerEntries {
+	t.Helper()
+	entries, err := listAll(t.Context(), NewRepository[models.LedgerEntries](store), ListSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txns := map[string]money.Amount{}
+	for _, e := range entries {
+		txns[e.TxnID] += e.Debit - e.Credit
+	}
+	for id, diff := range txns {
+		if diff != 0 {
+			t.Errorf("transaction %s is off by %s", id, diff)
+		}
+	}
+	return entries
+}
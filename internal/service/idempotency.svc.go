@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+)
+
+// idempotencyLease is how long a claimed key waits for its response. A claim
+// older than that is taken to have died with its server, such as one
+// restarting mid-request, and is claimed again by the next retry.
+const idempotencyLease = 5 * time.Minute
+
+// IdempotencyService stores the first response sent for an Idempotency-Key
+// so retries of the same request can be answered without running it again.
+type IdempotencyService struct {
+	db  *bun.DB
+	log zerolog.Logger
+	ttl time.Duration
+}
+
+func NewIdempotencyService(store Store, ttl time.Duration) (*IdempotencyService, error) {
+	if store.DB() == nil {
+		return nil, errNeedsDatabase
+	}
+	log := logging.L().With().Str("service", "idempotency.svc").Logger()
+	return &IdempotencyService{log: log, db: store.DB(), ttl: ttl}, nil
+}
+
+// Claim reserves the key of rec for a new request. It returns nil when the key
+// is fresh, or the stored record when the key was already used, in which case
+// the record has no response yet while the first request is still running.
+// Expired keys are claimed again, and so are keys still without a response
+// after idempotencyLease.
+func (s *IdempotencyService) Claim(ctx context.Context, rec *models.IdempotencyKeys) (*models.IdempotencyKeys, error) {
+	rec.CreatedAt = time.Now()
+	rec.ExpiresAt = rec.CreatedAt.Add(s.ttl)
+	res, err := s.db.NewInsert().Model(rec).
+		On("CONFLICT (user_id, key) DO UPDATE").
+		Set("request_hash = EXCLUDED.request_hash").
+		Set("method = EXCLUDED.method").
+		Set("path = EXCLUDED.path").
+		Set("status_code = NULL, response_headers = NULL, response_body = NULL, completed_at = NULL").
+		Set("created_at = EXCLUDED.created_at").
+		Set("expires_at = EXCLUDED.expires_at").
+		Where("idk.expires_at < NOW() OR (idk.completed_at IS NULL AND idk.created_at < ?)", rec.CreatedAt.Add(-idempotencyLease)).
+		Exec(ctx)
+	if err != nil {
+		s.log.Err(err).Str("key", rec.Key).Msg("Couldn't claim idempotency key")
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	existing := models.IdempotencyKeys{UserID: rec.UserID, Key: rec.Key}
+	if err := s.db.NewSelect().Model(&existing).WherePK().Scan(ctx); err != nil {
+		s.log.Err(err).Str("key", rec.Key).Msg("Couldn't load idempotency key")
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// Complete stores the response of a claimed key.
+func (s *IdempotencyService) Complete(ctx context.Context, rec *models.IdempotencyKeys) error {
+	now := time.Now()
+	rec.CompletedAt = &now
+	if _, err := s.db.NewUpdate().Model(rec).
+		Column("status_code", "response_headers", "response_body", "completed_at").
+		WherePK().
+		Exec(ctx); err != nil {
+		s.log.Err(err).Str("key", rec.Key).Msg("Couldn't store idempotent response")
+		return err
+	}
+	return nil
+}
+
+// Release forgets a claimed key so the request can be retried, used when it
+// failed with a server error.
+func (s *IdempotencyService) Release(ctx context.Context, rec *models.IdempotencyKeys) error {
+	if _, err := s.db.NewDelete().Model(rec).WherePK().Where("completed_at IS NULL").Exec(ctx); err != nil {
+		s.log.Err(err).Str("key", rec.Key).Msg("Couldn't release idempotency key")
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired removes the keys past their expiry and returns how many.
+func (s *IdempotencyService) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.NewDelete().Model((*models.IdempotencyKeys)(nil)).Where("expires_at < NOW()").Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunCleanup deletes expired keys every interval until ctx is done.
+func (s *IdempotencyService) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.DeleteExpired(ctx)
+			if err != nil {
+				s.log.Err(err).Msg("Couldn't delete expired idempotency keys")
+				continue
+			}
+			if n > 0 {
+				s.log.Info().Int64("deleted", n).Msg("Deleted expired idempotency keys")
+			}
+		}
+	}
+}
@@ -0,0 +1,658 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// MaxImportBytes bounds the size of an import file
+	MaxImportBytes = 10 << 20
+	maxImportRows  = 10000
+	// importSyncRows is the size up to which a file is validated and
+	// committed within the request, larger ones are left to run in the
+	// background and checked on later
+	importSyncRows = 500
+	importChunk    = 1000
+	// importedPasswordHash matches no password, imported users can't log in
+	// until a password is set for them
+	importedPasswordHash = "!"
+)
+
+// importFields are the fields a column of an import file can be mapped to
+var importFields = []string{
+	"student.username", "student.email", "student.first_name", "student.family_name",
+	"student.phone_number", "student.date_of_birth", "student.level",
+	"parent.username", "parent.email", "parent.first_name", "parent.family_name", "parent.phone_number",
+}
+
+var requiredImportFields = []string{"student.email", "student.level"}
+
+// importDateLayouts are the date formats accepted for date_of_birth
+var importDateLayouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", time.RFC3339}
+
+var headerSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// errImportChanged aborts a commit that found new errors since the dry run
+var errImportChanged = errors.New("data changed since the dry run")
+
+// ImportsService imports students and their parents from spreadsheets in two
+// steps: a dry run reporting the problems of every row, then the commit.
+type ImportsService struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+func NewImportsService(store Store) (*ImportsService, error) {
+	if store.DB() == nil {
+		return nil, errNeedsDatabase
+	}
+	log := logging.L().With().Str("service", "imports.svc").Logger()
+	return &ImportsService{log: log, db: store.DB()}, nil
+}
+
+// CreateImport reads the file, maps its columns and runs the dry run. Files
+// of more than importSyncRows rows are validated in the background and the
+// job is returned while still validating.
+func (s *ImportsService) CreateImport(ctx context.Context, callerID string, filename string, data []byte, mapping map[string]string) (*models.ImportJobs, error) {
+	format := spreadsheet.DetectFormat(data)
+	table, err := spreadsheet.Read(data, format, maxImportRows)
+	if errors.Is(err, spreadsheet.ErrTooManyRows) {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("file has more than %d rows, split it", maxImportRows))
+	}
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("file can't be read as "+format, err)
+	}
+	if len(table) < 2 {
+		return nil, huma.Error422UnprocessableEntity("file has no data rows")
+	}
+	columns, used, err := mapImportColumns(table[0].Cells, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ImportJobs{
+		ImportID:  ulid.Make().String(),
+		UserID:    callerID,
+		Filename:  filename,
+		Format:    format,
+		Status:    models.ImportValidating,
+		Mapping:   used,
+		Rows:      parseImportRows(table[1:], columns),
+		TotalRows: len(table) - 1,
+	}
+	if _, err := conn(ctx, s.db).NewInsert().Model(job).Returning("*").Exec(ctx); err != nil {
+		return nil, dbError(s.log, err, "import")
+	}
+
+	if job.TotalRows > importSyncRows {
+		go s.dryRun(context.Background(), cloneImport(job))
+		return job, nil
+	}
+	s.dryRun(ctx, job)
+	return job, nil
+}
+
+// dryRun validates the rows of job and records the report. Failures are
+// recorded on the job rather than returned.
+func (s *ImportsService) dryRun(ctx context.Context, job *models.ImportJobs) {
+	validateImportRows(job.Rows)
+	if err := checkExistingUsers(ctx, conn(ctx, s.db), job.Rows); err != nil {
+		s.failImport(ctx, job, err)
+		return
+	}
+	job.ValidRows, job.InvalidRows = countImportRows(job.Rows)
+	job.Status = models.ImportValidated
+	if err := s.saveImport(ctx, conn(ctx, s.db), job, "status", "rows", "valid_rows", "invalid_rows"); err != nil {
+		s.failImport(ctx, job, err)
+	}
+}
+
+// CommitImport imports the rows of a validated job. Rows with errors are left
+// out when skipInvalid is set, otherwise they keep the whole file out. Jobs
+// of more than importSyncRows rows are committed in the background.
+func (s *ImportsService) CommitImport(ctx context.Context, callerID string, id string, skipInvalid bool) (*models.ImportJobs, error) {
+	job, err := s.GetImport(ctx, callerID, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ImportValidated {
+		return nil, huma.Error409Conflict(fmt.Sprintf("import is %s, only validated imports can be committed", job.Status))
+	}
+	if job.InvalidRows > 0 && !skipInvalid {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("%d rows have errors, fix the file or commit with skip_invalid", job.InvalidRows))
+	}
+	if job.ValidRows == 0 {
+		return nil, huma.Error422UnprocessableEntity("import has no valid rows")
+	}
+
+	res, err := conn(ctx, s.db).NewUpdate().Model(job).
+		Set("status = ?", models.ImportCommitting).
+		Set("updated_at = NOW()").
+		WherePK().
+		Where("status = ?", models.ImportValidated).
+		Exec(ctx)
+	if err != nil {
+		return nil, dbError(s.log, err, "import")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, huma.Error409Conflict("import is already being committed")
+	}
+	job.Status = models.ImportCommitting
+
+	if job.TotalRows > importSyncRows {
+		go s.commit(context.Background(), cloneImport(job), skipInvalid)
+		return job, nil
+	}
+	s.commit(ctx, job, skipInvalid)
+	return job, nil
+}
+
+// commit validates the rows again, since the data may have changed since
+// the dry run, and inserts every valid one in a single transaction.
+func (s *ImportsService) commit(ctx context.Context, job *models.ImportJobs, skipInvalid bool) {
+	err := runInTx(ctx, s.db, nil, func(ctx context.Context, tx bun.Tx) error {
+		validateImportRows(job.Rows)
+		if err := checkExistingUsers(ctx, tx, job.Rows); err != nil {
+			return err
+		}
+		job.ValidRows, job.InvalidRows = countImportRows(job.Rows)
+		if job.InvalidRows > 0 && !skipInvalid {
+			return errImportChanged
+		}
+
+		users := []models.Users{}
+		students := []models.Students{}
+		parents := []models.Parents{}
+		links := []models.StudentParents{}
+		parentIDs := map[string]string{}
+		for _, r := range job.Rows {
+			if len(r.Errors) > 0 {
+				continue
+			}
+			studentID := ulid.Make().String()
+			level := r.Student.Level
+			users = append(users, importUser(studentID, &r.Student))
+			students = append(students, models.Students{StudentID: studentID, UserID: &studentID, Level: &level})
+			if r.Parent == nil {
+				continue
+			}
+			parentID, ok := parentIDs[r.Parent.Email]
+			if !ok {
+				parentID = r.ParentID
+				if parentID == "" {
+					parentID = r.ParentUserID
+					if parentID == "" {
+						parentID = ulid.Make().String()
+						users = append(users, importUser(parentID, r.Parent))
+					}
+					parents = append(parents, models.Parents{ParentID: parentID, UserID: parentID})
+				}
+				parentIDs[r.Parent.Email] = parentID
+			}
+			links = append(links, models.StudentParents{StudentID: studentID, ParentID: parentID})
+		}
+
+		var err error
+		if _, err = insertChunks(ctx, tx, users); err != nil {
+			return err
+		}
+		if job.CreatedStudents, err = insertChunks(ctx, tx, students); err != nil {
+			return err
+		}
+		if job.CreatedParents, err = insertChunks(ctx, tx, parents); err != nil {
+			return err
+		}
+		if job.CreatedLinks, err = insertChunks(ctx, tx, links); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		job.Status = models.ImportCommitted
+		job.CommittedAt = &now
+		job.Error = nil
+		return s.saveImport(ctx, tx, job, "status", "rows", "valid_rows", "invalid_rows",
+			"created_students", "created_parents", "created_links", "error", "committed_at")
+	})
+	if errors.Is(err, errImportChanged) {
+		// back to a dry run result the caller can look at and commit again
+		msg := fmt.Sprintf("%d rows have errors since the dry run, check them and commit again", job.InvalidRows)
+		job.Status = models.ImportValidated
+		job.Error = &msg
+		if err := s.saveImport(ctx, conn(ctx, s.db), job, "status", "rows", "valid_rows", "invalid_rows", "error"); err != nil {
+			s.failImport(ctx, job, err)
+		}
+		return
+	}
+	if err != nil {
+		s.failImport(ctx, job, err)
+	}
+}
+
+func (s *ImportsService) GetImport(ctx context.Context, callerID string, id string) (*models.ImportJobs, error) {
+	m := models.ImportJobs{ImportID: id}
+	if err := conn(ctx, s.db).NewSelect().Model(&m).WherePK().Where("user_id = ?", callerID).Scan(ctx); err != nil {
+		return nil, dbError(s.log, err, "import")
+	}
+	return &m, nil
+}
+
+// GetImports lists the imports started by the caller, without their rows.
+func (s *ImportsService) GetImports(ctx context.Context, callerID string, params *dto.ListImportsReq) (*dto.ListImportsRes, error) {
+	var jobs []models.ImportJobs
+	res := &dto.ListImportsRes{Body: dto.ListImportsResBody{ListQuery: params.ListQuery}}
+	q := conn(ctx, s.db).NewSelect().Model(&jobs).ExcludeColumn("rows").Where("user_id = ?", callerID)
+
+	res.Body.Total = -1
+	if params.WithTotal {
+		total, err := q.Clone().Count(ctx)
+		if err != nil {
+			return nil, dbError(s.log, err, "import")
+		}
+		res.Body.Total = total
+	}
+
+	page, err := dto.NewPage[models.ImportJobs](s.db, params.ListQuery)
+	if err != nil {
+		return nil, err
+	}
+	q = page.Apply(q)
+	if err := q.Scan(ctx, &jobs); err != nil {
+		return nil, dbError(s.log, err, "import")
+	}
+	jobs, res.Body.PageCursors = page.Trim(jobs)
+
+	res.Body.Imports = []dto.ImportJobRes{}
+	for i := range jobs {
+		res.Body.Imports = append(res.Body.Imports, *s.ModelToRes(&jobs[i], "none"))
+	}
+	return res, nil
+}
+
+// FailInterrupted marks the jobs left validating or committing by a previous
+// run of the server as failed. Their transaction died with it.
+func (s *ImportsService) FailInterrupted(ctx context.Context) error {
+	_, err := s.db.NewUpdate().Model((*models.ImportJobs)(nil)).
+		Set("status = ?", models.ImportFailed).
+		Set("error = ?", "interrupted by a server restart, upload the file again").
+		Set("updated_at = NOW()").
+		Where("status IN (?)", bun.In([]string{models.ImportValidating, models.ImportCommitting})).
+		Exec(ctx)
+	return err
+}
+
+func (s *ImportsService) saveImport(ctx context.Context, db bun.IDB, job *models.ImportJobs, columns ...string) error {
+	_, err := db.NewUpdate().Model(job).Column(columns...).Set("updated_at = NOW()").WherePK().Exec(ctx)
+	return err
+}
+
+// failImport records why job failed. Database errors aren't shown as is.
+func (s *ImportsService) failImport(ctx context.Context, job *models.ImportJobs, err error) {
+	s.log.Err(err).Str("import_id", job.ImportID).Msg("Import failed")
+	msg := "internal server error"
+	var statusErr huma.StatusError
+	if errors.As(dbError(s.log, err, "import"), &statusErr) && statusErr.GetStatus() < 500 {
+		msg = bulkReason(statusErr)
+	}
+	job.Status = models.ImportFailed
+	job.Error = &msg
+	if err := s.saveImport(context.WithoutCancel(ctx), s.db, job, "status", "error"); err != nil {
+		s.log.Err(err).Str("import_id", job.ImportID).Msg("Couldn't record failed import")
+	}
+}
+
+// rows is one of "issues", "all" or "none"
+func (s *ImportsService) ModelToRes(m *models.ImportJobs, rows string) *dto.ImportJobRes {
+	res := &dto.ImportJobRes{
+		ID:              m.ImportID,
+		Status:          m.Status,
+		Filename:        m.Filename,
+		Format:          m.Format,
+		Mapping:         m.Mapping,
+		TotalRows:       m.TotalRows,
+		ValidRows:       m.ValidRows,
+		InvalidRows:     m.InvalidRows,
+		CreatedStudents: m.CreatedStudents,
+		CreatedParents:  m.CreatedParents,
+		CreatedLinks:    m.CreatedLinks,
+		Error:           m.Error,
+		CreatedAt:       int(m.CreatedAt.Unix()),
+		UpdatedAt:       int(m.UpdatedAt.Unix()),
+	}
+	if m.CommittedAt != nil {
+		committedAt := int(m.CommittedAt.Unix())
+		res.CommittedAt = &committedAt
+	}
+	if rows == "none" {
+		return res
+	}
+	res.Rows = []dto.ImportRowRes{}
+	for _, r := range m.Rows {
+		if rows == "issues" && len(r.Errors) == 0 && len(r.Warnings) == 0 {
+			continue
+		}
+		row := dto.ImportRowRes{Line: r.Line, Student: dto.ImportPersonRes(r.Student), Errors: r.Errors, Warnings: r.Warnings}
+		if r.Parent != nil {
+			parent := dto.ImportPersonRes(*r.Parent)
+			row.Parent = &parent
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res
+}
+
+// mapImportColumns finds the column of every import field, from mapping or
+// else from a header named after the field, ignoring case and punctuation.
+// It also returns the header used for every field found.
+func mapImportColumns(headers []string, mapping map[string]string) (map[string]int, map[string]string, error) {
+	index := map[string]int{}
+	for i, h := range headers {
+		if _, ok := index[normalizeHeader(h)]; !ok {
+			index[normalizeHeader(h)] = i
+		}
+	}
+
+	details := []error{}
+	for field := range mapping {
+		if !slices.Contains(importFields, field) {
+			details = append(details, &huma.ErrorDetail{Message: "unknown import field, expected one of " + strings.Join(importFields, ", "), Location: "body.mapping." + field})
+		}
+	}
+	columns := map[string]int{}
+	used := map[string]string{}
+	for _, field := range importFields {
+		header, mapped := mapping[field]
+		if !mapped {
+			header = field
+		}
+		i, ok := index[normalizeHeader(header)]
+		if !ok {
+			if mapped {
+				details = append(details, &huma.ErrorDetail{Message: "no column has this header", Location: "body.mapping." + field, Value: header})
+			} else if slices.Contains(requiredImportFields, field) {
+				details = append(details, &huma.ErrorDetail{Message: "no column for this required field, map one", Location: "body.mapping." + field})
+			}
+			continue
+		}
+		columns[field] = i
+		used[field] = headers[i]
+	}
+	if len(details) > 0 {
+		slices.SortFunc(details, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+		return nil, nil, huma.Error422UnprocessableEntity("file columns can't be mapped", details...)
+	}
+	return columns, used, nil
+}
+
+func normalizeHeader(h string) string {
+	return strings.Trim(headerSeparators.ReplaceAllString(strings.ToLower(h), "_"), "_")
+}
+
+func parseImportRows(table []spreadsheet.Row, columns map[string]int) []models.ImportRow {
+	rows := []models.ImportRow{}
+	for _, line := range table {
+		cell := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(line.Cells) {
+				return ""
+			}
+			return line.Cells[i]
+		}
+		r := models.ImportRow{
+			Line: line.Line,
+			Student: models.ImportPerson{
+				Username:    cell("student.username"),
+				Email:       strings.ToLower(cell("student.email")),
+				FirstName:   cell("student.first_name"),
+				FamilyName:  cell("student.family_name"),
+				PhoneNumber: cell("student.phone_number"),
+				DateOfBirth: cell("student.date_of_birth"),
+				Level:       cell("student.level"),
+			},
+		}
+		parent := models.ImportPerson{
+			Username:    cell("parent.username"),
+			Email:       strings.ToLower(cell("parent.email")),
+			FirstName:   cell("parent.first_name"),
+			FamilyName:  cell("parent.family_name"),
+			PhoneNumber: cell("parent.phone_number"),
+		}
+		if parent != (models.ImportPerson{}) {
+			r.Parent = &parent
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// validateImportRows checks every row on its own and against the other rows
+// of the file. Usernames default to the email.
+func validateImportRows(rows []models.ImportRow) {
+	emails := map[string]int{}
+	usernames := map[string]int{}
+	parents := map[string]*models.ImportRow{}
+	for i := range rows {
+		r := &rows[i]
+		r.Errors, r.Warnings, r.ParentUserID, r.ParentID = nil, nil, "", ""
+
+		st := &r.Student
+		r.Errors = append(r.Errors, checkImportPerson("student", st)...)
+		if st.Level == "" {
+			r.Errors = append(r.Errors, "student.level is required")
+		}
+		if st.DateOfBirth != "" {
+			if d, ok := parseImportDate(st.DateOfBirth); ok {
+				st.DateOfBirth = d
+			} else {
+				r.Errors = append(r.Errors, "student.date_of_birth must be a date such as 2012-09-24")
+			}
+		}
+		if line, ok := emails[st.Email]; ok && st.Email != "" {
+			r.Errors = append(r.Errors, fmt.Sprintf("student.email is also used on line %d", line))
+		} else {
+			emails[st.Email] = r.Line
+		}
+		if line, ok := usernames[strings.ToLower(st.Username)]; ok && st.Username != "" {
+			r.Errors = append(r.Errors, fmt.Sprintf("student.username is also used on line %d", line))
+		} else {
+			usernames[strings.ToLower(st.Username)] = r.Line
+		}
+
+		if r.Parent == nil {
+			continue
+		}
+		p := r.Parent
+		r.Errors = append(r.Errors, checkImportPerson("parent", p)...)
+		if first, ok := parents[p.Email]; ok && p.Email != "" {
+			// siblings share their parent, the first row describing them wins
+			if *first.Parent != *p {
+				r.Warnings = append(r.Warnings, fmt.Sprintf("parent details differ from line %d, those are used", first.Line))
+			}
+			continue
+		}
+		parents[p.Email] = r
+		if line, ok := usernames[strings.ToLower(p.Username)]; ok && p.Username != "" {
+			r.Errors = append(r.Errors, fmt.Sprintf("parent.username is also used on line %d", line))
+		} else {
+			usernames[strings.ToLower(p.Username)] = r.Line
+		}
+	}
+	for i := range rows {
+		r := &rows[i]
+		if r.Parent == nil {
+			continue
+		}
+		if line, ok := emails[r.Parent.Email]; ok {
+			r.Errors = append(r.Errors, fmt.Sprintf("parent.email is the email of the student on line %d", line))
+		}
+	}
+}
+
+func checkImportPerson(prefix string, p *models.ImportPerson) []string {
+	errs := []string{}
+	if p.Email == "" {
+		errs = append(errs, prefix+".email is required")
+	} else if addr, err := mail.ParseAddress(p.Email); err != nil || addr.Address != p.Email {
+		errs = append(errs, prefix+".email is not a valid email address")
+	}
+	if p.Username == "" {
+		p.Username = p.Email
+	}
+	if n := utf8.RuneCountInString(p.Username); p.Username != "" && (n < 3 || n > 255) {
+		errs = append(errs, prefix+".username must be between 3 and 255 characters")
+	}
+	return errs
+}
+
+func parseImportDate(v string) (string, bool) {
+	for _, layout := range importDateLayouts {
+		if d, err := time.Parse(layout, v); err == nil {
+			return d.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// checkExistingUsers reports the rows whose users clash with existing ones.
+// A parent whose email is already a user's resolves to that user and is
+// linked rather than created.
+func checkExistingUsers(ctx context.Context, db bun.IDB, rows []models.ImportRow) error {
+	emails := []string{}
+	usernames := []string{}
+	for _, r := range rows {
+		emails = append(emails, r.Student.Email)
+		usernames = append(usernames, strings.ToLower(r.Student.Username))
+		if r.Parent != nil {
+			emails = append(emails, r.Parent.Email)
+			usernames = append(usernames, strings.ToLower(r.Parent.Username))
+		}
+	}
+
+	// deleted users still hold their email and username
+	users := []models.Users{}
+	if err := db.NewSelect().Model(&users).
+		Column("u.id", "u.username", "u.email", "u.deleted_at").
+		Relation("Parent", func(q *bun.SelectQuery) *bun.SelectQuery { return q.Column("id", "deleted_at") }).
+		WhereAllWithDeleted().
+		Where("LOWER(u.email) IN (?) OR LOWER(u.username) IN (?)", bun.In(emails), bun.In(usernames)).
+		Scan(ctx); err != nil {
+		return err
+	}
+	byEmail := map[string]*models.Users{}
+	byUsername := map[string]*models.Users{}
+	for i := range users {
+		byEmail[strings.ToLower(users[i].Email)] = &users[i]
+		byUsername[strings.ToLower(users[i].Username)] = &users[i]
+	}
+
+	for i := range rows {
+		r := &rows[i]
+		if _, ok := byEmail[r.Student.Email]; ok {
+			r.Errors = append(r.Errors, "student.email is already used by an existing user")
+		}
+		if _, ok := byUsername[strings.ToLower(r.Student.Username)]; ok {
+			r.Errors = append(r.Errors, "student.username is already used by an existing user")
+		}
+		if r.Parent == nil {
+			continue
+		}
+		u, ok := byEmail[r.Parent.Email]
+		switch {
+		case ok && !u.DeletedAt.IsZero():
+			r.Errors = append(r.Errors, "parent.email belongs to a deleted user")
+		case ok && u.Parent != nil && !u.Parent.DeletedAt.IsZero():
+			r.Errors = append(r.Errors, "parent.email belongs to a deleted parent")
+		case ok && u.Parent != nil:
+			r.ParentUserID = u.UserID
+			r.ParentID = u.Parent.ParentID
+			r.Warnings = append(r.Warnings, "parent already exists, the student will be linked to them")
+		case ok:
+			r.ParentUserID = u.UserID
+			r.Warnings = append(r.Warnings, "parent.email belongs to an existing user, who will become a parent")
+		default:
+			if _, taken := byUsername[strings.ToLower(r.Parent.Username)]; taken {
+				r.Errors = append(r.Errors, "parent.username is already used by an existing user")
+			}
+		}
+	}
+	return nil
+}
+
+// cloneImport copies job for work going on in the background while job is
+// sent back
+func cloneImport(job *models.ImportJobs) *models.ImportJobs {
+	c := *job
+	c.Rows = slices.Clone(job.Rows)
+	for i, r := range c.Rows {
+		if r.Parent != nil {
+			parent := *r.Parent
+			c.Rows[i].Parent = &parent
+		}
+	}
+	return &c
+}
+
+func countImportRows(rows []models.ImportRow) (valid int, invalid int) {
+	for _, r := range rows {
+		if len(r.Errors) > 0 {
+			invalid++
+		} else {
+			valid++
+		}
+	}
+	return valid, invalid
+}
+
+func importUser(id string, p *models.ImportPerson) models.Users {
+	u := models.Users{
+		UserID:       id,
+		Username:     p.Username,
+		Email:        p.Email,
+		PasswordHash: importedPasswordHash,
+	}
+	if p.FirstName != "" {
+		u.FirstName = &p.FirstName
+	}
+	if p.FamilyName != "" {
+		u.FamilyName = &p.FamilyName
+	}
+	if p.PhoneNumber != "" {
+		u.PhoneNumber = &p.PhoneNumber
+	}
+	if d, err := time.Parse("2006-01-02", p.DateOfBirth); err == nil {
+		u.DateOfBirth = &d
+	}
+	return u
+}
+
+// insertChunks inserts rows importChunk at a time and returns how many were
+// inserted.
+func insertChunks[M any](ctx context.Context, db bun.IDB, rows []M) (int, error) {
+	n := 0
+	for start := 0; start < len(rows); start += importChunk {
+		chunk := rows[start:min(start+importChunk, len(rows))]
+		res, err := db.NewInsert().Model(&chunk).Exec(ctx)
+		if err != nil {
+			return n, err
+		}
+		affected, _ := res.RowsAffected()
+		n += int(affected)
+	}
+	return n, nil
+}
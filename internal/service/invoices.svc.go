@@ -0,0 +1,510 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// InvoicesService bills the active enrollments of students per month or per
+// term. Invoices are generated as drafts, get their legal number when issued
+// and end up paid by payments or void. Issuing and voiding post to the
+// ledger. See docs/invoices.md.
+type InvoicesService struct {
+	store Store
+	log   zerolog.Logger
+	// center is the center invoices are numbered for
+	center string
+	// dueDays is how many days after being issued invoices are due
+	dueDays     int
+	crud        *resource[models.Invoices, dto.InvoiceModelRes]
+	lines       Repository[models.InvoiceLines]
+	sequences   Repository[models.InvoiceSequences]
+	enrollments Repository[models.Enrollments]
+	ledger      *ledger
+	pricer      *pricer
+	prorater    *prorater
+}
+
+func NewInvoicesService(store Store, center string, proration string, dueDays int) (*InvoicesService, error) {
+	if center == "" {
+		return nil, errors.New("no billing center configured")
+	}
+	log := logging.L().With().Str("service", "invoices.svc").Logger()
+	s := &InvoicesService{log: log, store: store, center: center, dueDays: dueDays}
+	s.lines = NewRepository[models.InvoiceLines](store)
+	s.sequences = NewRepository[models.InvoiceSequences](store)
+	s.enrollments = NewRepository[models.Enrollments](store)
+	s.ledger = newLedger(store, log)
+	s.pricer = newPricer(store, log)
+	s.prorater = newProrater(store, log, proration)
+	s.crud = newResource(store, log, resourceSpec[models.Invoices, dto.InvoiceModelRes]{
+		Entity:    "invoice",
+		Relations: []string{"Student.User"},
+		Search:    append(dto.UserSearchColumnsOf(`"student__user"`), "?TableAlias.number"),
+		Filters: withUserFilters(`"student__user"`, map[string]string{
+			"number":          "?TableAlias.number",
+			"student_id":      "?TableAlias.student_id",
+			"status":          "?TableAlias.status",
+			"period":          "?TableAlias.period",
+			"period_start":    "?TableAlias.period_start",
+			"period_end":      "?TableAlias.period_end",
+			"total":           "?TableAlias.total",
+			"amount_paid":     "?TableAlias.amount_paid",
+			"amount_credited": "?TableAlias.amount_credited",
+			"issued_at":       "?TableAlias.issued_at",
+			"due_date":        "?TableAlias.due_date",
+			"paid_at":         "?TableAlias.paid_at",
+		}),
+		Columns: invoiceColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
+}
+
+// billingPeriod returns the days billed and the number of months they span.
+// A month is the whole calendar month of start, a term runs from start to
+// end.
+func billingPeriod(period string, start string, end *string) (time.Time, time.Time, int, error) {
+	from, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		return from, from, 0, huma.Error422UnprocessableEntity("period_start is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "body.period_start", Value: start,
+		})
+	}
+	if period == models.PeriodMonthly {
+		from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, -1), 1, nil
+	}
+
+	if end == nil {
+		return from, from, 0, huma.Error422UnprocessableEntity("period_end is required for terms", &huma.ErrorDetail{
+			Message: "expected the last day of the term", Location: "body.period_end",
+		})
+	}
+	to, err := time.Parse(time.DateOnly, *end)
+	if err == nil && to.Before(from) {
+		err = errors.New("the term ends before it starts")
+	}
+	if err != nil {
+		return from, to, 0, huma.Error422UnprocessableEntity("period_end is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "body.period_end", Value: *end,
+		})
+	}
+	months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1
+	return from, to, months, nil
+}
+
+// GenerateInvoices creates a draft invoice for every student with active
+// enrollments, or for the given students, with a line per enrollment priced
+// by the rules valid during the period. The fee of an enrollment is monthly,
+// so a term bills it once per month the term touches. Enrollments starting
+// or ending within the period are prorated for the days they cover, and
+// those covering none of it aren't billed. Students already
+// invoiced for the same period are skipped, unless that invoice was voided,
+// so generating twice is harmless.
+func (s *InvoicesService) GenerateInvoices(ctx context.Context, period string, start string, end *string, studentIDs []string) (*dto.GenerateInvoicesResBody, error) {
+	from, to, months, err := billingPeriod(period, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range studentIDs {
+		if _, err := ulid.Parse(id); err != nil {
+			return nil, huma.Error422UnprocessableEntity("student_ids are invalid", &huma.ErrorDetail{
+				Message: "not a valid ID", Location: fmt.Sprintf("body.student_ids[%d]", i), Value: id,
+			})
+		}
+	}
+
+	res := &dto.GenerateInvoicesResBody{}
+	err = s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		*res = dto.GenerateInvoicesResBody{InvoiceIDs: []string{}}
+		spec := ListSpec{Relations: []string{"Group"}}
+		if studentIDs != nil {
+			spec.Where = map[string]any{"student_id": studentIDs}
+		}
+		enrollments, err := listAll(ctx, s.enrollments, spec)
+		if err != nil {
+			return dbError(s.log, err, "enrollment")
+		}
+		billed, err := listAll(ctx, s.crud.repo, ListSpec{Where: map[string]any{"period_start": from, "period_end": to}})
+		if err != nil {
+			return dbError(s.log, err, "invoice")
+		}
+		done := map[string]bool{}
+		for _, inv := range billed {
+			if inv.Status != models.InvoiceVoid {
+				done[inv.StudentID] = true
+			}
+		}
+
+		// enrollments of a deleted group are no longer billed, nor those
+		// outside the period
+		enrollments = slices.DeleteFunc(enrollments, func(e models.Enrollments) bool {
+			_, _, ok := covered(e, from, to)
+			return e.Group == nil || e.Group.GroupID == "" || !ok
+		})
+		quotes, err := s.pricer.price(ctx, from, to, enrollments)
+		if err != nil {
+			return err
+		}
+		byStudent := map[string][]models.Enrollments{}
+		prices := map[string]quote{}
+		for i, e := range enrollments {
+			byStudent[e.StudentID] = append(byStudent[e.StudentID], e)
+			prices[e.StudentID+"/"+e.GroupID] = quotes[i]
+		}
+		for _, studentID := range slices.Sorted(maps.Keys(byStudent)) {
+			if done[studentID] {
+				res.Skipped++
+				continue
+			}
+			inv := models.Invoices{
+				InvoiceID:   ulid.Make().String(),
+				Center:      s.center,
+				Currency:    money.CenterCurrency().Code,
+				StudentID:   studentID,
+				Period:      period,
+				PeriodStart: from,
+				PeriodEnd:   to,
+				Status:      models.InvoiceDraft,
+			}
+			lines := []models.InvoiceLines{}
+			enrolled := byStudent[studentID]
+			slices.SortFunc(enrolled, func(a, b models.Enrollments) int {
+				return cmp.Or(cmp.Compare(a.Group.Name, b.Group.Name), cmp.Compare(a.GroupID, b.GroupID))
+			})
+			for i, e := range enrolled {
+				q := prices[e.StudentID+"/"+e.GroupID]
+				start, end, _ := covered(e, from, to)
+				amount, proration, err := s.prorater.charge(ctx, e.GroupID, q.Fee.Times(months), from, to, start, end)
+				if err != nil {
+					return err
+				}
+				line := models.InvoiceLines{
+					LineID:      ulid.Make().String(),
+					InvoiceID:   inv.InvoiceID,
+					GroupID:     &e.GroupID,
+					Position:    i + 1,
+					Description: e.Group.Name,
+					Quantity:    months,
+					ListPrice:   e.Fee,
+					UnitPrice:   q.Fee,
+					Adjustments: q.Adjustments,
+					Amount:      amount,
+					CoveredFrom: start,
+					CoveredTo:   end,
+					Proration:   proration,
+				}
+				inv.Total += line.Amount
+				lines = append(lines, line)
+			}
+
+			if err := s.crud.repo.Insert(ctx, &inv); err != nil {
+				s.log.Err(err).Str("student_id", studentID).Msg("Couldn't insert invoice")
+				return dbError(s.log, err, "invoice")
+			}
+			for i := range lines {
+				if err := s.lines.Insert(ctx, &lines[i]); err != nil {
+					return dbError(s.log, err, "invoice line")
+				}
+			}
+			res.InvoiceIDs = append(res.InvoiceIDs, inv.InvoiceID)
+			res.Created++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetInvoiceByID returns the invoice with its lines
+func (s *InvoicesService) GetInvoiceByID(ctx context.Context, id string) (*dto.InvoiceModelRes, error) {
+	m := models.Invoices{InvoiceID: id}
+	if err := s.crud.Get(ctx, &m, "Lines"); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// changeStatus moves the invoice to status, provided it is in one of from,
+// setting the columns change returns, and holds it meanwhile
+func (s *InvoicesService) changeStatus(ctx context.Context, id string, status string, from []string, opts *sql.TxOptions, change func(ctx context.Context, m *models.Invoices) ([]string, error)) (*dto.InvoiceModelRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("invoiceID is invalid", err)
+	}
+	m := models.Invoices{InvoiceID: id}
+	err := s.store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		m = models.Invoices{InvoiceID: id}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		if !slices.Contains(from, m.Status) {
+			return huma.Error409Conflict(fmt.Sprintf("invoice is %s, only %s invoices can become %s", m.Status, strings.Join(from, " or "), status))
+		}
+		m.Status = status
+		columns, err := change(ctx, &m)
+		if err != nil {
+			return err
+		}
+		if err := s.crud.repo.Update(ctx, &m, append(columns, "status")...); err != nil {
+			return dbError(s.log, err, "invoice")
+		}
+		return s.crud.Get(ctx, &m, "Lines")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// IssueInvoice gives a draft its legal number, the next one of the center for
+// the current year, which no other invoice will get even if this one is
+// voided later. The total becomes owed by the student, and the credit the
+// student has pays it first.
+func (s *InvoicesService) IssueInvoice(ctx context.Context, id string) (*dto.InvoiceModelRes, error) {
+	// serializable turns two first issues of a year racing to create the
+	// sequence, or two uses of the same credit, into a retried serialization
+	// failure
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	return s.changeStatus(ctx, id, models.InvoiceIssued, []string{models.InvoiceDraft}, opts, func(ctx context.Context, m *models.Invoices) ([]string, error) {
+		now := time.Now()
+		number, err := s.nextNumber(ctx, now.Year())
+		if err != nil {
+			return nil, err
+		}
+		m.Number = &number
+		m.IssuedAt = &now
+		due := dateOf(now).AddDate(0, 0, s.dueDays)
+		m.DueDate = &due
+
+		billed := &txn{memo: "invoice " + number + " issued", studentID: m.StudentID}
+		billed.add(models.AccountReceivable, &m.InvoiceID, m.Total, 0).
+			add(models.AccountRevenue, &m.InvoiceID, 0, m.Total)
+		if err := s.ledger.post(ctx, billed); err != nil {
+			return nil, err
+		}
+		balances, err := s.ledger.balances(ctx, m.StudentID)
+		if err != nil {
+			return nil, err
+		}
+		applied := settle(m, balances[m.StudentID].Credit)
+		used := &txn{memo: "credit applied to invoice " + number, studentID: m.StudentID}
+		used.add(models.AccountCredit, &m.InvoiceID, applied, 0).
+			add(models.AccountReceivable, &m.InvoiceID, 0, applied)
+		if err := s.ledger.post(ctx, used); err != nil {
+			return nil, err
+		}
+		return append([]string{"number", "issued_at", "due_date"}, settledColumns...), nil
+	})
+}
+
+// nextNumber takes the next invoice number of the center for year
+func (s *InvoicesService) nextNumber(ctx context.Context, year int) (string, error) {
+	seq := models.InvoiceSequences{Center: s.center, Year: year}
+	err := s.sequences.Lock(ctx, &seq)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		seq.LastNumber = 1
+		err = s.sequences.Insert(ctx, &seq)
+	case err == nil:
+		seq.LastNumber++
+		err = s.sequences.Update(ctx, &seq, "last_number")
+	}
+	if err != nil {
+		return "", dbError(s.log, err, "invoice sequence")
+	}
+	return fmt.Sprintf("%s-%d-%06d", s.center, year, seq.LastNumber), nil
+}
+
+// VoidInvoice cancels a draft or issued invoice. Issued invoices keep their
+// number, so the numbering has no gaps, and stop being owed: what was already
+// paid on them becomes credit of the student.
+func (s *InvoicesService) VoidInvoice(ctx context.Context, id string, reason string) (*dto.InvoiceModelRes, error) {
+	return s.changeStatus(ctx, id, models.InvoiceVoid, []string{models.InvoiceDraft, models.InvoiceIssued}, nil, func(ctx context.Context, m *models.Invoices) ([]string, error) {
+		now := time.Now()
+		m.VoidedAt = &now
+		m.VoidReason = &reason
+		if m.Number != nil {
+			reversed := &txn{memo: "invoice " + *m.Number + " voided: " + reason, studentID: m.StudentID}
+			reversed.add(models.AccountRevenue, &m.InvoiceID, m.Total-m.AmountCredited, 0).
+				add(models.AccountReceivable, &m.InvoiceID, 0, owedOn(m)).
+				add(models.AccountCredit, &m.InvoiceID, 0, m.AmountPaid)
+			if err := s.ledger.post(ctx, reversed); err != nil {
+				return nil, err
+			}
+		}
+		return []string{"voided_at", "void_reason"}, nil
+	})
+}
+
+func (s *InvoicesService) GetInvoices(ctx context.Context, params *dto.ListInvoicesReq) (*dto.ListInvoicesRes, error) {
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.ListInvoicesRes{Body: invoicesListBody(l, params.ListQuery)}, nil
+}
+
+// ExportInvoices writes every invoice matching params to w
+func (s *InvoicesService) ExportInvoices(ctx context.Context, params *dto.ListInvoicesReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+// GetInvoicesByStudentID lists the invoices of a student
+func (s *InvoicesService) GetInvoicesByStudentID(ctx context.Context, params *dto.GetInvoicesByStudentIDReq) (*dto.GetInvoicesByStudentIDRes, error) {
+	if _, err := ulid.Parse(params.StudentID); err != nil {
+		return nil, huma.Error400BadRequest("studentID is invalid", err)
+	}
+	l, err := s.crud.List(ctx, params.ListQuery, map[string]any{"student_id": params.StudentID})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetInvoicesByStudentIDRes{Body: invoicesListBody(l, params.ListQuery)}, nil
+}
+
+// GetInvoicesByParentID lists the invoices of every student linked to a
+// parent
+func (s *InvoicesService) GetInvoicesByParentID(ctx context.Context, params *dto.GetInvoicesByParentIDReq) (*dto.GetInvoicesByParentIDRes, error) {
+	if _, err := ulid.Parse(params.ParentID); err != nil {
+		return nil, huma.Error400BadRequest("parentID is invalid", err)
+	}
+	studentIDs, err := childrenOf(ctx, s.store, s.log, params.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	l, err := s.crud.List(ctx, params.ListQuery, map[string]any{"student_id": studentIDs})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetInvoicesByParentIDRes{Body: invoicesListBody(l, params.ListQuery)}, nil
+}
+
+func invoicesListBody(l *listing[dto.InvoiceModelRes], params dto.ListQuery) dto.ListInvoicesResBody {
+	return dto.ListInvoicesResBody{
+		Invoices:    l.Items,
+		Total:       l.Total,
+		ListQuery:   l.Query(params),
+		PageCursors: l.Cursors,
+	}
+}
+
+var invoiceColumns = slices.Concat(
+	[]spreadsheet.Column[models.Invoices]{
+		{Name: "id", Value: func(m *models.Invoices) any { return m.InvoiceID }},
+		{Name: "number", Value: func(m *models.Invoices) any { return cellString(m.Number) }},
+		{Name: "center", Value: func(m *models.Invoices) any { return m.Center }},
+		{Name: "status", Value: func(m *models.Invoices) any { return m.Status }},
+		{Name: "period", Value: func(m *models.Invoices) any { return m.Period }},
+		{Name: "period_start", Value: func(m *models.Invoices) any { return m.PeriodStart.Format(time.DateOnly) }},
+		{Name: "period_end", Value: func(m *models.Invoices) any { return m.PeriodEnd.Format(time.DateOnly) }},
+		{Name: "currency", Value: func(m *models.Invoices) any { return m.Currency }},
+		{Name: "total", Value: func(m *models.Invoices) any { return m.Total }},
+		{Name: "amount_paid", Value: func(m *models.Invoices) any { return m.AmountPaid }},
+		{Name: "amount_credited", Value: func(m *models.Invoices) any { return m.AmountCredited }},
+		{Name: "student_id", Value: func(m *models.Invoices) any { return m.StudentID }},
+	},
+	userColumns("student_", func(m *models.Invoices) *models.Users {
+		if m.Student == nil {
+			return nil
+		}
+		return m.Student.User
+	}),
+	[]spreadsheet.Column[models.Invoices]{
+		{Name: "issued_at", Value: func(m *models.Invoices) any { return cellTime(m.IssuedAt) }},
+		{Name: "due_date", Value: func(m *models.Invoices) any { return cellString(datePtr(m.DueDate)) }},
+		{Name: "paid_at", Value: func(m *models.Invoices) any { return cellTime(m.PaidAt) }},
+		{Name: "voided_at", Value: func(m *models.Invoices) any { return cellTime(m.VoidedAt) }},
+		{Name: "void_reason", Value: func(m *models.Invoices) any { return cellString(m.VoidReason) }},
+		{Name: "created_at", Value: func(m *models.Invoices) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Invoices) any { return m.UpdatedAt }},
+	},
+)
+
+func prorationToRes(p *models.Proration) *dto.ProrationRes {
+	if p == nil {
+		return nil
+	}
+	return &dto.ProrationRes{Policy: p.Policy, Units: p.Units, Total: p.Total}
+}
+
+// unixPtr returns the Unix time of t, nil when unset
+func unixPtr(t *time.Time) *int {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	v := int(t.Unix())
+	return &v
+}
+
+func (s *InvoicesService) ModelToRes(m *models.Invoices) *dto.InvoiceModelRes {
+	if m == nil {
+		return nil
+	}
+	res := &dto.InvoiceModelRes{
+		ID:               m.InvoiceID,
+		Center:           m.Center,
+		Currency:         m.Currency,
+		Number:           m.Number,
+		StudentID:        m.StudentID,
+		Period:           m.Period,
+		PeriodStart:      m.PeriodStart.Format(time.DateOnly),
+		PeriodEnd:        m.PeriodEnd.Format(time.DateOnly),
+		Status:           m.Status,
+		Total:            m.Total,
+		AmountPaid:       m.AmountPaid,
+		AmountCredited:   m.AmountCredited,
+		IssuedAt:         unixPtr(m.IssuedAt),
+		DueDate:          datePtr(m.DueDate),
+		PaidAt:           unixPtr(m.PaidAt),
+		VoidedAt:         unixPtr(m.VoidedAt),
+		VoidReason:       m.VoidReason,
+		LateFeeInvoiceID: m.LateFeeInvoiceID,
+	}
+	lines := slices.SortedFunc(slices.Values(m.Lines), func(a, b models.InvoiceLines) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+	for _, l := range lines {
+		res.Lines = append(res.Lines, dto.InvoiceLineRes{
+			ID:          l.LineID,
+			GroupID:     l.GroupID,
+			Description: l.Description,
+			Quantity:    l.Quantity,
+			ListPrice:   l.ListPrice,
+			UnitPrice:   l.UnitPrice,
+			Adjustments: adjustmentsToRes(l.Adjustments),
+			Amount:      l.Amount,
+			CoveredFrom: l.CoveredFrom.Format(time.DateOnly),
+			CoveredTo:   l.CoveredTo.Format(time.DateOnly),
+			Proration:   prorationToRes(l.Proration),
+		})
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
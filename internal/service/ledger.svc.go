@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// ledger is the double-entry ledger shared by the invoices and the payments
+// services. Every money movement is posted as one transaction whose debits
+// equal its credits, and entries are never changed, so a balance is a sum of
+// entries that can't drift from the invoices and payments behind it. See
+// docs/payments.md.
+type ledger struct {
+	log     zerolog.Logger
+	store   Store
+	entries Repository[models.LedgerEntries]
+}
+
+func newLedger(store Store, log zerolog.Logger) *ledger {
+	return &ledger{log: log, store: store, entries: NewRepository[models.LedgerEntries](store)}
+}
+
+// txn is a ledger transaction of a student being written
+type txn struct {
+	memo      string
+	studentID string
+	paymentID *string
+	entries   []models.LedgerEntries
+}
+
+// add appends an entry of account, about invoiceID when set. Zero amounts are
+// left out.
+func (t *txn) add(account string, invoiceID *string, debit money.Amount, credit money.Amount) *txn {
+	if debit == 0 && credit == 0 {
+		return t
+	}
+	t.entries = append(t.entries, models.LedgerEntries{
+		Account:   account,
+		StudentID: &t.studentID,
+		InvoiceID: invoiceID,
+		PaymentID: t.paymentID,
+		Debit:     debit,
+		Credit:    credit,
+		Memo:      t.memo,
+	})
+	return t
+}
+
+// post writes t, refusing it unless its debits equal its credits
+func (l *ledger) post(ctx context.Context, t *txn) error {
+	var debits, credits money.Amount
+	for _, e := range t.entries {
+		debits += e.Debit
+		credits += e.Credit
+	}
+	if debits != credits {
+		return fmt.Errorf("unbalanced ledger transaction %q: %v debited, %v credited", t.memo, debits, credits)
+	}
+	txnID := ulid.Make().String()
+	now := time.Now()
+	for i := range t.entries {
+		e := &t.entries[i]
+		e.EntryID = ulid.Make().String()
+		e.TxnID = txnID
+		e.CreatedAt = now
+		if err := l.entries.Insert(ctx, e); err != nil {
+			l.log.Err(err).Str("memo", t.memo).Msg("Couldn't post ledger entry")
+			return dbError(l.log, err, "ledger entry")
+		}
+	}
+	return nil
+}
+
+// studentBalance is what a student owes on issued invoices and what they
+// paid beyond it
+type studentBalance struct {
+	Owed   money.Amount
+	Credit money.Amount
+}
+
+// ledgerSum is what the entries of a student in an account add up to, their
+// debits less their credits
+type ledgerSum struct {
+	StudentID string       `bun:"student_id"`
+	Account   string       `bun:"account"`
+	Net       money.Amount `bun:"net"`
+}
+
+// balances sums the receivable and credit accounts of the students
+func (l *ledger) balances(ctx context.Context, studentIDs ...string) (map[string]studentBalance, error) {
+	sums, err := l.store.sumLedger(ctx, studentIDs, []string{models.AccountReceivable, models.AccountCredit})
+	if err != nil {
+		return nil, dbError(l.log, err, "ledger entry")
+	}
+	res := make(map[string]studentBalance, len(studentIDs))
+	for _, id := range studentIDs {
+		res[id] = studentBalance{}
+	}
+	for _, sum := range sums {
+		b := res[sum.StudentID]
+		switch sum.Account {
+		case models.AccountReceivable:
+			b.Owed += sum.Net
+		case models.AccountCredit:
+			b.Credit -= sum.Net
+		}
+		res[sum.StudentID] = b
+	}
+	return res, nil
+}
+
+// settle applies up to amount to what is left to pay on an issued invoice,
+// marking it paid once nothing is, and returns the part applied. The caller
+// posts the matching entries and saves settledColumns.
+func settle(inv *models.Invoices, amount money.Amount) money.Amount {
+	applied := max(min(amount, owedOn(inv)), 0)
+	inv.AmountPaid += applied
+	if inv.Status == models.InvoiceIssued && owedOn(inv) <= 0 {
+		now := time.Now()
+		inv.Status = models.InvoicePaid
+		inv.PaidAt = &now
+	}
+	return applied
+}
+
+// owedOn is what is left to pay on an issued invoice: its total less what
+// withdrawals credited and what was paid
+func owedOn(inv *models.Invoices) money.Amount {
+	return inv.Total - inv.AmountCredited - inv.AmountPaid
+}
+
+// settledColumns are the invoice columns settle changes
+var settledColumns = []string{"amount_paid", "status", "paid_at"}
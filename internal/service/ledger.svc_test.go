@@ -0,0 +1,126 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+)
+
+func TestLedgerPost(t *testing.T) {
+	invoiceID := "01JINVOICE0000000000000000"
+	tests := []struct {
+		name    string
+		build   func(t *txn)
+		entries int
+		err     bool
+	}{
+		{name: "balanced", build: func(t *txn) {
+			t.add(models.AccountReceivable, &invoiceID, 45000, 0).add(models.AccountRevenue, &invoiceID, 0, 45000)
+		}, entries: 2},
+		{name: "split", build: func(t *txn) {
+			t.add(models.PaymentCash, nil, 50000, 0).add(models.AccountReceivable, &invoiceID, 0, 45000).add(models.AccountCredit, nil, 0, 5000)
+		}, entries: 3},
+		{name: "zero amounts left out", build: func(t *txn) {
+			t.add(models.PaymentCash, nil, 45000, 0).add(models.AccountReceivable, &invoiceID, 0, 45000).add(models.AccountCredit, nil, 0, 0)
+		}, entries: 2},
+		{name: "nothing", build: func(t *txn) {}, entries: 0},
+		{name: "unbalanced", build: func(t *txn) {
+			t.add(models.PaymentCash, nil, 50000, 0).add(models.AccountReceivable, &invoiceID, 0, 45000)
+		}, err: true},
+		{name: "one sided", build: func(t *txn) {
+			t.add(models.AccountCredit, nil, 0, 1)
+		}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			studentID := seedStudent(t, store, "student")
+			l := newLedger(store, logging.L())
+			tx := &txn{memo: tt.name, studentID: studentID}
+			tt.build(tx)
+
+			err := l.post(t.Context(), tx)
+			if tt.err != (err != nil) {
+				t.Fatalf("post = %v, want an error %v", err, tt.err)
+			}
+			entries := checkBalanced(t, store)
+			if len(entries) != tt.entries {
+				t.Fatalf("posted %d entries, want %d", len(entries), tt.entries)
+			}
+			for _, e := range entries {
+				if e.TxnID != entries[0].TxnID || e.Memo != tt.name || *e.StudentID != studentID || e.EntryID == "" {
+					t.Fatalf("posted %+v", e)
+				}
+			}
+		})
+	}
+}
+
+func TestSettle(t *testing.T) {
+	tests := []struct {
+		name                  string
+		status                string
+		total, credited, paid money.Amount
+		amount                money.Amount
+		applied, owed         money.Amount
+		wantStatus            string
+	}{
+		{name: "partial", status: models.InvoiceIssued, total: 45000, amount: 20000, applied: 20000, owed: 25000, wantStatus: models.InvoiceIssued},
+		{name: "rest of a partial", status: models.InvoiceIssued, total: 45000, paid: 20000, amount: 25000, applied: 25000, owed: 0, wantStatus: models.InvoicePaid},
+		{name: "exact", status: models.InvoiceIssued, total: 45000, amount: 45000, applied: 45000, wantStatus: models.InvoicePaid},
+		{name: "more than owed", status: models.InvoiceIssued, total: 45000, amount: 60000, applied: 45000, wantStatus: models.InvoicePaid},
+		{name: "credited by a withdrawal", status: models.InvoiceIssued, total: 45000, credited: 15000, amount: 45000, applied: 30000, wantStatus: models.InvoicePaid},
+		{name: "credited in full", status: models.InvoiceIssued, total: 45000, credited: 45000, amount: 10000, applied: 0, wantStatus: models.InvoicePaid},
+		{name: "already paid", status: models.InvoicePaid, total: 45000, paid: 45000, amount: 10000, applied: 0, wantStatus: models.InvoicePaid},
+		{name: "nothing", status: models.InvoiceIssued, total: 45000, amount: 0, applied: 0, owed: 45000, wantStatus: models.InvoiceIssued},
+		{name: "negative", status: models.InvoiceIssued, total: 45000, amount: -5000, applied: 0, owed: 45000, wantStatus: models.InvoiceIssued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := models.Invoices{Status: tt.status, Total: tt.total, AmountCredited: tt.credited, AmountPaid: tt.paid}
+			if got := settle(&inv, tt.amount); got != tt.applied {
+				t.Fatalf("settle(%s) = %s, want %s", tt.amount, got, tt.applied)
+			}
+			if inv.AmountPaid != tt.paid+tt.applied {
+				t.Fatalf("amount paid %s, want %s", inv.AmountPaid, tt.paid+tt.applied)
+			}
+			if got := owedOn(&inv); got != tt.owed {
+				t.Fatalf("owedOn = %s, want %s", got, tt.owed)
+			}
+			if inv.Status != tt.wantStatus {
+				t.Fatalf("status %s, want %s", inv.Status, tt.wantStatus)
+			}
+			if paidNow := tt.status == models.InvoiceIssued && tt.wantStatus == models.InvoicePaid; paidNow != (inv.PaidAt != nil) {
+				t.Fatalf("paid at %v, want it set %v", inv.PaidAt, paidNow)
+			}
+		})
+	}
+}
+
+func TestLedgerBalances(t *testing.T) {
+	store := NewMemoryStore()
+	a, b := seedStudent(t, store, "a"), seedStudent(t, store, "b")
+	l := newLedger(store, logging.L())
+	invoiceID := "01JINVOICE0000000000000000"
+	for _, tx := range []*txn{
+		(&txn{memo: "issue", studentID: a}).add(models.AccountReceivable, &invoiceID, 45000, 0).add(models.AccountRevenue, &invoiceID, 0, 45000),
+		(&txn{memo: "cash payment", studentID: a}).add(models.PaymentCash, nil, 20000, 0).add(models.AccountReceivable, &invoiceID, 0, 20000),
+		(&txn{memo: "cash payment", studentID: b}).add(models.PaymentCash, nil, 5000, 0).add(models.AccountCredit, nil, 0, 5000),
+	} {
+		if err := l.post(t.Context(), tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := l.balances(t.Context(), a, b, "01JNOBODY00000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]studentBalance{a: {Owed: 25000}, b: {Credit: 5000}, "01JNOBODY00000000000000000": {}}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("balance of %s = %+v, want %+v", id, got[id], w)
+		}
+	}
+}
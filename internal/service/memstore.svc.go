@@ -0,0 +1,856 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MemoryStore keeps records in process, for demos and handler tests, and
+// loses them when the process exits. It follows the bun tags of the models:
+// soft deletes, relations and defaults. It checks belongs-to references,
+// primary keys and memoryUniques, and runs one unit of work at a time,
+// rolling it back when it fails. Search is a substring match ignoring case
+// and accents, without the typo tolerance of Postgres.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tables map[string]*memoryTable
+}
+
+type memoryTable struct {
+	table *schema.Table
+	// rows point to structs that are replaced, never changed, so a copy of
+	// the slice is a snapshot
+	rows []reflect.Value
+}
+
+// memoryUniques are the unique columns of the migrations, by table
+var memoryUniques = map[string][]string{
+	"users": {"username", "email"},
+}
+
+type memoryTxKey struct{}
+
+// memoryTx is the unit of work running in a context
+type memoryTx struct {
+	store     *MemoryStore
+	isolation sql.IsolationLevel
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tables: map[string]*memoryTable{}}
+}
+
+func (s *MemoryStore) DB() *bun.DB {
+	return nil
+}
+
+// RunInTx runs fn holding the store, and puts every table back as it was
+// when fn fails. Nested calls are refused a stronger isolation like in
+// Postgres, although holding the store serializes everything.
+func (s *MemoryStore) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if running := s.running(ctx); running != nil {
+		if err := joinable(running.isolation, opts); err != nil {
+			return err
+		}
+		return fn(ctx)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := map[string][]reflect.Value{}
+	for name, t := range s.tables {
+		snapshot[name] = slices.Clone(t.rows)
+	}
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, &memoryTx{store: s, isolation: isolationOf(opts)})); err != nil {
+		for name, t := range s.tables {
+			t.rows = snapshot[name]
+		}
+		return err
+	}
+	return nil
+}
+
+// running returns the unit of work of the store running in ctx, nil outside
+// of one
+func (s *MemoryStore) running(ctx context.Context) *memoryTx {
+	if tx, ok := ctx.Value(memoryTxKey{}).(*memoryTx); ok && tx.store == s {
+		return tx
+	}
+	return nil
+}
+
+// do runs fn holding the store, unless the unit of work in ctx already does
+func (s *MemoryStore) do(ctx context.Context, fn func() error) error {
+	if s.running(ctx) != nil {
+		return fn()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+func (s *MemoryStore) table(t *schema.Table) *memoryTable {
+	mt, ok := s.tables[t.Name]
+	if !ok {
+		mt = &memoryTable{table: t}
+		s.tables[t.Name] = mt
+	}
+	return mt
+}
+
+// rowsWhere returns the positions of the rows of the named table whose
+// column holds one of values, leaving out the ones with soft set when given
+func (s *MemoryStore) rowsWhere(name string, column string, values []string, soft string) []int {
+	mt, ok := s.tables[name]
+	if !ok {
+		return nil
+	}
+	found := []int{}
+	for i, row := range mt.rows {
+		v := row.Elem()
+		if soft != "" && !isNullValue(mt.table.FieldMap[soft].Value(v)) {
+			continue
+		}
+		cv := mt.table.FieldMap[column].Value(v)
+		if !isNullValue(cv) && slices.Contains(values, fmt.Sprint(reflect.Indirect(cv).Interface())) {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+func (s *MemoryStore) planDeletion(ctx context.Context, entity string, id string) (*deletionPlan, error) {
+	var plan *deletionPlan
+	err := s.do(ctx, func() error {
+		root, ok := deleteEntities[entity]
+		if !ok {
+			return huma.Error500InternalServerError("no deletion policy for " + entity)
+		}
+		if len(s.rowsWhere(entity, root.Key, []string{id}, root.SoftColumn)) == 0 {
+			return huma.Error404NotFound(root.Name + " not found")
+		}
+		var err error
+		plan, err = walkDeletion(entity, id, func(rel deleteRelation, refs []string) (deletionStep, error) {
+			child := deleteEntities[rel.Entity]
+			rows := s.rowsWhere(rel.Entity, rel.Column, refs, child.SoftColumn)
+			st := deletionStep{Entity: rel.Entity, Column: rel.Column, Policy: rel.Policy, Refs: refs, Count: len(rows)}
+			if child.Key != "" {
+				mt := s.tables[rel.Entity]
+				for _, i := range rows {
+					st.IDs = append(st.IDs, fmt.Sprint(mt.table.FieldMap[child.Key].Value(mt.rows[i].Elem()).Interface()))
+				}
+			}
+			return st, nil
+		})
+		return err
+	})
+	return plan, err
+}
+
+func (s *MemoryStore) applyDeletion(ctx context.Context, plan *deletionPlan) error {
+	return s.do(ctx, func() error {
+		now := time.Now()
+		softDelete := func(name string, column string, values []string, soft string) {
+			mt := s.tables[name]
+			for _, i := range s.rowsWhere(name, column, values, soft) {
+				row := cloneRow(mt.rows[i])
+				setTime(mt.table.FieldMap[soft].Value(row.Elem()), now)
+				mt.rows[i] = row
+			}
+		}
+		for _, st := range plan.Steps {
+			switch st.Policy {
+			case DeleteCascade:
+				softDelete(st.Entity, st.Column, st.Refs, deleteEntities[st.Entity].SoftColumn)
+			case DeleteDetach:
+				mt := s.tables[st.Entity]
+				gone := s.rowsWhere(st.Entity, st.Column, st.Refs, "")
+				rows := []reflect.Value{}
+				for i, row := range mt.rows {
+					if !slices.Contains(gone, i) {
+						rows = append(rows, row)
+					}
+				}
+				mt.rows = rows
+			}
+		}
+		root := deleteEntities[plan.Entity]
+		softDelete(plan.Entity, root.Key, []string{plan.ID}, root.SoftColumn)
+		return nil
+	})
+}
+
+func (s *MemoryStore) sumLedger(ctx context.Context, studentIDs []string, accounts []string) ([]ledgerSum, error) {
+	sums := []ledgerSum{}
+	err := s.do(ctx, func() error {
+		at := map[[2]string]int{}
+		for _, row := range s.table(modelTable[models.LedgerEntries]()).rows {
+			e := row.Interface().(*models.LedgerEntries)
+			if e.StudentID == nil || !slices.Contains(studentIDs, *e.StudentID) || !slices.Contains(accounts, e.Account) {
+				continue
+			}
+			key := [2]string{*e.StudentID, e.Account}
+			i, ok := at[key]
+			if !ok {
+				i = len(sums)
+				at[key] = i
+				sums = append(sums, ledgerSum{StudentID: *e.StudentID, Account: e.Account})
+			}
+			sums[i].Net += e.Debit - e.Credit
+		}
+		return nil
+	})
+	return sums, err
+}
+
+// load returns a copy of row joined with relations
+func (s *MemoryStore) load(t *schema.Table, row reflect.Value, relations ...string) (reflect.Value, error) {
+	v := cloneRow(row)
+	for _, rel := range relations {
+		if err := s.join(t, v.Elem(), rel); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// join sets the relation named by path, such as Student.User, on the struct v
+// of t
+func (s *MemoryStore) join(t *schema.Table, v reflect.Value, path string) error {
+	name, rest, _ := strings.Cut(path, ".")
+	rel, ok := t.Relations[name]
+	if !ok {
+		return fmt.Errorf("%s has no relation %s", t.Name, name)
+	}
+	fv := rel.Field.Value(v)
+	if rest == "" && !fv.IsZero() {
+		return nil
+	}
+
+	related := []reflect.Value{}
+	switch rel.Type {
+	case schema.HasOneRelation, schema.BelongsToRelation, schema.HasManyRelation:
+		related = s.matching(rel.JoinTable, rel.JoinPKs, fieldValues(v, rel.BasePKs))
+	case schema.ManyToManyRelation:
+		for _, link := range s.matching(rel.M2MTable, rel.M2MBasePKs, fieldValues(v, rel.BasePKs)) {
+			related = append(related, s.matching(rel.JoinTable, rel.JoinPKs, fieldValues(link.Elem(), rel.M2MJoinPKs))...)
+		}
+	}
+	for i, r := range related {
+		related[i] = cloneRow(r)
+		if rest != "" {
+			if err := s.join(rel.JoinTable, related[i].Elem(), rest); err != nil {
+				return err
+			}
+		}
+	}
+
+	if fv.Kind() != reflect.Slice {
+		if len(related) > 0 {
+			fv.Set(related[0])
+		}
+		return nil
+	}
+	items := reflect.MakeSlice(fv.Type(), 0, len(related))
+	for _, r := range related {
+		if fv.Type().Elem().Kind() != reflect.Pointer {
+			r = r.Elem()
+		}
+		items = reflect.Append(items, r)
+	}
+	fv.Set(items)
+	return nil
+}
+
+// matching returns the live rows of t whose fields hold values
+func (s *MemoryStore) matching(t *schema.Table, fields []*schema.Field, values []reflect.Value) []reflect.Value {
+	for _, v := range values {
+		if isNullValue(v) {
+			return nil
+		}
+	}
+	found := []reflect.Value{}
+	for _, row := range s.table(t).rows {
+		if !isLive(t, row.Elem()) {
+			continue
+		}
+		if equalValues(fieldValues(row.Elem(), fields), values) {
+			found = append(found, row)
+		}
+	}
+	return found
+}
+
+// check fails with the constraint row breaks in t, skipping the row at
+// position self
+func (s *MemoryStore) check(t *schema.Table, row reflect.Value, self int) error {
+	v := row.Elem()
+	for i, other := range s.table(t).rows {
+		if i == self {
+			continue
+		}
+		if equalValues(fieldValues(other.Elem(), t.PKs), fieldValues(v, t.PKs)) {
+			return &constraintError{code: pgUniqueViolation, columns: fieldNames(t.PKs)}
+		}
+		for _, c := range memoryUniques[t.Name] {
+			f := t.FieldMap[c]
+			if !isNullValue(f.Value(v)) && dto.CompareValues(f.Value(other.Elem()), f.Value(v)) == 0 {
+				return &constraintError{code: pgUniqueViolation, columns: []string{c}}
+			}
+		}
+	}
+	for _, rel := range t.Relations {
+		if rel.Type != schema.BelongsToRelation {
+			continue
+		}
+		values := fieldValues(v, rel.BasePKs)
+		if slices.ContainsFunc(values, isNullValue) {
+			continue
+		}
+		found := slices.ContainsFunc(s.table(rel.JoinTable).rows, func(r reflect.Value) bool {
+			return equalValues(fieldValues(r.Elem(), rel.JoinPKs), values)
+		})
+		if !found {
+			return &constraintError{code: pgForeignKeyViolation, columns: fieldNames(rel.BasePKs)}
+		}
+	}
+	return nil
+}
+
+// memoryRepository is the Repository of M in a MemoryStore
+type memoryRepository[M any] struct {
+	store *MemoryStore
+	table *schema.Table
+}
+
+func newMemoryRepository[M any](store *MemoryStore) *memoryRepository[M] {
+	return &memoryRepository[M]{store: store, table: modelTable[M]()}
+}
+
+// find returns the position of the row with the primary key of m, -1 when
+// there is none
+func (r *memoryRepository[M]) find(m *M, live bool) int {
+	key := fieldValues(reflect.ValueOf(m).Elem(), r.table.PKs)
+	for i, row := range r.store.table(r.table).rows {
+		if equalValues(fieldValues(row.Elem(), r.table.PKs), key) {
+			if live && !isLive(r.table, row.Elem()) {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// scanBack copies the columns of row into m, as RETURNING * would
+func (r *memoryRepository[M]) scanBack(m *M, row reflect.Value) {
+	dst := reflect.ValueOf(m).Elem()
+	for _, f := range r.table.Fields {
+		f.Value(dst).Set(f.Value(row.Elem()))
+	}
+}
+
+// match returns every live row matching the search, filters and columns of
+// spec, joined with its relations
+func (r *memoryRepository[M]) match(spec ListSpec) ([]M, error) {
+	search, err := r.expressions(spec.Search)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]memoryFilter, len(spec.Filters))
+	for i, f := range spec.Filters {
+		exprs, err := r.expressions([]string{f.Field})
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = memoryFilter{Filter: f, expr: exprs[0]}
+	}
+	term := normalizeSearch(strings.TrimSpace(spec.Params.Search))
+
+	rows := []M{}
+	for _, stored := range r.store.table(r.table).rows {
+		if !isLive(r.table, stored.Elem()) {
+			continue
+		}
+		row, err := r.store.load(r.table, stored, spec.Relations...)
+		if err != nil {
+			return nil, err
+		}
+		v := row.Elem()
+		keep := true
+		for c, want := range spec.Where {
+			f, ok := r.table.FieldMap[c]
+			keep = keep && ok && whereKeeps(f.Value(v), want)
+		}
+		for _, f := range filters {
+			ok, err := f.keeps(v)
+			if err != nil {
+				return nil, err
+			}
+			keep = keep && ok
+		}
+		if keep && term != "" && len(search) > 0 {
+			relevance := 0.0
+			for _, e := range search {
+				text := normalizeSearch(e.text(v))
+				if text != "" && strings.Contains(text, term) {
+					relevance = max(relevance, float64(len(term))/float64(len(text)))
+				}
+			}
+			keep = relevance > 0
+			if f, ok := r.table.FieldMap["relevance"]; ok {
+				f.Value(v).SetFloat(relevance)
+			}
+		}
+		if keep {
+			rows = append(rows, v.Interface().(M))
+		}
+	}
+	return rows, nil
+}
+
+func (r *memoryRepository[M]) List(ctx context.Context, spec ListSpec) (*RowPage[M], error) {
+	var res *RowPage[M]
+	err := r.store.do(ctx, func() error {
+		page, err := dto.NewPage[M](tags, spec.Params)
+		if err != nil {
+			return err
+		}
+		rows, err := r.match(spec)
+		if err != nil {
+			return err
+		}
+		rows = page.Slice(rows)
+		res = &RowPage[M]{More: len(rows) > spec.Params.PerPage}
+		res.Rows, res.Cursors = page.Trim(rows)
+		return nil
+	})
+	return res, err
+}
+
+func (r *memoryRepository[M]) Count(ctx context.Context, spec ListSpec) (int, error) {
+	n := 0
+	err := r.store.do(ctx, func() error {
+		rows, err := r.match(spec)
+		n = len(rows)
+		return err
+	})
+	return n, err
+}
+
+func (r *memoryRepository[M]) Get(ctx context.Context, m *M, relations ...string) error {
+	return r.store.do(ctx, func() error {
+		i := r.find(m, true)
+		if i < 0 {
+			return sql.ErrNoRows
+		}
+		row, err := r.store.load(r.table, r.store.table(r.table).rows[i], relations...)
+		if err != nil {
+			return err
+		}
+		*m = row.Elem().Interface().(M)
+		return nil
+	})
+}
+
+func (r *memoryRepository[M]) GetBy(ctx context.Context, m *M, column string, value any) error {
+	f, ok := r.table.FieldMap[column]
+	if !ok {
+		return fmt.Errorf("%s has no column %s", r.table.Name, column)
+	}
+	return r.store.do(ctx, func() error {
+		for _, row := range r.store.table(r.table).rows {
+			if isLive(r.table, row.Elem()) && dto.CompareValues(f.Value(row.Elem()), reflect.ValueOf(value)) == 0 {
+				*m = cloneRow(row).Elem().Interface().(M)
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+}
+
+// Lock is Get, the store only runs one unit of work at a time
+func (r *memoryRepository[M]) Lock(ctx context.Context, m *M, relations ...string) error {
+	return r.Get(ctx, m, relations...)
+}
+
+func (r *memoryRepository[M]) Insert(ctx context.Context, m *M) error {
+	return r.store.do(ctx, func() error { return r.insert(m) })
+}
+
+func (r *memoryRepository[M]) insert(m *M) error {
+	row := cloneRow(reflect.ValueOf(m))
+	v := row.Elem()
+	// only columns are stored
+	for _, rel := range r.table.Relations {
+		rel.Field.Value(v).SetZero()
+	}
+	for _, f := range r.table.FieldMap {
+		if f.Tag.HasOption("scanonly") {
+			f.Value(v).SetZero()
+		}
+	}
+	now := time.Now()
+	for _, f := range r.table.Fields {
+		fv := f.Value(v)
+		switch {
+		case !fv.IsZero() || f.IsPtr:
+		case f.SQLDefault == "current_timestamp":
+			setTime(fv, now)
+		case f.SQLDefault == "1" && fv.CanInt():
+			fv.SetInt(1)
+		}
+	}
+	if err := r.store.check(r.table, row, -1); err != nil {
+		return err
+	}
+	mt := r.store.table(r.table)
+	mt.rows = append(mt.rows, row)
+	r.scanBack(m, row)
+	return nil
+}
+
+func (r *memoryRepository[M]) Revive(ctx context.Context, m *M, columns ...string) error {
+	return r.store.do(ctx, func() error {
+		i := r.find(m, false)
+		if i < 0 {
+			return r.insert(m)
+		}
+		mt := r.store.table(r.table)
+		if isLive(r.table, mt.rows[i].Elem()) {
+			return &constraintError{code: pgUniqueViolation}
+		}
+		row := cloneRow(mt.rows[i])
+		v := row.Elem()
+		for _, c := range columns {
+			f := r.table.FieldMap[c]
+			f.Value(v).Set(f.Value(reflect.ValueOf(m).Elem()))
+		}
+		r.table.SoftDeleteField.Value(v).SetZero()
+		now := time.Now()
+		for _, c := range []string{"created_at", "updated_at"} {
+			if f, ok := r.table.FieldMap[c]; ok {
+				setTime(f.Value(v), now)
+			}
+		}
+		if err := r.store.check(r.table, row, i); err != nil {
+			return err
+		}
+		mt.rows[i] = row
+		r.scanBack(m, row)
+		return nil
+	})
+}
+
+func (r *memoryRepository[M]) Update(ctx context.Context, m *M, columns ...string) error {
+	return r.store.do(ctx, func() error {
+		i := r.find(m, true)
+		if i < 0 {
+			return sql.ErrNoRows
+		}
+		mt := r.store.table(r.table)
+		if len(columns) == 0 {
+			r.scanBack(m, mt.rows[i])
+			return nil
+		}
+		row := cloneRow(mt.rows[i])
+		v := row.Elem()
+		for _, c := range columns {
+			f, ok := r.table.FieldMap[c]
+			if !ok {
+				return fmt.Errorf("%s has no column %s", r.table.Name, c)
+			}
+			f.Value(v).Set(f.Value(reflect.ValueOf(m).Elem()))
+		}
+		if f, ok := r.table.FieldMap["updated_at"]; ok {
+			setTime(f.Value(v), time.Now())
+		}
+		// as the bump_row_version trigger does
+		if f, ok := r.table.FieldMap["version"]; ok {
+			f.Value(v).SetInt(f.Value(v).Int() + 1)
+		}
+		if err := r.store.check(r.table, row, i); err != nil {
+			return err
+		}
+		mt.rows[i] = row
+		r.scanBack(m, row)
+		return nil
+	})
+}
+
+func (r *memoryRepository[M]) Delete(ctx context.Context, m *M) error {
+	return r.store.do(ctx, func() error {
+		i := r.find(m, true)
+		if i < 0 {
+			return sql.ErrNoRows
+		}
+		mt := r.store.table(r.table)
+		if soft := r.table.SoftDeleteField; soft != nil {
+			row := cloneRow(mt.rows[i])
+			setTime(soft.Value(row.Elem()), time.Now())
+			mt.rows[i] = row
+			return nil
+		}
+		mt.rows = slices.Delete(mt.rows, i, i+1)
+		return nil
+	})
+}
+
+// memoryColumn matches the columns referenced by the expressions given to a
+// memory repository, as ?TableAlias.name, "alias".name or alias.name
+var memoryColumn = regexp.MustCompile(`(\?TableAlias|"\w+"|\b\w+)\.(\w+)`)
+
+// memoryExpr is a search or filter expression, read as its columns joined
+// with spaces. Function calls around the columns are ignored.
+type memoryExpr []memoryRef
+
+// memoryRef is a column of the model or of a relation joined to it
+type memoryRef struct {
+	path  []*schema.Relation
+	field *schema.Field
+}
+
+// expressions resolves the columns of the SQL expressions exprs. Aliases are
+// the ones of bun, student__user for the relation Student.User.
+func (r *memoryRepository[M]) expressions(exprs []string) ([]memoryExpr, error) {
+	res := make([]memoryExpr, len(exprs))
+	for i, e := range exprs {
+		for _, m := range memoryColumn.FindAllStringSubmatch(e, -1) {
+			alias := strings.Trim(m[1], `"`)
+			t := r.table
+			ref := memoryRef{}
+			if alias != "?TableAlias" && alias != string(t.Alias) {
+				for _, name := range strings.Split(alias, "__") {
+					rel := findRelation(t, name)
+					if rel == nil {
+						return nil, fmt.Errorf("%s has no relation %s", t.Name, name)
+					}
+					ref.path = append(ref.path, rel)
+					t = rel.JoinTable
+				}
+			}
+			f, ok := t.FieldMap[m[2]]
+			if !ok {
+				return nil, fmt.Errorf("%s has no column %s", t.Name, m[2])
+			}
+			ref.field = f
+			res[i] = append(res[i], ref)
+		}
+		if len(res[i]) == 0 {
+			return nil, fmt.Errorf("expression %q has no columns", e)
+		}
+	}
+	return res, nil
+}
+
+func findRelation(t *schema.Table, name string) *schema.Relation {
+	for _, rel := range t.Relations {
+		if rel.Field.Name == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// value is the value of ref in the struct v, invalid when a relation on the
+// way is missing
+func (ref memoryRef) value(v reflect.Value) reflect.Value {
+	for _, rel := range ref.path {
+		fv := rel.Field.Value(v)
+		if fv.Kind() != reflect.Pointer || fv.IsNil() {
+			return reflect.Value{}
+		}
+		v = fv.Elem()
+	}
+	return ref.field.Value(v)
+}
+
+// text joins the values of the columns of e that aren't null
+func (e memoryExpr) text(v reflect.Value) string {
+	parts := []string{}
+	for _, ref := range e {
+		if fv := ref.value(v); !isNullValue(fv) {
+			parts = append(parts, fmt.Sprint(reflect.Indirect(fv).Interface()))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// memoryFilter evaluates a filter the way its SQL would, comparisons with
+// null keeping nothing
+type memoryFilter struct {
+	dto.Filter
+	expr memoryExpr
+}
+
+func (f memoryFilter) keeps(v reflect.Value) (bool, error) {
+	var fv reflect.Value
+	if len(f.expr) == 1 {
+		fv = f.expr[0].value(v)
+	} else {
+		fv = reflect.ValueOf(f.expr.text(v))
+	}
+	null := isNullValue(fv)
+	compare := func() (int, error) {
+		want, err := dto.ParseValue(reflect.Indirect(fv).Type(), f.Value)
+		if err != nil {
+			return 0, huma.Error422UnprocessableEntity("filters are invalid", &huma.ErrorDetail{
+				Message: err.Error(), Location: "query.filters", Value: f.Value,
+			})
+		}
+		return dto.CompareValues(fv, want), nil
+	}
+	text := func() string {
+		return strings.ToLower(fmt.Sprint(reflect.Indirect(fv).Interface()))
+	}
+
+	switch f.Rule {
+	case "null", "is", "nis", "nnull":
+		is := null
+		if f.Rule == "is" || f.Rule == "nis" {
+			if b, err := dto.ParseValue(reflect.TypeFor[bool](), f.Value); err == nil && !null {
+				is = dto.CompareValues(fv, b) == 0
+			}
+		}
+		return is == (f.Rule == "null" || f.Rule == "is"), nil
+	case "contains", "ncontains":
+		if null {
+			return false, nil
+		}
+		return strings.Contains(text(), strings.ToLower(f.Value)) == (f.Rule == "contains"), nil
+	case "in", "nin":
+		if null {
+			return false, nil
+		}
+		in := false
+		for _, item := range strings.Split(strings.Trim(f.Value, "()[] "), ",") {
+			want, err := dto.ParseValue(reflect.Indirect(fv).Type(), strings.Trim(item, ` '"`))
+			in = in || (err == nil && dto.CompareValues(fv, want) == 0)
+		}
+		return in == (f.Rule == "in"), nil
+	case "eq", "ne", "gt", "gte", "lt", "lte":
+		if null {
+			return false, nil
+		}
+		c, err := compare()
+		if err != nil {
+			return false, err
+		}
+		switch f.Rule {
+		case "eq":
+			return c == 0, nil
+		case "ne":
+			return c != 0, nil
+		case "gt":
+			return c > 0, nil
+		case "gte":
+			return c >= 0, nil
+		case "lt":
+			return c < 0, nil
+		}
+		return c <= 0, nil
+	}
+	return true, nil
+}
+
+// whereKeeps reports whether the column value v is want, or one of its
+// values for lists
+func whereKeeps(v reflect.Value, want any) bool {
+	if !isList(want) {
+		return dto.CompareValues(v, reflect.ValueOf(want)) == 0
+	}
+	list := reflect.ValueOf(want)
+	for i := range list.Len() {
+		if dto.CompareValues(v, list.Index(i)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneRow copies the struct row points to
+func cloneRow(row reflect.Value) reflect.Value {
+	c := reflect.New(row.Type().Elem())
+	c.Elem().Set(row.Elem())
+	return c
+}
+
+// isLive reports whether the struct v of t isn't soft-deleted
+func isLive(t *schema.Table, v reflect.Value) bool {
+	return t.SoftDeleteField == nil || isNullValue(t.SoftDeleteField.Value(v))
+}
+
+// isNullValue reports whether v would be stored as NULL, zero times
+// included as the models mark them nullzero
+func isNullValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return true
+		}
+	}
+	t, ok := reflect.Indirect(v).Interface().(time.Time)
+	return ok && t.IsZero()
+}
+
+func setTime(v reflect.Value, t time.Time) {
+	if v.Kind() == reflect.Pointer {
+		v.Set(reflect.ValueOf(&t))
+		return
+	}
+	v.Set(reflect.ValueOf(t))
+}
+
+func fieldValues(v reflect.Value, fields []*schema.Field) []reflect.Value {
+	values := make([]reflect.Value, len(fields))
+	for i, f := range fields {
+		values[i] = f.Value(v)
+	}
+	return values
+}
+
+func fieldNames(fields []*schema.Field) []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func equalValues(a, b []reflect.Value) bool {
+	for i := range a {
+		if isNullValue(a[i]) || dto.CompareValues(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeSearch lowers s and strips its accents, like search_normalize
+func normalizeSearch(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		out = s
+	}
+	return strings.ToLower(out)
+}
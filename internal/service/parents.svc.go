@@ -2,89 +2,71 @@ package service
 
 import (
 	"context"
-	"strings"
+	"io"
+	"slices"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 )
 
 type ParentsService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.Parents, dto.ParentModelRes]
 }
 
-func NewParentsService(db *bun.DB) (*ParentsService, error) {
+func NewParentsService(store Store) (*ParentsService, error) {
 	log := logging.L().With().Str("service", "parents.svc").Logger()
-	db.RegisterModel(&models.StudentParents{})
-	return &ParentsService{log: log, db: db}, nil
+	s := &ParentsService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.Parents, dto.ParentModelRes]{
+		Relations: []string{"User"},
+		Search:    dto.JoinedUserSearchColumns,
+		Filters:   withUserFilters(`"user"`, map[string]string{"user_id": "?TableAlias.user_id"}),
+		Columns:   parentColumns,
+		ToRes:     s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *ParentsService) GetParents(ctx context.Context, params *dto.ListParentsReq) (*dto.ListParentsRes, error) {
-	total, err := s.db.NewSelect().Model((*models.Parents)(nil)).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
-	var parents []models.Parents
-	res := &dto.ListParentsRes{
-		Body: dto.ListParentsResBody{
-			Total:     0,
-			ListQuery: params.ListQuery,
-			Parents:   nil,
-		},
-	}
-	res.Body.Total = total
-
-	q := s.db.NewSelect().Model(&parents).Relation("User")
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("user_id ILIKE ?", search)
-	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListParentsRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Parents = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &parents); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+var parentColumns = slices.Concat(
+	[]spreadsheet.Column[models.Parents]{
+		{Name: "id", Value: func(m *models.Parents) any { return m.ParentID }},
+	},
+	userColumns("", func(m *models.Parents) *models.Users { return m.User }),
+	[]spreadsheet.Column[models.Parents]{
+		{Name: "created_at", Value: func(m *models.Parents) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Parents) any { return m.UpdatedAt }},
+	},
+)
 
-	resParents := []dto.ParentModelRes{}
-	for _, par := range parents {
-		newParent := dto.ParentModelRes{
-			ID:     par.ParentID,
-			UserID: par.UserID,
-			UserModelRes: dto.UserModelRes{
-				ID:          par.User.UserID,
-				Username:    par.User.Username,
-				Email:       par.User.Email,
-				FirstName:   par.User.FirstName,
-				FamilyName:  par.User.FamilyName,
-				PhoneNumber: par.User.PhoneNumber,
-				DateOfBirth: par.User.DateOfBirth,
-			},
-			CreatedAt: int(par.CreatedAt.Unix()),
-			UpdatedAt: int(par.UpdatedAt.Unix()),
-		}
-		resParents = append(resParents, newParent)
-	}
-	res.Body.Parents = resParents
-	return res, nil
+// ExportParents writes every parent matching params to w
+func (s *ParentsService) ExportParents(ctx context.Context, params *dto.ListParentsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *ParentsService) GetParentByID(ctx context.Context, id string) (*dto.ParentModelRes, error) {
 	m := models.Parents{ParentID: id}
-	if err := s.db.NewSelect().Model(&m).Relation("User").Relation("Students").WherePK("id").Scan(ctx); err != nil {
-		s.log.Err(err).Msg("Couldn't get parent")
-		return nil, huma.Error404NotFound("parent not found")
+	if err := s.crud.Get(ctx, &m, "Students"); err != nil {
+		return nil, err
 	}
-
 	// Convert students to DTO
 	students := []dto.GetStudentResBody{}
 	if m.Students != nil {
@@ -99,10 +81,8 @@ func (s *ParentsService) GetParentByID(ctx context.Context, id string) (*dto.Par
 			students = append(students, newStudent)
 		}
 	}
-
 	res := s.ModelToRes(&m)
 	res.Students = students
-
 	return res, nil
 }
 
@@ -114,34 +94,27 @@ func (s *ParentsService) CreateParent(ctx context.Context, userID string) (*mode
 		ParentID: userID,
 		UserID:   userID,
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert parent")
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *ParentsService) UpdateParent(ctx context.Context, parent models.Parents) (*models.Parents, error) {
+func (s *ParentsService) UpdateParent(ctx context.Context, parent models.Parents, patch dto.Patch) (*models.Parents, error) {
 	m := parent
-	m.ParentID = parent.ParentID
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("parent not found")
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Update(ctx, &m, patch); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
 func (s *ParentsService) DeleteParent(ctx context.Context, id string) error {
-	m := models.Parents{ParentID: id}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("parent not found")
-		}
-		return huma.Error500InternalServerError(err.Error())
-	}
-	return nil
+	return s.crud.Delete(ctx, &models.Parents{ParentID: id})
+}
+
+// PreviewDeleteParent reports the records deleting the parent would affect
+func (s *ParentsService) PreviewDeleteParent(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
 }
 
 func (s *ParentsService) ModelToRes(m *models.Parents) *dto.ParentModelRes {
@@ -159,6 +132,9 @@ func (s *ParentsService) ModelToRes(m *models.Parents) *dto.ParentModelRes {
 		Students:     nil,
 		UserModelRes: userRes,
 	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
 	}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// PayRatesService keeps what teachers are paid per session or per hour,
+// which payroll runs pay the sessions taught at. See docs/payroll.md.
+type PayRatesService struct {
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.PayRates, dto.PayRateModelRes]
+}
+
+func NewPayRatesService(store Store) (*PayRatesService, error) {
+	log := logging.L().With().Str("service", "pay_rates.svc").Logger()
+	s := &PayRatesService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.PayRates, dto.PayRateModelRes]{
+		Filters: map[string]string{
+			"teacher_id":  "?TableAlias.teacher_id",
+			"group_id":    "?TableAlias.group_id",
+			"basis":       "?TableAlias.basis",
+			"rate":        "?TableAlias.rate",
+			"valid_from":  "?TableAlias.valid_from",
+			"valid_until": "?TableAlias.valid_until",
+		},
+		Columns: payRateColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
+}
+
+func (s *PayRatesService) GetPayRates(ctx context.Context, params *dto.ListPayRatesReq) (*dto.ListPayRatesRes, error) {
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.ListPayRatesRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Rates = l.Items
+	return res, nil
+}
+
+var payRateColumns = []spreadsheet.Column[models.PayRates]{
+	{Name: "id", Value: func(m *models.PayRates) any { return m.RateID }},
+	{Name: "teacher_id", Value: func(m *models.PayRates) any { return cellString(m.TeacherID) }},
+	{Name: "group_id", Value: func(m *models.PayRates) any { return cellString(m.GroupID) }},
+	{Name: "basis", Value: func(m *models.PayRates) any { return m.Basis }},
+	{Name: "rate", Value: func(m *models.PayRates) any { return m.Rate }},
+	{Name: "valid_from", Value: func(m *models.PayRates) any { return cellString(datePtr(m.ValidFrom)) }},
+	{Name: "valid_until", Value: func(m *models.PayRates) any { return cellString(datePtr(m.ValidUntil)) }},
+	{Name: "created_at", Value: func(m *models.PayRates) any { return m.CreatedAt }},
+	{Name: "updated_at", Value: func(m *models.PayRates) any { return m.UpdatedAt }},
+}
+
+// ExportPayRates writes every rate matching params to w
+func (s *PayRatesService) ExportPayRates(ctx context.Context, params *dto.ListPayRatesReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+func (s *PayRatesService) GetPayRateByID(ctx context.Context, id string) (*dto.PayRateModelRes, error) {
+	m := models.PayRates{RateID: id}
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+func (s *PayRatesService) CreatePayRate(ctx context.Context, input dto.CreatePayRateReq) (*dto.PayRateModelRes, error) {
+	in := input.Body
+	m := models.PayRates{
+		RateID:    ulid.Make().String(),
+		TeacherID: in.TeacherID,
+		GroupID:   in.GroupID,
+		Basis:     in.Basis,
+		Rate:      in.Rate,
+	}
+	var err error
+	if m.ValidFrom, err = parseDatePtr(in.ValidFrom, "body.valid_from"); err != nil {
+		return nil, err
+	}
+	if m.ValidUntil, err = parseDatePtr(in.ValidUntil, "body.valid_until"); err != nil {
+		return nil, err
+	}
+	if err := validatePayRate(&m); err != nil {
+		return nil, err
+	}
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// UpdatePayRate applies a merge patch to a rate. Who it is for can't change.
+// Payslips already worked out keep the rate they were paid at.
+func (s *PayRatesService) UpdatePayRate(ctx context.Context, input dto.UpdatePayRateReq) (*dto.PayRateModelRes, error) {
+	in := input.Body
+	m := models.PayRates{RateID: in.ID}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		m = models.PayRates{RateID: in.ID}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		patch := dto.Patch{}
+		dto.PatchValue(&patch, "basis", in.Basis, &m.Basis)
+		dto.PatchValue(&patch, "rate", in.Rate, &m.Rate)
+		var validFrom, validUntil *string
+		dto.PatchPtr(&patch, "valid_from", in.ValidFrom, &validFrom)
+		dto.PatchPtr(&patch, "valid_until", in.ValidUntil, &validUntil)
+		var err error
+		if patch.Has("valid_from") {
+			if m.ValidFrom, err = parseDatePtr(validFrom, "body.valid_from"); err != nil {
+				return err
+			}
+		}
+		if patch.Has("valid_until") {
+			if m.ValidUntil, err = parseDatePtr(validUntil, "body.valid_until"); err != nil {
+				return err
+			}
+		}
+		if err := validatePayRate(&m); err != nil {
+			return err
+		}
+		return s.crud.Update(ctx, &m, patch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// validatePayRate checks m is for someone and pays something
+func validatePayRate(m *models.PayRates) error {
+	invalid := func(location string, message string) error {
+		return huma.Error422UnprocessableEntity("pay rate is invalid", &huma.ErrorDetail{
+			Message: message, Location: location,
+		})
+	}
+	switch {
+	case m.TeacherID == nil && m.GroupID == nil:
+		return invalid("body.teacher_id", "expected a teacher, a group or both")
+	case m.Rate <= 0:
+		return invalid("body.rate", "expected a rate above zero")
+	case m.ValidFrom != nil && m.ValidUntil != nil && m.ValidUntil.Before(*m.ValidFrom):
+		return invalid("body.valid_until", "the rate ends before it starts")
+	}
+	return nil
+}
+
+func (s *PayRatesService) DeletePayRate(ctx context.Context, id string) error {
+	return s.crud.Delete(ctx, &models.PayRates{RateID: id})
+}
+
+func (s *PayRatesService) ModelToRes(m *models.PayRates) *dto.PayRateModelRes {
+	if m == nil {
+		return nil
+	}
+	res := &dto.PayRateModelRes{
+		ID:         m.RateID,
+		TeacherID:  m.TeacherID,
+		GroupID:    m.GroupID,
+		Basis:      m.Basis,
+		Rate:       m.Rate,
+		ValidFrom:  datePtr(m.ValidFrom),
+		ValidUntil: datePtr(m.ValidUntil),
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
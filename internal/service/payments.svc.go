@@ -0,0 +1,426 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// PaymentsService records the money students pay against their issued
+// invoices and reads their balances off the ledger. A payment can cover part
+// of an invoice, and what no invoice needs is kept as credit of the student.
+// See docs/payments.md.
+type PaymentsService struct {
+	store    Store
+	log      zerolog.Logger
+	crud     *resource[models.Payments, dto.PaymentModelRes]
+	journal  *resource[models.LedgerEntries, dto.LedgerEntryRes]
+	invoices Repository[models.Invoices]
+	students Repository[models.Students]
+	ledger   *ledger
+}
+
+func NewPaymentsService(store Store) (*PaymentsService, error) {
+	log := logging.L().With().Str("service", "payments.svc").Logger()
+	s := &PaymentsService{log: log, store: store}
+	s.invoices = NewRepository[models.Invoices](store)
+	s.students = NewRepository[models.Students](store)
+	s.ledger = newLedger(store, log)
+	s.crud = newResource(store, log, resourceSpec[models.Payments, dto.PaymentModelRes]{
+		Entity:    "payment",
+		Relations: []string{"Student.User"},
+		Search:    append(dto.UserSearchColumnsOf(`"student__user"`), "?TableAlias.reference"),
+		Filters: withUserFilters(`"student__user"`, map[string]string{
+			"student_id":  "?TableAlias.student_id",
+			"invoice_id":  "?TableAlias.invoice_id",
+			"method":      "?TableAlias.method",
+			"amount":      "?TableAlias.amount",
+			"reference":   "?TableAlias.reference",
+			"received_at": "?TableAlias.received_at",
+			"recorded_by": "?TableAlias.recorded_by",
+		}),
+		Columns: paymentColumns,
+		ToRes:   s.ModelToRes,
+	})
+	s.journal = newResource(store, log, resourceSpec[models.LedgerEntries, dto.LedgerEntryRes]{
+		Entity: "ledger entry",
+		Filters: map[string]string{
+			"txn_id":     "?TableAlias.txn_id",
+			"account":    "?TableAlias.account",
+			"student_id": "?TableAlias.student_id",
+			"invoice_id": "?TableAlias.invoice_id",
+			"payment_id": "?TableAlias.payment_id",
+			"debit":      "?TableAlias.debit",
+			"credit":     "?TableAlias.credit",
+			"created_at": "?TableAlias.created_at",
+		},
+		Columns: ledgerColumns,
+		ToRes:   ledgerEntryToRes,
+	})
+	return s, nil
+}
+
+// CreatePayment records a payment of a student received by recordedBy. It
+// pays the given invoice, or the open invoices of the student from the
+// oldest, and what is left becomes credit of the student.
+func (s *PaymentsService) CreatePayment(ctx context.Context, recordedBy string, body dto.CreatePaymentReq) (*dto.PaymentModelRes, error) {
+	input := body.Body
+	if input.Amount <= 0 {
+		return nil, huma.Error422UnprocessableEntity("amount is invalid", &huma.ErrorDetail{
+			Message: "expected an amount above zero", Location: "body.amount", Value: input.Amount,
+		})
+	}
+	if _, err := ulid.Parse(input.StudentID); err != nil {
+		return nil, huma.Error422UnprocessableEntity("student_id is invalid", &huma.ErrorDetail{
+			Message: "not a valid ID", Location: "body.student_id", Value: input.StudentID,
+		})
+	}
+	if input.InvoiceID != nil {
+		if _, err := ulid.Parse(*input.InvoiceID); err != nil {
+			return nil, huma.Error422UnprocessableEntity("invoice_id is invalid", &huma.ErrorDetail{
+				Message: "not a valid ID", Location: "body.invoice_id", Value: *input.InvoiceID,
+			})
+		}
+	}
+
+	m := models.Payments{
+		PaymentID:  ulid.Make().String(),
+		StudentID:  input.StudentID,
+		InvoiceID:  input.InvoiceID,
+		Method:     input.Method,
+		Currency:   money.CenterCurrency().Code,
+		Amount:     input.Amount,
+		Reference:  input.Reference,
+		ReceivedAt: time.Now(),
+	}
+	if input.ReceivedAt != nil {
+		m.ReceivedAt = *input.ReceivedAt
+	}
+	if recordedBy != "" {
+		m.RecordedBy = &recordedBy
+	}
+
+	// serializable turns a payment and an issue racing over the credit of
+	// the student into a retried serialization failure
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err := s.store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		if err := s.record(ctx, &m); err != nil {
+			return err
+		}
+		return s.crud.Get(ctx, &m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withAllocations(ctx, &m)
+}
+
+// record inserts the payment m, applies it to its invoice or the open
+// invoices of its student and posts it to the ledger. It runs in the
+// serializable unit of work of the caller.
+func (s *PaymentsService) record(ctx context.Context, m *models.Payments) error {
+	student := models.Students{StudentID: m.StudentID}
+	if err := s.students.Get(ctx, &student); err != nil {
+		return dbError(s.log, err, "student")
+	}
+	open, err := s.openInvoices(ctx, m)
+	if err != nil {
+		return err
+	}
+	if err := s.crud.repo.Insert(ctx, m); err != nil {
+		s.log.Err(err).Str("student_id", m.StudentID).Msg("Couldn't insert payment")
+		return dbError(s.log, err, "payment")
+	}
+
+	t := &txn{memo: m.Method + " payment", studentID: m.StudentID, paymentID: &m.PaymentID}
+	t.add(m.Method, nil, m.Amount, 0)
+	left := m.Amount
+	for _, inv := range open {
+		if left == 0 {
+			break
+		}
+		applied := settle(&inv, left)
+		if applied == 0 {
+			continue
+		}
+		if err := s.invoices.Update(ctx, &inv, settledColumns...); err != nil {
+			return dbError(s.log, err, "invoice")
+		}
+		t.add(models.AccountReceivable, &inv.InvoiceID, 0, applied)
+		left -= applied
+	}
+	t.add(models.AccountCredit, nil, 0, left)
+	return s.ledger.post(ctx, t)
+}
+
+// openInvoices locks the issued invoices of the student the payment goes to,
+// oldest first, or only the invoice of the payment when set
+func (s *PaymentsService) openInvoices(ctx context.Context, p *models.Payments) ([]models.Invoices, error) {
+	studentID, invoiceID := p.StudentID, p.InvoiceID
+	if invoiceID != nil {
+		inv := models.Invoices{InvoiceID: *invoiceID}
+		if err := s.invoices.Lock(ctx, &inv); err != nil {
+			return nil, dbError(s.log, err, "invoice")
+		}
+		if inv.StudentID != studentID {
+			return nil, huma.Error422UnprocessableEntity("invoice_id is invalid", &huma.ErrorDetail{
+				Message: "the invoice bills another student", Location: "body.invoice_id", Value: *invoiceID,
+			})
+		}
+		if inv.Status != models.InvoiceIssued {
+			return nil, huma.Error409Conflict(fmt.Sprintf("invoice is %s, only issued invoices can be paid", inv.Status))
+		}
+		if inv.Currency != p.Currency {
+			return nil, huma.Error409Conflict(fmt.Sprintf("invoice is in %s, payments are in %s", inv.Currency, p.Currency))
+		}
+		return []models.Invoices{inv}, nil
+	}
+
+	invoices, err := listAll(ctx, s.invoices, ListSpec{Where: map[string]any{
+		"student_id": studentID,
+		"status":     models.InvoiceIssued,
+		"currency":   p.Currency,
+	}})
+	if err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	slices.SortFunc(invoices, func(a, b models.Invoices) int {
+		return cmp.Or(a.IssuedAt.Compare(*b.IssuedAt), cmp.Compare(*a.Number, *b.Number))
+	})
+	for i := range invoices {
+		if err := s.invoices.Lock(ctx, &invoices[i]); err != nil {
+			return nil, dbError(s.log, err, "invoice")
+		}
+	}
+	return invoices, nil
+}
+
+// GetPaymentByID returns the payment with the invoices it paid
+func (s *PaymentsService) GetPaymentByID(ctx context.Context, id string) (*dto.PaymentModelRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("paymentID is invalid", err)
+	}
+	m := models.Payments{PaymentID: id}
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
+	}
+	return s.withAllocations(ctx, &m)
+}
+
+// withAllocations returns m with how it was split between invoices and
+// credit, as posted to the ledger
+func (s *PaymentsService) withAllocations(ctx context.Context, m *models.Payments) (*dto.PaymentModelRes, error) {
+	entries, err := listAll(ctx, s.ledger.entries, ListSpec{Where: map[string]any{"payment_id": m.PaymentID}})
+	if err != nil {
+		return nil, dbError(s.log, err, "ledger entry")
+	}
+	res := s.ModelToRes(m)
+	res.Allocations = []dto.PaymentAllocationRes{}
+	credited := money.Amount(0)
+	for _, e := range entries {
+		switch e.Account {
+		case models.AccountReceivable:
+			res.Allocations = append(res.Allocations, dto.PaymentAllocationRes{InvoiceID: *e.InvoiceID, Amount: e.Credit})
+		case models.AccountCredit:
+			credited += e.Credit
+		}
+	}
+	res.Credited = &credited
+	return res, nil
+}
+
+func (s *PaymentsService) GetPayments(ctx context.Context, params *dto.ListPaymentsReq) (*dto.ListPaymentsRes, error) {
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.ListPaymentsRes{Body: paymentsListBody(l, params.ListQuery)}, nil
+}
+
+// ExportPayments writes every payment matching params to w
+func (s *PaymentsService) ExportPayments(ctx context.Context, params *dto.ListPaymentsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+// GetPaymentsByStudentID lists the payments of a student
+func (s *PaymentsService) GetPaymentsByStudentID(ctx context.Context, params *dto.GetPaymentsByStudentIDReq) (*dto.GetPaymentsByStudentIDRes, error) {
+	if _, err := ulid.Parse(params.StudentID); err != nil {
+		return nil, huma.Error400BadRequest("studentID is invalid", err)
+	}
+	l, err := s.crud.List(ctx, params.ListQuery, map[string]any{"student_id": params.StudentID})
+	if err != nil {
+		return nil, err
+	}
+	return &dto.GetPaymentsByStudentIDRes{Body: paymentsListBody(l, params.ListQuery)}, nil
+}
+
+// GetStudentBalance returns what the student owes and their credit
+func (s *PaymentsService) GetStudentBalance(ctx context.Context, id string) (*dto.StudentBalanceRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("studentID is invalid", err)
+	}
+	student := models.Students{StudentID: id}
+	if err := s.students.Get(ctx, &student); err != nil {
+		return nil, dbError(s.log, err, "student")
+	}
+	balances, err := s.ledger.balances(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	res := balanceToRes(id, balances[id])
+	return &res, nil
+}
+
+// GetFamilyBalance returns the balance of every student linked to the parent
+// and their sum
+func (s *PaymentsService) GetFamilyBalance(ctx context.Context, id string) (*dto.FamilyBalanceRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("parentID is invalid", err)
+	}
+	studentIDs, err := childrenOf(ctx, s.store, s.log, id)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := s.ledger.balances(ctx, studentIDs...)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.FamilyBalanceRes{ParentID: id, Currency: money.CenterCurrency().Code, Students: []dto.StudentBalanceRes{}}
+	for _, studentID := range slices.Sorted(slices.Values(studentIDs)) {
+		b := balanceToRes(studentID, balances[studentID])
+		res.Owed += b.Owed
+		res.Credit += b.Credit
+		res.Students = append(res.Students, b)
+	}
+	res.Balance = res.Owed - res.Credit
+	return res, nil
+}
+
+func balanceToRes(studentID string, b studentBalance) dto.StudentBalanceRes {
+	return dto.StudentBalanceRes{
+		StudentID: studentID,
+		Owed:      b.Owed,
+		Credit:    b.Credit,
+		Balance:   b.Owed - b.Credit,
+		Currency:  money.CenterCurrency().Code,
+	}
+}
+
+// GetLedgerEntries lists the entries of the ledger
+func (s *PaymentsService) GetLedgerEntries(ctx context.Context, params *dto.ListLedgerEntriesReq) (*dto.ListLedgerEntriesRes, error) {
+	l, err := s.journal.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.ListLedgerEntriesRes{Body: dto.ListLedgerEntriesResBody{
+		Entries:     l.Items,
+		Total:       l.Total,
+		ListQuery:   l.Query(params.ListQuery),
+		PageCursors: l.Cursors,
+	}}, nil
+}
+
+// ExportLedgerEntries writes every ledger entry matching params to w
+func (s *PaymentsService) ExportLedgerEntries(ctx context.Context, params *dto.ListLedgerEntriesReq, format string, w io.Writer) error {
+	return s.journal.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+func paymentsListBody(l *listing[dto.PaymentModelRes], params dto.ListQuery) dto.ListPaymentsResBody {
+	return dto.ListPaymentsResBody{
+		Payments:    l.Items,
+		Total:       l.Total,
+		ListQuery:   l.Query(params),
+		PageCursors: l.Cursors,
+	}
+}
+
+var paymentColumns = slices.Concat(
+	[]spreadsheet.Column[models.Payments]{
+		{Name: "id", Value: func(m *models.Payments) any { return m.PaymentID }},
+		{Name: "method", Value: func(m *models.Payments) any { return m.Method }},
+		{Name: "currency", Value: func(m *models.Payments) any { return m.Currency }},
+		{Name: "amount", Value: func(m *models.Payments) any { return m.Amount }},
+		{Name: "reference", Value: func(m *models.Payments) any { return cellString(m.Reference) }},
+		{Name: "received_at", Value: func(m *models.Payments) any { return m.ReceivedAt }},
+		{Name: "invoice_id", Value: func(m *models.Payments) any { return cellString(m.InvoiceID) }},
+		{Name: "student_id", Value: func(m *models.Payments) any { return m.StudentID }},
+	},
+	userColumns("student_", func(m *models.Payments) *models.Users {
+		if m.Student == nil {
+			return nil
+		}
+		return m.Student.User
+	}),
+	[]spreadsheet.Column[models.Payments]{
+		{Name: "recorded_by", Value: func(m *models.Payments) any { return cellString(m.RecordedBy) }},
+		{Name: "created_at", Value: func(m *models.Payments) any { return m.CreatedAt }},
+	},
+)
+
+var ledgerColumns = []spreadsheet.Column[models.LedgerEntries]{
+	{Name: "id", Value: func(m *models.LedgerEntries) any { return m.EntryID }},
+	{Name: "txn_id", Value: func(m *models.LedgerEntries) any { return m.TxnID }},
+	{Name: "created_at", Value: func(m *models.LedgerEntries) any { return m.CreatedAt }},
+	{Name: "account", Value: func(m *models.LedgerEntries) any { return m.Account }},
+	{Name: "debit", Value: func(m *models.LedgerEntries) any { return m.Debit }},
+	{Name: "credit", Value: func(m *models.LedgerEntries) any { return m.Credit }},
+	{Name: "student_id", Value: func(m *models.LedgerEntries) any { return cellString(m.StudentID) }},
+	{Name: "invoice_id", Value: func(m *models.LedgerEntries) any { return cellString(m.InvoiceID) }},
+	{Name: "payment_id", Value: func(m *models.LedgerEntries) any { return cellString(m.PaymentID) }},
+	{Name: "memo", Value: func(m *models.LedgerEntries) any { return m.Memo }},
+}
+
+func (s *PaymentsService) ModelToRes(m *models.Payments) *dto.PaymentModelRes {
+	if m == nil {
+		return nil
+	}
+	res := &dto.PaymentModelRes{
+		ID:         m.PaymentID,
+		StudentID:  m.StudentID,
+		InvoiceID:  m.InvoiceID,
+		Method:     m.Method,
+		Currency:   m.Currency,
+		Amount:     m.Amount,
+		Reference:  m.Reference,
+		ReceivedAt: int(m.ReceivedAt.Unix()),
+		RecordedBy: m.RecordedBy,
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
+
+func ledgerEntryToRes(m *models.LedgerEntries) *dto.LedgerEntryRes {
+	return &dto.LedgerEntryRes{
+		ID:        m.EntryID,
+		TxnID:     m.TxnID,
+		Account:   m.Account,
+		StudentID: m.StudentID,
+		InvoiceID: m.InvoiceID,
+		PaymentID: m.PaymentID,
+		Debit:     m.Debit,
+		Credit:    m.Credit,
+		Memo:      m.Memo,
+		CreatedAt: int(m.CreatedAt.Unix()),
+	}
+}
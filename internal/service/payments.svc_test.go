@@ -0,0 +1,163 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/oklog/ulid/v2"
+)
+
+func TestPaymentsRecord(t *testing.T) {
+	// the student owes three invoices, numbered out of the order they
+	// were issued in, the last two on the same day
+	invoices := []struct {
+		n        int
+		issuedAt string
+		total    money.Amount
+	}{
+		{n: 3, issuedAt: "2026-01-05", total: 30000},
+		{n: 2, issuedAt: "2026-02-05", total: 30000},
+		{n: 1, issuedAt: "2026-02-05", total: 40000},
+	}
+	tests := []struct {
+		name    string
+		amount  money.Amount
+		invoice int // index of the invoice paid, -1 to pay the oldest first
+		paid    []money.Amount
+		credit  money.Amount
+	}{
+		{name: "partial", amount: 10000, invoice: -1, paid: []money.Amount{10000, 0, 0}},
+		{name: "oldest first", amount: 45000, invoice: -1, paid: []money.Amount{30000, 0, 15000}},
+		{name: "exactly everything", amount: 100000, invoice: -1, paid: []money.Amount{30000, 30000, 40000}},
+		{name: "overpayment becomes credit", amount: 120000, invoice: -1, paid: []money.Amount{30000, 30000, 40000}, credit: 20000},
+		{name: "given invoice", amount: 10000, invoice: 1, paid: []money.Amount{0, 10000, 0}},
+		{name: "given invoice overpaid", amount: 50000, invoice: 1, paid: []money.Amount{0, 30000, 0}, credit: 20000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			s, err := NewPaymentsService(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			studentID := seedStudent(t, store, "student")
+			var ids []string
+			for _, inv := range invoices {
+				ids = append(ids, seedInvoice(t, store, studentID, inv.n, day(inv.issuedAt), inv.total).InvoiceID)
+			}
+
+			p := models.Payments{
+				PaymentID: ulid.Make().String(),
+				StudentID: studentID,
+				Method:    models.PaymentCash,
+				Currency:  money.CenterCurrency().Code,
+				Amount:    tt.amount,
+			}
+			if tt.invoice >= 0 {
+				p.InvoiceID = &ids[tt.invoice]
+			}
+			err = store.RunInTx(t.Context(), &sql.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+				return s.record(ctx, &p)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, id := range ids {
+				inv := models.Invoices{InvoiceID: id}
+				if err := s.invoices.Get(t.Context(), &inv); err != nil {
+					t.Fatal(err)
+				}
+				if inv.AmountPaid != tt.paid[i] {
+					t.Errorf("invoice %d paid %s, want %s", i, inv.AmountPaid, tt.paid[i])
+				}
+				if wantPaid := tt.paid[i] == invoices[i].total; wantPaid != (inv.Status == models.InvoicePaid) {
+					t.Errorf("invoice %d is %s with %s paid", i, inv.Status, inv.AmountPaid)
+				}
+			}
+
+			entries := checkBalanced(t, store)
+			var cash, receivable, credit money.Amount
+			for _, e := range entries {
+				if e.PaymentID == nil || *e.PaymentID != p.PaymentID {
+					t.Fatalf("entry %+v isn't of the payment", e)
+				}
+				switch e.Account {
+				case models.PaymentCash:
+					cash += e.Debit
+				case models.AccountReceivable:
+					receivable += e.Credit
+				case models.AccountCredit:
+					credit += e.Credit
+				}
+			}
+			if cash != tt.amount || receivable != tt.amount-tt.credit || credit != tt.credit {
+				t.Fatalf("posted %s cash, %s receivable and %s credit, want %s, %s and %s",
+					cash, receivable, credit, tt.amount, tt.amount-tt.credit, tt.credit)
+			}
+			b, err := s.ledger.balances(t.Context(), studentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b[studentID].Credit != tt.credit {
+				t.Fatalf("credit balance %s, want %s", b[studentID].Credit, tt.credit)
+			}
+		})
+	}
+}
+
+func TestPaymentsRecordRefused(t *testing.T) {
+	store := NewMemoryStore()
+	s, err := NewPaymentsService(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	studentID := seedStudent(t, store, "student")
+	otherID := seedStudent(t, store, "other")
+	inv := seedInvoice(t, store, studentID, 1, day("2026-01-05"), 30000)
+	paid := seedInvoice(t, store, studentID, 2, day("2026-01-05"), 30000)
+	paid.Status = models.InvoicePaid
+	if err := s.invoices.Update(t.Context(), &paid, "status"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		studentID string
+		invoiceID *string
+		currency  string
+	}{
+		{name: "unknown student", studentID: ulid.Make().String()},
+		{name: "invoice of another student", studentID: otherID, invoiceID: &inv.InvoiceID},
+		{name: "paid invoice", studentID: studentID, invoiceID: &paid.InvoiceID},
+		{name: "other currency", studentID: studentID, invoiceID: &inv.InvoiceID, currency: "EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := models.Payments{
+				PaymentID: ulid.Make().String(),
+				StudentID: tt.studentID,
+				InvoiceID: tt.invoiceID,
+				Method:    models.PaymentCash,
+				Currency:  cmp.Or(tt.currency, money.CenterCurrency().Code),
+				Amount:    10000,
+			}
+			err := store.RunInTx(t.Context(), nil, func(ctx context.Context) error {
+				return s.record(ctx, &p)
+			})
+			if err == nil {
+				t.Fatal("recorded the payment, want an error")
+			}
+		})
+	}
+	if entries := checkBalanced(t, store); len(entries) != 0 {
+		t.Fatalf("posted %d entries for refused payments", len(entries))
+	}
+	if err := s.invoices.Get(t.Context(), &inv); err != nil || inv.AmountPaid != 0 {
+		t.Fatalf("invoice paid %s, %v, want nothing paid", inv.AmountPaid, err)
+	}
+}
@@ -0,0 +1,511 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// PayrollService pays teachers for the sessions they taught. A payroll run
+// works out a draft payslip per teacher and period from the group sessions
+// held and the pay rates, adjustments are added by hand, and locking a
+// payslip makes it final. See docs/payroll.md.
+type PayrollService struct {
+	store    Store
+	log      zerolog.Logger
+	crud     *resource[models.Payslips, dto.PayslipModelRes]
+	lines    Repository[models.PayslipLines]
+	sessions Repository[models.GroupSessions]
+	rates    Repository[models.PayRates]
+}
+
+func NewPayrollService(store Store) (*PayrollService, error) {
+	log := logging.L().With().Str("service", "payroll.svc").Logger()
+	s := &PayrollService{log: log, store: store}
+	s.lines = NewRepository[models.PayslipLines](store)
+	s.sessions = NewRepository[models.GroupSessions](store)
+	s.rates = NewRepository[models.PayRates](store)
+	s.crud = newResource(store, log, resourceSpec[models.Payslips, dto.PayslipModelRes]{
+		Entity:    "payslip",
+		Relations: []string{"Teacher.User"},
+		Search:    dto.UserSearchColumnsOf(`"teacher__user"`),
+		Filters: withUserFilters(`"teacher__user"`, map[string]string{
+			"teacher_id":   "?TableAlias.teacher_id",
+			"status":       "?TableAlias.status",
+			"period_start": "?TableAlias.period_start",
+			"period_end":   "?TableAlias.period_end",
+			"sessions":     "?TableAlias.sessions",
+			"gross":        "?TableAlias.gross",
+			"total":        "?TableAlias.total",
+			"locked_at":    "?TableAlias.locked_at",
+		}),
+		Columns: payslipColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
+}
+
+// RunPayroll works out the payslip of every teacher who taught from start to
+// end, or of the given teachers. Each session held in the period, not
+// cancelled and over by now, is paid at the rate covering it. A draft
+// payslip already there is worked out again, keeping its adjustments, and a
+// locked one is left alone, so running twice is harmless.
+func (s *PayrollService) RunPayroll(ctx context.Context, start string, end string, teacherIDs []string) (*dto.RunPayrollResBody, error) {
+	from, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("period_start is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "body.period_start", Value: start,
+		})
+	}
+	to, err := time.Parse(time.DateOnly, end)
+	if err == nil && to.Before(from) {
+		err = errors.New("the period ends before it starts")
+	}
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("period_end is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "body.period_end", Value: end,
+		})
+	}
+	for i, id := range teacherIDs {
+		if _, err := ulid.Parse(id); err != nil {
+			return nil, huma.Error422UnprocessableEntity("teacher_ids are invalid", &huma.ErrorDetail{
+				Message: "not a valid ID", Location: fmt.Sprintf("body.teacher_ids[%d]", i), Value: id,
+			})
+		}
+	}
+
+	res := &dto.RunPayrollResBody{}
+	err = s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		*res = dto.RunPayrollResBody{PayslipIDs: []string{}, Unrated: []dto.UnratedSessionRes{}}
+		spec := ListSpec{Relations: []string{"Group"}}
+		if teacherIDs != nil {
+			spec.Where = map[string]any{"teacher_id": teacherIDs}
+		}
+		sessions, err := listAll(ctx, s.sessions, spec)
+		if err != nil {
+			return dbError(s.log, err, "group session")
+		}
+		now := time.Now()
+		sessions = slices.DeleteFunc(sessions, func(gs models.GroupSessions) bool {
+			day := dateOf(gs.Starts)
+			return gs.CancelledAt != nil || gs.Ends.After(now) || day.Before(from) || day.After(to)
+		})
+		slices.SortFunc(sessions, func(a, b models.GroupSessions) int {
+			return cmp.Or(a.Starts.Compare(b.Starts), cmp.Compare(a.SessionID, b.SessionID))
+		})
+		rates, err := listAll(ctx, s.rates, ListSpec{})
+		if err != nil {
+			return dbError(s.log, err, "pay rate")
+		}
+
+		where := map[string]any{"period_start": from, "period_end": to}
+		if teacherIDs != nil {
+			where["teacher_id"] = teacherIDs
+		}
+		existing, err := listAll(ctx, s.crud.repo, ListSpec{Where: where})
+		if err != nil {
+			return dbError(s.log, err, "payslip")
+		}
+		payslips := map[string]models.Payslips{}
+		for _, p := range existing {
+			payslips[p.TeacherID] = p
+		}
+		// a draft whose sessions were all cancelled since is worked out too
+		byTeacher := map[string][]models.GroupSessions{}
+		for _, p := range existing {
+			byTeacher[p.TeacherID] = nil
+		}
+		for _, gs := range sessions {
+			byTeacher[gs.TeacherID] = append(byTeacher[gs.TeacherID], gs)
+		}
+		for _, teacherID := range slices.Sorted(maps.Keys(byTeacher)) {
+			m, ok := payslips[teacherID]
+			if ok && m.Status == models.PayslipLocked {
+				res.Skipped++
+				continue
+			}
+			if !ok {
+				m = models.Payslips{TeacherID: teacherID, PeriodStart: from, PeriodEnd: to}
+			}
+
+			lines := []models.PayslipLines{}
+			for _, gs := range byTeacher[teacherID] {
+				rate := rateFor(rates, gs)
+				if rate == nil {
+					res.Unrated = append(res.Unrated, dto.UnratedSessionRes{
+						SessionID: gs.SessionID, TeacherID: gs.TeacherID, GroupID: gs.GroupID, Starts: int(gs.Starts.Unix()),
+					})
+					continue
+				}
+				lines = append(lines, sessionLine(gs, rate))
+			}
+
+			if m.PayslipID == "" {
+				m.PayslipID = ulid.Make().String()
+				m.Status = models.PayslipDraft
+				if err := s.crud.repo.Insert(ctx, &m); err != nil {
+					s.log.Err(err).Str("teacher_id", teacherID).Msg("Couldn't insert payslip")
+					return dbError(s.log, err, "payslip")
+				}
+				res.Created++
+			} else {
+				res.Updated++
+			}
+			if err := s.replaceSessionLines(ctx, &m, lines); err != nil {
+				return err
+			}
+			res.PayslipIDs = append(res.PayslipIDs, m.PayslipID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// rateFor returns the rate paying gs: of the rates valid on its day, one
+// for its teacher in its group first, then one for its group, then one for
+// its teacher. Among rates as specific the one starting last wins.
+func rateFor(rates []models.PayRates, gs models.GroupSessions) *models.PayRates {
+	day := dateOf(gs.Starts)
+	var best *models.PayRates
+	bestRank := 0
+	for i, r := range rates {
+		if (r.ValidFrom != nil && r.ValidFrom.After(day)) || (r.ValidUntil != nil && r.ValidUntil.Before(day)) {
+			continue
+		}
+		if (r.TeacherID != nil && *r.TeacherID != gs.TeacherID) || (r.GroupID != nil && *r.GroupID != gs.GroupID) {
+			continue
+		}
+		rank := 1
+		switch {
+		case r.TeacherID != nil && r.GroupID != nil:
+			rank = 3
+		case r.GroupID != nil:
+			rank = 2
+		}
+		if best == nil || rank > bestRank || (rank == bestRank && laterRate(r, *best)) {
+			best, bestRank = &rates[i], rank
+		}
+	}
+	return best
+}
+
+// laterRate tells whether a starts after b, a rate without a start coming
+// first, and the one created last otherwise
+func laterRate(a, b models.PayRates) bool {
+	switch {
+	case a.ValidFrom == nil && b.ValidFrom == nil:
+	case a.ValidFrom == nil:
+		return false
+	case b.ValidFrom == nil:
+		return true
+	case !a.ValidFrom.Equal(*b.ValidFrom):
+		return a.ValidFrom.After(*b.ValidFrom)
+	}
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.RateID, b.RateID)) > 0
+}
+
+// sessionLine pays gs at rate, per session or per minute taught
+func sessionLine(gs models.GroupSessions, rate *models.PayRates) models.PayslipLines {
+	minutes := int(gs.Ends.Sub(gs.Starts).Minutes())
+	amount := rate.Rate
+	if rate.Basis == models.PerHour {
+		amount = rate.Rate.Share(minutes, 60)
+	}
+	description := gs.GroupID
+	if gs.Group != nil && gs.Group.Name != "" {
+		description = gs.Group.Name
+	}
+	return models.PayslipLines{
+		Kind:        models.LineSession,
+		SessionID:   &gs.SessionID,
+		GroupID:     &gs.GroupID,
+		PayRateID:   &rate.RateID,
+		Description: description,
+		Starts:      &gs.Starts,
+		Minutes:     &minutes,
+		Basis:       &rate.Basis,
+		Rate:        &rate.Rate,
+		Amount:      amount,
+	}
+}
+
+// replaceSessionLines swaps the session lines of m for lines, keeping its
+// adjustments after them, and saves the totals
+func (s *PayrollService) replaceSessionLines(ctx context.Context, m *models.Payslips, lines []models.PayslipLines) error {
+	old, err := listAll(ctx, s.lines, ListSpec{Where: map[string]any{"payslip_id": m.PayslipID}})
+	if err != nil {
+		return dbError(s.log, err, "payslip line")
+	}
+	adjustments := []models.PayslipLines{}
+	for i := range old {
+		if old[i].Kind == models.LineAdjustment {
+			adjustments = append(adjustments, old[i])
+			continue
+		}
+		if err := s.lines.Delete(ctx, &old[i]); err != nil {
+			return dbError(s.log, err, "payslip line")
+		}
+	}
+	slices.SortFunc(adjustments, func(a, b models.PayslipLines) int { return cmp.Compare(a.Position, b.Position) })
+
+	m.Sessions, m.Minutes, m.Gross = 0, 0, 0
+	for i := range lines {
+		l := &lines[i]
+		l.LineID = ulid.Make().String()
+		l.PayslipID = m.PayslipID
+		l.Position = i + 1
+		if err := s.lines.Insert(ctx, l); err != nil {
+			return dbError(s.log, err, "payslip line")
+		}
+		m.Sessions++
+		m.Minutes += *l.Minutes
+		m.Gross += l.Amount
+	}
+	for i := range adjustments {
+		adjustments[i].Position = len(lines) + i + 1
+		if err := s.lines.Update(ctx, &adjustments[i], "position"); err != nil {
+			return dbError(s.log, err, "payslip line")
+		}
+	}
+	return s.saveTotals(ctx, m, adjustments)
+}
+
+// saveTotals sums the adjustments into m and saves its totals, refusing a
+// payslip paying less than nothing
+func (s *PayrollService) saveTotals(ctx context.Context, m *models.Payslips, adjustments []models.PayslipLines) error {
+	m.Adjusted = 0
+	for _, a := range adjustments {
+		m.Adjusted += a.Amount
+	}
+	m.Total = m.Gross + m.Adjusted
+	if m.Total < 0 {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("payslip would pay %v, the adjustments take more than the sessions pay", m.Total))
+	}
+	if err := s.crud.repo.Update(ctx, m, "sessions", "minutes", "gross", "adjusted", "total"); err != nil {
+		return dbError(s.log, err, "payslip")
+	}
+	return nil
+}
+
+// GetPayslipByID returns the payslip with its lines
+func (s *PayrollService) GetPayslipByID(ctx context.Context, id string) (*dto.PayslipModelRes, error) {
+	m := models.Payslips{PayslipID: id}
+	if err := s.crud.Get(ctx, &m, "Lines"); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// changeDraft runs change on the draft payslip id, held meanwhile, and
+// returns the payslip after it. Locked payslips are a 409.
+func (s *PayrollService) changeDraft(ctx context.Context, id string, change func(ctx context.Context, m *models.Payslips) error) (*dto.PayslipModelRes, error) {
+	if _, err := ulid.Parse(id); err != nil {
+		return nil, huma.Error400BadRequest("payslipID is invalid", err)
+	}
+	m := models.Payslips{PayslipID: id}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		m = models.Payslips{PayslipID: id}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		if m.Status != models.PayslipDraft {
+			return huma.Error409Conflict(fmt.Sprintf("payslip is %s, only draft payslips can change", m.Status))
+		}
+		if err := change(ctx, &m); err != nil {
+			return err
+		}
+		return s.crud.Get(ctx, &m, "Lines")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// adjustments returns the adjustment lines of m
+func (s *PayrollService) adjustments(ctx context.Context, m *models.Payslips) ([]models.PayslipLines, int, error) {
+	lines, err := listAll(ctx, s.lines, ListSpec{Where: map[string]any{"payslip_id": m.PayslipID}})
+	if err != nil {
+		return nil, 0, dbError(s.log, err, "payslip line")
+	}
+	last := 0
+	adjustments := []models.PayslipLines{}
+	for _, l := range lines {
+		last = max(last, l.Position)
+		if l.Kind == models.LineAdjustment {
+			adjustments = append(adjustments, l)
+		}
+	}
+	return adjustments, last, nil
+}
+
+// AddAdjustment adds a bonus, or a deduction when amount is negative, to a
+// draft payslip
+func (s *PayrollService) AddAdjustment(ctx context.Context, id string, description string, amount money.Amount) (*dto.PayslipModelRes, error) {
+	if amount == 0 {
+		return nil, huma.Error422UnprocessableEntity("amount is invalid", &huma.ErrorDetail{
+			Message: "expected an amount other than zero", Location: "body.amount", Value: amount,
+		})
+	}
+	return s.changeDraft(ctx, id, func(ctx context.Context, m *models.Payslips) error {
+		adjustments, last, err := s.adjustments(ctx, m)
+		if err != nil {
+			return err
+		}
+		line := models.PayslipLines{
+			LineID:      ulid.Make().String(),
+			PayslipID:   m.PayslipID,
+			Position:    last + 1,
+			Kind:        models.LineAdjustment,
+			Description: description,
+			Amount:      amount,
+		}
+		if err := s.lines.Insert(ctx, &line); err != nil {
+			return dbError(s.log, err, "payslip line")
+		}
+		return s.saveTotals(ctx, m, append(adjustments, line))
+	})
+}
+
+// RemoveAdjustment takes an adjustment off a draft payslip
+func (s *PayrollService) RemoveAdjustment(ctx context.Context, id string, lineID string) (*dto.PayslipModelRes, error) {
+	return s.changeDraft(ctx, id, func(ctx context.Context, m *models.Payslips) error {
+		adjustments, _, err := s.adjustments(ctx, m)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(adjustments, func(l models.PayslipLines) bool { return l.LineID == lineID })
+		if i < 0 {
+			return huma.Error404NotFound("adjustment not found")
+		}
+		if err := s.lines.Delete(ctx, &adjustments[i]); err != nil {
+			return dbError(s.log, err, "payslip line")
+		}
+		return s.saveTotals(ctx, m, slices.Delete(adjustments, i, i+1))
+	})
+}
+
+// LockPayslip makes a draft payslip final: payroll runs leave it alone and
+// its adjustments can't change
+func (s *PayrollService) LockPayslip(ctx context.Context, id string) (*dto.PayslipModelRes, error) {
+	return s.changeDraft(ctx, id, func(ctx context.Context, m *models.Payslips) error {
+		now := time.Now()
+		m.Status = models.PayslipLocked
+		m.LockedAt = &now
+		if err := s.crud.repo.Update(ctx, m, "status", "locked_at"); err != nil {
+			return dbError(s.log, err, "payslip")
+		}
+		return nil
+	})
+}
+
+func (s *PayrollService) GetPayslips(ctx context.Context, params *dto.ListPayslipsReq) (*dto.ListPayslipsRes, error) {
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.ListPayslipsRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Payslips = l.Items
+	return res, nil
+}
+
+// ExportPayslips writes every payslip matching params to w, one row per
+// teacher and period
+func (s *PayrollService) ExportPayslips(ctx context.Context, params *dto.ListPayslipsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+var payslipColumns = slices.Concat(
+	[]spreadsheet.Column[models.Payslips]{
+		{Name: "id", Value: func(m *models.Payslips) any { return m.PayslipID }},
+		{Name: "teacher_id", Value: func(m *models.Payslips) any { return m.TeacherID }},
+	},
+	userColumns("teacher_", func(m *models.Payslips) *models.Users {
+		if m.Teacher == nil {
+			return nil
+		}
+		return m.Teacher.User
+	}),
+	[]spreadsheet.Column[models.Payslips]{
+		{Name: "period_start", Value: func(m *models.Payslips) any { return m.PeriodStart.Format(time.DateOnly) }},
+		{Name: "period_end", Value: func(m *models.Payslips) any { return m.PeriodEnd.Format(time.DateOnly) }},
+		{Name: "status", Value: func(m *models.Payslips) any { return m.Status }},
+		{Name: "currency", Value: func(m *models.Payslips) any { return money.CenterCurrency().Code }},
+		{Name: "sessions", Value: func(m *models.Payslips) any { return m.Sessions }},
+		{Name: "minutes", Value: func(m *models.Payslips) any { return m.Minutes }},
+		{Name: "gross", Value: func(m *models.Payslips) any { return m.Gross }},
+		{Name: "adjusted", Value: func(m *models.Payslips) any { return m.Adjusted }},
+		{Name: "total", Value: func(m *models.Payslips) any { return m.Total }},
+		{Name: "locked_at", Value: func(m *models.Payslips) any { return cellTime(m.LockedAt) }},
+		{Name: "created_at", Value: func(m *models.Payslips) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Payslips) any { return m.UpdatedAt }},
+	},
+)
+
+func (s *PayrollService) ModelToRes(m *models.Payslips) *dto.PayslipModelRes {
+	if m == nil {
+		return nil
+	}
+	res := &dto.PayslipModelRes{
+		ID:          m.PayslipID,
+		TeacherID:   m.TeacherID,
+		PeriodStart: m.PeriodStart.Format(time.DateOnly),
+		PeriodEnd:   m.PeriodEnd.Format(time.DateOnly),
+		Status:      m.Status,
+		Currency:    money.CenterCurrency().Code,
+		Sessions:    m.Sessions,
+		Minutes:     m.Minutes,
+		Gross:       m.Gross,
+		Adjusted:    m.Adjusted,
+		Total:       m.Total,
+		LockedAt:    unixPtr(m.LockedAt),
+	}
+	lines := slices.SortedFunc(slices.Values(m.Lines), func(a, b models.PayslipLines) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+	for _, l := range lines {
+		res.Lines = append(res.Lines, dto.PayslipLineRes{
+			ID:          l.LineID,
+			Kind:        l.Kind,
+			SessionID:   l.SessionID,
+			GroupID:     l.GroupID,
+			PayRateID:   l.PayRateID,
+			Description: l.Description,
+			Starts:      unixPtr(l.Starts),
+			Minutes:     l.Minutes,
+			Basis:       l.Basis,
+			Rate:        l.Rate,
+			Amount:      l.Amount,
+		})
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
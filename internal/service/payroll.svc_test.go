@@ -0,0 +1,276 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+)
+
+func TestRateFor(t *testing.T) {
+	const teacher, group = "teacher", "group"
+	date := func(s string) *time.Time {
+		d := day(s)
+		return &d
+	}
+	rate := func(id string, teacherID string, groupID string, from string, until string) models.PayRates {
+		r := models.PayRates{RateID: id, Basis: models.PerSession, Rate: 10000, CreatedAt: day("2025-01-01")}
+		if teacherID != "" {
+			r.TeacherID = &teacherID
+		}
+		if groupID != "" {
+			r.GroupID = &groupID
+		}
+		if from != "" {
+			r.ValidFrom = date(from)
+		}
+		if until != "" {
+			r.ValidUntil = date(until)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		rates   []models.PayRates
+		teacher string
+		group   string
+		want    string
+	}{
+		{name: "no rates", want: ""},
+		{name: "teacher rate", rates: []models.PayRates{rate("teacher", teacher, "", "", "")}, want: "teacher"},
+		{
+			name:  "group rate beats teacher rate",
+			rates: []models.PayRates{rate("teacher", teacher, "", "", ""), rate("group", "", group, "", "")},
+			want:  "group",
+		},
+		{
+			name:  "teacher in group beats both",
+			rates: []models.PayRates{rate("group", "", group, "", ""), rate("both", teacher, group, "", ""), rate("teacher", teacher, "", "", "")},
+			want:  "both",
+		},
+		{
+			name:    "rates of others don't apply",
+			rates:   []models.PayRates{rate("group", "", group, "", ""), rate("both", teacher, group, "", ""), rate("teacher", teacher, "", "", "")},
+			teacher: "other", group: "other",
+			want: "",
+		},
+		{
+			name:    "group rate for another teacher",
+			rates:   []models.PayRates{rate("group", "", group, "", ""), rate("both", teacher, group, "", "")},
+			teacher: "other",
+			want:    "group",
+		},
+		{
+			name:  "later effective date wins",
+			rates: []models.PayRates{rate("raise", teacher, "", "2026-01-01", ""), rate("first", teacher, "", "2025-09-01", ""), rate("always", teacher, "", "", "")},
+			want:  "raise",
+		},
+		{
+			name:  "raise not in effect yet",
+			rates: []models.PayRates{rate("raise", teacher, "", "2026-01-06", ""), rate("first", teacher, "", "2025-09-01", "")},
+			want:  "first",
+		},
+		{
+			name:  "starts on the day",
+			rates: []models.PayRates{rate("raise", teacher, "", "2026-01-05", ""), rate("first", teacher, "", "2025-09-01", "")},
+			want:  "raise",
+		},
+		{
+			name:  "expired rate",
+			rates: []models.PayRates{rate("old", teacher, group, "", "2026-01-04"), rate("teacher", teacher, "", "", "")},
+			want:  "teacher",
+		},
+		{
+			name:  "ends on the day",
+			rates: []models.PayRates{rate("old", teacher, group, "", "2026-01-05"), rate("teacher", teacher, "", "", "")},
+			want:  "old",
+		},
+		{
+			name:  "specific beats recent",
+			rates: []models.PayRates{rate("group", "", group, "2025-09-01", ""), rate("teacher", teacher, "", "2026-01-01", "")},
+			want:  "group",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := models.GroupSessions{TeacherID: teacher, GroupID: group, Starts: time.Date(2026, 1, 5, 17, 0, 0, 0, time.UTC)}
+			if tt.teacher != "" {
+				gs.TeacherID = tt.teacher
+			}
+			if tt.group != "" {
+				gs.GroupID = tt.group
+			}
+			got := ""
+			if r := rateFor(tt.rates, gs); r != nil {
+				got = r.RateID
+			}
+			if got != tt.want {
+				t.Fatalf("rateFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaterRate(t *testing.T) {
+	rate := func(id string, from string, created string) models.PayRates {
+		r := models.PayRates{RateID: id, CreatedAt: day(created)}
+		if from != "" {
+			d := day(from)
+			r.ValidFrom = &d
+		}
+		return r
+	}
+	tests := []struct {
+		name string
+		a, b models.PayRates
+		want bool
+	}{
+		{name: "starts later", a: rate("a", "2026-01-01", "2025-01-01"), b: rate("b", "2025-09-01", "2025-06-01"), want: true},
+		{name: "starts earlier", a: rate("a", "2025-09-01", "2025-06-01"), b: rate("b", "2026-01-01", "2025-01-01"), want: false},
+		{name: "a start beats none", a: rate("a", "2025-09-01", "2025-01-01"), b: rate("b", "", "2025-06-01"), want: true},
+		{name: "none loses to a start", a: rate("a", "", "2025-06-01"), b: rate("b", "2025-09-01", "2025-01-01"), want: false},
+		{name: "same start, created later", a: rate("a", "2025-09-01", "2025-06-01"), b: rate("b", "2025-09-01", "2025-01-01"), want: true},
+		{name: "no start, created later", a: rate("a", "", "2025-06-01"), b: rate("b", "", "2025-01-01"), want: true},
+		{name: "no start, created earlier", a: rate("a", "", "2025-01-01"), b: rate("b", "", "2025-06-01"), want: false},
+		{name: "created together", a: rate("b", "", "2025-01-01"), b: rate("a", "", "2025-01-01"), want: true},
+		{name: "itself", a: rate("a", "2025-09-01", "2025-01-01"), b: rate("a", "2025-09-01", "2025-01-01"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := laterRate(tt.a, tt.b); got != tt.want {
+				t.Fatalf("laterRate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPayroll(t *testing.T) {
+	store := NewMemoryStore()
+	s, err := NewPayrollService(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teacher, unrated := seedTeacher(t, store, "teacher"), seedTeacher(t, store, "unrated")
+	group, other, orphan := seedGroup(t, store, teacher, 45000), seedGroup(t, store, teacher, 45000), seedGroup(t, store, unrated, 45000)
+	// the group pays 20.000 a session, the teacher 12.000 an hour elsewhere
+	seed(t, store, &models.PayRates{RateID: "01JRATE0000000000000000001", GroupID: &group, Basis: models.PerSession, Rate: 20000})
+	seed(t, store, &models.PayRates{RateID: "01JRATE0000000000000000002", TeacherID: &teacher, Basis: models.PerHour, Rate: 12000})
+	// 90 minute sessions: two held in the group and one cancelled, one in
+	// the other group, one in February and one of a group without rates
+	seedSessions(t, store, group, teacher, []string{"2026-01-05T17:00:00Z", "2026-01-19T17:00:00Z", "2026-02-02T17:00:00Z"}, []string{"2026-01-12T17:00:00Z"})
+	seedSessions(t, store, other, teacher, []string{"2026-01-07T17:00:00Z"}, nil)
+	seedSessions(t, store, orphan, unrated, []string{"2026-01-08T17:00:00Z"}, nil)
+
+	payslipOf := func(teacherID string) *dto.PayslipModelRes {
+		t.Helper()
+		all, err := listAll(t.Context(), s.crud.repo, ListSpec{Where: map[string]any{"teacher_id": teacherID}})
+		if err != nil || len(all) != 1 {
+			t.Fatalf("found %d payslips of %s, %v, want 1", len(all), teacherID, err)
+		}
+		p, err := s.GetPayslipByID(t.Context(), all[0].PayslipID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	res, err := s.RunPayroll(t.Context(), "2026-01-01", "2026-01-31", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 2 || res.Updated != 0 || res.Skipped != 0 || len(res.Unrated) != 1 || res.Unrated[0].GroupID != orphan {
+		t.Fatalf("first run %+v, want two payslips and the session of the orphan group unrated", res)
+	}
+	p := payslipOf(teacher)
+	// two sessions at 20.000 and an hour and a half at 12.000
+	if p.Status != models.PayslipDraft || p.Sessions != 3 || p.Minutes != 270 || p.Gross != 58000 || p.Total != 58000 {
+		t.Fatalf("payslip %+v, want 3 sessions paying 58.000", p)
+	}
+	var amounts []money.Amount
+	for _, l := range p.Lines {
+		amounts = append(amounts, l.Amount)
+	}
+	if len(amounts) != 3 || amounts[0] != 20000 || amounts[1] != 18000 || amounts[2] != 20000 {
+		t.Fatalf("lines paying %v, want 20.000, 18.000 and 20.000 in the order taught", amounts)
+	}
+	if p := payslipOf(unrated); p.Sessions != 0 || p.Total != 0 {
+		t.Fatalf("payslip of the unrated teacher %+v, want nothing paid", p)
+	}
+
+	// a rerun works drafts out again, keeping their adjustments
+	if _, err := s.AddAdjustment(t.Context(), p.ID, "Bonus", 5000); err != nil {
+		t.Fatal(err)
+	}
+	// and drops the session cancelled since
+	sessions, err := listAll(t.Context(), s.sessions, ListSpec{Where: map[string]any{"group_id": other}})
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("found %d sessions, %v, want 1", len(sessions), err)
+	}
+	cancelled, now := sessions[0], time.Now()
+	cancelled.CancelledAt = &now
+	if err := s.sessions.Update(t.Context(), &cancelled, "cancelled_at"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = s.RunPayroll(t.Context(), "2026-01-01", "2026-01-31", []string{teacher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 0 || res.Updated != 1 || len(res.PayslipIDs) != 1 || res.PayslipIDs[0] != p.ID {
+		t.Fatalf("rerun %+v, want the draft updated", res)
+	}
+	p = payslipOf(teacher)
+	if p.Sessions != 2 || p.Gross != 40000 || p.Adjusted != 5000 || p.Total != 45000 || len(p.Lines) != 3 || p.Lines[2].Kind != models.LineAdjustment {
+		t.Fatalf("payslip %+v, want the cancelled session dropped and the bonus kept last", p)
+	}
+
+	// a locked payslip is left alone
+	if _, err := s.LockPayslip(t.Context(), p.ID); err != nil {
+		t.Fatal(err)
+	}
+	seedSessions(t, store, group, teacher, []string{"2026-01-26T17:00:00Z"}, nil)
+	res, err = s.RunPayroll(t.Context(), "2026-01-01", "2026-01-31", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Skipped != 1 || res.Updated != 1 || res.Created != 0 {
+		t.Fatalf("run after locking %+v, want the locked payslip skipped", res)
+	}
+	locked := payslipOf(teacher)
+	if locked.Status != models.PayslipLocked || locked.Sessions != 2 || locked.Total != 45000 || len(locked.Lines) != 3 || locked.UpdatedAt != p.UpdatedAt {
+		t.Fatalf("locked payslip %+v changed by a rerun", locked)
+	}
+	if _, err := s.AddAdjustment(t.Context(), p.ID, "Late bonus", 1000); err == nil {
+		t.Fatal("adjusted a locked payslip")
+	}
+
+	// a new period gets payslips of its own
+	res, err = s.RunPayroll(t.Context(), "2026-02-01", "2026-02-28", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Skipped != 0 {
+		t.Fatalf("February run %+v, want one payslip created", res)
+	}
+}
+
+func TestRunPayrollInvalid(t *testing.T) {
+	s, err := NewPayrollService(NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ start, end string }{
+		{start: "2026-01", end: "2026-01-31"},
+		{start: "2026-01-01", end: "31/01/2026"},
+		{start: "2026-01-31", end: "2026-01-01"},
+	} {
+		if _, err := s.RunPayroll(t.Context(), tt.start, tt.end, nil); err == nil {
+			t.Errorf("RunPayroll(%s, %s) succeeded, want an error", tt.start, tt.end)
+		}
+	}
+	if _, err := s.RunPayroll(t.Context(), "2026-01-01", "2026-01-31", []string{"not-an-id"}); err == nil {
+		t.Error("RunPayroll with an invalid teacher ID succeeded")
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/rs/zerolog"
+)
+
+// pricer works out what students pay for their enrollments: the fee of the
+// enrollment lowered by the pricing rules that apply to it. It is shared by
+// the enrollments service, which prices enrollments as they are made, and
+// the invoices service, which prices them again for every period billed. See
+// docs/pricing.md.
+type pricer struct {
+	log         zerolog.Logger
+	rules       Repository[models.PricingRules]
+	enrollments Repository[models.Enrollments]
+	links       Repository[models.StudentParents]
+}
+
+func newPricer(store Store, log zerolog.Logger) *pricer {
+	return &pricer{
+		log:         log,
+		rules:       NewRepository[models.PricingRules](store),
+		enrollments: NewRepository[models.Enrollments](store),
+		links:       NewRepository[models.StudentParents](store),
+	}
+}
+
+// quote is the price of an enrollment and why
+type quote struct {
+	Fee         money.Amount
+	Adjustments []models.PriceAdjustment
+}
+
+// kindOrder is the order rules of each kind apply in
+var kindOrder = []string{models.RuleScholarship, models.RuleSibling, models.RuleDiscount}
+
+// price quotes enrollments for the days from to to, in the order given. Rules
+// valid on any of those days apply. Enrollments not saved yet count as made
+// now when ranking siblings.
+func (p *pricer) price(ctx context.Context, from, to time.Time, enrollments []models.Enrollments) ([]quote, error) {
+	return p.quote(ctx, enrollments, func(models.Enrollments) (time.Time, time.Time) { return from, to })
+}
+
+// priceOnStart quotes enrollments like price, each with the rules valid on
+// the day it starts
+func (p *pricer) priceOnStart(ctx context.Context, enrollments []models.Enrollments) ([]quote, error) {
+	return p.quote(ctx, enrollments, func(e models.Enrollments) (time.Time, time.Time) { return e.StartDate, e.StartDate })
+}
+
+// quote quotes each enrollment with the rules valid on any of the days
+// returned by days for it
+func (p *pricer) quote(ctx context.Context, enrollments []models.Enrollments, days func(e models.Enrollments) (time.Time, time.Time)) ([]quote, error) {
+	rules, err := listAll(ctx, p.rules, ListSpec{})
+	if err != nil {
+		return nil, dbError(p.log, err, "pricing rule")
+	}
+	slices.SortFunc(rules, func(a, b models.PricingRules) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(kindOrder, a.Kind), slices.Index(kindOrder, b.Kind)),
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.RuleID, b.RuleID),
+		)
+	})
+
+	valid := make([][]models.PricingRules, len(enrollments))
+	siblings := false
+	for i, e := range enrollments {
+		from, to := days(e)
+		valid[i] = slices.DeleteFunc(slices.Clone(rules), func(r models.PricingRules) bool {
+			return (r.ValidFrom != nil && r.ValidFrom.After(to)) || (r.ValidUntil != nil && r.ValidUntil.Before(from))
+		})
+		siblings = siblings || slices.ContainsFunc(valid[i], func(r models.PricingRules) bool { return r.Kind == models.RuleSibling })
+	}
+
+	ranks := map[string]int{}
+	if siblings {
+		if ranks, err = p.siblingRanks(ctx, enrollments); err != nil {
+			return nil, err
+		}
+	}
+
+	quotes := make([]quote, len(enrollments))
+	for i, e := range enrollments {
+		quotes[i] = applyRules(e, valid[i], max(ranks[e.StudentID], 1))
+	}
+	return quotes, nil
+}
+
+// applyRules lowers the fee of e by the rules that apply to it, sorted in
+// the order they apply. Each rule works on what the previous ones left, so
+// the fee never goes below zero. Of the sibling rules only the one for the
+// highest rank the student reached applies.
+func applyRules(e models.Enrollments, rules []models.PricingRules, rank int) quote {
+	var sibling *models.PricingRules
+	for i, r := range rules {
+		if r.Kind == models.RuleSibling && *r.SiblingRank <= rank && (r.GroupID == nil || *r.GroupID == e.GroupID) &&
+			(sibling == nil || *r.SiblingRank > *sibling.SiblingRank) {
+			sibling = &rules[i]
+		}
+	}
+
+	q := quote{Fee: e.Fee, Adjustments: []models.PriceAdjustment{}}
+	for i, r := range rules {
+		if r.GroupID != nil && *r.GroupID != e.GroupID {
+			continue
+		}
+		switch r.Kind {
+		case models.RuleScholarship:
+			if *r.StudentID != e.StudentID {
+				continue
+			}
+		case models.RuleSibling:
+			if sibling != &rules[i] {
+				continue
+			}
+		}
+		off := q.Fee
+		if r.Percent != nil {
+			off = q.Fee.Percent(*r.Percent)
+		} else if *r.Amount < off {
+			off = *r.Amount
+		}
+		if off <= 0 {
+			continue
+		}
+		q.Fee -= off
+		q.Adjustments = append(q.Adjustments, models.PriceAdjustment{
+			RuleID: r.RuleID, Name: r.Name, Kind: r.Kind, Percent: r.Percent, Amount: off,
+		})
+	}
+	return q
+}
+
+// siblingRanks ranks the students of enrollments among their siblings, the
+// students sharing a parent with them who are enrolled in a group. Siblings
+// are ranked from 1 in the order they first enrolled.
+func (p *pricer) siblingRanks(ctx context.Context, enrollments []models.Enrollments) (map[string]int, error) {
+	studentIDs := []string{}
+	for _, e := range enrollments {
+		if !slices.Contains(studentIDs, e.StudentID) {
+			studentIDs = append(studentIDs, e.StudentID)
+		}
+	}
+	ranks := map[string]int{}
+	if len(studentIDs) == 0 {
+		return ranks, nil
+	}
+
+	own, err := listAll(ctx, p.links, ListSpec{Where: map[string]any{"student_id": studentIDs}})
+	if err != nil {
+		return nil, dbError(p.log, err, "student-parent relationship")
+	}
+	parentIDs := []string{}
+	for _, l := range own {
+		parentIDs = append(parentIDs, l.ParentID)
+	}
+	if len(parentIDs) == 0 {
+		return ranks, nil
+	}
+	links, err := listAll(ctx, p.links, ListSpec{Where: map[string]any{"parent_id": parentIDs}})
+	if err != nil {
+		return nil, dbError(p.log, err, "student-parent relationship")
+	}
+	children := map[string][]string{}
+	family := []string{}
+	for _, l := range links {
+		children[l.ParentID] = append(children[l.ParentID], l.StudentID)
+		family = append(family, l.StudentID)
+	}
+
+	enrolled, err := listAll(ctx, p.enrollments, ListSpec{Where: map[string]any{"student_id": family}})
+	if err != nil {
+		return nil, dbError(p.log, err, "enrollment")
+	}
+	now := time.Now()
+	first := map[string]time.Time{}
+	for _, e := range slices.Concat(enrolled, enrollments) {
+		at := e.CreatedAt
+		if at.IsZero() {
+			at = now
+		}
+		if f, ok := first[e.StudentID]; !ok || at.Before(f) {
+			first[e.StudentID] = at
+		}
+	}
+
+	for _, id := range studentIDs {
+		siblings := []string{id}
+		for _, l := range own {
+			if l.StudentID != id {
+				continue
+			}
+			for _, s := range children[l.ParentID] {
+				if _, ok := first[s]; ok && !slices.Contains(siblings, s) {
+					siblings = append(siblings, s)
+				}
+			}
+		}
+		slices.SortFunc(siblings, func(a, b string) int {
+			return cmp.Or(first[a].Compare(first[b]), cmp.Compare(a, b))
+		})
+		ranks[id] = slices.Index(siblings, id) + 1
+	}
+	return ranks, nil
+}
+
+func adjustmentsToRes(adjustments []models.PriceAdjustment) []dto.PriceAdjustmentRes {
+	res := make([]dto.PriceAdjustmentRes, len(adjustments))
+	for i, a := range adjustments {
+		res[i] = dto.PriceAdjustmentRes{RuleID: a.RuleID, Name: a.Name, Kind: a.Kind, Percent: a.Percent, Amount: a.Amount}
+	}
+	return res
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/oklog/ulid/v2"
+)
+
+func TestApplyRules(t *testing.T) {
+	const student, other, group, otherGroup = "student", "other", "group", "other-group"
+	percent := func(id string, kind string, p int) models.PricingRules {
+		return models.PricingRules{RuleID: id, Name: id, Kind: kind, Percent: &p}
+	}
+	amount := func(id string, kind string, a money.Amount) models.PricingRules {
+		return models.PricingRules{RuleID: id, Name: id, Kind: kind, Amount: &a}
+	}
+	scholarship := func(r models.PricingRules, studentID string) models.PricingRules {
+		r.StudentID = &studentID
+		return r
+	}
+	sibling := func(r models.PricingRules, rank int) models.PricingRules {
+		r.SiblingRank = &rank
+		return r
+	}
+	inGroup := func(r models.PricingRules, groupID string) models.PricingRules {
+		r.GroupID = &groupID
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		rules []models.PricingRules
+		rank  int
+		fee   money.Amount
+		// off are the rules applied in order and amt what each took off
+		off []string
+		amt []money.Amount
+	}{
+		{name: "no rules", rank: 1, fee: 45000},
+		{
+			name:  "scholarship, then sibling, then discount, each on what is left",
+			rules: []models.PricingRules{scholarship(percent("half", models.RuleScholarship, 50), student), sibling(percent("second", models.RuleSibling, 10), 2), amount("spring", models.RuleDiscount, 5000)},
+			rank:  2, fee: 15250,
+			off: []string{"half", "second", "spring"}, amt: []money.Amount{22500, 2250, 5000},
+		},
+		{
+			name:  "scholarship of another student",
+			rules: []models.PricingRules{scholarship(percent("half", models.RuleScholarship, 50), other), percent("all", models.RuleDiscount, 10)},
+			rank:  1, fee: 40500,
+			off: []string{"all"}, amt: []money.Amount{4500},
+		},
+		{
+			name:  "first child gets no sibling rule",
+			rules: []models.PricingRules{sibling(percent("second", models.RuleSibling, 10), 2)},
+			rank:  1, fee: 45000,
+		},
+		{
+			name:  "only the highest rank reached applies",
+			rules: []models.PricingRules{sibling(percent("second", models.RuleSibling, 10), 2), sibling(percent("third", models.RuleSibling, 20), 3), sibling(percent("fourth", models.RuleSibling, 30), 4)},
+			rank:  3, fee: 36000,
+			off: []string{"third"}, amt: []money.Amount{9000},
+		},
+		{
+			name:  "ranks beyond the rules get the highest one",
+			rules: []models.PricingRules{sibling(percent("second", models.RuleSibling, 10), 2), sibling(percent("third", models.RuleSibling, 20), 3)},
+			rank:  5, fee: 36000,
+			off: []string{"third"}, amt: []money.Amount{9000},
+		},
+		{
+			name:  "sibling rule of another group is passed over",
+			rules: []models.PricingRules{sibling(percent("second", models.RuleSibling, 10), 2), inGroup(sibling(percent("third", models.RuleSibling, 20), 3), otherGroup)},
+			rank:  3, fee: 40500,
+			off: []string{"second"}, amt: []money.Amount{4500},
+		},
+		{
+			name:  "group rules",
+			rules: []models.PricingRules{inGroup(amount("this", models.RuleDiscount, 5000), group), inGroup(amount("that", models.RuleDiscount, 7000), otherGroup)},
+			rank:  1, fee: 40000,
+			off: []string{"this"}, amt: []money.Amount{5000},
+		},
+		{
+			name:  "amounts stop at zero",
+			rules: []models.PricingRules{scholarship(amount("most", models.RuleScholarship, 40000), student), amount("big", models.RuleDiscount, 10000), amount("more", models.RuleDiscount, 1000)},
+			rank:  1, fee: 0,
+			off: []string{"most", "big"}, amt: []money.Amount{40000, 5000},
+		},
+		{
+			name:  "full scholarship leaves nothing to discount",
+			rules: []models.PricingRules{scholarship(percent("full", models.RuleScholarship, 100), student), percent("all", models.RuleDiscount, 10)},
+			rank:  1, fee: 0,
+			off: []string{"full"}, amt: []money.Amount{45000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := applyRules(models.Enrollments{StudentID: student, GroupID: group, Fee: 45000}, tt.rules, tt.rank)
+			if q.Fee != tt.fee {
+				t.Errorf("fee %s, want %s", q.Fee, tt.fee)
+			}
+			var off []string
+			var amt []money.Amount
+			for _, a := range q.Adjustments {
+				off = append(off, a.RuleID)
+				amt = append(amt, a.Amount)
+			}
+			if !reflect.DeepEqual(off, tt.off) || !reflect.DeepEqual(amt, tt.amt) {
+				t.Errorf("adjustments %v %v, want %v %v", off, amt, tt.off, tt.amt)
+			}
+		})
+	}
+}
+
+func TestPricerPriceOrder(t *testing.T) {
+	store := NewMemoryStore()
+	p := newPricer(store, logging.L())
+	studentID := seedStudent(t, store, "student")
+	groupID := seedGroup(t, store, seedTeacher(t, store, "teacher"), 45000)
+	ten, half := 10, 50
+	fixed := money.Amount(5000)
+	expired := day("2025-12-31")
+	// inserted out of the order they apply in
+	for _, r := range []models.PricingRules{
+		{RuleID: "01JRULE0000000000000000001", Name: "spring", Kind: models.RuleDiscount, Amount: &fixed},
+		{RuleID: "01JRULE0000000000000000002", Name: "old", Kind: models.RuleDiscount, Percent: &half, ValidUntil: &expired},
+		{RuleID: "01JRULE0000000000000000003", Name: "all", Kind: models.RuleDiscount, Percent: &ten},
+		{RuleID: "01JRULE0000000000000000004", Name: "merit", Kind: models.RuleScholarship, Percent: &half, StudentID: &studentID},
+	} {
+		seed(t, store, &r)
+	}
+
+	quotes, err := p.price(t.Context(), day("2026-01-01"), day("2026-01-31"), []models.Enrollments{{StudentID: studentID, GroupID: groupID, Fee: 45000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scholarship halves 45.000, then the discounts apply by name:
+	// 10% before the fixed 5.000, and the expired one not at all
+	q := quotes[0]
+	if q.Fee != 15250 {
+		t.Fatalf("fee %s, want 15.250", q.Fee)
+	}
+	var names []string
+	for _, a := range q.Adjustments {
+		names = append(names, a.Name)
+	}
+	if want := []string{"merit", "all", "spring"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("applied %v, want %v", names, want)
+	}
+}
+
+func TestSiblingRanks(t *testing.T) {
+	store := NewMemoryStore()
+	p := newPricer(store, logging.L())
+	teacherID := seedTeacher(t, store, "teacher")
+	group, other := seedGroup(t, store, teacherID, 45000), seedGroup(t, store, teacherID, 30000)
+	enroll := func(studentID string, groupID string, at string) models.Enrollments {
+		t.Helper()
+		e := models.Enrollments{StudentID: studentID, GroupID: groupID, Fee: 45000, StartDate: day(at), CreatedAt: day(at)}
+		seed(t, store, &e)
+		return e
+	}
+
+	// a family of four: the eldest left, the second enrolled first in two
+	// groups, the third later, the youngest isn't enrolled yet
+	eldest, second, third, youngest := seedStudent(t, store, "eldest"), seedStudent(t, store, "second"), seedStudent(t, store, "third"), seedStudent(t, store, "youngest")
+	seedParent(t, store, "mother", eldest, second, third, youngest)
+	left := enroll(eldest, group, "2025-09-01")
+	if err := p.enrollments.Delete(t.Context(), &left); err != nil {
+		t.Fatal(err)
+	}
+	enroll(second, group, "2025-10-01")
+	enroll(second, other, "2026-01-01")
+	enroll(third, group, "2025-11-01")
+	// a half-sibling of the third enrolled before everyone, through another
+	// parent
+	half := seedStudent(t, store, "half")
+	seedParent(t, store, "father", third, half)
+	enroll(half, other, "2025-08-01")
+	// and an only child
+	only := seedStudent(t, store, "only")
+	seedParent(t, store, "parent", only)
+	enroll(only, group, "2025-10-01")
+	orphan := seedStudent(t, store, "orphan")
+
+	tests := []struct {
+		name        string
+		enrollments []models.Enrollments
+		want        map[string]int
+	}{
+		{name: "nothing", want: map[string]int{}},
+		{
+			name:        "ranked by their first enrollment",
+			enrollments: []models.Enrollments{{StudentID: second, GroupID: group}, {StudentID: second, GroupID: other}},
+			want:        map[string]int{second: 1},
+		},
+		{
+			name:        "siblings through every parent",
+			enrollments: []models.Enrollments{{StudentID: third, GroupID: group}},
+			want:        map[string]int{third: 3},
+		},
+		{
+			name:        "the half-sibling only shares one parent",
+			enrollments: []models.Enrollments{{StudentID: half, GroupID: other}},
+			want:        map[string]int{half: 1},
+		},
+		{
+			name:        "new enrollments count as made now",
+			enrollments: []models.Enrollments{{StudentID: youngest, GroupID: other}, {StudentID: second, GroupID: group}},
+			want:        map[string]int{youngest: 3, second: 1},
+		},
+		{
+			name:        "only child",
+			enrollments: []models.Enrollments{{StudentID: only, GroupID: group}},
+			want:        map[string]int{only: 1},
+		},
+		{
+			name:        "no parent",
+			enrollments: []models.Enrollments{{StudentID: orphan, GroupID: group}},
+			want:        map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.siblingRanks(t.Context(), tt.enrollments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ranks %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrollmentsPricedOnStart(t *testing.T) {
+	store := NewMemoryStore()
+	s, err := NewEnrollmentsService(store, "days")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teacherID := seedTeacher(t, store, "teacher")
+	group, other := seedGroup(t, store, teacherID, 45000), seedGroup(t, store, teacherID, 45000)
+	studentID := seedStudent(t, store, "student")
+	ten := 10
+	from, until := day("2030-07-01"), day("2030-08-31")
+	seed(t, store, &models.PricingRules{RuleID: ulid.Make().String(), Name: "summer", Kind: models.RuleDiscount, Percent: &ten, ValidFrom: &from, ValidUntil: &until})
+
+	// a summer rule that isn't valid today applies to the enrollment starting
+	// in the summer only
+	inSummer, later := "2030-07-15", "2030-09-01"
+	summer, err := s.CreateEnrollment(t.Context(), studentID, group, nil, &inSummer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autumn, err := s.CreateEnrollment(t.Context(), studentID, other, nil, &later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summer.EffectiveFee != 40500 || autumn.EffectiveFee != 45000 {
+		t.Fatalf("effective fees %s and %s, want 40.500 and 45.000", summer.EffectiveFee, autumn.EffectiveFee)
+	}
+
+	// a new fee is priced on the day the enrollment started too
+	m := models.Enrollments{StudentID: studentID, GroupID: group}
+	patch := dto.Patch{}
+	dto.PatchValue(&patch, "fee", dto.Optional[money.Amount]{Sent: true, Value: 50000}, &m.Fee)
+	updated, err := s.UpdateEnrollment(t.Context(), m, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.EffectiveFee != 45000 {
+		t.Fatalf("effective fee %s after the update, want 45.000", updated.EffectiveFee)
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// PricingRulesService keeps the scholarships, sibling rules and discounts
+// the pricer lowers fees with. See docs/pricing.md.
+type PricingRulesService struct {
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.PricingRules, dto.PricingRuleModelRes]
+}
+
+func NewPricingRulesService(store Store) (*PricingRulesService, error) {
+	log := logging.L().With().Str("service", "pricing_rules.svc").Logger()
+	s := &PricingRulesService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.PricingRules, dto.PricingRuleModelRes]{
+		Search: []string{"?TableAlias.name"},
+		Filters: map[string]string{
+			"name":         "?TableAlias.name",
+			"kind":         "?TableAlias.kind",
+			"group_id":     "?TableAlias.group_id",
+			"student_id":   "?TableAlias.student_id",
+			"sibling_rank": "?TableAlias.sibling_rank",
+			"valid_from":   "?TableAlias.valid_from",
+			"valid_until":  "?TableAlias.valid_until",
+		},
+		Columns: pricingRuleColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
+}
+
+func (s *PricingRulesService) GetPricingRules(ctx context.Context, params *dto.ListPricingRulesReq) (*dto.ListPricingRulesRes, error) {
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.ListPricingRulesRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Rules = l.Items
+	return res, nil
+}
+
+var pricingRuleColumns = []spreadsheet.Column[models.PricingRules]{
+	{Name: "id", Value: func(m *models.PricingRules) any { return m.RuleID }},
+	{Name: "name", Value: func(m *models.PricingRules) any { return m.Name }},
+	{Name: "kind", Value: func(m *models.PricingRules) any { return m.Kind }},
+	{Name: "percent", Value: func(m *models.PricingRules) any {
+		if m.Percent == nil {
+			return nil
+		}
+		return *m.Percent
+	}},
+	{Name: "amount", Value: func(m *models.PricingRules) any {
+		if m.Amount == nil {
+			return nil
+		}
+		return *m.Amount
+	}},
+	{Name: "group_id", Value: func(m *models.PricingRules) any { return cellString(m.GroupID) }},
+	{Name: "student_id", Value: func(m *models.PricingRules) any { return cellString(m.StudentID) }},
+	{Name: "sibling_rank", Value: func(m *models.PricingRules) any {
+		if m.SiblingRank == nil {
+			return nil
+		}
+		return *m.SiblingRank
+	}},
+	{Name: "valid_from", Value: func(m *models.PricingRules) any { return cellString(datePtr(m.ValidFrom)) }},
+	{Name: "valid_until", Value: func(m *models.PricingRules) any { return cellString(datePtr(m.ValidUntil)) }},
+	{Name: "created_at", Value: func(m *models.PricingRules) any { return m.CreatedAt }},
+	{Name: "updated_at", Value: func(m *models.PricingRules) any { return m.UpdatedAt }},
+}
+
+// ExportPricingRules writes every rule matching params to w
+func (s *PricingRulesService) ExportPricingRules(ctx context.Context, params *dto.ListPricingRulesReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
+}
+
+func (s *PricingRulesService) GetPricingRuleByID(ctx context.Context, id string) (*dto.PricingRuleModelRes, error) {
+	m := models.PricingRules{RuleID: id}
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+func (s *PricingRulesService) CreatePricingRule(ctx context.Context, input dto.CreatePricingRuleReq) (*dto.PricingRuleModelRes, error) {
+	in := input.Body
+	m := models.PricingRules{
+		RuleID:      ulid.Make().String(),
+		Name:        in.Name,
+		Kind:        in.Kind,
+		Percent:     in.Percent,
+		Amount:      in.Amount,
+		GroupID:     in.GroupID,
+		StudentID:   in.StudentID,
+		SiblingRank: in.SiblingRank,
+	}
+	var err error
+	if m.ValidFrom, err = parseDatePtr(in.ValidFrom, "body.valid_from"); err != nil {
+		return nil, err
+	}
+	if m.ValidUntil, err = parseDatePtr(in.ValidUntil, "body.valid_until"); err != nil {
+		return nil, err
+	}
+	if err := validateRule(&m); err != nil {
+		return nil, err
+	}
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// UpdatePricingRule applies a merge patch to a rule. Its kind can't change,
+// and the rule must still make sense for its kind once patched.
+func (s *PricingRulesService) UpdatePricingRule(ctx context.Context, input dto.UpdatePricingRuleReq) (*dto.PricingRuleModelRes, error) {
+	in := input.Body
+	m := models.PricingRules{RuleID: in.ID}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		m = models.PricingRules{RuleID: in.ID}
+		if err := s.crud.Lock(ctx, &m); err != nil {
+			return err
+		}
+		patch := dto.Patch{}
+		dto.PatchValue(&patch, "name", in.Name, &m.Name)
+		dto.PatchPtr(&patch, "percent", in.Percent, &m.Percent)
+		dto.PatchPtr(&patch, "amount", in.Amount, &m.Amount)
+		dto.PatchPtr(&patch, "group_id", in.GroupID, &m.GroupID)
+		dto.PatchValuePtr(&patch, "student_id", in.StudentID, &m.StudentID)
+		dto.PatchValuePtr(&patch, "sibling_rank", in.SiblingRank, &m.SiblingRank)
+		var validFrom, validUntil *string
+		dto.PatchPtr(&patch, "valid_from", in.ValidFrom, &validFrom)
+		dto.PatchPtr(&patch, "valid_until", in.ValidUntil, &validUntil)
+		var err error
+		if patch.Has("valid_from") {
+			if m.ValidFrom, err = parseDatePtr(validFrom, "body.valid_from"); err != nil {
+				return err
+			}
+		}
+		if patch.Has("valid_until") {
+			if m.ValidUntil, err = parseDatePtr(validUntil, "body.valid_until"); err != nil {
+				return err
+			}
+		}
+		if err := validateRule(&m); err != nil {
+			return err
+		}
+		return s.crud.Update(ctx, &m, patch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ModelToRes(&m), nil
+}
+
+// validateRule checks m holds what its kind needs and nothing else
+func validateRule(m *models.PricingRules) error {
+	invalid := func(location string, message string) error {
+		return huma.Error422UnprocessableEntity("pricing rule is invalid", &huma.ErrorDetail{
+			Message: message, Location: location,
+		})
+	}
+	switch {
+	case (m.Percent == nil) == (m.Amount == nil):
+		return invalid("body.percent", "expected either a percent or an amount")
+	case m.Amount != nil && *m.Amount <= 0:
+		return invalid("body.amount", "expected an amount above zero")
+	case m.Kind == models.RuleScholarship && m.StudentID == nil:
+		return invalid("body.student_id", "scholarships need a student")
+	case m.Kind != models.RuleScholarship && m.StudentID != nil:
+		return invalid("body.student_id", "only scholarships have a student")
+	case m.Kind == models.RuleSibling && m.SiblingRank == nil:
+		return invalid("body.sibling_rank", "sibling rules need a sibling rank")
+	case m.Kind != models.RuleSibling && m.SiblingRank != nil:
+		return invalid("body.sibling_rank", "only sibling rules have a sibling rank")
+	case m.ValidFrom != nil && m.ValidUntil != nil && m.ValidUntil.Before(*m.ValidFrom):
+		return invalid("body.valid_until", "the rule ends before it starts")
+	}
+	return nil
+}
+
+func (s *PricingRulesService) DeletePricingRule(ctx context.Context, id string) error {
+	return s.crud.Delete(ctx, &models.PricingRules{RuleID: id})
+}
+
+func (s *PricingRulesService) ModelToRes(m *models.PricingRules) *dto.PricingRuleModelRes {
+	if m == nil {
+		return nil
+	}
+	res := &dto.PricingRuleModelRes{
+		ID:          m.RuleID,
+		Name:        m.Name,
+		Kind:        m.Kind,
+		Percent:     m.Percent,
+		Amount:      m.Amount,
+		GroupID:     m.GroupID,
+		StudentID:   m.StudentID,
+		SiblingRank: m.SiblingRank,
+		ValidFrom:   datePtr(m.ValidFrom),
+		ValidUntil:  datePtr(m.ValidUntil),
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
+
+// parseDatePtr parses the date of the field at location, nil staying nil
+func parseDatePtr(s *string, location string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.DateOnly, *s)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("date is invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: location, Value: *s,
+		})
+	}
+	return &t, nil
+}
+
+// datePtr formats a date, nil staying nil
+func datePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.DateOnly)
+	return &s
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/rs/zerolog"
+)
+
+// prorater works out what an enrollment covering only part of a billed
+// period is charged, under the proration policy of the center. It is shared
+// by the invoices service, which bills the days an enrollment covers, and the
+// enrollments service, which credits the days a withdrawal gives back. See
+// docs/proration.md.
+type prorater struct {
+	log      zerolog.Logger
+	policy   string
+	sessions Repository[models.GroupSessions]
+}
+
+func newProrater(store Store, log zerolog.Logger, policy string) *prorater {
+	if policy == "" {
+		policy = models.ProrateDays
+	}
+	return &prorater{log: log, policy: policy, sessions: NewRepository[models.GroupSessions](store)}
+}
+
+// covered returns the days of from to to e covers, ok false when it covers
+// none of them
+func covered(e models.Enrollments, from, to time.Time) (start time.Time, end time.Time, ok bool) {
+	start, end = from, to
+	if e.StartDate.After(start) {
+		start = e.StartDate
+	}
+	if e.EndDate != nil && e.EndDate.Before(end) {
+		end = *e.EndDate
+	}
+	return start, end, !end.Before(start)
+}
+
+// charge returns what billing full for the period from to to of groupID
+// costs when only the days start to end are covered, with the proration
+// applied, nil when full is charged
+func (p *prorater) charge(ctx context.Context, groupID string, full money.Amount, from, to, start, end time.Time) (money.Amount, *models.Proration, error) {
+	if end.Before(start) {
+		return 0, nil, nil
+	}
+	if p.policy == models.ProrateNone || (start.Equal(from) && end.Equal(to)) {
+		return full, nil, nil
+	}
+	if p.policy == models.ProrateSessions {
+		units, total, err := p.sessionsIn(ctx, groupID, from, to, start, end)
+		if err != nil {
+			return 0, nil, err
+		}
+		// a group without sessions in the period falls back to days
+		if total > 0 {
+			return full.Share(units, total), &models.Proration{Policy: models.ProrateSessions, Units: units, Total: total}, nil
+		}
+	}
+	units, total := days(start, end), days(from, to)
+	return full.Share(units, total), &models.Proration{Policy: models.ProrateDays, Units: units, Total: total}, nil
+}
+
+// sessionsIn counts the sessions of groupID held from start to end and from
+// from to to. Cancelled sessions don't count.
+func (p *prorater) sessionsIn(ctx context.Context, groupID string, from, to, start, end time.Time) (int, int, error) {
+	sessions, err := listAll(ctx, p.sessions, ListSpec{Where: map[string]any{"group_id": groupID}})
+	if err != nil {
+		return 0, 0, dbError(p.log, err, "group session")
+	}
+	units, total := 0, 0
+	for _, gs := range sessions {
+		if gs.CancelledAt != nil {
+			continue
+		}
+		day := dateOf(gs.Starts)
+		if day.Before(from) || day.After(to) {
+			continue
+		}
+		total++
+		if !day.Before(start) && !day.After(end) {
+			units++
+		}
+	}
+	return units, total, nil
+}
+
+// days counts the days from start to end, both included
+func days(start, end time.Time) int {
+	return int(end.Sub(start).Hours()/24) + 1
+}
+
+// dateOf returns the day of t in UTC
+func dateOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
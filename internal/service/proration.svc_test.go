@@ -0,0 +1,186 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/oklog/ulid/v2"
+)
+
+func TestDays(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       int
+	}{
+		{start: "2026-01-01", end: "2026-01-01", want: 1},
+		{start: "2026-01-01", end: "2026-01-02", want: 2},
+		{start: "2026-01-01", end: "2026-01-31", want: 31},
+		{start: "2026-01-16", end: "2026-01-31", want: 16},
+		{start: "2026-02-01", end: "2026-02-28", want: 28},
+		{start: "2028-02-01", end: "2028-02-29", want: 29},
+		{start: "2026-03-01", end: "2026-03-31", want: 31},
+		{start: "2025-09-15", end: "2026-06-30", want: 289},
+	}
+	for _, tt := range tests {
+		t.Run(tt.start+"/"+tt.end, func(t *testing.T) {
+			if got := days(day(tt.start), day(tt.end)); got != tt.want {
+				t.Fatalf("days(%s, %s) = %d, want %d", tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCovered(t *testing.T) {
+	withdrawn := func(s string) *time.Time {
+		d := day(s)
+		return &d
+	}
+	tests := []struct {
+		name       string
+		e          models.Enrollments
+		start, end string
+		ok         bool
+	}{
+		{name: "whole period", e: models.Enrollments{StartDate: day("2025-09-01")}, start: "2026-01-01", end: "2026-01-31", ok: true},
+		{name: "joined mid period", e: models.Enrollments{StartDate: day("2026-01-16")}, start: "2026-01-16", end: "2026-01-31", ok: true},
+		{name: "withdrew mid period", e: models.Enrollments{StartDate: day("2025-09-01"), EndDate: withdrawn("2026-01-10")}, start: "2026-01-01", end: "2026-01-10", ok: true},
+		{name: "joined and withdrew", e: models.Enrollments{StartDate: day("2026-01-05"), EndDate: withdrawn("2026-01-20")}, start: "2026-01-05", end: "2026-01-20", ok: true},
+		{name: "last day only", e: models.Enrollments{StartDate: day("2026-01-31")}, start: "2026-01-31", end: "2026-01-31", ok: true},
+		{name: "joins after", e: models.Enrollments{StartDate: day("2026-02-01")}, ok: false},
+		{name: "withdrew before", e: models.Enrollments{StartDate: day("2025-09-01"), EndDate: withdrawn("2025-12-31")}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := covered(tt.e, day("2026-01-01"), day("2026-01-31"))
+			if ok != tt.ok {
+				t.Fatalf("covered = %v, want %v", ok, tt.ok)
+			}
+			if ok && (!start.Equal(day(tt.start)) || !end.Equal(day(tt.end))) {
+				t.Fatalf("covered %s to %s, want %s to %s", start.Format(time.DateOnly), end.Format(time.DateOnly), tt.start, tt.end)
+			}
+		})
+	}
+}
+
+// seedSessions inserts sessions of the group starting at the times, and
+// cancelled ones at the cancelled times
+func seedSessions(t *testing.T, store Store, groupID string, teacherID string, starts []string, cancelled []string) {
+	t.Helper()
+	for i, s := range append(starts, cancelled...) {
+		at, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gs := models.GroupSessions{SessionID: ulid.Make().String(), GroupID: groupID, TeacherID: teacherID, Starts: at, Ends: at.Add(90 * time.Minute)}
+		if i >= len(starts) {
+			gs.CancelledAt = &at
+		}
+		seed(t, store, &gs)
+	}
+}
+
+func TestProraterCharge(t *testing.T) {
+	store := NewMemoryStore()
+	teacherID := seedTeacher(t, store, "teacher")
+	weekly, empty, other := seedGroup(t, store, teacherID, 45000), seedGroup(t, store, teacherID, 45000), seedGroup(t, store, teacherID, 45000)
+	// four Monday sessions held in January, one cancelled on a Wednesday,
+	// one in February and those of another group
+	seedSessions(t, store, weekly, teacherID,
+		[]string{"2026-01-05T17:00:00Z", "2026-01-12T17:00:00Z", "2026-01-19T17:00:00Z", "2026-01-26T17:00:00Z", "2026-02-02T17:00:00Z"},
+		[]string{"2026-01-14T17:00:00Z"})
+	seedSessions(t, store, other, teacherID, []string{"2026-01-20T17:00:00Z", "2026-01-21T17:00:00Z"}, nil)
+
+	tests := []struct {
+		name       string
+		policy     string
+		groupID    string
+		start, end string
+		want       money.Amount
+		proration  *models.Proration
+	}{
+		{name: "whole period", policy: models.ProrateDays, groupID: weekly, start: "2026-01-01", end: "2026-01-31", want: 45000},
+		{name: "no proration", policy: models.ProrateNone, groupID: weekly, start: "2026-01-16", end: "2026-01-31", want: 45000},
+		{name: "nothing covered", policy: models.ProrateDays, groupID: weekly, start: "2026-01-31", end: "2026-01-30", want: 0},
+		{
+			name: "days joined mid period", policy: models.ProrateDays, groupID: weekly, start: "2026-01-16", end: "2026-01-31",
+			want: 23226, proration: &models.Proration{Policy: models.ProrateDays, Units: 16, Total: 31},
+		},
+		{
+			name: "days withdrew mid period", policy: models.ProrateDays, groupID: weekly, start: "2026-01-01", end: "2026-01-10",
+			want: 14516, proration: &models.Proration{Policy: models.ProrateDays, Units: 10, Total: 31},
+		},
+		{
+			name: "days single day", policy: models.ProrateDays, groupID: weekly, start: "2026-01-31", end: "2026-01-31",
+			want: 1452, proration: &models.Proration{Policy: models.ProrateDays, Units: 1, Total: 31},
+		},
+		{
+			name: "sessions joined mid period", policy: models.ProrateSessions, groupID: weekly, start: "2026-01-16", end: "2026-01-31",
+			want: 22500, proration: &models.Proration{Policy: models.ProrateSessions, Units: 2, Total: 4},
+		},
+		{
+			name: "sessions withdrew on a session day", policy: models.ProrateSessions, groupID: weekly, start: "2026-01-01", end: "2026-01-19",
+			want: 33750, proration: &models.Proration{Policy: models.ProrateSessions, Units: 3, Total: 4},
+		},
+		{
+			name: "sessions none attended", policy: models.ProrateSessions, groupID: weekly, start: "2026-01-13", end: "2026-01-18",
+			want: 0, proration: &models.Proration{Policy: models.ProrateSessions, Units: 0, Total: 4},
+		},
+		{
+			name: "sessions fall back to days", policy: models.ProrateSessions, groupID: empty, start: "2026-01-16", end: "2026-01-31",
+			want: 23226, proration: &models.Proration{Policy: models.ProrateDays, Units: 16, Total: 31},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProrater(store, logging.L(), tt.policy)
+			got, proration, err := p.charge(t.Context(), tt.groupID, 45000, day("2026-01-01"), day("2026-01-31"), day(tt.start), day(tt.end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("charged %s, want %s", got, tt.want)
+			}
+			if (proration == nil) != (tt.proration == nil) || (proration != nil && *proration != *tt.proration) {
+				t.Errorf("proration %+v, want %+v", proration, tt.proration)
+			}
+		})
+	}
+}
+
+func TestSessionsIn(t *testing.T) {
+	store := NewMemoryStore()
+	teacherID := seedTeacher(t, store, "teacher")
+	groupID := seedGroup(t, store, teacherID, 45000)
+	seedSessions(t, store, groupID, teacherID,
+		// sessions are dated in UTC: the one starting on February 1st in
+		// Tunis is held on January 31st
+		[]string{"2025-12-31T17:00:00Z", "2026-01-01T08:00:00Z", "2026-01-15T23:30:00Z", "2026-02-01T00:30:00+01:00", "2026-02-01T08:00:00Z"},
+		[]string{"2026-01-10T17:00:00Z", "2026-01-20T17:00:00Z"})
+
+	tests := []struct {
+		name         string
+		start, end   string
+		units, total int
+	}{
+		{name: "whole month", start: "2026-01-01", end: "2026-01-31", units: 3, total: 3},
+		{name: "first half", start: "2026-01-01", end: "2026-01-15", units: 2, total: 3},
+		{name: "first day", start: "2026-01-01", end: "2026-01-01", units: 1, total: 3},
+		{name: "last days", start: "2026-01-16", end: "2026-01-31", units: 1, total: 3},
+		{name: "only cancelled sessions", start: "2026-01-17", end: "2026-01-25", units: 0, total: 3},
+	}
+	p := newProrater(store, logging.L(), models.ProrateSessions)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units, total, err := p.sessionsIn(t.Context(), groupID, day("2026-01-01"), day("2026-01-31"), day(tt.start), day(tt.end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if units != tt.units || total != tt.total {
+				t.Fatalf("sessionsIn = %d of %d, want %d of %d", units, total, tt.units, tt.total)
+			}
+		})
+	}
+}
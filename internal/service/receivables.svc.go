@@ -0,0 +1,757 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/notify"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+)
+
+// Policies charging a late fee on overdue invoices
+const (
+	LateFeeNone    = "none"
+	LateFeeFixed   = "fixed"
+	LateFeePercent = "percent"
+)
+
+// LateFeePolicy is the fee charged once on an invoice overdue by After days
+// or more: Amount under LateFeeFixed, Percent of what is left to pay under
+// LateFeePercent
+type LateFeePolicy struct {
+	Kind    string
+	Amount  money.Amount
+	Percent int
+	After   int
+}
+
+// fee is the late fee charged on an invoice with due left to pay
+func (p LateFeePolicy) fee(due money.Amount) money.Amount {
+	switch p.Kind {
+	case LateFeeFixed:
+		return p.Amount
+	case LateFeePercent:
+		return due.Percent(p.Percent)
+	}
+	return 0
+}
+
+// ParseReminderDays parses the days overdue reminders escalate at, such as
+// "7,21,45": the first reminder is sent 7 days after the due date, the second
+// after 21 and the last after 45
+func ParseReminderDays(s string) ([]int, error) {
+	days := []int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := strconv.Atoi(part)
+		if err != nil || d < 1 {
+			return nil, fmt.Errorf("reminder day %q is not a number of days above zero", part)
+		}
+		if len(days) > 0 && d <= days[len(days)-1] {
+			return nil, fmt.Errorf("reminder days must be increasing, %d comes after %d", d, days[len(days)-1])
+		}
+		days = append(days, d)
+	}
+	if len(days) == 0 {
+		return nil, errors.New("no reminder days configured")
+	}
+	return days, nil
+}
+
+// ReceivablesService follows up on what families owe on issued invoices: it
+// ages the balances, reminds the parents of overdue invoices in messages
+// escalating with the days overdue, and charges late fees under the policy.
+// See docs/receivables.md.
+type ReceivablesService struct {
+	store    Store
+	log      zerolog.Logger
+	invoices *InvoicesService
+	notifier notify.Notifier
+	// reminderDays are the days overdue each level of reminder is sent at
+	reminderDays []int
+	lateFee      LateFeePolicy
+	open         Repository[models.Invoices]
+	lines        Repository[models.InvoiceLines]
+	reminders    Repository[models.Reminders]
+	links        Repository[models.StudentParents]
+	parents      Repository[models.Parents]
+}
+
+func NewReceivablesService(store Store, invoices *InvoicesService, notifier notify.Notifier, reminderDays []int, lateFee LateFeePolicy) (*ReceivablesService, error) {
+	log := logging.L().With().Str("service", "receivables.svc").Logger()
+	if invoices == nil {
+		return nil, errors.New("invoices service is required")
+	}
+	if notifier == nil {
+		return nil, errors.New("no notification channel configured")
+	}
+	if len(reminderDays) == 0 {
+		return nil, errors.New("no reminder days configured")
+	}
+	switch {
+	case lateFee.Kind == LateFeeFixed && lateFee.Amount <= 0:
+		return nil, errors.New("the fixed late fee must be above zero")
+	case lateFee.Kind == LateFeePercent && (lateFee.Percent < 1 || lateFee.Percent > 100):
+		return nil, errors.New("the late fee percent must be between 1 and 100")
+	case lateFee.Kind != LateFeeNone && lateFee.Kind != LateFeeFixed && lateFee.Kind != LateFeePercent:
+		return nil, fmt.Errorf("unknown late fee policy %q", lateFee.Kind)
+	}
+	// due today isn't overdue yet
+	lateFee.After = max(lateFee.After, 1)
+	return &ReceivablesService{
+		store:        store,
+		log:          log,
+		invoices:     invoices,
+		notifier:     notifier,
+		reminderDays: reminderDays,
+		lateFee:      lateFee,
+		open:         NewRepository[models.Invoices](store),
+		lines:        NewRepository[models.InvoiceLines](store),
+		reminders:    NewRepository[models.Reminders](store),
+		links:        NewRepository[models.StudentParents](store),
+		parents:      NewRepository[models.Parents](store),
+	}, nil
+}
+
+// receivable is an issued invoice with something left to pay on a day
+type receivable struct {
+	inv *models.Invoices
+	due money.Amount
+	// days are the days past the due date, negative while not due
+	days int
+	// level is the level of reminder the days reached, 0 before the first
+	level int
+}
+
+// family are students sharing a parent, and their parents
+type family struct {
+	studentIDs []string
+	parentIDs  []string
+	open       []*receivable
+}
+
+// daysBetween counts the days from one day to another
+func daysBetween(from time.Time, to time.Time) int {
+	return int(dateOf(to).Sub(dateOf(from)).Hours() / 24)
+}
+
+// level is the level of reminder an invoice overdue by days reached
+func (s *ReceivablesService) level(days int) int {
+	level := 0
+	for _, d := range s.reminderDays {
+		if days >= d {
+			level++
+		}
+	}
+	return level
+}
+
+// families returns the issued invoices left to pay on asOf grouped by
+// family, students with no parent being a family of their own. Families are
+// sorted by their first student.
+func (s *ReceivablesService) families(ctx context.Context, asOf time.Time) ([]*family, error) {
+	invoices, err := listAll(ctx, s.open, ListSpec{
+		Where:     map[string]any{"status": models.InvoiceIssued},
+		Relations: []string{"Student.User"},
+	})
+	if err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	open := []*receivable{}
+	for i := range invoices {
+		inv := &invoices[i]
+		due := owedOn(inv)
+		if due <= 0 {
+			continue
+		}
+		dueDate := cmp.Or(ptrValue(inv.DueDate), dateOf(ptrValue(inv.IssuedAt)))
+		r := &receivable{inv: inv, due: due, days: daysBetween(dueDate, asOf)}
+		r.level = s.level(r.days)
+		open = append(open, r)
+	}
+	if len(open) == 0 {
+		return []*family{}, nil
+	}
+	studentIDs := []string{}
+	for _, r := range open {
+		if !slices.Contains(studentIDs, r.inv.StudentID) {
+			studentIDs = append(studentIDs, r.inv.StudentID)
+		}
+	}
+	links, err := listAll(ctx, s.links, ListSpec{Where: map[string]any{"student_id": studentIDs}})
+	if err != nil {
+		return nil, dbError(s.log, err, "student-parent relationship")
+	}
+
+	// students sharing a parent end up with the same root
+	root := map[string]string{}
+	find := func(id string) string {
+		for root[id] != "" && root[id] != id {
+			id = root[id]
+		}
+		return id
+	}
+	for _, id := range studentIDs {
+		root[id] = id
+	}
+	byParent := map[string]string{}
+	for _, l := range links {
+		if other, ok := byParent[l.ParentID]; ok {
+			root[find(l.StudentID)] = find(other)
+		} else {
+			byParent[l.ParentID] = l.StudentID
+		}
+	}
+	byRoot := map[string]*family{}
+	for _, id := range studentIDs {
+		r := find(id)
+		if byRoot[r] == nil {
+			byRoot[r] = &family{parentIDs: []string{}}
+		}
+		byRoot[r].studentIDs = append(byRoot[r].studentIDs, id)
+	}
+	for parentID, studentID := range byParent {
+		f := byRoot[find(studentID)]
+		f.parentIDs = append(f.parentIDs, parentID)
+	}
+	for _, r := range open {
+		f := byRoot[find(r.inv.StudentID)]
+		f.open = append(f.open, r)
+	}
+	res := slices.Collect(maps.Values(byRoot))
+	for _, f := range res {
+		slices.Sort(f.studentIDs)
+		slices.Sort(f.parentIDs)
+		slices.SortFunc(f.open, func(a, b *receivable) int {
+			return cmp.Or(cmp.Compare(b.days, a.days), cmp.Compare(a.inv.InvoiceID, b.inv.InvoiceID))
+		})
+	}
+	slices.SortFunc(res, func(a, b *family) int { return cmp.Compare(a.studentIDs[0], b.studentIDs[0]) })
+	return res, nil
+}
+
+// GetAging returns what families owe on asOf, today when nil, by days past
+// the due date of the invoices
+func (s *ReceivablesService) GetAging(ctx context.Context, asOf *string) (*dto.ReceivablesAgingResBody, error) {
+	day, err := parseDateOr(asOf, "query.as_of")
+	if err != nil {
+		return nil, err
+	}
+	families, err := s.families(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.ReceivablesAgingResBody{
+		AsOf:     day.Format(time.DateOnly),
+		Currency: money.CenterCurrency().Code,
+		Families: make([]dto.FamilyAgingRes, 0, len(families)),
+	}
+	for _, f := range families {
+		row := dto.FamilyAgingRes{StudentIDs: f.studentIDs, ParentIDs: f.parentIDs}
+		for _, r := range f.open {
+			age(&row.Buckets, r)
+			age(&res.Totals, r)
+		}
+		res.Families = append(res.Families, row)
+	}
+	slices.SortStableFunc(res.Families, func(a, b dto.FamilyAgingRes) int {
+		return cmp.Compare(b.Buckets.Total-b.Buckets.Current, a.Buckets.Total-a.Buckets.Current)
+	})
+	return res, nil
+}
+
+// age adds what is left to pay on r to its bucket
+func age(b *dto.AgingBucketsRes, r *receivable) {
+	switch {
+	case r.days < 0:
+		b.Current += r.due
+	case r.days <= 30:
+		b.Days0To30 += r.due
+	case r.days <= 60:
+		b.Days31To60 += r.due
+	case r.days <= 90:
+		b.Days61To90 += r.due
+	default:
+		b.Days90Plus += r.due
+	}
+	b.Total += r.due
+}
+
+// RunReminders charges the late fees due today and reminds every family of
+// their overdue invoices, once per level of reminder an invoice reaches. A
+// family gets one message per run, at the highest level reached, sent to
+// their parents or to the students when they have none. Reminders that
+// failed are sent again by the next run. Running twice is harmless, and a
+// dry run only reports what would be done.
+func (s *ReceivablesService) RunReminders(ctx context.Context, dryRun bool) (*dto.RemindersRunResBody, error) {
+	today := dateOf(time.Now())
+	families, err := s.families(ctx, today)
+	if err != nil {
+		return nil, err
+	}
+	res := &dto.RemindersRunResBody{AsOf: today.Format(time.DateOnly), DryRun: dryRun, Families: []dto.OverdueFamilyRes{}}
+	for _, f := range families {
+		row, err := s.remind(ctx, today, f, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			continue
+		}
+		for _, inv := range row.Invoices {
+			if inv.LateFee != nil {
+				res.LateFees++
+			}
+		}
+		switch {
+		case row.Error != nil:
+			res.Failed++
+		case len(row.Recipients) > 0:
+			res.Sent++
+		}
+		res.Families = append(res.Families, *row)
+	}
+	return res, nil
+}
+
+// RunSchedule runs the reminders every interval until ctx is done
+func (s *ReceivablesService) RunSchedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res, err := s.RunReminders(ctx, false)
+			if err != nil {
+				s.log.Err(err).Msg("Couldn't run overdue reminders")
+				continue
+			}
+			if res.Sent > 0 || res.Failed > 0 || res.LateFees > 0 {
+				s.log.Info().Int("sent", res.Sent).Int("failed", res.Failed).Int("late_fees", res.LateFees).
+					Msg("Ran overdue reminders")
+			}
+		}
+	}
+}
+
+// remind charges the late fees of the family and sends their reminder, nil
+// when nothing of theirs is overdue
+func (s *ReceivablesService) remind(ctx context.Context, today time.Time, f *family, dryRun bool) (*dto.OverdueFamilyRes, error) {
+	overdue := slices.DeleteFunc(slices.Clone(f.open), func(r *receivable) bool { return r.days < 1 })
+	if len(overdue) == 0 {
+		return nil, nil
+	}
+	row := &dto.OverdueFamilyRes{StudentIDs: f.studentIDs, ParentIDs: f.parentIDs, Recipients: []string{}}
+	byInvoice := map[string]*dto.OverdueInvoiceRes{}
+	for _, r := range overdue {
+		row.Overdue += r.due
+		row.Level = max(row.Level, r.level)
+		row.Invoices = append(row.Invoices, dto.OverdueInvoiceRes{
+			InvoiceID:        r.inv.InvoiceID,
+			Number:           ptrValue(r.inv.Number),
+			StudentID:        r.inv.StudentID,
+			DueDate:          today.AddDate(0, 0, -r.days).Format(time.DateOnly),
+			DaysOverdue:      r.days,
+			AmountDue:        r.due,
+			Level:            r.level,
+			LateFeeInvoiceID: r.inv.LateFeeInvoiceID,
+		})
+	}
+	for i := range row.Invoices {
+		byInvoice[row.Invoices[i].InvoiceID] = &row.Invoices[i]
+	}
+
+	if err := s.chargeLateFees(ctx, today, overdue, byInvoice, dryRun); err != nil {
+		return nil, err
+	}
+
+	to, err := s.recipients(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	var claimed []models.Reminders
+	if dryRun {
+		claimed, err = s.pending(ctx, overdue)
+	} else {
+		claimed, err = s.claim(ctx, overdue, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return row, nil
+	}
+	level := 0
+	for _, c := range claimed {
+		byInvoice[c.InvoiceID].Reminded = true
+		level = max(level, c.Level)
+	}
+	for _, r := range to {
+		row.Recipients = append(row.Recipients, r.UserID)
+	}
+	if dryRun {
+		return row, nil
+	}
+
+	msg := s.message(level, to, overdue, byInvoice)
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		s.log.Err(err).Strs("student_ids", f.studentIDs).Int("level", level).Msg("Couldn't send overdue reminder")
+		reason := err.Error()
+		row.Error = &reason
+		if err := s.fail(ctx, claimed, reason); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// pending returns the reminders overdue invoices are due, those not sent yet
+// at the level they reached
+func (s *ReceivablesService) pending(ctx context.Context, overdue []*receivable) ([]models.Reminders, error) {
+	ids := make([]string, len(overdue))
+	for i, r := range overdue {
+		ids[i] = r.inv.InvoiceID
+	}
+	sent, err := listAll(ctx, s.reminders, ListSpec{Where: map[string]any{"invoice_id": ids}})
+	if err != nil {
+		return nil, dbError(s.log, err, "reminder")
+	}
+	res := []models.Reminders{}
+	for _, r := range overdue {
+		if r.level == 0 {
+			continue
+		}
+		i := slices.IndexFunc(sent, func(m models.Reminders) bool {
+			return m.InvoiceID == r.inv.InvoiceID && m.Level == r.level
+		})
+		if i >= 0 && sent[i].Status == models.ReminderSent {
+			continue
+		}
+		m := models.Reminders{ReminderID: ulid.Make().String(), InvoiceID: r.inv.InvoiceID}
+		if i >= 0 {
+			m = sent[i]
+		}
+		m.StudentID = r.inv.StudentID
+		m.Level = r.level
+		m.DaysOverdue = r.days
+		m.AmountDue = r.due
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// claim records the reminders the overdue invoices are due as sent to to,
+// before sending them, so runs racing send each reminder once
+func (s *ReceivablesService) claim(ctx context.Context, overdue []*receivable, to []notify.Recipient) ([]models.Reminders, error) {
+	recipients := make([]string, len(to))
+	for i, r := range to {
+		recipients[i] = r.UserID
+	}
+	var claimed []models.Reminders
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err := s.store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		var err error
+		claimed, err = s.pending(ctx, overdue)
+		if err != nil {
+			return err
+		}
+		for i := range claimed {
+			m := &claimed[i]
+			failed := m.Status == models.ReminderFailed
+			m.Status = models.ReminderSent
+			m.Recipients = recipients
+			m.Error = nil
+			if failed {
+				err = s.reminders.Update(ctx, m, "days_overdue", "amount_due", "recipients", "status", "error")
+			} else {
+				err = s.reminders.Insert(ctx, m)
+			}
+			if err != nil {
+				return dbError(s.log, err, "reminder")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// fail marks the claimed reminders failed for reason, so the next run sends
+// them again
+func (s *ReceivablesService) fail(ctx context.Context, claimed []models.Reminders, reason string) error {
+	return s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		for i := range claimed {
+			m := &claimed[i]
+			m.Status = models.ReminderFailed
+			m.Error = &reason
+			if err := s.reminders.Update(ctx, m, "status", "error"); err != nil {
+				return dbError(s.log, err, "reminder")
+			}
+		}
+		return nil
+	})
+}
+
+// recipients are the users of the parents of f, or of its students when
+// they have no parent
+func (s *ReceivablesService) recipients(ctx context.Context, f *family) ([]notify.Recipient, error) {
+	users := []*models.Users{}
+	if len(f.parentIDs) > 0 {
+		parents, err := listAll(ctx, s.parents, ListSpec{Where: map[string]any{"id": f.parentIDs}, Relations: []string{"User"}})
+		if err != nil {
+			return nil, dbError(s.log, err, "parent")
+		}
+		for _, p := range parents {
+			users = append(users, p.User)
+		}
+	}
+	if len(users) == 0 {
+		for _, r := range f.open {
+			if st := r.inv.Student; st != nil && !slices.Contains(users, st.User) {
+				users = append(users, st.User)
+			}
+		}
+	}
+	to := []notify.Recipient{}
+	for _, u := range users {
+		if u == nil || u.UserID == "" || slices.ContainsFunc(to, func(r notify.Recipient) bool { return r.UserID == u.UserID }) {
+			continue
+		}
+		to = append(to, notify.Recipient{UserID: u.UserID, Name: userName(u), Email: u.Email, Phone: ptrValue(u.PhoneNumber)})
+	}
+	return to, nil
+}
+
+// message is the reminder at level about the overdue invoices. Its tone
+// hardens with the level, the last one being a final notice.
+func (s *ReceivablesService) message(level int, to []notify.Recipient, overdue []*receivable, byInvoice map[string]*dto.OverdueInvoiceRes) notify.Message {
+	names := make([]string, len(to))
+	for i, r := range to {
+		names[i] = r.Name
+	}
+	currency := money.CenterCurrency().Code
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dear %s,\n\n", strings.Join(names, ", "))
+	subject := "Payment reminder"
+	switch {
+	case level >= len(s.reminderDays) && level > 1:
+		subject = "Final notice: unpaid invoices"
+		b.WriteString("Despite our previous reminders, the invoices below are still unpaid. This is our final notice: please pay them or contact us without delay.\n\n")
+	case level > 1:
+		subject = fmt.Sprintf("Payment reminder %d: unpaid invoices", level)
+		b.WriteString("We haven't received payment of the invoices below despite our previous reminder. Please pay them as soon as possible.\n\n")
+	default:
+		b.WriteString("The invoices below are past their due date. If you have already paid them, please disregard this message.\n\n")
+	}
+	var total money.Amount
+	for _, r := range overdue {
+		total += r.due
+		name := r.inv.StudentID
+		if r.inv.Student != nil {
+			name = studentName(r.inv.Student)
+		}
+		fmt.Fprintf(&b, "- Invoice %s for %s, due %s, %d days overdue: %s %s left to pay\n",
+			ptrValue(r.inv.Number), name, byInvoice[r.inv.InvoiceID].DueDate, r.days, r.due, currency)
+	}
+	fmt.Fprintf(&b, "\nTotal overdue: %s %s\n", total, currency)
+	for _, r := range overdue {
+		if fee := byInvoice[r.inv.InvoiceID].LateFee; fee != nil {
+			fmt.Fprintf(&b, "A late fee of %s %s was charged on invoice %s.\n", *fee, currency, ptrValue(r.inv.Number))
+		}
+	}
+	chargeable := slices.ContainsFunc(overdue, func(r *receivable) bool {
+		return r.inv.Period != models.PeriodLateFee && byInvoice[r.inv.InvoiceID].LateFeeInvoiceID == nil
+	})
+	if s.lateFee.Kind != LateFeeNone && chargeable {
+		fmt.Fprintf(&b, "A late fee is charged on invoices overdue by %d days or more.\n", s.lateFee.After)
+	}
+	return notify.Message{To: to, Subject: subject, Body: b.String()}
+}
+
+// chargeLateFees bills the late fee of the overdue invoices reaching the
+// policy that weren't charged one yet, on an invoice per student issued
+// today. Late fee invoices aren't charged late fees themselves.
+func (s *ReceivablesService) chargeLateFees(ctx context.Context, today time.Time, overdue []*receivable, byInvoice map[string]*dto.OverdueInvoiceRes, dryRun bool) error {
+	if s.lateFee.Kind == LateFeeNone {
+		return nil
+	}
+	byStudent := map[string][]*receivable{}
+	for _, r := range overdue {
+		if r.days >= s.lateFee.After && r.inv.Period != models.PeriodLateFee && r.inv.LateFeeInvoiceID == nil && s.lateFee.fee(r.due) > 0 {
+			byStudent[r.inv.StudentID] = append(byStudent[r.inv.StudentID], r)
+		}
+	}
+	for _, studentID := range slices.Sorted(maps.Keys(byStudent)) {
+		charged := byStudent[studentID]
+		if dryRun {
+			for _, r := range charged {
+				fee := s.lateFee.fee(r.due)
+				byInvoice[r.inv.InvoiceID].LateFee = &fee
+			}
+			continue
+		}
+		fees, feeInvoiceID, err := s.chargeLateFee(ctx, today, studentID, charged)
+		if err != nil {
+			return err
+		}
+		for id, fee := range fees {
+			byInvoice[id].LateFee = &fee
+			byInvoice[id].LateFeeInvoiceID = &feeInvoiceID
+		}
+	}
+	return nil
+}
+
+// chargeLateFee issues the late fee invoice of the student for today, with a
+// line per invoice charged, and returns the fees charged by invoice
+func (s *ReceivablesService) chargeLateFee(ctx context.Context, today time.Time, studentID string, charged []*receivable) (map[string]money.Amount, string, error) {
+	var fees map[string]money.Amount
+	feeInv := models.Invoices{}
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err := s.store.RunInTx(ctx, opts, func(ctx context.Context) error {
+		fees = map[string]money.Amount{}
+		billed, err := listAll(ctx, s.open, ListSpec{Where: map[string]any{
+			"student_id": studentID, "period": models.PeriodLateFee, "period_start": today,
+		}})
+		if err != nil {
+			return dbError(s.log, err, "invoice")
+		}
+		if slices.ContainsFunc(billed, func(inv models.Invoices) bool { return inv.Status != models.InvoiceVoid }) {
+			s.log.Warn().Str("student_id", studentID).Msg("Late fees were already charged today, leaving the rest for tomorrow")
+			return nil
+		}
+
+		feeInv = models.Invoices{
+			InvoiceID:   ulid.Make().String(),
+			Center:      s.invoices.center,
+			Currency:    money.CenterCurrency().Code,
+			StudentID:   studentID,
+			Period:      models.PeriodLateFee,
+			PeriodStart: today,
+			PeriodEnd:   today,
+			Status:      models.InvoiceDraft,
+		}
+		lines := []models.InvoiceLines{}
+		invoices := []*models.Invoices{}
+		for _, r := range charged {
+			inv := models.Invoices{InvoiceID: r.inv.InvoiceID}
+			if err := s.open.Lock(ctx, &inv); err != nil {
+				return dbError(s.log, err, "invoice")
+			}
+			// paid or charged since it was listed
+			if inv.Status != models.InvoiceIssued || inv.LateFeeInvoiceID != nil || owedOn(&inv) <= 0 {
+				continue
+			}
+			fee := s.lateFee.fee(owedOn(&inv))
+			lines = append(lines, models.InvoiceLines{
+				LineID:      ulid.Make().String(),
+				InvoiceID:   feeInv.InvoiceID,
+				Position:    len(lines) + 1,
+				Description: fmt.Sprintf("Late fee on invoice %s, %d days overdue", ptrValue(inv.Number), r.days),
+				Quantity:    1,
+				ListPrice:   fee,
+				UnitPrice:   fee,
+				Adjustments: []models.PriceAdjustment{},
+				Amount:      fee,
+				CoveredFrom: today,
+				CoveredTo:   today,
+			})
+			feeInv.Total += fee
+			fees[inv.InvoiceID] = fee
+			invoices = append(invoices, &inv)
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		if err := s.open.Insert(ctx, &feeInv); err != nil {
+			s.log.Err(err).Str("student_id", studentID).Msg("Couldn't insert late fee invoice")
+			return dbError(s.log, err, "invoice")
+		}
+		for i := range lines {
+			if err := s.lines.Insert(ctx, &lines[i]); err != nil {
+				return dbError(s.log, err, "invoice line")
+			}
+		}
+		if _, err := s.invoices.IssueInvoice(ctx, feeInv.InvoiceID); err != nil {
+			return err
+		}
+		for _, inv := range invoices {
+			inv.LateFeeInvoiceID = &feeInv.InvoiceID
+			if err := s.open.Update(ctx, inv, "late_fee_invoice_id"); err != nil {
+				return dbError(s.log, err, "invoice")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return fees, feeInv.InvoiceID, nil
+}
+
+// GetRemindersByInvoiceID lists the reminders sent about the invoice, the
+// first first
+func (s *ReceivablesService) GetRemindersByInvoiceID(ctx context.Context, invoiceID string) (*dto.GetRemindersByInvoiceIDRes, error) {
+	if _, err := ulid.Parse(invoiceID); err != nil {
+		return nil, huma.Error400BadRequest("invoiceID is invalid", err)
+	}
+	inv := models.Invoices{InvoiceID: invoiceID}
+	if err := s.open.Get(ctx, &inv); err != nil {
+		return nil, dbError(s.log, err, "invoice")
+	}
+	rows, err := listAll(ctx, s.reminders, ListSpec{Where: map[string]any{"invoice_id": invoiceID}})
+	if err != nil {
+		return nil, dbError(s.log, err, "reminder")
+	}
+	res := &dto.GetRemindersByInvoiceIDRes{}
+	res.Body.Reminders = make([]dto.ReminderRes, len(rows))
+	for i := range rows {
+		res.Body.Reminders[i] = reminderToRes(&rows[i])
+	}
+	return res, nil
+}
+
+func reminderToRes(m *models.Reminders) dto.ReminderRes {
+	res := dto.ReminderRes{
+		ID:          m.ReminderID,
+		InvoiceID:   m.InvoiceID,
+		StudentID:   m.StudentID,
+		Level:       m.Level,
+		DaysOverdue: m.DaysOverdue,
+		AmountDue:   m.AmountDue,
+		Recipients:  m.Recipients,
+		Status:      m.Status,
+		Error:       m.Error,
+	}
+	if res.Recipients == nil {
+		res.Recipients = []string{}
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/money"
+	"github.com/ICan-TC/users/internal/notify"
+)
+
+// fakeNotifier keeps the messages sent, failing with err when set
+type fakeNotifier struct {
+	sent []notify.Message
+	err  error
+}
+
+func (n *fakeNotifier) Send(ctx context.Context, m notify.Message) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, m)
+	return nil
+}
+
+// newReceivables returns the receivables of the store reminding at 7, 21
+// and 45 days overdue through n
+func newReceivables(t *testing.T, store Store, n notify.Notifier, lateFee LateFeePolicy) *ReceivablesService {
+	t.Helper()
+	invoices, err := NewInvoicesService(store, "test", models.ProrateNone, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewReceivablesService(store, invoices, n, []int{7, 21, 45}, lateFee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLateFeePolicyFee(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LateFeePolicy
+		due    money.Amount
+		want   money.Amount
+	}{
+		{name: "none", policy: LateFeePolicy{Kind: LateFeeNone}, due: 45000, want: 0},
+		{name: "fixed", policy: LateFeePolicy{Kind: LateFeeFixed, Amount: 5000}, due: 45000, want: 5000},
+		{name: "fixed above what is left", policy: LateFeePolicy{Kind: LateFeeFixed, Amount: 5000}, due: 1000, want: 5000},
+		{name: "percent", policy: LateFeePolicy{Kind: LateFeePercent, Percent: 10}, due: 45000, want: 4500},
+		{name: "percent rounded down", policy: LateFeePolicy{Kind: LateFeePercent, Percent: 5}, due: 12345, want: 617},
+		{name: "percent rounded half up", policy: LateFeePolicy{Kind: LateFeePercent, Percent: 10}, due: 12345, want: 1235},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.fee(tt.due); got != tt.want {
+				t.Fatalf("fee(%s) = %s, want %s", tt.due, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceivablesLevel(t *testing.T) {
+	s := newReceivables(t, NewMemoryStore(), &fakeNotifier{}, LateFeePolicy{Kind: LateFeeNone})
+	tests := []struct {
+		days, want int
+	}{
+		{days: -3, want: 0},
+		{days: 0, want: 0},
+		{days: 6, want: 0},
+		{days: 7, want: 1},
+		{days: 20, want: 1},
+		{days: 21, want: 2},
+		{days: 44, want: 2},
+		{days: 45, want: 3},
+		{days: 400, want: 3},
+	}
+	for _, tt := range tests {
+		if got := s.level(tt.days); got != tt.want {
+			t.Errorf("level(%d) = %d, want %d", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestAge(t *testing.T) {
+	tests := []struct {
+		days int
+		want dto.AgingBucketsRes
+	}{
+		{days: -1, want: dto.AgingBucketsRes{Current: 1000}},
+		{days: 0, want: dto.AgingBucketsRes{Days0To30: 1000}},
+		{days: 30, want: dto.AgingBucketsRes{Days0To30: 1000}},
+		{days: 31, want: dto.AgingBucketsRes{Days31To60: 1000}},
+		{days: 60, want: dto.AgingBucketsRes{Days31To60: 1000}},
+		{days: 61, want: dto.AgingBucketsRes{Days61To90: 1000}},
+		{days: 90, want: dto.AgingBucketsRes{Days61To90: 1000}},
+		{days: 91, want: dto.AgingBucketsRes{Days90Plus: 1000}},
+	}
+	for _, tt := range tests {
+		var got dto.AgingBucketsRes
+		age(&got, &receivable{days: tt.days, due: 1000})
+		tt.want.Total = 1000
+		if got != tt.want {
+			t.Errorf("age of %d days = %+v, want %+v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestChargeLateFees(t *testing.T) {
+	store := NewMemoryStore()
+	s := newReceivables(t, store, &fakeNotifier{}, LateFeePolicy{Kind: LateFeeFixed, Amount: 5000, After: 10})
+	today := day("2026-03-01")
+	// invoices are due 15 days after they are issued
+	overdueBy := func(studentID string, n int, days int) models.Invoices {
+		t.Helper()
+		return seedInvoice(t, store, studentID, n, today.AddDate(0, 0, -15-days), 30000)
+	}
+	student, other := seedStudent(t, store, "student"), seedStudent(t, store, "other")
+	late, early, later := overdueBy(student, 1, 20), overdueBy(student, 2, 5), overdueBy(student, 3, 40)
+	// a late fee invoice, and an invoice it already charged
+	fee, charged := overdueBy(other, 4, 30), overdueBy(other, 5, 30)
+	fee.Period = models.PeriodLateFee
+	if err := s.open.Update(t.Context(), &fee, "period"); err != nil {
+		t.Fatal(err)
+	}
+	charged.LateFeeInvoiceID = &fee.InvoiceID
+	if err := s.open.Update(t.Context(), &charged, "late_fee_invoice_id"); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(dryRun bool) map[string]*dto.OverdueInvoiceRes {
+		t.Helper()
+		families, err := s.families(t.Context(), today)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var overdue []*receivable
+		byInvoice := map[string]*dto.OverdueInvoiceRes{}
+		for _, f := range families {
+			for _, r := range f.open {
+				if r.days >= 1 {
+					overdue = append(overdue, r)
+					byInvoice[r.inv.InvoiceID] = &dto.OverdueInvoiceRes{InvoiceID: r.inv.InvoiceID}
+				}
+			}
+		}
+		if err := s.chargeLateFees(t.Context(), today, overdue, byInvoice, dryRun); err != nil {
+			t.Fatal(err)
+		}
+		return byInvoice
+	}
+	feeInvoices := func() []models.Invoices {
+		t.Helper()
+		all, err := listAll(t.Context(), s.open, ListSpec{Where: map[string]any{"period": models.PeriodLateFee, "period_start": today}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return all
+	}
+	feeOf := func(byInvoice map[string]*dto.OverdueInvoiceRes, id string) money.Amount {
+		if byInvoice[id] == nil || byInvoice[id].LateFee == nil {
+			return 0
+		}
+		return *byInvoice[id].LateFee
+	}
+
+	// a dry run reports the fees without charging them
+	byInvoice := run(true)
+	if feeOf(byInvoice, late.InvoiceID) != 5000 || feeOf(byInvoice, later.InvoiceID) != 5000 {
+		t.Fatalf("dry run charged %s and %s, want 5.000 each", feeOf(byInvoice, late.InvoiceID), feeOf(byInvoice, later.InvoiceID))
+	}
+	if n := len(feeInvoices()); n != 0 {
+		t.Fatalf("dry run issued %d late fee invoices", n)
+	}
+
+	byInvoice = run(false)
+	for _, id := range []string{early.InvoiceID, fee.InvoiceID, charged.InvoiceID} {
+		if f := feeOf(byInvoice, id); f != 0 {
+			t.Errorf("charged %s on invoice %s", f, id)
+		}
+	}
+	issued := feeInvoices()
+	if len(issued) != 1 {
+		t.Fatalf("issued %d late fee invoices, want 1", len(issued))
+	}
+	feeInv := issued[0]
+	if feeInv.StudentID != student || feeInv.Status != models.InvoiceIssued || feeInv.Total != 10000 {
+		t.Fatalf("late fee invoice %+v, want 10.000 issued to the student", feeInv)
+	}
+	lines, err := listAll(t.Context(), s.lines, ListSpec{Where: map[string]any{"invoice_id": feeInv.InvoiceID}})
+	if err != nil || len(lines) != 2 {
+		t.Fatalf("late fee invoice has %d lines, %v, want 2", len(lines), err)
+	}
+	for _, inv := range []models.Invoices{late, later} {
+		if err := s.open.Get(t.Context(), &inv); err != nil {
+			t.Fatal(err)
+		}
+		if inv.LateFeeInvoiceID == nil || *inv.LateFeeInvoiceID != feeInv.InvoiceID || feeOf(byInvoice, inv.InvoiceID) != 5000 {
+			t.Fatalf("invoice %s isn't charged by the late fee invoice", *inv.Number)
+		}
+	}
+	checkBalanced(t, store)
+
+	// fees are charged once
+	byInvoice = run(false)
+	for id := range byInvoice {
+		if f := feeOf(byInvoice, id); f != 0 {
+			t.Errorf("charged %s again on invoice %s", f, id)
+		}
+	}
+	if n := len(feeInvoices()); n != 1 {
+		t.Fatalf("issued %d late fee invoices, want 1", n)
+	}
+}
+
+func TestRunReminders(t *testing.T) {
+	store := NewMemoryStore()
+	n := &fakeNotifier{}
+	s := newReceivables(t, store, n, LateFeePolicy{Kind: LateFeeFixed, Amount: 5000, After: 14})
+	studentID := seedStudent(t, store, "student")
+	parentID := seedParent(t, store, "parent", studentID)
+	parent := models.Parents{ParentID: parentID}
+	if err := NewRepository[models.Parents](store).Get(t.Context(), &parent); err != nil {
+		t.Fatal(err)
+	}
+	today := dateOf(time.Now())
+	inv := seedInvoice(t, store, studentID, 1, today.AddDate(0, 0, -30), 30000)
+	overdueBy := func(days int) {
+		t.Helper()
+		due := today.AddDate(0, 0, -days)
+		inv.DueDate = &due
+		if err := s.open.Update(t.Context(), &inv, "due_date"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		days     int
+		err      error
+		sent     int
+		failed   int
+		lateFees int
+		// subject of the message sent, none when empty
+		subject string
+	}{
+		{name: "not due yet", days: -1},
+		{name: "overdue before the first reminder", days: 3},
+		{name: "first reminder", days: 7, sent: 1, subject: "Payment reminder"},
+		{name: "sent once", days: 8},
+		{name: "second reminder and the late fee", days: 21, sent: 1, lateFees: 1, subject: "Payment reminder 2: unpaid invoices"},
+		{name: "late fee charged once", days: 30},
+		{name: "final notice fails", days: 45, err: errors.New("mailbox full"), failed: 1},
+		{name: "final notice sent again", days: 46, sent: 1, subject: "Final notice: unpaid invoices"},
+		{name: "nothing left to send", days: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overdueBy(tt.days)
+			n.sent, n.err = nil, tt.err
+			res, err := s.RunReminders(t.Context(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Sent != tt.sent || res.Failed != tt.failed || res.LateFees != tt.lateFees {
+				t.Fatalf("sent %d, failed %d and charged %d late fees, want %d, %d and %d",
+					res.Sent, res.Failed, res.LateFees, tt.sent, tt.failed, tt.lateFees)
+			}
+			if tt.subject == "" {
+				if len(n.sent) != 0 {
+					t.Fatalf("sent %+v", n.sent)
+				}
+				return
+			}
+			if len(n.sent) != 1 || n.sent[0].Subject != tt.subject {
+				t.Fatalf("sent %+v, want one message %q", n.sent, tt.subject)
+			}
+			if to := n.sent[0].To; len(to) != 1 || to[0].UserID != parent.UserID {
+				t.Fatalf("sent to %+v, want the parent", to)
+			}
+			if tt.lateFees > 0 && !strings.Contains(n.sent[0].Body, "A late fee of 5.000") {
+				t.Fatalf("message doesn't mention the late fee:\n%s", n.sent[0].Body)
+			}
+		})
+	}
+
+	res, err := s.GetRemindersByInvoiceID(t.Context(), inv.InvoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Body.Reminders; len(got) != 3 {
+		t.Fatalf("%d reminders recorded, want one per level", len(got))
+	}
+	for _, r := range res.Body.Reminders {
+		if r.Status != models.ReminderSent || r.Error != nil {
+			t.Fatalf("reminder %+v wasn't sent", r)
+		}
+	}
+}
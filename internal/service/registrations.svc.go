@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+)
+
+// RegistrationsService enrolls a new student in one go by composing the
+// user, student, parent and enrollment services in a single unit of work.
+type RegistrationsService struct {
+	store Store
+	log   zerolog.Logger
+	usvc  *UsersService
+	ssvc  *StudentsService
+	psvc  *ParentsService
+	spsvc *StudentParentsService
+	esvc  *EnrollmentsService
+}
+
+func NewRegistrationsService(store Store, usvc *UsersService, ssvc *StudentsService, psvc *ParentsService, spsvc *StudentParentsService, esvc *EnrollmentsService) (*RegistrationsService, error) {
+	log := logging.L().With().Str("service", "registrations.svc").Logger()
+	return &RegistrationsService{log: log, store: store, usvc: usvc, ssvc: ssvc, psvc: psvc, spsvc: spsvc, esvc: esvc}, nil
+}
+
+// RegisterStudent creates the student and their user, creates or links each
+// parent and enrolls the student in the groups. Nothing is kept when any
+// step fails.
+func (s *RegistrationsService) RegisterStudent(ctx context.Context, input *dto.RegisterStudentReq) (*dto.RegistrationResBody, error) {
+	body := &input.Body
+	if err := validateRegistration(body.Parents, body.Enrollments); err != nil {
+		return nil, err
+	}
+
+	res := &dto.RegistrationResBody{}
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		*res = dto.RegistrationResBody{Parents: []dto.ParentModelRes{}, Enrollments: []dto.EnrollmentModelRes{}}
+
+		u, err := s.usvc.CreateUser(ctx, &body.Student.CreateUserReqBody)
+		if err != nil {
+			return err
+		}
+		st, err := s.ssvc.CreateStudent(ctx, body.Student.Level, &u.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range body.Parents {
+			parentID := ""
+			if p.ParentID != nil {
+				parentID = *p.ParentID
+			} else {
+				pu, err := s.usvc.CreateUser(ctx, p.User)
+				if err != nil {
+					return err
+				}
+				par, err := s.psvc.CreateParent(ctx, pu.ID)
+				if err != nil {
+					return err
+				}
+				parentID = par.ParentID
+			}
+			if _, err := s.spsvc.CreateStudentParent(ctx, st.StudentID, parentID); err != nil {
+				return err
+			}
+			par, err := s.psvc.GetParentByID(ctx, parentID)
+			if err != nil {
+				return err
+			}
+			res.Parents = append(res.Parents, *par)
+		}
+
+		for _, e := range body.Enrollments {
+			enr, err := s.esvc.CreateEnrollment(ctx, st.StudentID, e.GroupID, e.Fee, nil)
+			if err != nil {
+				return err
+			}
+			res.Enrollments = append(res.Enrollments, *s.esvc.ModelToRes(enr))
+		}
+
+		student, err := s.ssvc.GetStudentByID(ctx, st.StudentID)
+		if err != nil {
+			return err
+		}
+		res.Student = *student
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// validateRegistration rejects parents that are both or neither existing and
+// new, and repeated parents or groups, before anything is written.
+func validateRegistration(parents []dto.RegistrationParent, enrollments []dto.RegistrationEnrollment) error {
+	details := []error{}
+	seenParents := map[string]bool{}
+	for i, p := range parents {
+		loc := fmt.Sprintf("body.parents[%d]", i)
+		switch {
+		case p.ParentID == nil && p.User == nil:
+			details = append(details, &huma.ErrorDetail{Message: "either parent_id or user is required", Location: loc})
+		case p.ParentID != nil && p.User != nil:
+			details = append(details, &huma.ErrorDetail{Message: "parent_id and user can't be used together", Location: loc})
+		case p.ParentID != nil:
+			if seenParents[*p.ParentID] {
+				details = append(details, &huma.ErrorDetail{Message: "parent is listed twice", Location: loc + ".parent_id", Value: *p.ParentID})
+			}
+			seenParents[*p.ParentID] = true
+		}
+	}
+	seenGroups := map[string]bool{}
+	for i, e := range enrollments {
+		if seenGroups[e.GroupID] {
+			details = append(details, &huma.ErrorDetail{Message: "group is listed twice", Location: fmt.Sprintf("body.enrollments[%d].group_id", i), Value: e.GroupID})
+		}
+		seenGroups[e.GroupID] = true
+	}
+	if len(details) > 0 {
+		return huma.Error422UnprocessableEntity("registration is invalid", details...)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/spreadsheet"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun/schema"
+)
+
+// resourceSpec describes an entity served by a resource
+type resourceSpec[M any, R any] struct {
+	// Entity names the rows in errors, defaults to the name of the deletion
+	// policies of the table
+	Entity string
+	// Relations are joined to every row read
+	Relations []string
+	// ExportRelations are joined on top of Relations by exports only
+	ExportRelations []string
+	// Search are the SQL expressions the search parameter is matched against
+	Search []string
+	// Filters maps the fields accepted by the filters parameter to SQL
+	// expressions, created_at and updated_at are always accepted
+	Filters map[string]string
+	// Columns are the columns of exports
+	Columns []spreadsheet.Column[M]
+	// ToRes maps a row to its response
+	ToRes func(m *M) *R
+}
+
+// resource is the list, get, create, update, delete and export code shared
+// by the services of the entities, for the model M and its response R.
+// Services keep their own methods and delegate to it, so every entity
+// searches, filters, counts and pages the same way. See docs/resources.md.
+type resource[M any, R any] struct {
+	resourceSpec[M, R]
+	store  Store
+	repo   Repository[M]
+	log    zerolog.Logger
+	table  *schema.Table
+	entity string
+}
+
+func newResource[M any, R any](store Store, log zerolog.Logger, spec resourceSpec[M, R]) *resource[M, R] {
+	repo := NewRepository[M](store)
+	table := modelTable[M]()
+	entity := spec.Entity
+	if e, ok := deleteEntities[table.Name]; ok && entity == "" {
+		entity = e.Name
+	} else if entity == "" {
+		entity = table.Name
+	}
+	filters := map[string]string{
+		"created_at": "?TableAlias.created_at",
+		"updated_at": "?TableAlias.updated_at",
+	}
+	maps.Copy(filters, spec.Filters)
+	spec.Filters = filters
+	return &resource[M, R]{resourceSpec: spec, store: store, repo: repo, log: log, table: table, entity: entity}
+}
+
+// listing is a page of rows read by resource.List
+type listing[R any] struct {
+	Items []R
+	// Total is -1 unless asked for
+	Total   int
+	Filters []dto.Filter
+	Cursors dto.PageCursors
+}
+
+// Query echoes params with the parsed filters
+func (l *listing[R]) Query(params dto.ListQuery) dto.ListQueryRes {
+	return dto.ListQueryRes{
+		Page: params.Page, PerPage: params.PerPage, SortBy: params.SortBy, SortDir: params.SortDir, Search: params.Search, Includes: params.Includes, Filters: l.Filters, Cursor: params.Cursor, WithTotal: params.WithTotal,
+	}
+}
+
+// listSpec selects the rows matching the search and filters of params and
+// returns the filters as given
+func (r *resource[M, R]) listSpec(params dto.ListQuery, relations ...string) (ListSpec, []dto.Filter, error) {
+	given, applied, err := r.filters(params.Filters)
+	if err != nil {
+		return ListSpec{}, nil, err
+	}
+	return ListSpec{
+		Params:    params,
+		Search:    r.Search,
+		Filters:   applied,
+		Relations: slices.Concat(r.Relations, relations),
+	}, given, nil
+}
+
+// filters parses the filters parameter into the filters as given and the
+// ones to apply, whose fields are replaced by their SQL expressions
+func (r *resource[M, R]) filters(raw string) ([]dto.Filter, []dto.Filter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return []dto.Filter{}, nil, nil
+	}
+	given, err := dto.ParseFilters(raw)
+	if err != nil {
+		return nil, nil, huma.Error422UnprocessableEntity("filters are invalid", &huma.ErrorDetail{
+			Message: err.Error(), Location: "query.filters", Value: raw,
+		})
+	}
+	applied := make([]dto.Filter, len(given))
+	for i, f := range given {
+		expr, ok := r.Filters[f.Field]
+		if !ok {
+			return nil, nil, huma.Error422UnprocessableEntity("filters are invalid", &huma.ErrorDetail{
+				Message:  fmt.Sprintf("unknown field %q, expected one of %s", f.Field, strings.Join(slices.Sorted(maps.Keys(r.Filters)), ", ")),
+				Location: fmt.Sprintf("query.filters[%d].field", i),
+				Value:    f.Field,
+			})
+		}
+		f.Field = expr
+		applied[i] = f
+	}
+	return given, applied, nil
+}
+
+// List reads the page of rows asked for by params, narrowed to the rows
+// whose columns equal the values of where. The total counts every row
+// matching the search, filters and where.
+func (r *resource[M, R]) List(ctx context.Context, params dto.ListQuery, where map[string]any) (*listing[R], error) {
+	spec, filters, err := r.listSpec(params)
+	if err != nil {
+		return nil, err
+	}
+	spec.Where = where
+	l := &listing[R]{Items: []R{}, Total: -1, Filters: filters}
+	if params.WithTotal {
+		if l.Total, err = r.repo.Count(ctx, spec); err != nil {
+			return nil, dbError(r.log, err, r.entity)
+		}
+	}
+
+	page, err := r.repo.List(ctx, spec)
+	if err != nil {
+		return nil, dbError(r.log, err, r.entity)
+	}
+	l.Cursors = page.Cursors
+	for i := range page.Rows {
+		l.Items = append(l.Items, *r.ToRes(&page.Rows[i]))
+	}
+	return l, nil
+}
+
+// Export writes every row matching params to w, see exportList
+func (r *resource[M, R]) Export(ctx context.Context, params dto.ListQuery, columns string, format string, w io.Writer) error {
+	spec, _, err := r.listSpec(params, r.ExportRelations...)
+	if err != nil {
+		return err
+	}
+	err = exportList(ctx, r.store, r.repo, spec, columns, r.Columns, format, w)
+	return dbError(r.log, err, r.entity)
+}
+
+// Get loads the row with the primary key of m into m, joining relations on
+// top of the usual ones
+func (r *resource[M, R]) Get(ctx context.Context, m *M, relations ...string) error {
+	return dbError(r.log, r.repo.Get(ctx, m, slices.Concat(r.Relations, relations)...), r.entity)
+}
+
+// GetBy loads the row whose column equals value into m, without relations
+func (r *resource[M, R]) GetBy(ctx context.Context, m *M, column string, value any) error {
+	return dbError(r.log, r.repo.GetBy(ctx, m, column, value), r.entity)
+}
+
+// Lock is Get holding the row until the unit of work running in ctx ends
+func (r *resource[M, R]) Lock(ctx context.Context, m *M) error {
+	return dbError(r.log, r.repo.Lock(ctx, m, r.Relations...), r.entity)
+}
+
+// Create inserts m and scans the inserted row back into it
+func (r *resource[M, R]) Create(ctx context.Context, m *M) error {
+	if err := r.repo.Insert(ctx, m); err != nil {
+		r.log.Err(err).Msgf("Couldn't insert %s", r.entity)
+		return dbError(r.log, err, r.entity)
+	}
+	return nil
+}
+
+// Update writes the columns of m changed by patch, cleared ones included,
+// and reloads the row with its relations. An empty patch only reloads it.
+func (r *resource[M, R]) Update(ctx context.Context, m *M, patch dto.Patch) error {
+	if err := r.repo.Update(ctx, m, patch.Columns...); err != nil {
+		return dbError(r.log, err, r.entity)
+	}
+	if len(r.Relations) > 0 {
+		return r.Get(ctx, m)
+	}
+	return nil
+}
+
+// Delete deletes the row with the primary key of m, see DeleteIf
+func (r *resource[M, R]) Delete(ctx context.Context, m *M) error {
+	return r.DeleteIf(ctx, m, nil)
+}
+
+// DeleteIf deletes the row with the primary key of m once check passes.
+// Entities with a key of their own go through their deletion policies,
+// link tables delete the row alone.
+func (r *resource[M, R]) DeleteIf(ctx context.Context, m *M, check func(ctx context.Context) error) error {
+	if e, ok := deleteEntities[r.table.Name]; ok && e.Key != "" {
+		id := r.table.PKs[0].Value(reflect.ValueOf(m).Elem()).String()
+		return deleteWithPoliciesIf(ctx, r.store, r.log, r.table.Name, id, check)
+	}
+	return r.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if check != nil {
+			if err := check(ctx); err != nil {
+				return err
+			}
+		}
+		return dbError(r.log, r.repo.Delete(ctx, m), r.entity)
+	})
+}
+
+// PreviewDelete reports the records deleting the row with the given key
+// would affect
+func (r *resource[M, R]) PreviewDelete(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return previewDeletion(ctx, r.store, r.table.Name, id)
+}
+
+// withUserFilters adds the filterable fields of the user behind alias to
+// filters
+func withUserFilters(alias string, filters map[string]string) map[string]string {
+	for _, f := range []string{"username", "email", "first_name", "family_name", "phone_number", "date_of_birth"} {
+		filters[f] = alias + "." + f
+	}
+	return filters
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ICan-TC/lib/logging"
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/rs/zerolog"
+	"github.com/uptrace/bun"
+)
+
+type SearchService struct {
+	db  *bun.DB
+	log zerolog.Logger
+}
+
+func NewSearchService(store Store) (*SearchService, error) {
+	if store.DB() == nil {
+		return nil, errNeedsDatabase
+	}
+	log := logging.L().With().Str("service", "search.svc").Logger()
+	return &SearchService{log: log, db: store.DB()}, nil
+}
+
+// searchScope is what a caller may find. Employees see everyone; anybody
+// else sees themselves plus the people and groups linked to their roles.
+type searchScope struct {
+	All       bool
+	UserID    string
+	StudentID string
+	ParentID  string
+	TeacherID string
+}
+
+type searchHit struct {
+	Type       string  `bun:"type"`
+	ID         string  `bun:"id"`
+	Label      string  `bun:"label"`
+	Detail     string  `bun:"detail"`
+	Relevance  float64 `bun:"relevance"`
+	StudentID  *string `bun:"student_id"`
+	ParentID   *string `bun:"parent_id"`
+	TeacherID  *string `bun:"teacher_id"`
+	EmployeeID *string `bun:"employee_id"`
+}
+
+func (s *SearchService) scopeOf(ctx context.Context, callerID string) (*searchScope, error) {
+	u := models.Users{UserID: callerID}
+	if err := s.db.NewSelect().Model(&u).
+		Relation("Student").Relation("Parent").Relation("Teacher").Relation("Employee").
+		WherePK("id").Scan(ctx); err != nil {
+		s.log.Err(err).Str("user_id", callerID).Msg("Couldn't load caller")
+		return nil, huma.Error403Forbidden("caller is not a known user")
+	}
+	sc := &searchScope{UserID: u.UserID, All: u.Employee != nil}
+	if u.Student != nil {
+		sc.StudentID = u.Student.StudentID
+	}
+	if u.Parent != nil {
+		sc.ParentID = u.Parent.ParentID
+	}
+	if u.Teacher != nil {
+		sc.TeacherID = u.Teacher.TeacherID
+	}
+	return sc, nil
+}
+
+// Search ranks users and groups matching term in a single query, limited to
+// what the caller may see.
+func (s *SearchService) Search(ctx context.Context, callerID string, params *dto.GlobalSearchReq) (*dto.GlobalSearchRes, error) {
+	term := strings.TrimSpace(params.Q)
+	res := &dto.GlobalSearchRes{Body: dto.GlobalSearchResBody{Query: term, Hits: []dto.SearchHitRes{}}}
+	if term == "" {
+		return res, nil
+	}
+	sc, err := s.scopeOf(ctx, callerID)
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]bool{}
+	for _, t := range strings.Split(params.Types, ",") {
+		types[strings.TrimSpace(t)] = true
+	}
+	var branches []*bun.SelectQuery
+	if types["user"] {
+		branches = append(branches, s.usersQuery(term, sc))
+	}
+	if types["group"] && (sc.All || sc.StudentID != "" || sc.ParentID != "" || sc.TeacherID != "") {
+		branches = append(branches, s.groupsQuery(term, sc))
+	}
+	if len(branches) == 0 {
+		return nil, huma.Error400BadRequest("types must include user or group")
+	}
+	union := branches[0]
+	for _, b := range branches[1:] {
+		union = union.UnionAll(b)
+	}
+
+	var hits []searchHit
+	if err := s.db.NewSelect().
+		TableExpr("(?) AS hits", union).
+		OrderExpr("relevance DESC, label ASC").
+		Limit(params.Limit).
+		Scan(ctx, &hits); err != nil {
+		return nil, dbError(s.log, err, "search result")
+	}
+
+	for _, h := range hits {
+		hit := dto.SearchHitRes{Type: h.Type, ID: h.ID, Label: h.Label, Detail: h.Detail, Relevance: h.Relevance}
+		roles := []struct {
+			role string
+			id   *string
+		}{{"student", h.StudentID}, {"parent", h.ParentID}, {"teacher", h.TeacherID}, {"employee", h.EmployeeID}}
+		for _, r := range roles {
+			if r.id != nil {
+				hit.Roles = append(hit.Roles, dto.SearchRoleRes{Role: r.role, ID: *r.id})
+			}
+		}
+		res.Body.Hits = append(res.Body.Hits, hit)
+	}
+	return res, nil
+}
+
+func (s *SearchService) usersQuery(term string, sc *searchScope) *bun.SelectQuery {
+	e := dto.NewSearchExpr(term, "u.username", "u.email", "u.first_name", "u.family_name", dto.FullNameSearchColumn("u"))
+	q := s.db.NewSelect().
+		TableExpr("users AS u").
+		ColumnExpr("'user' AS type, u.id").
+		ColumnExpr("coalesce(nullif(trim(coalesce(u.first_name, '') || ' ' || coalesce(u.family_name, '')), ''), u.username) AS label").
+		ColumnExpr("u.email AS detail").
+		ColumnExpr(e.Score+" AS relevance", e.ScoreArgs...).
+		ColumnExpr("std.id AS student_id, par.id AS parent_id, tch.id AS teacher_id, emp.id AS employee_id").
+		Join("LEFT JOIN students AS std ON std.user_id = u.id AND std.deleted_at IS NULL").
+		Join("LEFT JOIN parents AS par ON par.user_id = u.id AND par.deleted_at IS NULL").
+		Join("LEFT JOIN teachers AS tch ON tch.user_id = u.id AND tch.deleted_at IS NULL").
+		Join("LEFT JOIN employees AS emp ON emp.user_id = u.id AND emp.deleted_at IS NULL").
+		Where("u.deleted_at IS NULL").
+		Where(e.Cond, e.CondArgs...)
+	if sc.All {
+		return q
+	}
+	return q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.Where("u.id = ?", sc.UserID)
+		if sc.TeacherID != "" {
+			q = q.WhereOr(`std.id IN (
+				SELECT enr.student_id FROM enrollments AS enr JOIN groups AS g ON g.id = enr.group_id
+				WHERE g.teacher_id = ? AND enr.deleted_at IS NULL AND g.deleted_at IS NULL)`, sc.TeacherID)
+		}
+		if sc.ParentID != "" {
+			q = q.WhereOr("std.id IN (SELECT sp.student_id FROM student_parents AS sp WHERE sp.parent_id = ?)", sc.ParentID)
+		}
+		return q
+	})
+}
+
+func (s *SearchService) groupsQuery(term string, sc *searchScope) *bun.SelectQuery {
+	e := dto.NewSearchExpr(term, "g.name", "g.subject", "g.level", "g.description")
+	q := s.db.NewSelect().
+		TableExpr("groups AS g").
+		ColumnExpr("'group' AS type, g.id, g.name AS label").
+		ColumnExpr("g.subject || ' ' || g.level AS detail").
+		ColumnExpr(e.Score+" AS relevance", e.ScoreArgs...).
+		ColumnExpr("NULL::text AS student_id, NULL::text AS parent_id, NULL::text AS teacher_id, NULL::text AS employee_id").
+		Where("g.deleted_at IS NULL").
+		Where(e.Cond, e.CondArgs...)
+	if sc.All {
+		return q
+	}
+	return q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		if sc.TeacherID != "" {
+			q = q.WhereOr("g.teacher_id = ?", sc.TeacherID)
+		}
+		if sc.StudentID != "" {
+			q = q.WhereOr("g.id IN (SELECT enr.group_id FROM enrollments AS enr WHERE enr.student_id = ? AND enr.deleted_at IS NULL)", sc.StudentID)
+		}
+		if sc.ParentID != "" {
+			q = q.WhereOr(`g.id IN (
+				SELECT enr.group_id FROM enrollments AS enr JOIN student_parents AS sp ON sp.student_id = enr.student_id
+				WHERE sp.parent_id = ? AND enr.deleted_at IS NULL)`, sc.ParentID)
+		}
+		return q
+	})
+}
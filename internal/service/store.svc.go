@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/ICan-TC/users/internal/dto"
+	"github.com/ICan-TC/users/internal/models"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// Store keeps the records of the services. A PostgresStore runs everything
+// against the database, a MemoryStore keeps records in process for demos and
+// handler tests. See docs/stores.md.
+type Store interface {
+	// DB is the database behind the store, nil when there is none. Bulk
+	// writes, imports, global search and idempotency keys need one.
+	DB() *bun.DB
+	// RunInTx runs fn as a unit of work, see runInTx. Nested calls join the
+	// running unit and may not ask for a stronger isolation.
+	RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error
+
+	// planDeletion and applyDeletion back deleteWithPoliciesIf
+	planDeletion(ctx context.Context, entity string, id string) (*deletionPlan, error)
+	applyDeletion(ctx context.Context, plan *deletionPlan) error
+	// sumLedger backs ledger.balances, summing the entries of the students
+	// in accounts without reading them
+	sumLedger(ctx context.Context, studentIDs []string, accounts []string) ([]ledgerSum, error)
+}
+
+// errNeedsDatabase is returned by the features a store without a database
+// can't run
+var errNeedsDatabase = huma.Error501NotImplemented("not available without a database, see docs/stores.md")
+
+// Repository reads and writes the records of the model M in a store. Its
+// errors are database/sql, Postgres or Huma errors for dbError to translate,
+// sql.ErrNoRows when a record is missing.
+type Repository[M any] interface {
+	// List reads the page of records matching q
+	List(ctx context.Context, q ListSpec) (*RowPage[M], error)
+	// Count counts the records matching q, ignoring its page
+	Count(ctx context.Context, q ListSpec) (int, error)
+	// Get loads the record with the primary key of m into m, joining
+	// relations
+	Get(ctx context.Context, m *M, relations ...string) error
+	// GetBy loads the record whose column equals value into m
+	GetBy(ctx context.Context, m *M, column string, value any) error
+	// Lock is Get keeping the record from concurrent changes until the unit
+	// of work running in ctx ends
+	Lock(ctx context.Context, m *M, relations ...string) error
+	// Insert inserts m and loads the inserted record back into it
+	Insert(ctx context.Context, m *M) error
+	// Revive inserts m, or brings back the soft-deleted record with its
+	// primary key with the columns of m. A live record with that key is a
+	// unique violation.
+	Revive(ctx context.Context, m *M, columns ...string) error
+	// Update writes the columns of m, stamps updated_at and loads the record
+	// back into m. Without columns it only reloads it.
+	Update(ctx context.Context, m *M, columns ...string) error
+	// Delete deletes the record with the primary key of m, soft-deleting
+	// models that support it
+	Delete(ctx context.Context, m *M) error
+}
+
+// ListSpec picks the records read by Repository.List
+type ListSpec struct {
+	// Params holds the search term, sort and page
+	Params dto.ListQuery
+	// Search are the expressions the search term is matched against
+	Search []string
+	// Filters are applied with fields holding expressions
+	Filters []dto.Filter
+	// Where keeps the records whose columns equal the values, or one of the
+	// values of slices
+	Where map[string]any
+	// Relations are joined to every record
+	Relations []string
+	// Stable breaks ties on the sort column by primary key
+	Stable bool
+}
+
+// RowPage is a page of records read by Repository.List
+type RowPage[M any] struct {
+	Rows    []M
+	Cursors dto.PageCursors
+	// More tells whether another page follows
+	More bool
+}
+
+// isList reports whether v is a slice of values for ListSpec.Where
+func isList(v any) bool {
+	_, bytes := v.([]byte)
+	return !bytes && v != nil && reflect.TypeOf(v).Kind() == reflect.Slice
+}
+
+// listAll reads every record of repo matching spec, a page at a time
+func listAll[M any](ctx context.Context, repo Repository[M], spec ListSpec) ([]M, error) {
+	spec.Params.Page, spec.Params.PerPage, spec.Params.Cursor = 1, exportBatch, ""
+	if spec.Params.SortBy == "" {
+		spec.Params.SortBy, spec.Params.SortDir = "created_at", "asc"
+	}
+	spec.Stable = true
+	all := []M{}
+	for {
+		page, err := repo.List(ctx, spec)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Rows...)
+		if !page.More {
+			return all, nil
+		}
+		if page.Cursors.NextCursor != nil {
+			spec.Params.Cursor = *page.Cursors.NextCursor
+		} else {
+			spec.Params.Page++
+		}
+	}
+}
+
+// tags reads the bun tags of the models for code that works in any store,
+// it is never connected
+var tags = func() *bun.DB {
+	db := bun.NewDB(&sql.DB{}, pgdialect.New())
+	db.RegisterModel((*models.StudentParents)(nil))
+	return db
+}()
+
+// modelTable describes the table of the model M
+func modelTable[M any]() *schema.Table {
+	return tags.Table(reflect.TypeFor[M]())
+}
+
+// NewRepository returns the repository of M kept by store
+func NewRepository[M any](store Store) Repository[M] {
+	switch s := store.(type) {
+	case *PostgresStore:
+		return newBunRepository[M](s.db)
+	case *MemoryStore:
+		return newMemoryRepository[M](s)
+	}
+	panic(fmt.Sprintf("no repositories for %T", store))
+}
@@ -2,11 +2,14 @@ package service
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"io"
+	"slices"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
@@ -14,58 +17,72 @@ import (
 )
 
 type StudentParentsService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store    Store
+	students Repository[models.Students]
+	parents  Repository[models.Parents]
+	// db is nil in stores without a database
+	db   *bun.DB
+	log  zerolog.Logger
+	crud *resource[models.StudentParents, dto.GetStudentParentResBody]
 }
 
-func NewStudentParentsService(db *bun.DB) (*StudentParentsService, error) {
+func NewStudentParentsService(store Store) (*StudentParentsService, error) {
 	log := logging.L().With().Str("service", "student_parents.svc").Logger()
-	return &StudentParentsService{log: log, db: db}, nil
+	s := &StudentParentsService{log: log, store: store, db: store.DB()}
+	s.students = NewRepository[models.Students](store)
+	s.parents = NewRepository[models.Parents](store)
+	s.crud = newResource(store, log, resourceSpec[models.StudentParents, dto.GetStudentParentResBody]{
+		Relations: []string{"Student.User", "Parent.User"},
+		Search:    slices.Concat(dto.UserSearchColumnsOf(`"student__user"`), dto.UserSearchColumnsOf(`"parent__user"`)),
+		Filters: map[string]string{
+			"student_id": "?TableAlias.student_id",
+			"parent_id":  "?TableAlias.parent_id",
+		},
+		Columns: studentParentColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *StudentParentsService) GetStudentParents(ctx context.Context, params *dto.ListStudentParentsReq) (*dto.ListStudentParentsRes, error) {
-	total, err := s.db.NewSelect().Model((*models.StudentParents)(nil)).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-	var studentParents []models.StudentParents
-	res := &dto.ListStudentParentsRes{
-		Body: dto.ListStudentParentsResBody{
-			Total:          0,
-			ListQuery:      params.ListQuery,
-			StudentParents: nil,
-		},
-	}
-	res.Body.Total = total
-
-	q := s.db.NewSelect().Model(&studentParents)
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("(student_id ILIKE ? OR parent_id ILIKE ?)", search, search)
+		return nil, err
 	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListStudentParentsRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.StudentParents = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &studentParents); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
+var studentParentColumns = slices.Concat(
+	[]spreadsheet.Column[models.StudentParents]{
+		{Name: "student_id", Value: func(m *models.StudentParents) any { return m.StudentID }},
+		{Name: "parent_id", Value: func(m *models.StudentParents) any { return m.ParentID }},
+	},
+	userColumns("student_", func(m *models.StudentParents) *models.Users {
+		if m.Student == nil {
+			return nil
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-
-	resStudentParents := []dto.GetStudentParentResBody{}
-	for _, sp := range studentParents {
-		newSP := dto.GetStudentParentResBody{
-			StudentID: sp.StudentID,
-			ParentID:  sp.ParentID,
-			CreatedAt: int(sp.CreatedAt.Unix()),
-			UpdatedAt: int(sp.UpdatedAt.Unix()),
+		return m.Student.User
+	}),
+	userColumns("parent_", func(m *models.StudentParents) *models.Users {
+		if m.Parent == nil {
+			return nil
 		}
-		resStudentParents = append(resStudentParents, newSP)
-	}
-	res.Body.StudentParents = resStudentParents
-	return res, nil
+		return m.Parent.User
+	}),
+	[]spreadsheet.Column[models.StudentParents]{
+		{Name: "created_at", Value: func(m *models.StudentParents) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.StudentParents) any { return m.UpdatedAt }},
+	},
+)
+
+// ExportStudentParents writes every student-parent link matching params to w
+func (s *StudentParentsService) ExportStudentParents(ctx context.Context, params *dto.ListStudentParentsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *StudentParentsService) GetStudentParentByID(ctx context.Context, studentID string, parentID string) (*models.StudentParents, error) {
@@ -78,9 +95,8 @@ func (s *StudentParentsService) GetStudentParentByID(ctx context.Context, studen
 	}
 
 	m := models.StudentParents{StudentID: studentID, ParentID: parentID}
-	if err := s.db.NewSelect().Model(&m).WherePK().Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get student-parent relationship")
-		return nil, huma.Error404NotFound("student-parent relationship not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
@@ -96,26 +112,22 @@ func (s *StudentParentsService) CreateStudentParent(ctx context.Context, student
 
 	// Verify student exists
 	student := models.Students{StudentID: studentID}
-	if err := s.db.NewSelect().Model(&student).WherePK("id").Scan(ctx, &student); err != nil {
-		return nil, huma.Error404NotFound("student not found")
+	if err := s.students.Get(ctx, &student); err != nil {
+		return nil, dbError(s.log, err, "student")
 	}
 
 	// Verify parent exists
 	parent := models.Parents{ParentID: parentID}
-	if err := s.db.NewSelect().Model(&parent).WherePK("id").Scan(ctx, &parent); err != nil {
-		return nil, huma.Error404NotFound("parent not found")
+	if err := s.parents.Get(ctx, &parent); err != nil {
+		return nil, dbError(s.log, err, "parent")
 	}
 
 	m := models.StudentParents{
 		StudentID: studentID,
 		ParentID:  parentID,
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert student-parent relationship")
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate") {
-			return nil, huma.Error409Conflict("student-parent relationship already exists")
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
@@ -135,37 +147,121 @@ func (s *StudentParentsService) UpdateStudentParent(ctx context.Context, oldStud
 		return nil, huma.Error400BadRequest("new parentID is invalid", err)
 	}
 
-	// Verify new student exists
-	student := models.Students{StudentID: newStudentID}
-	if err := s.db.NewSelect().Model(&student).WherePK("id").Scan(ctx, &student); err != nil {
-		return nil, huma.Error404NotFound("new student not found")
-	}
-
-	// Verify new parent exists
-	parent := models.Parents{ParentID: newParentID}
-	if err := s.db.NewSelect().Model(&parent).WherePK("id").Scan(ctx, &parent); err != nil {
-		return nil, huma.Error404NotFound("new parent not found")
-	}
-
 	m := models.StudentParents{
 		StudentID: newStudentID,
 		ParentID:  newParentID,
 	}
+	// The old link is replaced by the new one, both or neither
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		// Verify new student exists
+		student := models.Students{StudentID: newStudentID}
+		if err := s.students.Get(ctx, &student); err != nil {
+			return dbError(s.log, err, "new student")
+		}
+
+		// Verify new parent exists
+		parent := models.Parents{ParentID: newParentID}
+		if err := s.parents.Get(ctx, &parent); err != nil {
+			return dbError(s.log, err, "new parent")
+		}
 
-	// Delete old relationship and insert new one
-	if _, err := s.db.NewDelete().Model(&models.StudentParents{StudentID: oldStudentID, ParentID: oldParentID}).WherePK().Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("student-parent relationship not found")
+		if err := s.crud.repo.Delete(ctx, &models.StudentParents{StudentID: oldStudentID, ParentID: oldParentID}); err != nil {
+			return dbError(s.log, err, "student-parent relationship")
+		}
+		if err := s.crud.repo.Insert(ctx, &m); err != nil {
+			return dbError(s.log, err, "student-parent relationship")
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &m, nil
+}
 
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't update student-parent relationship")
-		return nil, huma.Error500InternalServerError(err.Error())
+// BulkCreateStudentParents links every item's student and parent.
+func (s *StudentParentsService) BulkCreateStudentParents(ctx context.Context, mode string, items []dto.BulkCreateStudentParentItem) (*dto.BulkRes[dto.GetStudentParentResBody], error) {
+	b := newBulk[dto.GetStudentParentResBody](mode, len(items))
+	studentIDs := []string{}
+	parentIDs := []string{}
+	seen := map[string]int{}
+	for i, it := range items {
+		if _, err := ulid.Parse(it.StudentID); err != nil {
+			b.fail(i, dto.BulkInvalid, "student_id is invalid")
+			continue
+		}
+		if _, err := ulid.Parse(it.ParentID); err != nil {
+			b.fail(i, dto.BulkInvalid, "parent_id is invalid")
+			continue
+		}
+		key := it.StudentID + "/" + it.ParentID
+		if j, ok := seen[key]; ok {
+			b.fail(i, dto.BulkConflict, fmt.Sprintf("same link as item %d", j))
+			continue
+		}
+		seen[key] = i
+		studentIDs = append(studentIDs, it.StudentID)
+		parentIDs = append(parentIDs, it.ParentID)
 	}
 
-	return &m, nil
+	return b.run(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		students, err := existingIDs(ctx, tx, (*models.Students)(nil), "id", studentIDs)
+		if err != nil {
+			return dbError(s.log, err, "student")
+		}
+		parents, err := existingIDs(ctx, tx, (*models.Parents)(nil), "id", parentIDs)
+		if err != nil {
+			return dbError(s.log, err, "parent")
+		}
+		rows := []models.StudentParents{}
+		idx := []int{}
+		for i, it := range items {
+			if !b.pending(i) {
+				continue
+			}
+			if !students[it.StudentID] {
+				b.fail(i, dto.BulkInvalid, "student_id refers to a missing student")
+				continue
+			}
+			if !parents[it.ParentID] {
+				b.fail(i, dto.BulkInvalid, "parent_id refers to a missing parent")
+				continue
+			}
+			rows = append(rows, models.StudentParents{StudentID: it.StudentID, ParentID: it.ParentID})
+			idx = append(idx, i)
+		}
+
+		created := map[string]*models.StudentParents{}
+		insert := func(ctx context.Context, tx bun.Tx, rows []models.StudentParents) error {
+			res := []models.StudentParents{}
+			if _, err := tx.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Returning("*").Exec(ctx, &res); err != nil {
+				return err
+			}
+			for i := range res {
+				created[res[i].StudentID+"/"+res[i].ParentID] = &res[i]
+			}
+			return nil
+		}
+		if err := b.save(ctx, tx, s.log, "student-parent relationship", idx,
+			func(ctx context.Context, tx bun.Tx) error { return insert(ctx, tx, rows) },
+			func(ctx context.Context, tx bun.Tx, k int) error { return insert(ctx, tx, rows[k:k+1]) },
+		); err != nil {
+			return err
+		}
+
+		for k, i := range idx {
+			if !b.pending(i) {
+				continue
+			}
+			m, ok := created[rows[k].StudentID+"/"+rows[k].ParentID]
+			if !ok {
+				b.fail(i, dto.BulkConflict, "student-parent relationship already exists")
+				continue
+			}
+			b.done(i, dto.BulkCreated, s.ModelToRes(m))
+		}
+		return nil
+	})
 }
 
 func (s *StudentParentsService) DeleteStudentParent(ctx context.Context, studentID string, parentID string) error {
@@ -177,12 +273,71 @@ func (s *StudentParentsService) DeleteStudentParent(ctx context.Context, student
 		return huma.Error400BadRequest("parentID is invalid", err)
 	}
 
-	m := models.StudentParents{StudentID: studentID, ParentID: parentID}
-	if _, err := s.db.NewDelete().Model(&m).WherePK().Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("student-parent relationship not found")
+	return s.crud.Delete(ctx, &models.StudentParents{StudentID: studentID, ParentID: parentID})
+}
+
+func (s *StudentParentsService) ModelToRes(m *models.StudentParents) *dto.GetStudentParentResBody {
+	if m == nil {
+		return nil
+	}
+	res := &dto.GetStudentParentResBody{
+		StudentID: m.StudentID,
+		ParentID:  m.ParentID,
+	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	if !m.CreatedAt.IsZero() {
+		res.CreatedAt = int(m.CreatedAt.Unix())
+	}
+	if !m.UpdatedAt.IsZero() {
+		res.UpdatedAt = int(m.UpdatedAt.Unix())
+	}
+	return res
+}
+
+// childrenOf returns the IDs of the students linked to the parent, a 404 when
+// there is no such parent
+func childrenOf(ctx context.Context, store Store, log zerolog.Logger, parentID string) ([]string, error) {
+	parent := models.Parents{ParentID: parentID}
+	if err := NewRepository[models.Parents](store).Get(ctx, &parent); err != nil {
+		return nil, dbError(log, err, "parent")
+	}
+	links, err := listAll(ctx, NewRepository[models.StudentParents](store), ListSpec{Where: map[string]any{"parent_id": parentID}})
+	if err != nil {
+		return nil, dbError(log, err, "student-parent relationship")
+	}
+	ids := make([]string, len(links))
+	for i, l := range links {
+		ids[i] = l.StudentID
+	}
+	return ids, nil
+}
+
+// familyOf returns the student and every student sharing a parent with
+// them, the student first
+func familyOf(ctx context.Context, store Store, log zerolog.Logger, studentID string) ([]string, error) {
+	links := NewRepository[models.StudentParents](store)
+	own, err := listAll(ctx, links, ListSpec{Where: map[string]any{"student_id": studentID}})
+	if err != nil {
+		return nil, dbError(log, err, "student-parent relationship")
+	}
+	ids := []string{studentID}
+	if len(own) == 0 {
+		return ids, nil
+	}
+	parentIDs := make([]string, len(own))
+	for i, l := range own {
+		parentIDs[i] = l.ParentID
+	}
+	family, err := listAll(ctx, links, ListSpec{Where: map[string]any{"parent_id": parentIDs}})
+	if err != nil {
+		return nil, dbError(log, err, "student-parent relationship")
+	}
+	for _, l := range family {
+		if !slices.Contains(ids, l.StudentID) {
+			ids = append(ids, l.StudentID)
 		}
-		return huma.Error500InternalServerError(err.Error())
 	}
-	return nil
+	return ids, nil
 }
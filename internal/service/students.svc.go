@@ -2,85 +2,80 @@ package service
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"io"
+	"slices"
 	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/conditional"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
 	"github.com/uptrace/bun"
 )
 
 type StudentsService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	// db is nil in stores without a database
+	db   *bun.DB
+	log  zerolog.Logger
+	crud *resource[models.Students, dto.StudentsModelRes]
 }
 
-func NewStudentsService(db *bun.DB) (*StudentsService, error) {
+func NewStudentsService(store Store) (*StudentsService, error) {
 	log := logging.L().With().Str("service", "students.svc").Logger()
-	return &StudentsService{log: log, db: db}, nil
+	s := &StudentsService{log: log, store: store, db: store.DB()}
+	s.crud = newResource(store, log, resourceSpec[models.Students, dto.StudentsModelRes]{
+		Relations: []string{"User"},
+		Search:    append([]string{"?TableAlias.level"}, dto.JoinedUserSearchColumns...),
+		Filters: withUserFilters(`"user"`, map[string]string{
+			"level":   "?TableAlias.level",
+			"user_id": "?TableAlias.user_id",
+		}),
+		Columns: studentColumns,
+		ToRes:   s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *StudentsService) GetStudents(ctx context.Context, params *dto.ListStudentsReq) (*dto.ListStudentsRes, error) {
-	var students []models.Students
-	res := &dto.ListStudentsRes{
-		Body: dto.ListStudentsResBody{
-			Total:     0,
-			ListQuery: dto.ListQueryRes{},
-			Students:  nil,
-		},
-	}
-	q := s.db.NewSelect().Model(&students).Relation("User")
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("level ILIKE ? OR user_id ILIKE ? OR username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR family_name ILIKE ?", search, search, search, search, search, search)
-	}
-
-	filters, err := dto.ParseFilters(params.Filters)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		s.log.Err(err).Msg("Couldn't parse filters")
+		return nil, err
 	}
-	q = dto.ApplyFilters(filters, q)
-
-	total, err := q.Clone().Count(ctx)
-	if err != nil {
-		s.log.Error().Err(err).Msg("Couldn't get students")
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
-	res.Body.Total = total
-
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListStudentsRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Students = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &students); err != nil {
-		s.log.Error().Err(err).Msg("Couldn't get students")
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+var studentColumns = slices.Concat(
+	[]spreadsheet.Column[models.Students]{
+		{Name: "id", Value: func(m *models.Students) any { return m.StudentID }},
+		{Name: "level", Value: func(m *models.Students) any { return cellString(m.Level) }},
+	},
+	userColumns("", func(m *models.Students) *models.Users { return m.User }),
+	[]spreadsheet.Column[models.Students]{
+		{Name: "created_at", Value: func(m *models.Students) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Students) any { return m.UpdatedAt }},
+	},
+)
 
-	resStudents := []dto.StudentsModelRes{}
-	for _, st := range students {
-		newStudent := *s.ModelToRes(&st)
-		resStudents = append(resStudents, newStudent)
-	}
-	res.Body.ListQuery = dto.ListQueryRes{
-		Page: params.Page, PerPage: params.PerPage, SortBy: params.SortBy, SortDir: params.SortDir, Search: params.Search, Includes: params.Includes, Filters: filters,
-	}
-	res.Body.Students = resStudents
-	return res, nil
+// ExportStudents writes every student matching params to w
+func (s *StudentsService) ExportStudents(ctx context.Context, params *dto.ListStudentsReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *StudentsService) GetStudentByID(ctx context.Context, id string) (*dto.StudentsModelRes, error) {
 	m := models.Students{StudentID: id}
-	if err := s.db.NewSelect().Model(&m).Relation("User").WherePK("id").Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get student")
-		return nil, huma.Error404NotFound("student not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m), nil
 }
@@ -95,42 +90,253 @@ func (s *StudentsService) CreateStudent(ctx context.Context, level string, userI
 	m := models.Students{
 		StudentID: *userID,
 		Level:     &level,
+		UserID:    userID,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	if userID != nil {
-		m.UserID = userID
-	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert student")
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *StudentsService) UpdateStudent(ctx context.Context, student models.Students) (*models.Students, error) {
+func (s *StudentsService) UpdateStudent(ctx context.Context, student models.Students, patch dto.Patch, cond *conditional.Params) (*models.Students, error) {
 	m := student
-	m.StudentID = student.StudentID
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("student not found")
+	err := s.store.RunInTx(ctx, nil, func(ctx context.Context) error {
+		if err := s.checkPrecondition(ctx, student.StudentID, cond); err != nil {
+			return err
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		return s.crud.Update(ctx, &m, patch)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *StudentsService) DeleteStudent(ctx context.Context, id string) error {
-	m := models.Students{StudentID: id, DeletedAt: time.Now()}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("student not found")
-		}
-		return huma.Error500InternalServerError(err.Error())
+func (s *StudentsService) DeleteStudent(ctx context.Context, id string, cond *conditional.Params) error {
+	return s.crud.DeleteIf(ctx, &models.Students{StudentID: id}, func(ctx context.Context) error {
+		return s.checkPrecondition(ctx, id, cond)
+	})
+}
+
+// checkPrecondition locks the student and fails with 412 when the If-Match
+// or If-None-Match headers don't match its current ETag.
+func (s *StudentsService) checkPrecondition(ctx context.Context, id string, cond *conditional.Params) error {
+	if cond == nil || !cond.HasConditionalParams() {
+		return nil
+	}
+	m := models.Students{StudentID: id}
+	if err := s.crud.Lock(ctx, &m); err != nil {
+		return err
+	}
+	if err := cond.PreconditionFailed(StudentETag(&m), m.UpdatedAt); err != nil {
+		return err
 	}
 	return nil
 }
 
+// StudentETag changes whenever the student or its user is updated
+func StudentETag(m *models.Students) string {
+	if m.User == nil {
+		return dto.ETag(m.Version)
+	}
+	return dto.ETag(m.Version, m.User.Version)
+}
+
+// PreviewDeleteStudent reports the records deleting the student would affect
+func (s *StudentsService) PreviewDeleteStudent(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
+}
+
+// BulkCreateStudents creates a student for every item, with the ID of its
+// user like CreateStudent.
+func (s *StudentsService) BulkCreateStudents(ctx context.Context, mode string, items []dto.BulkCreateStudentItem) (*dto.BulkRes[dto.StudentsModelRes], error) {
+	b := newBulk[dto.StudentsModelRes](mode, len(items))
+	userIDs := []string{}
+	seen := map[string]int{}
+	for i, it := range items {
+		if _, err := ulid.Parse(it.UserID); err != nil {
+			b.fail(i, dto.BulkInvalid, "user_id is invalid")
+			continue
+		}
+		if j, ok := seen[it.UserID]; ok {
+			b.fail(i, dto.BulkConflict, fmt.Sprintf("same user as item %d", j))
+			continue
+		}
+		seen[it.UserID] = i
+		userIDs = append(userIDs, it.UserID)
+	}
+
+	return b.run(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		users, err := existingIDs(ctx, tx, (*models.Users)(nil), "id", userIDs)
+		if err != nil {
+			return dbError(s.log, err, "user")
+		}
+		rows := []models.Students{}
+		idx := []int{}
+		for i := range items {
+			it := &items[i]
+			if !b.pending(i) {
+				continue
+			}
+			if !users[it.UserID] {
+				b.fail(i, dto.BulkInvalid, "user_id refers to a missing user")
+				continue
+			}
+			rows = append(rows, models.Students{StudentID: it.UserID, UserID: &it.UserID, Level: &it.Level})
+			idx = append(idx, i)
+		}
+
+		created := []string{}
+		insert := func(ctx context.Context, tx bun.Tx, rows []models.Students) error {
+			res := []models.Students{}
+			if _, err := tx.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Returning("id").Exec(ctx, &res); err != nil {
+				return err
+			}
+			for _, r := range res {
+				created = append(created, r.StudentID)
+			}
+			return nil
+		}
+		if err := b.save(ctx, tx, s.log, "student", idx,
+			func(ctx context.Context, tx bun.Tx) error { return insert(ctx, tx, rows) },
+			func(ctx context.Context, tx bun.Tx, k int) error { return insert(ctx, tx, rows[k:k+1]) },
+		); err != nil {
+			return err
+		}
+
+		loaded, err := s.loadStudents(ctx, tx, created)
+		if err != nil {
+			return err
+		}
+		for k, i := range idx {
+			if !b.pending(i) {
+				continue
+			}
+			m, ok := loaded[rows[k].StudentID]
+			if !ok {
+				b.fail(i, dto.BulkConflict, "student already exists")
+				continue
+			}
+			b.done(i, dto.BulkCreated, s.ModelToRes(m))
+		}
+		return nil
+	})
+}
+
+// BulkUpdateStudents applies a merge patch to every item's student. ETags
+// aren't checked, use PATCH /students for conditional updates.
+func (s *StudentsService) BulkUpdateStudents(ctx context.Context, mode string, items []dto.BulkUpdateStudentItem) (*dto.BulkRes[dto.StudentsModelRes], error) {
+	b := newBulk[dto.StudentsModelRes](mode, len(items))
+	rows := []models.Students{}
+	patches := []dto.Patch{}
+	idx := []int{}
+	userIDs := []string{}
+	seen := map[string]int{}
+	for i, it := range items {
+		if _, err := ulid.Parse(it.ID); err != nil {
+			b.fail(i, dto.BulkInvalid, "id is invalid")
+			continue
+		}
+		if _, err := ulid.Parse(it.UserID.Value); it.UserID.Sent && err != nil {
+			b.fail(i, dto.BulkInvalid, "user_id is invalid")
+			continue
+		}
+		if j, ok := seen[it.ID]; ok {
+			b.fail(i, dto.BulkConflict, fmt.Sprintf("same student as item %d", j))
+			continue
+		}
+		seen[it.ID] = i
+		m := models.Students{StudentID: it.ID}
+		patch := dto.Patch{}
+		dto.PatchValuePtr(&patch, "level", it.Level, &m.Level)
+		dto.PatchValuePtr(&patch, "user_id", it.UserID, &m.UserID)
+		if patch.Empty() {
+			b.fail(i, dto.BulkInvalid, "nothing to update")
+			continue
+		}
+		if it.UserID.Sent {
+			userIDs = append(userIDs, it.UserID.Value)
+		}
+		rows = append(rows, m)
+		patches = append(patches, patch)
+		idx = append(idx, i)
+	}
+
+	return b.run(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		users, err := existingIDs(ctx, tx, (*models.Users)(nil), "id", userIDs)
+		if err != nil {
+			return dbError(s.log, err, "user")
+		}
+		vrows := []models.Students{}
+		vpatches := []dto.Patch{}
+		vidx := []int{}
+		for k, i := range idx {
+			if patches[k].Has("user_id") && !users[*rows[k].UserID] {
+				b.fail(i, dto.BulkInvalid, "user_id refers to a missing user")
+				continue
+			}
+			vrows = append(vrows, rows[k])
+			vpatches = append(vpatches, patches[k])
+			vidx = append(vidx, i)
+		}
+
+		updated := []string{}
+		update := func(ctx context.Context, tx bun.Tx, rows []models.Students, patches []dto.Patch) error {
+			res, err := bulkUpdate(ctx, tx, rows, patches)
+			if err != nil {
+				return err
+			}
+			for _, r := range res {
+				updated = append(updated, r.StudentID)
+			}
+			return nil
+		}
+		if err := b.save(ctx, tx, s.log, "student", vidx,
+			func(ctx context.Context, tx bun.Tx) error { return update(ctx, tx, vrows, vpatches) },
+			func(ctx context.Context, tx bun.Tx, k int) error {
+				return update(ctx, tx, vrows[k:k+1], vpatches[k:k+1])
+			},
+		); err != nil {
+			return err
+		}
+
+		loaded, err := s.loadStudents(ctx, tx, updated)
+		if err != nil {
+			return err
+		}
+		for k, i := range vidx {
+			if !b.pending(i) {
+				continue
+			}
+			m, ok := loaded[vrows[k].StudentID]
+			if !ok {
+				b.fail(i, dto.BulkNotFound, "student not found")
+				continue
+			}
+			b.done(i, dto.BulkUpdated, s.ModelToRes(m))
+		}
+		return nil
+	})
+}
+
+// loadStudents fetches the students with ids and their users, by ID.
+func (s *StudentsService) loadStudents(ctx context.Context, db bun.IDB, ids []string) (map[string]*models.Students, error) {
+	loaded := map[string]*models.Students{}
+	if len(ids) == 0 {
+		return loaded, nil
+	}
+	students := []models.Students{}
+	if err := db.NewSelect().Model(&students).Relation("User").Where("std.id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+		return nil, dbError(s.log, err, "student")
+	}
+	for i := range students {
+		loaded[students[i].StudentID] = &students[i]
+	}
+	return loaded, nil
+}
+
 func (s *StudentsService) ModelToRes(m *models.Students) *dto.StudentsModelRes {
 	if m == nil {
 		return nil
@@ -146,6 +352,10 @@ func (s *StudentsService) ModelToRes(m *models.Students) *dto.StudentsModelRes {
 		UserID:       m.UserID,
 		UserModelRes: userRes,
 	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
+	res.ETag = StudentETag(m)
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
 	}
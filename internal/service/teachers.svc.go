@@ -2,76 +2,70 @@ package service
 
 import (
 	"context"
-	"strings"
-	"time"
+	"io"
+	"slices"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 )
 
 type TeachersService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.Teachers, dto.TeachersModelRes]
 }
 
-func NewTeachersService(db *bun.DB) (*TeachersService, error) {
+func NewTeachersService(store Store) (*TeachersService, error) {
 	log := logging.L().With().Str("service", "teachers.svc").Logger()
-	return &TeachersService{log: log, db: db}, nil
+	s := &TeachersService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.Teachers, dto.TeachersModelRes]{
+		Relations: []string{"User"},
+		Search:    dto.JoinedUserSearchColumns,
+		Filters:   withUserFilters(`"user"`, map[string]string{"user_id": "?TableAlias.user_id"}),
+		Columns:   teacherColumns,
+		ToRes:     s.ModelToRes,
+	})
+	return s, nil
 }
 
 func (s *TeachersService) GetTeachers(ctx context.Context, params *dto.ListTeachersReq) (*dto.ListTeachersRes, error) {
-	total, err := s.db.NewSelect().Model((*models.Teachers)(nil)).Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
-	var teachers []models.Teachers
-	res := &dto.ListTeachersRes{
-		Body: dto.ListTeachersResBody{
-			Total:     0,
-			ListQuery: dto.ListQueryRes{},
-			Teachers:  nil,
-		},
-	}
-	res.Body.Total = total
-
-	q := s.db.NewSelect().Model(&teachers).Relation("User")
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where("user_id ILIKE ?", search)
-	}
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListTeachersRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Teachers = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &teachers); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+var teacherColumns = slices.Concat(
+	[]spreadsheet.Column[models.Teachers]{
+		{Name: "id", Value: func(m *models.Teachers) any { return m.TeacherID }},
+	},
+	userColumns("", func(m *models.Teachers) *models.Users { return m.User }),
+	[]spreadsheet.Column[models.Teachers]{
+		{Name: "created_at", Value: func(m *models.Teachers) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Teachers) any { return m.UpdatedAt }},
+	},
+)
 
-	resTeachers := []dto.TeachersModelRes{}
-	for _, tch := range teachers {
-		newTeacher := *s.ModelToRes(&tch)
-		resTeachers = append(resTeachers, newTeacher)
-	}
-	res.Body.Teachers = resTeachers
-	res.Body.ListQuery = dto.ListQueryRes{
-		Page: params.Page, PerPage: params.PerPage, SortBy: params.SortBy, SortDir: params.SortDir, Search: params.Search, Includes: params.Includes, /*Filters: filters,*/
-	}
-	return res, nil
+// ExportTeachers writes every teacher matching params to w
+func (s *TeachersService) ExportTeachers(ctx context.Context, params *dto.ListTeachersReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *TeachersService) GetTeacherByID(ctx context.Context, id string) (*dto.TeachersModelRes, error) {
 	m := models.Teachers{TeacherID: id}
-	if err := s.db.NewSelect().Model(&m).Relation("User").WherePK("id").Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get teacher")
-		return nil, huma.Error404NotFound("teacher not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m), nil
 }
@@ -84,35 +78,27 @@ func (s *TeachersService) CreateTeacher(ctx context.Context, userID string) (*mo
 		TeacherID: userID,
 		UserID:    &userID,
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert teacher")
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
-func (s *TeachersService) UpdateTeacher(ctx context.Context, teacher models.Teachers) (*models.Teachers, error) {
+func (s *TeachersService) UpdateTeacher(ctx context.Context, teacher models.Teachers, patch dto.Patch) (*models.Teachers, error) {
 	m := teacher
-	m.TeacherID = teacher.TeacherID
-	m.UpdatedAt = time.Now()
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("teacher not found")
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Update(ctx, &m, patch); err != nil {
+		return nil, err
 	}
 	return &m, nil
 }
 
 func (s *TeachersService) DeleteTeacher(ctx context.Context, id string) error {
-	m := models.Teachers{TeacherID: id, DeletedAt: time.Now()}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("teacher not found")
-		}
-		return huma.Error500InternalServerError(err.Error())
-	}
-	return nil
+	return s.crud.Delete(ctx, &models.Teachers{TeacherID: id})
+}
+
+// PreviewDeleteTeacher reports the records deleting the teacher would affect
+func (s *TeachersService) PreviewDeleteTeacher(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
 }
 
 func (s *TeachersService) ModelToRes(m *models.Teachers) *dto.TeachersModelRes {
@@ -129,6 +115,9 @@ func (s *TeachersService) ModelToRes(m *models.Teachers) *dto.TeachersModelRes {
 		UserID:       *m.UserID,
 		UserModelRes: userRes,
 	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
 	}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"strings"
 	"time"
 
@@ -11,21 +13,20 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 )
 
 type TokensService struct {
-	db  *bun.DB
-	tp  *tokens.TokenProvider
-	log zerolog.Logger
+	repo Repository[models.RefreshTokens]
+	tp   *tokens.TokenProvider
+	log  zerolog.Logger
 }
 
-func NewTokensService(tp *tokens.TokenProvider, db *bun.DB) *TokensService {
+func NewTokensService(tp *tokens.TokenProvider, store Store) *TokensService {
 	logger := logging.L().With().Str("service", "tokens.svc").Logger()
 	return &TokensService{
-		tp:  tp,
-		log: logger,
-		db:  db,
+		tp:   tp,
+		log:  logger,
+		repo: NewRepository[models.RefreshTokens](store),
 	}
 }
 
@@ -44,7 +45,7 @@ func (s *TokensService) TokensPair(ctx context.Context, sub string, username str
 		ExpiresAt: t.RefreshExp,
 		RevokedAt: nil,
 	}
-	if err := s.db.NewInsert().Model(&m).Returning("*").Scan(ctx, &m); err != nil {
+	if err := s.repo.Insert(ctx, &m); err != nil {
 		s.log.Error().Err(err).Msg("failed to insert refresh token")
 		return nil, huma.Error500InternalServerError("could not save token")
 	}
@@ -59,8 +60,7 @@ func (s *TokensService) RefreshTokens(ctx context.Context, refreshToken string)
 		return "", 0, huma.Error500InternalServerError("could not parse refresh token")
 	}
 	t := models.RefreshTokens{ID: claims.TokenID}
-	err = s.db.NewSelect().Model(&t).WherePK("id").Scan(ctx, &t)
-	if err != nil {
+	if err := s.repo.Get(ctx, &t); err != nil {
 		s.log.Error().Err(err).Msg("failed to select refresh token")
 		return "", 0, huma.Error500InternalServerError("could not select refresh token")
 	}
@@ -91,8 +91,8 @@ func (s *TokensService) ValidateAccessToken(ctx context.Context, token string) (
 	}
 
 	t := models.RefreshTokens{ID: claims.TokenID}
-	if err := s.db.NewSelect().Model(&t).WherePK("id").Scan(ctx, &t); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
+	if err := s.repo.Get(ctx, &t); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
 			return nil, huma.Error401Unauthorized("invalid token")
 		}
 		return nil, huma.Error500InternalServerError("could not select refresh token")
@@ -112,7 +112,7 @@ func (s *TokensService) RevokeRefreshToken(ctx context.Context, token string) er
 	}
 	revokedAt := time.Now()
 	t := models.RefreshTokens{ID: claims.TokenID, RevokedAt: &revokedAt}
-	if _, err := s.db.NewUpdate().Model(&t).OmitZero().WherePK("id").Exec(ctx); err != nil {
+	if err := s.repo.Update(ctx, &t, "revoked_at"); err != nil {
 		s.log.Error().Err(err).Msg("failed to revoke refresh token")
 		return huma.Error500InternalServerError("could not revoke refresh token")
 	}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// maxTxAttempts bounds how many times runInTx runs a unit of work that keeps
+// failing to serialize.
+const maxTxAttempts = 3
+
+// txRetryDelay is the pause before the second attempt, doubled afterwards.
+const txRetryDelay = 20 * time.Millisecond
+
+type txKey struct{}
+
+// runningTx is the transaction of the unit of work running in a context
+type runningTx struct {
+	tx        bun.Tx
+	isolation sql.IsolationLevel
+}
+
+// runInTx runs fn as a unit of work: every query made through the tx it gets,
+// or through conn on the ctx it gets, commits or rolls back together. A call
+// nested in a running unit of work joins it, so services can compose each
+// other's methods, and runs at its isolation: asking for a stronger one is an
+// error, the caller needing it must start the unit of work. When Postgres
+// aborts the transaction with a serialization failure the whole unit is run
+// again, fn must therefore be safe to repeat.
+func runInTx(ctx context.Context, db *bun.DB, opts *sql.TxOptions, fn func(ctx context.Context, tx bun.Tx) error) error {
+	if running, ok := ctx.Value(txKey{}).(*runningTx); ok {
+		if err := joinable(running.isolation, opts); err != nil {
+			return err
+		}
+		return fn(ctx, running.tx)
+	}
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := db.RunInTx(ctx, opts, func(ctx context.Context, tx bun.Tx) error {
+			return fn(context.WithValue(ctx, txKey{}, &runningTx{tx: tx, isolation: isolationOf(opts)}), tx)
+		})
+		if err == nil || attempt == maxTxAttempts || !isSerializationFailure(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// conn returns the transaction of the unit of work running in ctx, or db
+// outside of one.
+func conn(ctx context.Context, db *bun.DB) bun.IDB {
+	if running, ok := ctx.Value(txKey{}).(*runningTx); ok {
+		return running.tx
+	}
+	return db
+}
+
+// isolationOf is the isolation a unit of work started with opts runs at,
+// read committed being the default of Postgres
+func isolationOf(opts *sql.TxOptions) sql.IsolationLevel {
+	if opts == nil || opts.Isolation == sql.LevelDefault {
+		return sql.LevelReadCommitted
+	}
+	return opts.Isolation
+}
+
+// joinable refuses to join a unit of work running at isolation with a call
+// asking for a stronger one with opts, which it would silently not get
+func joinable(isolation sql.IsolationLevel, opts *sql.TxOptions) error {
+	if want := isolationOf(opts); want > isolation {
+		return fmt.Errorf("a nested unit of work asks for %s isolation, the running one is %s", want, isolation)
+	}
+	return nil
+}
+
+// isSerializationFailure reports whether err, possibly already translated by
+// dbError, is Postgres giving up on serializing the transaction.
+func isSerializationFailure(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == pgSerializationFailed
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRunInTxNestedIsolation(t *testing.T) {
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	tests := []struct {
+		name          string
+		outer, nested *sql.TxOptions
+		wantErr       bool
+	}{
+		{"default in default", nil, nil, false},
+		{"read committed in default", nil, &sql.TxOptions{Isolation: sql.LevelReadCommitted}, false},
+		{"serializable in default", nil, serializable, true},
+		{"repeatable read in read committed", &sql.TxOptions{Isolation: sql.LevelReadCommitted}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead}, true},
+		{"serializable in serializable", serializable, serializable, false},
+		{"default in serializable", serializable, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			ran := false
+			err := store.RunInTx(t.Context(), tt.outer, func(ctx context.Context) error {
+				return store.RunInTx(ctx, tt.nested, func(ctx context.Context) error {
+					ran = true
+					return nil
+				})
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if ran == tt.wantErr {
+				t.Fatalf("nested ran = %v, want %v", ran, !tt.wantErr)
+			}
+		})
+	}
+}
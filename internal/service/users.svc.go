@@ -2,110 +2,106 @@ package service
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"io"
+	"slices"
 	"time"
 
 	"github.com/ICan-TC/lib/logging"
 	"github.com/ICan-TC/users/internal/dto"
 	"github.com/ICan-TC/users/internal/models"
+	"github.com/ICan-TC/users/internal/spreadsheet"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog"
-	"github.com/uptrace/bun"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UsersService struct {
-	db  *bun.DB
-	log zerolog.Logger
+	store Store
+	log   zerolog.Logger
+	crud  *resource[models.Users, dto.UserModelRes]
 }
 
-func NewUsersService(db *bun.DB) (*UsersService, error) {
+func NewUsersService(store Store) (*UsersService, error) {
 	log := logging.L().With().Str("service", "users.svc").Logger()
-	return &UsersService{log: log, db: db}, nil
+	s := &UsersService{log: log, store: store}
+	s.crud = newResource(store, log, resourceSpec[models.Users, dto.UserModelRes]{
+		Relations: []string{"Teacher", "Student", "Employee", "Parent"},
+		Search:    dto.UserSearchColumns,
+		Filters:   withUserFilters("?TableAlias", map[string]string{}),
+		Columns:   userExportColumns,
+		ToRes: func(m *models.Users) *dto.UserModelRes {
+			return s.ModelToRes(m, false)
+		},
+	})
+	return s, nil
 }
 
 func (s *UsersService) GetUsers(ctx context.Context, params *dto.ListUsersReq) (*dto.ListUsersRes, error) {
-	var users []models.Users
-	res := &dto.ListUsersRes{
-		Body: dto.ListUsersResBody{
-			Total:     0,
-			ListQuery: dto.ListQueryRes{},
-			Users:     nil,
-		},
-	}
-
-	q := s.db.NewSelect().
-		Model(&users).
-		Relation("Teacher").
-		Relation("Student").
-		Relation("Employee").
-		Relation("Parent")
-
-	if params.Search != "" {
-		search := "%" + params.Search + "%"
-		q = q.Where(
-			"(username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR family_name ILIKE ?)",
-			search, search, search, search,
-		)
-	}
-	// if params.Filters != "" {
-	// 	s.log.Warn().Str("filters", params.Filters).Msg("filters are not implemented yet")
-	// }
-	// if params.Includes != "" {
-	// 	s.log.Warn().Str("includes", params.Includes).Msg("includes are not implemented yet")
-	// }
-
-	filters, err := dto.ParseFilters(params.Filters)
-	if err != nil {
-		s.log.Err(err).Msg("Couldn't parse filters")
-	}
-	q = dto.ApplyFilters(filters, q)
-
-	total, err := q.Clone().Count(ctx)
+	l, err := s.crud.List(ctx, params.ListQuery, nil)
 	if err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+		return nil, err
 	}
-	res.Body.Total = total
-
-	q = q.Order(params.SortBy + " " + params.SortDir)
-	q = q.Limit(params.PerPage)
-	q = q.Offset(params.PerPage * (params.Page - 1))
+	res := &dto.ListUsersRes{}
+	res.Body.Total = l.Total
+	res.Body.ListQuery = l.Query(params.ListQuery)
+	res.Body.PageCursors = l.Cursors
+	res.Body.Users = l.Items
+	return res, nil
+}
 
-	if err := q.Scan(ctx, &users); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return res, nil
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
-	}
+var userExportColumns = slices.Concat(
+	[]spreadsheet.Column[models.Users]{
+		{Name: "id", Value: func(m *models.Users) any { return m.UserID }},
+	},
+	userColumns("", func(m *models.Users) *models.Users { return m }),
+	[]spreadsheet.Column[models.Users]{
+		{Name: "student_id", Value: func(m *models.Users) any {
+			if m.Student == nil {
+				return nil
+			}
+			return m.Student.StudentID
+		}},
+		{Name: "teacher_id", Value: func(m *models.Users) any {
+			if m.Teacher == nil {
+				return nil
+			}
+			return m.Teacher.TeacherID
+		}},
+		{Name: "parent_id", Value: func(m *models.Users) any {
+			if m.Parent == nil {
+				return nil
+			}
+			return m.Parent.ParentID
+		}},
+		{Name: "employee_id", Value: func(m *models.Users) any {
+			if m.Employee == nil {
+				return nil
+			}
+			return m.Employee.EmployeeID
+		}},
+		{Name: "created_at", Value: func(m *models.Users) any { return m.CreatedAt }},
+		{Name: "updated_at", Value: func(m *models.Users) any { return m.UpdatedAt }},
+	},
+)
 
-	resUsers := []dto.UserModelRes{}
-	for _, u := range users {
-		resUsers = append(resUsers, *s.ModelToRes(&u, false))
-	}
-	res.Body.Users = resUsers
-	res.Body.ListQuery = dto.ListQueryRes{
-		Page: params.Page, PerPage: params.PerPage, SortBy: params.SortBy, SortDir: params.SortDir, Search: params.Search, Includes: params.Includes, Filters: filters,
-	}
-	return res, nil
+// ExportUsers writes every user matching params to w
+func (s *UsersService) ExportUsers(ctx context.Context, params *dto.ListUsersReq, format string, w io.Writer) error {
+	return s.crud.Export(ctx, params.ListQuery, params.Columns, format, w)
 }
 
 func (s *UsersService) GetUserByID(ctx context.Context, id string) (*dto.UserModelRes, error) {
 	m := models.Users{UserID: id}
-	if err := s.db.NewSelect().Model(&m).WherePK("id").Scan(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't get user")
-		return nil, huma.Error404NotFound("user not found")
+	if err := s.crud.Get(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m, false), nil
 }
 
 func (s *UsersService) GetUserByField(ctx context.Context, f string, v string, include_hash bool) (*dto.UserModelRes, error) {
 	m := models.Users{}
-	q := s.db.NewSelect().Model(&m).Where(fmt.Sprintf("%s = ?", f), v)
-	s.log.Debug().Str("query", q.String()).Msg("Couldn't get user")
-	if err := q.Scan(ctx, &m); err != nil {
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.GetBy(ctx, &m, f, v); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m, include_hash), nil
 }
@@ -114,7 +110,8 @@ func (s *UsersService) CreateUser(ctx context.Context, data *dto.CreateUserReqBo
 	// TODO: fix this, should probably create a new struct for this function's input
 	hash, err := bcrypt.GenerateFromPassword([]byte(data.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, nil
+		s.log.Err(err).Msg("Couldn't hash password")
+		return nil, huma.Error500InternalServerError("internal server error")
 	}
 	userID := ulid.Make().String()
 	m := models.Users{
@@ -139,40 +136,34 @@ func (s *UsersService) CreateUser(ctx context.Context, data *dto.CreateUserReqBo
 	if data.PhoneNumber != nil {
 		m.PhoneNumber = data.PhoneNumber
 	}
-	if _, err := s.db.NewInsert().Model(&m).Returning("*").Exec(ctx, &m); err != nil {
-		s.log.Err(err).Msg("Couldn't insert user")
-		if strings.Contains(err.Error(), "users_username_key") {
-			return nil, huma.Error400BadRequest("username already exists")
-		}
-		if strings.Contains(err.Error(), "users_email_key") {
-			return nil, huma.Error400BadRequest("email already exists")
-		}
-		return nil, huma.Error500InternalServerError(err.Error())
+	if err := s.crud.Create(ctx, &m); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m, false), nil
 }
 
-func (s *UsersService) UpdateUser(ctx context.Context, user models.Users) (*dto.UserModelRes, error) {
+func (s *UsersService) UpdateUser(ctx context.Context, user models.Users, patch dto.Patch) (*dto.UserModelRes, error) {
 	m := user
-	m.UserID = user.UserID
-	if err := s.db.NewUpdate().Model(&m).Returning("*").OmitZero().WherePK("id").Scan(ctx, &m); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return nil, huma.Error404NotFound("user not found")
+	if patch.Has("password_hash") {
+		hash, err := bcrypt.GenerateFromPassword([]byte(m.PasswordHash), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, dbError(s.log, err, "user")
 		}
-		return nil, huma.Error500InternalServerError(err.Error())
+		m.PasswordHash = string(hash)
+	}
+	if err := s.crud.Update(ctx, &m, patch); err != nil {
+		return nil, err
 	}
 	return s.ModelToRes(&m, false), nil
 }
 
 func (s *UsersService) DeleteUser(ctx context.Context, id string) error {
-	m := models.Users{UserID: id}
-	if _, err := s.db.NewDelete().Model(&m).WherePK("id").Exec(ctx); err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			return huma.Error404NotFound("user not found")
-		}
-		return huma.Error500InternalServerError(err.Error())
-	}
-	return nil
+	return s.crud.Delete(ctx, &models.Users{UserID: id})
+}
+
+// PreviewDeleteUser reports the records deleting the user would affect
+func (s *UsersService) PreviewDeleteUser(ctx context.Context, id string) (*dto.DeletionPlanRes, error) {
+	return s.crud.PreviewDelete(ctx, id)
 }
 
 func (s *UsersService) ModelToRes(m *models.Users, include_hash bool) *dto.UserModelRes {
@@ -216,6 +207,9 @@ func UsersModelToRes(m *models.Users, include_hash bool) *dto.UserModelRes {
 	if m.Parent != nil {
 		res.ParentID = &m.Parent.ParentID
 	}
+	if m.Relevance > 0 {
+		res.Relevance = &m.Relevance
+	}
 	if !m.CreatedAt.IsZero() {
 		res.CreatedAt = int(m.CreatedAt.Unix())
 	}
@@ -0,0 +1,138 @@
+// Package spreadsheet reads and writes the CSV and XLSX files used to import
+// and export records.
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Row is a non-blank row of a file, Line counting from 1 like spreadsheet
+// programs do
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+// ErrTooManyRows is returned by Read when the file has more rows than allowed
+var ErrTooManyRows = errors.New("too many rows")
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// DetectFormat tells XLSX, a zip archive, from CSV by the first bytes of data
+func DetectFormat(data []byte) string {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+// Read returns the rows of a CSV file, or of the first sheet of an XLSX file,
+// headers first. Cells are trimmed and blank rows dropped, and it fails with
+// ErrTooManyRows past maxRows data rows. CSV files may be separated by commas
+// or, as spreadsheet programs in many locales export them, by semicolons.
+func Read(data []byte, format string, maxRows int) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(data, maxRows)
+	case FormatXLSX:
+		return readXLSX(data, maxRows)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+func readCSV(data []byte, maxRows int) ([]Row, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.Comma = sniffDelimiter(data)
+
+	rows := []Row{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cells := trimRow(record); cells != nil {
+			if len(rows) > maxRows {
+				return nil, ErrTooManyRows
+			}
+			line, _ := r.FieldPos(0)
+			rows = append(rows, Row{Line: line, Cells: cells})
+		}
+	}
+	return rows, nil
+}
+
+func readXLSX(data []byte, maxRows int) ([]Row, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	it, err := f.Rows(sheets[0])
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	rows := []Row{}
+	for line := 1; it.Next(); line++ {
+		record, err := it.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if cells := trimRow(record); cells != nil {
+			if len(rows) > maxRows {
+				return nil, ErrTooManyRows
+			}
+			rows = append(rows, Row{Line: line, Cells: cells})
+		}
+	}
+	return rows, it.Error()
+}
+
+// sniffDelimiter picks ';' over ',' when the header line has more of them
+func sniffDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+// trimRow trims every cell, nil when they are all blank
+func trimRow(record []string) []string {
+	blank := true
+	row := make([]string, len(record))
+	for i, cell := range record {
+		row[i] = strings.TrimSpace(cell)
+		if row[i] != "" {
+			blank = false
+		}
+	}
+	if blank {
+		return nil
+	}
+	return row
+}
@@ -0,0 +1,172 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Content types of the formats
+const (
+	ContentTypeCSV  = "text/csv; charset=utf-8"
+	ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// dateTimeFormat is how times are written to CSV files, without a time zone
+// since spreadsheet programs don't read one
+const dateTimeFormat = "2006-01-02 15:04:05"
+
+// Column is a column of an export of T rows. Value returns nil for an empty
+// cell, times and numbers stay dates and numbers in XLSX files.
+type Column[T any] struct {
+	Name  string
+	Value func(*T) any
+}
+
+// SelectColumns picks the columns named in names, comma separated, in that
+// order. Empty names picks them all.
+func SelectColumns[T any](all []Column[T], names string) ([]Column[T], error) {
+	if strings.TrimSpace(names) == "" {
+		return all, nil
+	}
+	picked := []Column[T]{}
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(all, func(c Column[T]) bool { return c.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q, expected some of %s", name, strings.Join(ColumnNames(all), ", "))
+		}
+		picked = append(picked, all[i])
+	}
+	return picked, nil
+}
+
+func ColumnNames[T any](columns []Column[T]) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Writer writes rows to a file. Nothing may be written to the underlying
+// writer before Close for XLSX files, which are zip archives.
+type Writer interface {
+	WriteRow(cells []any) error
+	Close() error
+}
+
+// ContentType returns the content type of format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return ContentTypeXLSX
+	}
+	return ContentTypeCSV
+}
+
+// NewWriter returns a Writer of format to w
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		// the BOM tells spreadsheet programs the file is UTF-8
+		if _, err := w.Write(utf8BOM); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		f := excelize.NewFile()
+		sw, err := f.NewStreamWriter(f.GetSheetName(0))
+		if err != nil {
+			return nil, err
+		}
+		dates, err := f.NewStyle(&excelize.Style{NumFmt: 22})
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxWriter{w: w, f: f, sw: sw, dates: dates}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) WriteRow(cells []any) error {
+	record := make([]string, len(cells))
+	for i, v := range cells {
+		record[i] = formatCell(v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Number is a cell value with an exact text form, such as money.Amount. CSV
+// cells get the text, XLSX cells a number as spreadsheets only have float64
+// numbers.
+type Number interface {
+	fmt.Stringer
+	Float64() float64
+}
+
+func formatCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(dateTimeFormat)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// xlsxWriter spools the rows to a temporary file, excelize writes the
+// workbook on Close
+type xlsxWriter struct {
+	w     io.Writer
+	f     *excelize.File
+	sw    *excelize.StreamWriter
+	dates int
+	rows  int
+}
+
+func (x *xlsxWriter) WriteRow(cells []any) error {
+	x.rows++
+	row := make([]any, len(cells))
+	for i, v := range cells {
+		switch c := v.(type) {
+		case time.Time:
+			v = excelize.Cell{StyleID: x.dates, Value: c.UTC()}
+		case Number:
+			v = c.Float64()
+		}
+		row[i] = v
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+	return x.sw.SetRow(cell, row)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.f.Close()
+	if err := x.sw.Flush(); err != nil {
+		return err
+	}
+	_, err := x.f.WriteTo(x.w)
+	return err
+}